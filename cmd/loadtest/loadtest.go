@@ -4,16 +4,20 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/mattermost/mattermost-load-test/fakeserver"
 	"github.com/mattermost/mattermost-load-test/loadtest"
 	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
 )
 
 type TestItem struct {
@@ -96,6 +100,71 @@ var tests []TestItem = []TestItem{
 		ShortDesc: "Test users posting reactions",
 		Test:      &loadtest.TestPostReactions,
 	},
+	{
+		Name:      "mobile",
+		ShortDesc: "Test mobile app clients",
+		Test:      &loadtest.TestMobile,
+	},
+	{
+		Name:      "mixed-clients",
+		ShortDesc: "Test a mix of webapp and mobile app clients",
+		Test:      &loadtest.TestMixedClients,
+	},
+	{
+		Name:      "threads",
+		ShortDesc: "Test replying to, following and reading threads while under load",
+		Test:      &loadtest.TestThreads,
+	},
+	{
+		Name:      "post-lifecycle",
+		ShortDesc: "Test editing, deleting, pinning and flagging posts while under load",
+		Test:      &loadtest.TestPostLifecycle,
+	},
+	{
+		Name:      "files",
+		ShortDesc: "Test uploading, downloading, previewing and searching files while under load",
+		Test:      &loadtest.TestFiles,
+	},
+	{
+		Name:      "slash-commands",
+		ShortDesc: "Test executing custom slash commands answered by the loadtest agent while under load",
+		Test:      &loadtest.TestSlashCommands,
+	},
+	{
+		Name:      "interactive-messages",
+		ShortDesc: "Test clicking the buttons and menus of interactive messages answered by the loadtest agent while under load",
+		Test:      &loadtest.TestInteractiveMessages,
+	},
+	{
+		Name:      "bots",
+		ShortDesc: "Test bot accounts posting and updating messages at a high rate with personal access tokens while under load",
+		Test:      &loadtest.TestBots,
+	},
+	{
+		Name:      "plugins",
+		ShortDesc: "Test posting and calling the endpoints of the load test plugin, whose hooks do configurable work, while under load",
+		Test:      &loadtest.TestPlugins,
+	},
+	{
+		Name:      "statuses",
+		ShortDesc: "Test users changing their status and custom status and typing before they post while under load",
+		Test:      &loadtest.TestStatuses,
+	},
+	{
+		Name:      "sidebar",
+		ShortDesc: "Test users favoriting, muting and marking channels read, changing channel notifications, organizing sidebar categories and opening the more direct messages dialog while under load",
+		Test:      &loadtest.TestSidebar,
+	},
+	{
+		Name:      "teams",
+		ShortDesc: "Test users browsing teams, looking up invite links and inviting by email, and admins creating, archiving and updating teams while under load",
+		Test:      &loadtest.TestTeams,
+	},
+	{
+		Name:      "permissions",
+		ShortDesc: "Test admins changing role permissions, assigning schemes to teams and channels and promoting channel admins while under load",
+		Test:      &loadtest.TestPermissions,
+	},
 }
 
 func main() {
@@ -119,6 +188,24 @@ func main() {
 		RunE:  pprofCmd,
 	}
 
+	cmdFakeServer := &cobra.Command{
+		Use:   "fakeserver",
+		Short: "Run an in-memory fake Mattermost server seeded with the configured load test environment",
+		RunE:  fakeServerCmd,
+	}
+	cmdFakeServer.Flags().StringP("address", "a", ":8065", "the address on which to listen")
+	cmdFakeServer.Flags().DurationP("latency", "", 0, "latency added to every request")
+	cmdFakeServer.Flags().DurationP("latency-jitter", "", 0, "maximum random latency added to every request")
+	cmdFakeServer.Flags().Float64P("error-rate", "", 0, "probability of failing any given request")
+
+	cmdValidate := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration and that the server, database, websocket and app server can be reached",
+		RunE:  validateCmd,
+	}
+	cmdValidate.Flags().IntP("instances", "i", 1, "the number of loadtest instances that will share the users")
+	cmdValidate.Flags().BoolP("skip-connectivity", "", false, "only check the configuration itself")
+
 	var rootCmd = &cobra.Command{Use: "loadtest"}
 
 	commands := make([]*cobra.Command, 0, len(tests))
@@ -138,7 +225,7 @@ func main() {
 		})
 	}
 	rootCmd.AddCommand(commands...)
-	rootCmd.AddCommand(cmdPprof, cmdLoad, cmdGenerate)
+	rootCmd.AddCommand(cmdPprof, cmdLoad, cmdGenerate, cmdFakeServer, cmdValidate)
 	rootCmd.Execute()
 }
 
@@ -209,6 +296,32 @@ func loadCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func validateCmd(cmd *cobra.Command, args []string) error {
+	cfg := &loadtest.LoadTestConfig{}
+	if err := viper.Unmarshal(cfg); err != nil {
+		return errors.Wrap(err, "failed to read loadtest configuration")
+	}
+
+	instances, _ := cmd.Flags().GetInt("instances")
+	skipConnectivity, _ := cmd.Flags().GetBool("skip-connectivity")
+
+	validation := loadtest.ValidateConfig(cfg, instances, !skipConnectivity)
+	for _, warning := range validation.Warnings {
+		fmt.Println("WARNING: " + warning)
+	}
+	for _, problem := range validation.Problems {
+		fmt.Println("ERROR: " + problem)
+	}
+
+	if len(validation.Problems) > 0 {
+		return fmt.Errorf("found %d problems with the configuration", len(validation.Problems))
+	}
+
+	fmt.Println("Configuration is valid.")
+
+	return nil
+}
+
 func genBulkLoadCmd(cmd *cobra.Command, args []string) error {
 	cfg := &loadtest.LoadTestConfig{}
 	if err := viper.Unmarshal(cfg); err != nil {
@@ -220,3 +333,91 @@ func genBulkLoadCmd(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func fakeServerCmd(cmd *cobra.Command, args []string) error {
+	cfg := &loadtest.LoadTestConfig{}
+	if err := viper.Unmarshal(cfg); err != nil {
+		return errors.Wrap(err, "failed to read loadtest configuration")
+	}
+
+	address, _ := cmd.Flags().GetString("address")
+	latency, _ := cmd.Flags().GetDuration("latency")
+	latencyJitter, _ := cmd.Flags().GetDuration("latency-jitter")
+	errorRate, _ := cmd.Flags().GetFloat64("error-rate")
+
+	server := fakeserver.New(fakeserver.Config{
+		Latency:       latency,
+		LatencyJitter: latencyJitter,
+		ErrorRate:     errorRate,
+	})
+
+	mlog.Info("Seeding fake server")
+	start := time.Now()
+	seedFakeServer(server, cfg)
+	mlog.Info("Seeded fake server", mlog.Duration("duration", time.Since(start)))
+
+	return server.ListenAndServe(address)
+}
+
+// seedFakeServer loads the same teams, channels, users and emoji into the fake server as
+// the bulkload file would into a real server, along with the admin user.
+func seedFakeServer(server *fakeserver.Server, cfg *loadtest.LoadTestConfig) {
+	results := loadtest.GenerateBulkloadFile(&cfg.LoadtestEnviromentConfig)
+
+	server.CreateUser(&model.User{
+		Username: "ltadmin",
+		Email:    cfg.ConnectionConfiguration.AdminEmail,
+		Roles:    model.SYSTEM_USER_ROLE_ID + " " + model.SYSTEM_ADMIN_ROLE_ID,
+	}, cfg.ConnectionConfiguration.AdminPassword)
+
+	teamIds := make(map[string]string)
+	for _, team := range results.Teams {
+		teamIds[team.Name] = server.CreateTeam(&model.Team{
+			Name:            team.Name,
+			DisplayName:     team.DisplayName,
+			Type:            team.Type,
+			AllowOpenInvite: team.AllowOpenInvite,
+		}).Id
+	}
+
+	channelIds := make(map[string]map[string]string)
+	for _, channel := range results.Channels {
+		if channelIds[channel.Team] == nil {
+			channelIds[channel.Team] = make(map[string]string)
+		}
+		channelIds[channel.Team][channel.Name] = server.CreateChannel(&model.Channel{
+			TeamId:      teamIds[channel.Team],
+			Name:        channel.Name,
+			DisplayName: channel.DisplayName,
+			Type:        channel.Type,
+			Header:      channel.Header,
+			Purpose:     channel.Purpose,
+		}).Id
+	}
+
+	for _, userData := range results.Users {
+		user := server.CreateUser(&model.User{
+			Username:  userData.Username,
+			Email:     userData.Email,
+			Nickname:  userData.Nickname,
+			FirstName: userData.FirstName,
+			LastName:  userData.LastName,
+			Position:  userData.Position,
+			Roles:     userData.Roles,
+			Locale:    userData.Locale,
+		}, userData.Password)
+
+		for _, team := range userData.Teams {
+			server.AddTeamMember(teamIds[team.Name], user.Id)
+			for _, channel := range team.Channels {
+				if channelId, ok := channelIds[team.Name][channel.Name]; ok {
+					server.AddChannelMember(channelId, user.Id)
+				}
+			}
+		}
+	}
+
+	for _, emoji := range results.Emojis {
+		server.CreateEmoji(emoji.Name)
+	}
+}
@@ -22,6 +22,7 @@ func resultsCmd(cmd *cobra.Command, args []string) error {
 	inputFilename, _ := cmd.Flags().GetString("file")
 	baselineFilename, _ := cmd.Flags().GetString("baseline")
 	verbose, _ := cmd.Flags().GetBool("verbose")
+	config.Phase, _ = cmd.Flags().GetInt("phase")
 
 	config.Output = os.Stdout
 
@@ -67,6 +68,7 @@ func init() {
 	results.Flags().BoolP("aggregate", "a", false, "aggregate all results found instead of just picking the last")
 	results.Flags().StringP("baseline", "b", "", "a file containing structured logs to which to compare results")
 	results.Flags().BoolP("verbose", "v", false, "display additional statistics")
+	results.Flags().IntP("phase", "p", 0, "only include results between configuration changes, starting from 1 before the first change")
 
 	rootCmd.AddCommand(results)
 }
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func (s *Server) initBotRoutes() {
+	s.handle(http.MethodPost, "/api/v4/bots", true, createBot)
+}
+
+// createBot creates a bot along with the user it posts as, owned by the session user.
+func createBot(c *context) {
+	var bot model.Bot
+	if !c.decode(&bot) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if !*c.s.store.config.ServiceSettings.EnableBotAccountCreation {
+		c.writeError("createBot", http.StatusForbidden, "bot account creation is disabled")
+		return
+	}
+	if bot.Username == "" {
+		c.writeError("createBot", http.StatusBadRequest, "missing username")
+		return
+	}
+	if c.s.store.userByUsername(bot.Username) != nil {
+		c.writeError("createBot", http.StatusBadRequest, "username is taken")
+		return
+	}
+
+	user := &model.User{
+		Username:       bot.Username,
+		Email:          bot.Username + "@localhost",
+		FirstName:      bot.DisplayName,
+		Roles:          model.SYSTEM_USER_ROLE_ID,
+		IsBot:          true,
+		BotDescription: bot.Description,
+	}
+	user.PreSave()
+	user.EmailVerified = true
+	c.s.store.users[user.Id] = user
+
+	bot.UserId = user.Id
+	bot.OwnerId = c.userId
+	bot.CreateAt = user.CreateAt
+	bot.UpdateAt = user.UpdateAt
+	stored := bot
+	c.s.store.bots[user.Id] = &stored
+
+	c.writeJSON(http.StatusCreated, &bot)
+}
@@ -0,0 +1,499 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func (s *Server) initChannelRoutes() {
+	s.handle(http.MethodGet, "/api/v4/teams/{team_id}/channels", true, getPublicChannelsForTeam)
+	s.handle(http.MethodGet, "/api/v4/teams/{team_id}/channels/name/{channel_name}", true, getChannelByName)
+	s.handle(http.MethodGet, "/api/v4/teams/{team_id}/channels/autocomplete", true, autocompleteChannelsForTeam)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/channels/search", true, searchChannels)
+
+	s.handle(http.MethodPost, "/api/v4/channels", true, createChannel)
+	s.handle(http.MethodPost, "/api/v4/channels/direct", true, createDirectChannel)
+	s.handle(http.MethodPost, "/api/v4/channels/group", true, createGroupChannel)
+	s.handle(http.MethodPost, "/api/v4/channels/members/{user_id}/view", true, viewChannel)
+	s.handle(http.MethodGet, "/api/v4/channels/{channel_id}", true, getChannel)
+	s.handle(http.MethodDelete, "/api/v4/channels/{channel_id}", true, deleteChannel)
+	s.handle(http.MethodGet, "/api/v4/channels/{channel_id}/stats", true, getChannelStats)
+	s.handle(http.MethodGet, "/api/v4/channels/{channel_id}/members", true, getChannelMembers)
+	s.handle(http.MethodPost, "/api/v4/channels/{channel_id}/members", true, addChannelMember)
+	s.handle(http.MethodGet, "/api/v4/channels/{channel_id}/members/{user_id}", true, getChannelMember)
+	s.handle(http.MethodDelete, "/api/v4/channels/{channel_id}/members/{user_id}", true, removeChannelMember)
+	s.handle(http.MethodPut, "/api/v4/channels/{channel_id}/members/{user_id}/notify_props", true, updateChannelNotifyProps)
+	s.handle(http.MethodPut, "/api/v4/channels/{channel_id}/members/{user_id}/schemeRoles", true, updateChannelMemberSchemeRoles)
+	s.handle(http.MethodPut, "/api/v4/channels/{channel_id}/scheme", true, updateChannelScheme)
+}
+
+// publicChannels returns the open, undeleted channels of a team ordered by name.
+func (st *store) publicChannels(teamId string) []*model.Channel {
+	channels := []*model.Channel{}
+	for _, channel := range st.channels {
+		if channel.TeamId == teamId && channel.Type == model.CHANNEL_OPEN && channel.DeleteAt == 0 {
+			channels = append(channels, channel)
+		}
+	}
+
+	return sortedChannels(channels)
+}
+
+func getPublicChannelsForTeam(c *context) {
+	page, perPage := c.pageParams(60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channels := c.s.store.publicChannels(c.param("team_id"))
+
+	start, end := paginate(len(channels), page, perPage)
+	c.writeJSON(http.StatusOK, channels[start:end])
+}
+
+func getChannelByName(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channel := c.s.store.channelByName(c.param("team_id"), c.param("channel_name"))
+	if channel == nil {
+		c.notFound("getChannelByName", "channel")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, channel)
+}
+
+func autocompleteChannelsForTeam(c *context) {
+	name := c.r.URL.Query().Get("name")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channels := []*model.Channel{}
+	for _, channel := range c.s.store.publicChannels(c.param("team_id")) {
+		if len(channels) >= 50 {
+			break
+		}
+		if name == "" || hasPrefixFold(channel.Name, name) || hasPrefixFold(channel.DisplayName, name) {
+			channels = append(channels, channel)
+		}
+	}
+
+	c.writeJSON(http.StatusOK, channels)
+}
+
+func searchChannels(c *context) {
+	search := model.ChannelSearchFromJson(c.r.Body)
+	if search == nil {
+		c.writeError("searchChannels", http.StatusBadRequest, "invalid search")
+		return
+	}
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channels := []*model.Channel{}
+	for _, channel := range c.s.store.publicChannels(c.param("team_id")) {
+		if len(channels) >= 100 {
+			break
+		}
+		if strings.Contains(strings.ToLower(channel.Name), strings.ToLower(search.Term)) ||
+			strings.Contains(strings.ToLower(channel.DisplayName), strings.ToLower(search.Term)) {
+			channels = append(channels, channel)
+		}
+	}
+
+	c.writeJSON(http.StatusOK, channels)
+}
+
+func createChannel(c *context) {
+	var channel model.Channel
+	if !c.decode(&channel) {
+		return
+	}
+	channel.Id = ""
+	channel.CreatorId = c.userId
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if c.s.store.teams[channel.TeamId] == nil {
+		c.notFound("createChannel", "team")
+		return
+	}
+	if c.s.store.channelByName(channel.TeamId, channel.Name) != nil {
+		c.writeError("createChannel", http.StatusBadRequest, "a channel with that name already exists")
+		return
+	}
+
+	created := c.s.store.createChannel(&channel)
+	member := c.s.store.addChannelMember(created.Id, c.userId)
+	member.Roles = model.CHANNEL_USER_ROLE_ID + " " + model.CHANNEL_ADMIN_ROLE_ID
+	member.SchemeAdmin = true
+
+	c.writeJSON(http.StatusCreated, created)
+}
+
+// getOrCreateMessageChannel returns the direct or group message channel with the given name,
+// creating it with the given members if it does not yet exist.
+func (st *store) getOrCreateMessageChannel(channelType, name string, userIds []string) *model.Channel {
+	if channel := st.channelByName("", name); channel != nil {
+		return channel
+	}
+
+	channel := st.createChannel(&model.Channel{
+		Name: name,
+		Type: channelType,
+	})
+	for _, userId := range userIds {
+		st.addChannelMember(channel.Id, userId)
+	}
+
+	return channel
+}
+
+func createDirectChannel(c *context) {
+	userIds := model.ArrayFromJson(c.r.Body)
+	if len(userIds) != 2 {
+		c.writeError("createDirectChannel", http.StatusBadRequest, "a direct channel requires two users")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	for _, userId := range userIds {
+		if c.s.store.users[userId] == nil {
+			c.notFound("createDirectChannel", "user")
+			return
+		}
+	}
+
+	channel := c.s.store.getOrCreateMessageChannel(model.CHANNEL_DIRECT, model.GetDMNameFromIds(userIds[0], userIds[1]), userIds)
+	c.writeJSON(http.StatusCreated, channel)
+}
+
+func createGroupChannel(c *context) {
+	userIds := model.ArrayFromJson(c.r.Body)
+
+	found := false
+	for _, userId := range userIds {
+		found = found || userId == c.userId
+	}
+	if !found {
+		userIds = append(userIds, c.userId)
+	}
+	if len(userIds) < model.CHANNEL_GROUP_MIN_USERS || len(userIds) > model.CHANNEL_GROUP_MAX_USERS {
+		c.writeError("createGroupChannel", http.StatusBadRequest, "invalid number of users for a group channel")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	users := make([]*model.User, 0, len(userIds))
+	for _, userId := range userIds {
+		user := c.s.store.users[userId]
+		if user == nil {
+			c.notFound("createGroupChannel", "user")
+			return
+		}
+		users = append(users, user)
+	}
+
+	channel := c.s.store.getOrCreateMessageChannel(model.CHANNEL_GROUP, model.GetGroupNameFromUserIds(userIds), userIds)
+	channel.DisplayName = model.GetGroupDisplayNameFromUsers(users, true)
+	c.writeJSON(http.StatusCreated, channel)
+}
+
+func viewChannel(c *context) {
+	view := model.ChannelViewFromJson(c.r.Body)
+	if view == nil {
+		c.writeError("viewChannel", http.StatusBadRequest, "invalid channel view")
+		return
+	}
+
+	userId := c.param("user_id")
+	response := &model.ChannelViewResponse{
+		Status:            model.STATUS_OK,
+		LastViewedAtTimes: map[string]int64{},
+	}
+
+	c.s.store.mu.Lock()
+	channel := c.s.store.channels[view.ChannelId]
+	member := c.s.store.channelMembers[view.ChannelId][userId]
+	if channel != nil && member != nil {
+		member.LastViewedAt = model.GetMillis()
+		member.LastUpdateAt = member.LastViewedAt
+		member.MsgCount = channel.TotalMsgCount
+		member.MentionCount = 0
+		response.LastViewedAtTimes[channel.Id] = member.LastViewedAt
+	}
+	c.s.store.mu.Unlock()
+
+	if channel != nil && member != nil {
+		event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_CHANNEL_VIEWED, "", "", userId, nil)
+		event.Add("channel_id", channel.Id)
+		c.s.hub.broadcast(event)
+	}
+
+	c.writeJSON(http.StatusOK, response)
+}
+
+func getChannel(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channel := c.s.store.channels[c.param("channel_id")]
+	if channel == nil {
+		c.notFound("getChannel", "channel")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, channel)
+}
+
+func deleteChannel(c *context) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	channel := c.s.store.channels[c.param("channel_id")]
+	if channel == nil || channel.DeleteAt != 0 {
+		c.notFound("deleteChannel", "channel")
+		return
+	}
+	if channel.Name == model.DEFAULT_CHANNEL {
+		c.writeError("deleteChannel", http.StatusBadRequest, "cannot delete the default channel")
+		return
+	}
+	channel.DeleteAt = model.GetMillis()
+	channel.UpdateAt = channel.DeleteAt
+
+	c.writeOK()
+}
+
+func getChannelStats(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channelId := c.param("channel_id")
+	if c.s.store.channels[channelId] == nil {
+		c.notFound("getChannelStats", "channel")
+		return
+	}
+
+	stats := &model.ChannelStats{
+		ChannelId:   channelId,
+		MemberCount: int64(len(c.s.store.channelMembers[channelId])),
+	}
+	for _, postId := range c.s.store.channelPosts[channelId] {
+		if post := c.s.store.posts[postId]; post.IsPinned && post.DeleteAt == 0 {
+			stats.PinnedPostCount++
+		}
+	}
+
+	c.writeJSON(http.StatusOK, stats)
+}
+
+func getChannelMembers(c *context) {
+	page, perPage := c.pageParams(60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	members := model.ChannelMembers{}
+	for _, member := range c.s.store.channelMembers[c.param("channel_id")] {
+		members = append(members, *member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserId < members[j].UserId })
+
+	start, end := paginate(len(members), page, perPage)
+	c.writeJSON(http.StatusOK, members[start:end])
+}
+
+func addChannelMember(c *context) {
+	props := model.StringInterfaceFromJson(c.r.Body)
+	userId, _ := props["user_id"].(string)
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	channel := c.s.store.channels[c.param("channel_id")]
+	if channel == nil || channel.DeleteAt != 0 {
+		c.notFound("addChannelMember", "channel")
+		return
+	}
+	if c.s.store.users[userId] == nil {
+		c.notFound("addChannelMember", "user")
+		return
+	}
+
+	c.writeJSON(http.StatusCreated, c.s.store.addChannelMember(channel.Id, userId))
+}
+
+func getChannelMember(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	member := c.s.store.channelMembers[c.param("channel_id")][c.param("user_id")]
+	if member == nil {
+		c.notFound("getChannelMember", "channel member")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, member)
+}
+
+// updateChannelNotifyProps changes how the user is notified of posts in the channel.
+func updateChannelNotifyProps(c *context) {
+	props := model.MapFromJson(c.r.Body)
+	if c.param("user_id") != c.userId {
+		c.writeError("updateChannelNotifyProps", http.StatusForbidden, "cannot change another user's notify props")
+		return
+	}
+	for name, value := range props {
+		valid := true
+		switch name {
+		case model.DESKTOP_NOTIFY_PROP, model.PUSH_NOTIFY_PROP:
+			valid = model.IsChannelNotifyLevelValid(value)
+		case model.MARK_UNREAD_NOTIFY_PROP:
+			valid = model.IsChannelMarkUnreadLevelValid(value)
+		case model.EMAIL_NOTIFY_PROP:
+			valid = model.IsSendEmailValid(value)
+		case model.IGNORE_CHANNEL_MENTIONS_NOTIFY_PROP:
+			valid = model.IsIgnoreChannelMentionsValid(value)
+		}
+		if !valid {
+			c.writeError("updateChannelNotifyProps", http.StatusBadRequest, "invalid value for notify prop "+name)
+			return
+		}
+	}
+
+	c.s.store.mu.Lock()
+	member := c.s.store.channelMembers[c.param("channel_id")][c.userId]
+	var updated model.ChannelMember
+	if member != nil {
+		// The props are replaced rather than changed, since copies of the member share them.
+		notifyProps := make(model.StringMap, len(member.NotifyProps)+len(props))
+		for name, value := range member.NotifyProps {
+			notifyProps[name] = value
+		}
+		for name, value := range props {
+			notifyProps[name] = value
+		}
+		member.NotifyProps = notifyProps
+		member.LastUpdateAt = model.GetMillis()
+		updated = *member
+	}
+	c.s.store.mu.Unlock()
+
+	if member == nil {
+		c.notFound("updateChannelNotifyProps", "channel member")
+		return
+	}
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_CHANNEL_MEMBER_UPDATED, "", "", c.userId, nil)
+	event.Add("channelMember", updated.ToJson())
+	c.s.hub.broadcast(event)
+
+	c.writeOK()
+}
+
+// updateChannelMemberSchemeRoles promotes a channel member to channel admin, or demotes them.
+func updateChannelMemberSchemeRoles(c *context) {
+	var schemeRoles model.SchemeRoles
+	if !c.decode(&schemeRoles) {
+		return
+	}
+	if !schemeRoles.SchemeUser {
+		c.writeError("updateChannelMemberSchemeRoles", http.StatusBadRequest, "channel members must keep the channel user role")
+		return
+	}
+
+	channelId := c.param("channel_id")
+	userId := c.param("user_id")
+
+	c.s.store.mu.Lock()
+	caller := c.s.store.channelMembers[channelId][c.userId]
+	if !c.s.store.isSystemAdmin(c.userId) && (caller == nil || !caller.SchemeAdmin) {
+		c.s.store.mu.Unlock()
+		c.writeError("updateChannelMemberSchemeRoles", http.StatusForbidden, "not an admin of the channel")
+		return
+	}
+	member := c.s.store.channelMembers[channelId][userId]
+	var updated model.ChannelMember
+	if member != nil {
+		member.SchemeUser = schemeRoles.SchemeUser
+		member.SchemeAdmin = schemeRoles.SchemeAdmin
+		member.LastUpdateAt = model.GetMillis()
+		updated = *member
+	}
+	c.s.store.mu.Unlock()
+
+	if member == nil {
+		c.notFound("updateChannelMemberSchemeRoles", "channel member")
+		return
+	}
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_CHANNEL_MEMBER_UPDATED, "", "", userId, nil)
+	event.Add("channelMember", updated.ToJson())
+	c.s.hub.broadcast(event)
+
+	c.writeOK()
+}
+
+// updateChannelScheme sets the permission scheme of the channel, or returns it to the scheme of
+// its team.
+func updateChannelScheme(c *context) {
+	var patch model.SchemeIDPatch
+	if !c.decode(&patch) || patch.SchemeID == nil {
+		c.writeError("updateChannelScheme", http.StatusBadRequest, "invalid scheme id")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	channel := c.s.store.channels[c.param("channel_id")]
+	if channel == nil || channel.DeleteAt != 0 {
+		c.notFound("updateChannelScheme", "channel")
+		return
+	}
+	if appErr := c.s.store.checkScheme(*patch.SchemeID, model.SCHEME_SCOPE_CHANNEL, c.userId); appErr != nil {
+		c.writeError("updateChannelScheme", appErr.StatusCode, appErr.DetailedError)
+		return
+	}
+	channel.SchemeId = patch.SchemeID
+	channel.UpdateAt = model.GetMillis()
+
+	c.writeOK()
+}
+
+func removeChannelMember(c *context) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	channel := c.s.store.channels[c.param("channel_id")]
+	if channel == nil {
+		c.notFound("removeChannelMember", "channel")
+		return
+	}
+	if channel.Name == model.DEFAULT_CHANNEL {
+		c.writeError("removeChannelMember", http.StatusBadRequest, "cannot leave the default channel")
+		return
+	}
+	if !c.s.store.isChannelMember(channel.Id, c.param("user_id")) {
+		c.notFound("removeChannelMember", "channel member")
+		return
+	}
+	delete(c.s.store.channelMembers[channel.Id], c.param("user_id"))
+
+	c.writeOK()
+}
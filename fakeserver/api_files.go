@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxUploadMemory is the amount of a multipart upload kept in memory before spilling to disk.
+const maxUploadMemory = 32 << 20
+
+func (s *Server) initFileRoutes() {
+	s.handle(http.MethodPost, "/api/v4/files", true, uploadFiles)
+	s.handle(http.MethodGet, "/api/v4/files/{file_id}", true, getFile)
+	s.handle(http.MethodGet, "/api/v4/files/{file_id}/thumbnail", true, getFileThumbnail)
+	s.handle(http.MethodGet, "/api/v4/files/{file_id}/info", true, getFileInfo)
+	s.handle(http.MethodGet, "/api/v4/files/{file_id}/preview", true, getFilePreview)
+	s.handle(http.MethodGet, "/api/v4/files/{file_id}/link", true, getFileLink)
+	s.handle(http.MethodGet, "/files/{file_id}/public", false, getPublicFile)
+	s.handle(http.MethodGet, "/api/v4/posts/{post_id}/files/info", true, getFileInfosForPost)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/files/search", true, searchFiles)
+}
+
+func uploadFiles(c *context) {
+	if err := c.r.ParseMultipartForm(maxUploadMemory); err != nil {
+		c.writeError("uploadFiles", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	channelId := c.r.FormValue("channel_id")
+	c.s.store.mu.RLock()
+	isMember := c.s.store.isChannelMember(channelId, c.userId)
+	c.s.store.mu.RUnlock()
+	if !isMember {
+		c.writeError("uploadFiles", http.StatusForbidden, "not a member of the channel")
+		return
+	}
+
+	response := &model.FileUploadResponse{
+		FileInfos: []*model.FileInfo{},
+		ClientIds: c.r.MultipartForm.Value["client_ids"],
+	}
+	for _, header := range c.r.MultipartForm.File["files"] {
+		file, err := header.Open()
+		if err != nil {
+			c.writeError("uploadFiles", http.StatusBadRequest, err.Error())
+			return
+		}
+		data, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			c.writeError("uploadFiles", http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Images that fail to decode are still accepted, as the real server does.
+		info, _ := model.GetInfoForBytes(header.Filename, data)
+		info.CreatorId = c.userId
+		info.PreSave()
+
+		c.s.store.mu.Lock()
+		c.s.store.files[info.Id] = info
+		c.s.store.fileData[info.Id] = data
+		c.s.store.mu.Unlock()
+
+		response.FileInfos = append(response.FileInfos, info)
+	}
+
+	c.writeJSON(http.StatusCreated, response)
+}
+
+func (c *context) writeFileData(where string) {
+	c.s.store.mu.RLock()
+	info := c.s.store.files[c.param("file_id")]
+	data := c.s.store.fileData[c.param("file_id")]
+	c.s.store.mu.RUnlock()
+
+	if info == nil {
+		c.notFound(where, "file")
+		return
+	}
+
+	c.w.Header().Set("Content-Type", info.MimeType)
+	c.w.WriteHeader(http.StatusOK)
+	c.w.Write(data)
+}
+
+func getFile(c *context) {
+	c.writeFileData("getFile")
+}
+
+func getFileThumbnail(c *context) {
+	// The original file stands in for its thumbnail; the client only measures the transfer.
+	c.writeFileData("getFileThumbnail")
+}
+
+func getFileInfo(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	info := c.s.store.files[c.param("file_id")]
+	if info == nil {
+		c.notFound("getFileInfo", "file")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, info)
+}
+
+func getFileInfosForPost(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	post := c.s.store.posts[c.param("post_id")]
+	if post == nil {
+		c.notFound("getFileInfosForPost", "post")
+		return
+	}
+
+	infos := []*model.FileInfo{}
+	for _, fileId := range post.FileIds {
+		if info := c.s.store.files[fileId]; info != nil {
+			infos = append(infos, info)
+		}
+	}
+
+	c.writeJSON(http.StatusOK, infos)
+}
+
+func getFilePreview(c *context) {
+	// As with thumbnails, the original file stands in for its preview.
+	c.writeFileData("getFilePreview")
+}
+
+// publicLinkHash is the hash a public link must carry to download the given file.
+func publicLinkHash(fileId string) string {
+	hash := sha256.Sum256([]byte("fakeserver" + fileId))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func getFileLink(c *context) {
+	c.s.store.mu.RLock()
+	info := c.s.store.files[c.param("file_id")]
+	c.s.store.mu.RUnlock()
+
+	if info == nil {
+		c.notFound("getFileLink", "file")
+		return
+	}
+
+	link := "http://" + c.r.Host + "/files/" + info.Id + "/public?h=" + publicLinkHash(info.Id)
+	c.writeJSON(http.StatusOK, map[string]string{"link": link})
+}
+
+func getPublicFile(c *context) {
+	if c.r.URL.Query().Get("h") != publicLinkHash(c.param("file_id")) {
+		c.writeError("getPublicFile", http.StatusBadRequest, "invalid public link")
+		return
+	}
+
+	c.writeFileData("getPublicFile")
+}
+
+// fileInfoList is the response to a file search.
+type fileInfoList struct {
+	Order     []string                   `json:"order"`
+	FileInfos map[string]*model.FileInfo `json:"file_infos"`
+}
+
+// searchFiles matches the search terms against the names of the files attached to posts in the
+// team's channels that the user is a member of, newest first.
+func searchFiles(c *context) {
+	var params struct {
+		Terms      string `json:"terms"`
+		IsOrSearch bool   `json:"is_or_search"`
+	}
+	if !c.decode(&params) {
+		return
+	}
+	terms := strings.Fields(strings.ToLower(params.Terms))
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	var matches []*model.FileInfo
+	for _, info := range c.s.store.files {
+		post := c.s.store.posts[info.PostId]
+		if post == nil || post.DeleteAt != 0 {
+			continue
+		}
+		channel := c.s.store.channels[post.ChannelId]
+		if channel == nil || channel.TeamId != c.param("team_id") || !c.s.store.isChannelMember(channel.Id, c.userId) {
+			continue
+		}
+
+		name := strings.ToLower(info.Name)
+		matched := !params.IsOrSearch
+		for _, term := range terms {
+			if params.IsOrSearch {
+				matched = matched || strings.Contains(name, term)
+			} else {
+				matched = matched && strings.Contains(name, term)
+			}
+		}
+		if matched && len(terms) > 0 {
+			matches = append(matches, info)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreateAt > matches[j].CreateAt
+	})
+
+	list := &fileInfoList{Order: []string{}, FileInfos: make(map[string]*model.FileInfo)}
+	for _, info := range matches {
+		list.Order = append(list.Order, info.Id)
+		list.FileInfos[info.Id] = info
+	}
+
+	c.writeJSON(http.StatusOK, list)
+}
@@ -0,0 +1,648 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// integrationTimeout bounds the requests made to integrations, as the real server's does.
+const integrationTimeout = 30 * time.Second
+
+func (s *Server) initIntegrationRoutes() {
+	s.handle(http.MethodPost, "/api/v4/hooks/incoming", true, createIncomingHook)
+	s.handle(http.MethodPost, "/hooks/{hook_id}", false, executeIncomingHook)
+
+	s.handle(http.MethodPost, "/api/v4/commands", true, createCommand)
+	s.handle(http.MethodGet, "/api/v4/commands", true, listCommands)
+	s.handle(http.MethodPut, "/api/v4/commands/{command_id}", true, updateCommand)
+	s.handle(http.MethodPost, "/api/v4/commands/execute", true, executeCommand)
+	s.handle(http.MethodPost, "/hooks/commands/{hook_id}", false, executeCommandHook)
+
+	s.handle(http.MethodPost, "/api/v4/hooks/outgoing", true, createOutgoingHook)
+	s.handle(http.MethodGet, "/api/v4/hooks/outgoing", true, getOutgoingHooks)
+	s.handle(http.MethodPut, "/api/v4/hooks/outgoing/{hook_id}", true, updateOutgoingHook)
+
+	s.handle(http.MethodPost, "/api/v4/posts/{post_id}/actions/{action_id}", true, doPostAction)
+}
+
+func createIncomingHook(c *context) {
+	var hook model.IncomingWebhook
+	if !c.decode(&hook) {
+		return
+	}
+	hook.Id = ""
+	hook.UserId = c.userId
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	channel := c.s.store.channels[hook.ChannelId]
+	if channel == nil {
+		c.notFound("createIncomingHook", "channel")
+		return
+	}
+	hook.TeamId = channel.TeamId
+	hook.PreSave()
+	c.s.store.incomingHooks[hook.Id] = &hook
+
+	c.writeJSON(http.StatusCreated, &hook)
+}
+
+func executeIncomingHook(c *context) {
+	request, appErr := model.IncomingWebhookRequestFromJson(c.r.Body)
+	if appErr != nil {
+		c.writeError("executeIncomingHook", http.StatusBadRequest, appErr.Error())
+		return
+	}
+	if request.Text == "" && len(request.Attachments) == 0 {
+		c.writeError("executeIncomingHook", http.StatusBadRequest, "text or attachments required")
+		return
+	}
+
+	c.s.store.mu.RLock()
+	hook := c.s.store.incomingHooks[c.param("hook_id")]
+	channelId := ""
+	if hook != nil {
+		channelId = hook.ChannelId
+		// Like the real server, webhooks may post to other channels of their team unless locked
+		// to their own. Posting to direct channels with @username is not supported.
+		if request.ChannelName != "" {
+			channel := c.s.store.channelByName(hook.TeamId, strings.TrimPrefix(request.ChannelName, "#"))
+			if channel == nil {
+				channelId = ""
+			} else if !hook.ChannelLocked || channel.Id == hook.ChannelId {
+				channelId = channel.Id
+			}
+		}
+	}
+	c.s.store.mu.RUnlock()
+	if hook == nil {
+		c.notFound("executeIncomingHook", "webhook")
+		return
+	}
+	if channelId == "" {
+		c.notFound("executeIncomingHook", "channel")
+		return
+	}
+	if channelId != hook.ChannelId && hook.ChannelLocked {
+		c.writeError("executeIncomingHook", http.StatusForbidden, "webhook is locked to its channel")
+		return
+	}
+
+	post := &model.Post{
+		ChannelId: channelId,
+		UserId:    hook.UserId,
+		Message:   request.Text,
+		Type:      request.Type,
+	}
+	post.AddProp("from_webhook", "true")
+	if request.Username != "" {
+		post.AddProp("override_username", request.Username)
+	}
+	if request.IconURL != "" {
+		post.AddProp("override_icon_url", request.IconURL)
+	}
+	if len(request.Attachments) > 0 {
+		post.AddProp("attachments", request.Attachments)
+	}
+
+	if _, appErr := c.s.publishPost(post); appErr != nil {
+		c.writeError("executeIncomingHook", appErr.StatusCode, appErr.DetailedError)
+		return
+	}
+
+	c.w.Header().Set("Content-Type", "text/plain")
+	c.w.WriteHeader(http.StatusOK)
+	c.w.Write([]byte("ok"))
+}
+
+func createCommand(c *context) {
+	var command model.Command
+	if !c.decode(&command) {
+		return
+	}
+	if command.Trigger == "" || command.URL == "" {
+		c.writeError("createCommand", http.StatusBadRequest, "trigger and url required")
+		return
+	}
+	command.Id = ""
+	command.Token = ""
+	command.CreatorId = c.userId
+	command.PreSave()
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if c.s.store.teams[command.TeamId] == nil {
+		c.notFound("createCommand", "team")
+		return
+	}
+	for _, existing := range c.s.store.commands {
+		if existing.TeamId == command.TeamId && existing.Trigger == command.Trigger && existing.DeleteAt == 0 {
+			c.writeError("createCommand", http.StatusBadRequest, "trigger already in use")
+			return
+		}
+	}
+	c.s.store.commands[command.Id] = &command
+
+	c.writeJSON(http.StatusCreated, &command)
+}
+
+func listCommands(c *context) {
+	teamId := c.r.URL.Query().Get("team_id")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	commands := []*model.Command{}
+	for _, command := range c.s.store.commands {
+		if command.TeamId == teamId && command.DeleteAt == 0 {
+			commands = append(commands, command)
+		}
+	}
+
+	c.writeJSON(http.StatusOK, commands)
+}
+
+func updateCommand(c *context) {
+	var update model.Command
+	if !c.decode(&update) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	command := c.s.store.commands[c.param("command_id")]
+	if command == nil || command.DeleteAt != 0 {
+		c.notFound("updateCommand", "command")
+		return
+	}
+
+	command.Trigger = update.Trigger
+	command.Method = update.Method
+	command.URL = update.URL
+	command.Username = update.Username
+	command.IconURL = update.IconURL
+	command.AutoComplete = update.AutoComplete
+	command.AutoCompleteDesc = update.AutoCompleteDesc
+	command.AutoCompleteHint = update.AutoCompleteHint
+	command.DisplayName = update.DisplayName
+	command.Description = update.Description
+	command.UpdateAt = model.GetMillis()
+
+	c.writeJSON(http.StatusOK, command)
+}
+
+// executeCommand calls the custom slash command matching the executed command's trigger, and
+// handles its response.
+func executeCommand(c *context) {
+	var args model.CommandArgs
+	if !c.decode(&args) {
+		return
+	}
+	fields := strings.Fields(args.Command)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		c.writeError("executeCommand", http.StatusBadRequest, "command must start with a slash")
+		return
+	}
+	trigger := strings.TrimPrefix(fields[0], "/")
+	args.UserId = c.userId
+
+	c.s.store.mu.Lock()
+	channel := c.s.store.channels[args.ChannelId]
+	if channel == nil || !c.s.store.isChannelMember(args.ChannelId, c.userId) {
+		c.s.store.mu.Unlock()
+		c.writeError("executeCommand", http.StatusForbidden, "not a member of the channel")
+		return
+	}
+	if args.TeamId == "" {
+		args.TeamId = channel.TeamId
+	}
+	var command *model.Command
+	for _, candidate := range c.s.store.commands {
+		if candidate.TeamId == args.TeamId && candidate.Trigger == trigger && candidate.DeleteAt == 0 {
+			commandCopy := *candidate
+			command = &commandCopy
+			break
+		}
+	}
+	if command == nil {
+		c.s.store.mu.Unlock()
+		c.notFound("executeCommand", "command")
+		return
+	}
+	hookId := model.NewId()
+	c.s.store.commandHooks[hookId] = &commandHook{commandId: command.Id, args: args}
+	c.s.store.mu.Unlock()
+
+	form := url.Values{
+		"token":        {command.Token},
+		"team_id":      {args.TeamId},
+		"channel_id":   {args.ChannelId},
+		"user_id":      {args.UserId},
+		"command":      {fields[0]},
+		"text":         {strings.Join(fields[1:], " ")},
+		"response_url": {"http://" + c.r.Host + "/hooks/commands/" + hookId},
+	}
+
+	var r *http.Response
+	var err error
+	if command.Method == model.COMMAND_METHOD_GET {
+		r, err = c.s.integrationClient.Get(command.URL + "?" + form.Encode())
+	} else {
+		r, err = c.s.integrationClient.PostForm(command.URL, form)
+	}
+	if err != nil {
+		c.writeError("executeCommand", http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		c.writeError("executeCommand", http.StatusInternalServerError, "command failed with status "+r.Status)
+		return
+	}
+	response, err := model.CommandResponseFromHTTPBody(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		c.writeError("executeCommand", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if appErr := c.s.handleCommandResponse(command, &args, response); appErr != nil {
+		c.writeError("executeCommand", appErr.StatusCode, appErr.DetailedError)
+		return
+	}
+
+	c.writeJSON(http.StatusOK, response)
+}
+
+// executeCommandHook handles a response sent to the response URL of a slash command.
+func executeCommandHook(c *context) {
+	response, err := model.CommandResponseFromJson(c.r.Body)
+	if err != nil {
+		c.writeError("executeCommandHook", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.s.store.mu.RLock()
+	var command model.Command
+	hook := c.s.store.commandHooks[c.param("hook_id")]
+	if hook != nil && c.s.store.commands[hook.commandId] != nil {
+		command = *c.s.store.commands[hook.commandId]
+	}
+	c.s.store.mu.RUnlock()
+	if hook == nil || command.Id == "" {
+		c.notFound("executeCommandHook", "command webhook")
+		return
+	}
+
+	if appErr := c.s.handleCommandResponse(&command, &hook.args, response); appErr != nil {
+		c.writeError("executeCommandHook", appErr.StatusCode, appErr.DetailedError)
+		return
+	}
+
+	c.w.Header().Set("Content-Type", "text/plain")
+	c.w.WriteHeader(http.StatusOK)
+	c.w.Write([]byte("ok"))
+}
+
+// handleCommandResponse posts a slash command's response to the channel the command was
+// executed in, or only shows it to the user who executed it if the response is ephemeral.
+func (s *Server) handleCommandResponse(command *model.Command, args *model.CommandArgs, response *model.CommandResponse) *model.AppError {
+	if response.Text == "" && len(response.Attachments) == 0 {
+		return nil
+	}
+
+	post := &model.Post{
+		ChannelId: args.ChannelId,
+		UserId:    args.UserId,
+		Message:   response.Text,
+	}
+	post.AddProp("from_webhook", "true")
+	if command.Username != "" {
+		post.AddProp("override_username", command.Username)
+	}
+	if len(response.Attachments) > 0 {
+		post.AddProp("attachments", response.Attachments)
+	}
+
+	if response.ResponseType == model.COMMAND_RESPONSE_TYPE_IN_CHANNEL {
+		_, appErr := s.publishPost(post)
+		return appErr
+	}
+
+	post.Id = model.NewId()
+	post.CreateAt = model.GetMillis()
+	post.Type = model.POST_EPHEMERAL
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_EPHEMERAL_MESSAGE, "", post.ChannelId, args.UserId, nil)
+	event.Add("post", post.ToJson())
+	s.hub.broadcast(event)
+
+	return nil
+}
+
+func createOutgoingHook(c *context) {
+	var hook model.OutgoingWebhook
+	if !c.decode(&hook) {
+		return
+	}
+	if len(hook.CallbackURLs) == 0 || (hook.ChannelId == "" && len(hook.TriggerWords) == 0) {
+		c.writeError("createOutgoingHook", http.StatusBadRequest, "callback urls and a channel or trigger words required")
+		return
+	}
+	hook.Id = ""
+	hook.Token = ""
+	hook.CreatorId = c.userId
+	hook.PreSave()
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if c.s.store.teams[hook.TeamId] == nil {
+		c.notFound("createOutgoingHook", "team")
+		return
+	}
+	c.s.store.outgoingHooks[hook.Id] = &hook
+
+	c.writeJSON(http.StatusCreated, &hook)
+}
+
+func getOutgoingHooks(c *context) {
+	query := c.r.URL.Query()
+	teamId := query.Get("team_id")
+	channelId := query.Get("channel_id")
+	page, perPage := c.pageParams(60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	hooks := []*model.OutgoingWebhook{}
+	for _, hook := range c.s.store.outgoingHooks {
+		if hook.DeleteAt != 0 || (teamId != "" && hook.TeamId != teamId) || (channelId != "" && hook.ChannelId != channelId) {
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].Id < hooks[j].Id })
+
+	start, end := paginate(len(hooks), page, perPage)
+	c.writeJSON(http.StatusOK, hooks[start:end])
+}
+
+func updateOutgoingHook(c *context) {
+	var update model.OutgoingWebhook
+	if !c.decode(&update) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	hook := c.s.store.outgoingHooks[c.param("hook_id")]
+	if hook == nil || hook.DeleteAt != 0 {
+		c.notFound("updateOutgoingHook", "webhook")
+		return
+	}
+
+	hook.ChannelId = update.ChannelId
+	hook.TriggerWords = update.TriggerWords
+	hook.TriggerWhen = update.TriggerWhen
+	hook.CallbackURLs = update.CallbackURLs
+	hook.DisplayName = update.DisplayName
+	hook.Description = update.Description
+	hook.ContentType = update.ContentType
+	hook.Username = update.Username
+	hook.IconURL = update.IconURL
+	hook.PreUpdate()
+
+	c.writeJSON(http.StatusOK, hook)
+}
+
+// triggerOutgoingHooks calls the outgoing webhooks matching a new post in a public channel, and
+// posts their responses. Like the real server, the webhooks are called in the background.
+func (s *Server) triggerOutgoingHooks(post *model.Post, channel *model.Channel, senderName string) {
+	var firstWord string
+	if fields := strings.Fields(post.Message); len(fields) > 0 {
+		firstWord = fields[0]
+	}
+
+	s.store.mu.RLock()
+	var teamName string
+	if team := s.store.teams[channel.TeamId]; team != nil {
+		teamName = team.Name
+	}
+	var payloads []*model.OutgoingWebhookPayload
+	var hooks []model.OutgoingWebhook
+	for _, hook := range s.store.outgoingHooks {
+		if hook.DeleteAt != 0 || hook.TeamId != channel.TeamId || (hook.ChannelId != "" && hook.ChannelId != post.ChannelId) {
+			continue
+		}
+
+		var triggerWord string
+		switch {
+		case hook.ChannelId != "" && len(hook.TriggerWords) == 0:
+		case hook.TriggerWhen == 0 && hook.TriggerWordExactMatch(firstWord):
+			triggerWord = firstWord
+		case hook.TriggerWhen == 1 && hook.TriggerWordStartsWith(firstWord):
+			triggerWord = firstWord
+		default:
+			continue
+		}
+
+		hooks = append(hooks, *hook)
+		payloads = append(payloads, &model.OutgoingWebhookPayload{
+			Token:       hook.Token,
+			TeamId:      channel.TeamId,
+			TeamDomain:  teamName,
+			ChannelId:   post.ChannelId,
+			ChannelName: channel.Name,
+			Timestamp:   post.CreateAt,
+			UserId:      post.UserId,
+			UserName:    senderName,
+			PostId:      post.Id,
+			Text:        post.Message,
+			TriggerWord: triggerWord,
+			FileIds:     strings.Join(post.FileIds, ","),
+		})
+	}
+	s.store.mu.RUnlock()
+
+	for i := range hooks {
+		for _, callbackURL := range hooks[i].CallbackURLs {
+			go s.callOutgoingHook(&hooks[i], payloads[i], post, callbackURL)
+		}
+	}
+}
+
+// callOutgoingHook calls an outgoing webhook, posting its response to the channel, or in the
+// post's thread when asked to.
+func (s *Server) callOutgoingHook(hook *model.OutgoingWebhook, payload *model.OutgoingWebhookPayload, post *model.Post, callbackURL string) {
+	var r *http.Response
+	var err error
+	if hook.ContentType == "application/json" {
+		r, err = s.integrationClient.Post(callbackURL, "application/json", strings.NewReader(payload.ToJSON()))
+	} else {
+		r, err = s.integrationClient.Post(callbackURL, "application/x-www-form-urlencoded", strings.NewReader(payload.ToFormValues()))
+	}
+	if err != nil {
+		return
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return
+	}
+	response, err := model.OutgoingWebhookResponseFromJson(r.Body)
+	if err != nil || response == nil || ((response.Text == nil || *response.Text == "") && len(response.Attachments) == 0) {
+		return
+	}
+
+	reply := &model.Post{
+		ChannelId: post.ChannelId,
+		UserId:    hook.CreatorId,
+	}
+	if response.Text != nil {
+		reply.Message = *response.Text
+	}
+	if response.ResponseType == model.OUTGOING_HOOK_RESPONSE_TYPE_COMMENT {
+		reply.RootId = post.Id
+		if post.RootId != "" {
+			reply.RootId = post.RootId
+		}
+		reply.ParentId = reply.RootId
+	}
+	reply.AddProp("from_webhook", "true")
+	if response.Username != "" {
+		reply.AddProp("override_username", response.Username)
+	} else if hook.Username != "" {
+		reply.AddProp("override_username", hook.Username)
+	}
+	if len(response.Attachments) > 0 {
+		reply.AddProp("attachments", response.Attachments)
+	}
+
+	s.publishPost(reply)
+}
+
+// doPostAction calls the integration of an interactive message's action, and applies the update
+// it responds with to the message.
+func doPostAction(c *context) {
+	var request model.DoPostActionRequest
+	if c.r.ContentLength != 0 && !c.decode(&request) {
+		return
+	}
+
+	c.s.store.mu.RLock()
+	post := c.s.store.posts[c.param("post_id")]
+	if post == nil || post.DeleteAt != 0 || !c.s.store.isChannelMember(post.ChannelId, c.userId) {
+		c.s.store.mu.RUnlock()
+		c.notFound("doPostAction", "post")
+		return
+	}
+	post = clonePost(post)
+	action := post.GetAction(c.param("action_id"))
+	channel := c.s.store.channels[post.ChannelId]
+	originalProps := model.StringInterface{}
+	for _, key := range model.PostActionRetainPropKeys {
+		if value, ok := post.Props[key]; ok {
+			originalProps[key] = value
+		}
+	}
+	c.s.store.mu.RUnlock()
+	if action == nil || action.Integration == nil {
+		c.notFound("doPostAction", "action")
+		return
+	}
+
+	upstreamRequest := &model.PostActionIntegrationRequest{
+		UserId:     c.userId,
+		ChannelId:  post.ChannelId,
+		TeamId:     channel.TeamId,
+		PostId:     post.Id,
+		Type:       action.Type,
+		DataSource: action.DataSource,
+		Context:    map[string]interface{}{},
+	}
+	for key, value := range action.Integration.Context {
+		upstreamRequest.Context[key] = value
+	}
+	if request.SelectedOption != "" {
+		upstreamRequest.Context["selected_option"] = request.SelectedOption
+	}
+
+	body, _ := json.Marshal(upstreamRequest)
+	r, err := c.s.integrationClient.Post(action.Integration.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		c.writeError("doPostAction", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		c.writeError("doPostAction", http.StatusBadRequest, "action failed with status "+r.Status)
+		return
+	}
+	var response model.PostActionIntegrationResponse
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		c.writeError("doPostAction", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if response.Update != nil {
+		c.s.store.mu.Lock()
+		post := c.s.store.posts[post.Id]
+		if post == nil || post.DeleteAt != 0 {
+			c.s.store.mu.Unlock()
+			c.notFound("doPostAction", "post")
+			return
+		}
+		props := model.StringInterface{}
+		for key, value := range response.Update.Props {
+			props[key] = value
+		}
+		delete(props, "from_webhook")
+		for key, value := range originalProps {
+			props[key] = value
+		}
+		if post.Message != response.Update.Message {
+			post.EditAt = model.GetMillis()
+		}
+		post.Message = response.Update.Message
+		post.Props = props
+		post.UpdateAt = model.GetMillis()
+		updated := clonePost(post)
+		c.s.store.mu.Unlock()
+
+		event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_POST_EDITED, "", updated.ChannelId, "", nil)
+		event.Add("post", updated.ToJson())
+		c.s.hub.broadcast(event)
+	}
+
+	if response.EphemeralText != "" {
+		ephemeral := &model.Post{
+			Id:        model.NewId(),
+			ChannelId: post.ChannelId,
+			UserId:    c.userId,
+			RootId:    post.RootId,
+			Message:   response.EphemeralText,
+			CreateAt:  model.GetMillis(),
+			Type:      model.POST_EPHEMERAL,
+		}
+		event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_EPHEMERAL_MESSAGE, "", ephemeral.ChannelId, c.userId, nil)
+		event.Add("post", ephemeral.ToJson())
+		c.s.hub.broadcast(event)
+	}
+
+	c.writeJSON(http.StatusOK, &model.PostActionAPIResponse{Status: "OK"})
+}
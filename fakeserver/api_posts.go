@@ -0,0 +1,436 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func (s *Server) initPostRoutes() {
+	s.handle(http.MethodPost, "/api/v4/posts", true, createPost)
+	s.handle(http.MethodGet, "/api/v4/posts/{post_id}", true, getPost)
+	s.handle(http.MethodDelete, "/api/v4/posts/{post_id}", true, deletePost)
+	s.handle(http.MethodPut, "/api/v4/posts/{post_id}/patch", true, patchPost)
+	s.handle(http.MethodPost, "/api/v4/posts/{post_id}/pin", true, pinPost)
+	s.handle(http.MethodPost, "/api/v4/posts/{post_id}/unpin", true, unpinPost)
+	s.handle(http.MethodGet, "/api/v4/channels/{channel_id}/posts", true, getPostsForChannel)
+	s.handle(http.MethodGet, "/api/v4/channels/{channel_id}/pinned", true, getPinnedPosts)
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/posts/flagged", true, getFlaggedPosts)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/posts/search", true, searchPosts)
+
+	s.handle(http.MethodPost, "/api/v4/reactions", true, saveReaction)
+	s.handle(http.MethodGet, "/api/v4/posts/{post_id}/reactions", true, getReactions)
+
+	s.handle(http.MethodGet, "/api/v4/emoji/name/{emoji_name}", true, getEmojiByName)
+	s.handle(http.MethodPost, "/api/v4/opengraph", true, getOpenGraphMetadata)
+}
+
+// publishPost stores the post and notifies the members of its channel.
+func (s *Server) publishPost(post *model.Post) (*model.Post, *model.AppError) {
+	connected := s.hub.connectedUserIds()
+
+	s.store.mu.Lock()
+	channel := s.store.channels[post.ChannelId]
+	if channel == nil || channel.DeleteAt != 0 {
+		s.store.mu.Unlock()
+		return nil, model.NewAppError("publishPost", "fakeserver.app_error", nil, "channel not found", http.StatusNotFound)
+	}
+	if post.ParentId != "" && s.store.posts[post.ParentId] == nil {
+		s.store.mu.Unlock()
+		return nil, model.NewAppError("publishPost", "fakeserver.app_error", nil, "parent post not found", http.StatusBadRequest)
+	}
+
+	created := clonePost(s.store.createPost(post))
+	mentions := s.store.mentionedUserIds(created, connected)
+	for _, userId := range mentions {
+		s.store.channelMembers[channel.Id][userId].MentionCount++
+	}
+	channelCopy := *channel
+	var senderName string
+	if user := s.store.users[post.UserId]; user != nil {
+		senderName = user.Username
+	}
+	s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_POSTED, "", channelCopy.Id, "", nil)
+	event.Add("post", created.ToJson())
+	event.Add("channel_type", channelCopy.Type)
+	event.Add("channel_display_name", channelCopy.DisplayName)
+	event.Add("channel_name", channelCopy.Name)
+	event.Add("sender_name", senderName)
+	event.Add("team_id", channelCopy.TeamId)
+	if len(mentions) > 0 {
+		event.Add("mentions", model.ArrayToJson(mentions))
+	}
+	s.hub.broadcast(event)
+
+	// As on the real server, posts made by integrations don't trigger outgoing webhooks.
+	if created.Props["from_webhook"] == nil && channelCopy.Type == model.CHANNEL_OPEN {
+		s.triggerOutgoingHooks(created, &channelCopy, senderName)
+	}
+
+	return created, nil
+}
+
+// mentionedUserIds returns the members of the post's channel that it mentions by username,
+// @channel, @all or a mention key, other than its author. Members with a websocket connection
+// are also mentioned by @here.
+func (st *store) mentionedUserIds(post *model.Post, connected map[string]bool) []string {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(post.Message)) {
+		words[strings.TrimRight(word, ".,:;!?")] = true
+	}
+
+	var userIds []string
+	for userId := range st.channelMembers[post.ChannelId] {
+		user := st.users[userId]
+		if user == nil || userId == post.UserId {
+			continue
+		}
+
+		mentioned := words["@channel"] || words["@all"] || words["@"+user.Username] ||
+			(words["@here"] && connected[userId])
+		for _, key := range strings.Split(user.NotifyProps[model.MENTION_KEYS_NOTIFY_PROP], ",") {
+			mentioned = mentioned || (key != "" && words[strings.ToLower(key)])
+		}
+		if mentioned {
+			userIds = append(userIds, userId)
+		}
+	}
+	sort.Strings(userIds)
+
+	return userIds
+}
+
+func createPost(c *context) {
+	var post model.Post
+	if !c.decode(&post) {
+		return
+	}
+	post.Id = ""
+	post.UserId = c.userId
+
+	c.s.store.mu.RLock()
+	isMember := c.s.store.isChannelMember(post.ChannelId, c.userId)
+	c.s.store.mu.RUnlock()
+	if !isMember {
+		c.writeError("createPost", http.StatusForbidden, "not a member of the channel")
+		return
+	}
+
+	created, appErr := c.s.publishPost(&post)
+	if appErr != nil {
+		c.writeError("createPost", appErr.StatusCode, appErr.DetailedError)
+		return
+	}
+
+	c.writeJSON(http.StatusCreated, created)
+}
+
+func getPost(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	post := c.s.store.posts[c.param("post_id")]
+	if post == nil || post.DeleteAt != 0 {
+		c.notFound("getPost", "post")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, post)
+}
+
+// updatePost applies a change to a post and notifies the members of its channel. The change
+// is made with the store locked, and may refuse it by returning an error.
+func (c *context) updatePost(where, eventType string, update func(post *model.Post) *model.AppError) {
+	c.s.store.mu.Lock()
+	post := c.s.store.posts[c.param("post_id")]
+	if post == nil || post.DeleteAt != 0 || !c.s.store.isChannelMember(post.ChannelId, c.userId) {
+		c.s.store.mu.Unlock()
+		c.notFound(where, "post")
+		return
+	}
+	if appErr := update(post); appErr != nil {
+		c.s.store.mu.Unlock()
+		c.writeError(where, appErr.StatusCode, appErr.DetailedError)
+		return
+	}
+	updated := clonePost(post)
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(eventType, "", updated.ChannelId, "", nil)
+	event.Add("post", updated.ToJson())
+	c.s.hub.broadcast(event)
+
+	if eventType == model.WEBSOCKET_EVENT_POST_DELETED {
+		c.writeOK()
+	} else {
+		c.writeJSON(http.StatusOK, updated)
+	}
+}
+
+func patchPost(c *context) {
+	var patch model.PostPatch
+	if !c.decode(&patch) {
+		return
+	}
+
+	c.updatePost("patchPost", model.WEBSOCKET_EVENT_POST_EDITED, func(post *model.Post) *model.AppError {
+		if post.UserId != c.userId {
+			return model.NewAppError("patchPost", "fakeserver.app_error", nil, "cannot edit another user's post", http.StatusForbidden)
+		}
+
+		post.Patch(&patch)
+		post.UpdateAt = model.GetMillis()
+		post.EditAt = post.UpdateAt
+		return nil
+	})
+}
+
+func deletePost(c *context) {
+	c.updatePost("deletePost", model.WEBSOCKET_EVENT_POST_DELETED, func(post *model.Post) *model.AppError {
+		if post.UserId != c.userId {
+			return model.NewAppError("deletePost", "fakeserver.app_error", nil, "cannot delete another user's post", http.StatusForbidden)
+		}
+
+		post.DeleteAt = model.GetMillis()
+		post.UpdateAt = post.DeleteAt
+		return nil
+	})
+}
+
+func setPostPinned(c *context, where string, pinned bool) {
+	c.updatePost(where, model.WEBSOCKET_EVENT_POST_EDITED, func(post *model.Post) *model.AppError {
+		post.IsPinned = pinned
+		post.UpdateAt = model.GetMillis()
+		return nil
+	})
+}
+
+func pinPost(c *context) {
+	setPostPinned(c, "pinPost", true)
+}
+
+func unpinPost(c *context) {
+	setPostPinned(c, "unpinPost", false)
+}
+
+func getPinnedPosts(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	if c.s.store.channels[c.param("channel_id")] == nil {
+		c.notFound("getPinnedPosts", "channel")
+		return
+	}
+
+	var postIds []string
+	for _, postId := range c.s.store.channelPosts[c.param("channel_id")] {
+		if c.s.store.posts[postId].IsPinned {
+			postIds = append(postIds, postId)
+		}
+	}
+
+	c.writeJSON(http.StatusOK, c.s.store.postList(postIds))
+}
+
+func getFlaggedPosts(c *context) {
+	page, perPage := c.pageParams(60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	var postIds []string
+	for _, preference := range c.s.store.preferences[c.param("user_id")] {
+		if preference.Category != model.PREFERENCE_CATEGORY_FLAGGED_POST {
+			continue
+		}
+		if post := c.s.store.posts[preference.Name]; post != nil && post.DeleteAt == 0 {
+			postIds = append(postIds, post.Id)
+		}
+	}
+	sort.Slice(postIds, func(i, j int) bool {
+		return c.s.store.posts[postIds[i]].CreateAt < c.s.store.posts[postIds[j]].CreateAt
+	})
+
+	// Posts are listed oldest first, so pages are counted back from the end.
+	skip, count := paginate(len(postIds), page, perPage)
+	c.writeJSON(http.StatusOK, c.s.store.postList(postIds[len(postIds)-count:len(postIds)-skip]))
+}
+
+func getPostsForChannel(c *context) {
+	query := c.r.URL.Query()
+	page, perPage := c.pageParams(60)
+	since, _ := strconv.ParseInt(query.Get("since"), 10, 64)
+	before := query.Get("before")
+	after := query.Get("after")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	if c.s.store.channels[c.param("channel_id")] == nil {
+		c.notFound("getPostsForChannel", "channel")
+		return
+	}
+	postIds := c.s.store.channelPosts[c.param("channel_id")]
+
+	if since > 0 {
+		var updated []string
+		for _, postId := range postIds {
+			if post := c.s.store.posts[postId]; post.CreateAt >= since || post.UpdateAt >= since {
+				updated = append(updated, postId)
+			}
+		}
+		c.writeJSON(http.StatusOK, c.s.store.postList(updated))
+		return
+	}
+
+	// Posts are stored oldest first, so pages are counted back from the end.
+	end := len(postIds)
+	if before != "" || after != "" {
+		anchor := before + after
+		index := -1
+		for i, postId := range postIds {
+			if postId == anchor {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			c.writeJSON(http.StatusOK, model.NewPostList())
+			return
+		}
+
+		if before != "" {
+			end = index
+		} else {
+			start := index + 1 + page*perPage
+			if start > len(postIds) {
+				start = len(postIds)
+			}
+			stop := start + perPage
+			if stop > len(postIds) {
+				stop = len(postIds)
+			}
+			c.writeJSON(http.StatusOK, c.s.store.postList(postIds[start:stop]))
+			return
+		}
+	}
+
+	skip, count := paginate(end, page, perPage)
+	c.writeJSON(http.StatusOK, c.s.store.postList(postIds[end-count:end-skip]))
+}
+
+func searchPosts(c *context) {
+	var params model.SearchParameter
+	if !c.decode(&params) {
+		return
+	}
+	if params.Terms == nil {
+		c.writeError("searchPosts", http.StatusBadRequest, "missing terms")
+		return
+	}
+	terms := strings.Fields(strings.ToLower(*params.Terms))
+	perPage := 60
+	if params.PerPage != nil {
+		perPage = *params.PerPage
+	}
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	var matches []string
+	for channelId, postIds := range c.s.store.channelPosts {
+		channel := c.s.store.channels[channelId]
+		if channel == nil || channel.TeamId != c.param("team_id") || !c.s.store.isChannelMember(channelId, c.userId) {
+			continue
+		}
+
+		for _, postId := range postIds {
+			message := strings.ToLower(c.s.store.posts[postId].Message)
+			for _, term := range terms {
+				if strings.Contains(message, strings.Trim(term, "\"*")) {
+					matches = append(matches, postId)
+					break
+				}
+			}
+		}
+	}
+	if len(matches) > perPage {
+		matches = matches[:perPage]
+	}
+
+	list := c.s.store.postList(matches)
+	list.SortByCreateAt()
+	c.writeJSON(http.StatusOK, model.MakePostSearchResults(list, nil))
+}
+
+func saveReaction(c *context) {
+	var reaction model.Reaction
+	if !c.decode(&reaction) {
+		return
+	}
+	if reaction.UserId != c.userId {
+		c.writeError("saveReaction", http.StatusForbidden, "cannot react on behalf of another user")
+		return
+	}
+	reaction.PreSave()
+
+	c.s.store.mu.Lock()
+	post := c.s.store.posts[reaction.PostId]
+	if post == nil {
+		c.s.store.mu.Unlock()
+		c.notFound("saveReaction", "post")
+		return
+	}
+	c.s.store.reactions[post.Id] = append(c.s.store.reactions[post.Id], &reaction)
+	post.HasReactions = true
+	channelId := post.ChannelId
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_REACTION_ADDED, "", channelId, "", nil)
+	event.Add("reaction", reaction.ToJson())
+	c.s.hub.broadcast(event)
+
+	c.writeJSON(http.StatusCreated, &reaction)
+}
+
+func getReactions(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	reactions := c.s.store.reactions[c.param("post_id")]
+	if reactions == nil {
+		reactions = []*model.Reaction{}
+	}
+
+	c.writeJSON(http.StatusOK, reactions)
+}
+
+func getEmojiByName(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	emoji := c.s.store.emoji[c.param("emoji_name")]
+	if emoji == nil {
+		c.notFound("getEmojiByName", "emoji")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, emoji)
+}
+
+func getOpenGraphMetadata(c *context) {
+	props := model.MapFromJson(c.r.Body)
+
+	c.writeJSON(http.StatusOK, map[string]string{
+		"type": "website",
+		"url":  props["url"],
+	})
+}
@@ -0,0 +1,341 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The types of sidebar categories, and the websocket events telling users of changes to theirs.
+// The sidebar categories API is newer than the model package.
+const (
+	sidebarCategoryCustom         = "custom"
+	sidebarCategoryChannels       = "channels"
+	sidebarCategoryDirectMessages = "direct_messages"
+	sidebarCategoryFavorites      = "favorites"
+
+	websocketEventSidebarCategoryCreated      = "sidebar_category_created"
+	websocketEventSidebarCategoryUpdated      = "sidebar_category_updated"
+	websocketEventSidebarCategoryOrderUpdated = "sidebar_category_order_updated"
+)
+
+// sidebarCategory is the wire format of a sidebar category along with its channels.
+type sidebarCategory struct {
+	Id          string   `json:"id"`
+	UserId      string   `json:"user_id"`
+	TeamId      string   `json:"team_id"`
+	SortOrder   int64    `json:"sort_order"`
+	Type        string   `json:"type"`
+	DisplayName string   `json:"display_name"`
+	Muted       bool     `json:"muted"`
+	Collapsed   bool     `json:"collapsed"`
+	Channels    []string `json:"channel_ids"`
+}
+
+type orderedSidebarCategories struct {
+	Categories []*sidebarCategory `json:"categories"`
+	Order      []string           `json:"order"`
+}
+
+// sidebar is a user's sidebar categories in a team.
+type sidebar struct {
+	categories map[string]*sidebarCategory
+	order      []string
+}
+
+func (s *Server) initSidebarRoutes() {
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/teams/{team_id}/channels/categories", true, getSidebarCategories)
+	s.handle(http.MethodPost, "/api/v4/users/{user_id}/teams/{team_id}/channels/categories", true, createSidebarCategory)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/teams/{team_id}/channels/categories", true, updateSidebarCategories)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/teams/{team_id}/channels/categories/order", true, updateSidebarCategoryOrder)
+}
+
+// inSidebar returns whether the channel belongs in the user's sidebar in the team.
+func (st *store) inSidebar(userId, teamId, channelId string) bool {
+	channel := st.channels[channelId]
+	if channel == nil || channel.DeleteAt != 0 || !st.isChannelMember(channelId, userId) {
+		return false
+	}
+
+	return channel.TeamId == teamId || channel.Type == model.CHANNEL_DIRECT || channel.Type == model.CHANNEL_GROUP
+}
+
+// sidebar returns the user's sidebar categories in the team, creating the default categories if
+// necessary. Channels the user has left are removed from the categories, and channels the user
+// has joined since are added to the channels or direct messages category.
+func (st *store) sidebar(userId, teamId string) *sidebar {
+	if st.sidebars[userId] == nil {
+		st.sidebars[userId] = make(map[string]*sidebar)
+	}
+
+	sb := st.sidebars[userId][teamId]
+	if sb == nil {
+		sb = &sidebar{categories: make(map[string]*sidebarCategory)}
+		for _, category := range []struct{ categoryType, displayName string }{
+			{sidebarCategoryFavorites, "Favorites"},
+			{sidebarCategoryChannels, "Channels"},
+			{sidebarCategoryDirectMessages, "Direct Messages"},
+		} {
+			id := model.NewId()
+			sb.categories[id] = &sidebarCategory{
+				Id:          id,
+				UserId:      userId,
+				TeamId:      teamId,
+				Type:        category.categoryType,
+				DisplayName: category.displayName,
+				Channels:    []string{},
+			}
+			sb.order = append(sb.order, id)
+		}
+		st.sidebars[userId][teamId] = sb
+	}
+
+	categorized := make(map[string]bool)
+	for _, category := range sb.categories {
+		channelIds := []string{}
+		for _, channelId := range category.Channels {
+			if st.inSidebar(userId, teamId, channelId) && !categorized[channelId] {
+				channelIds = append(channelIds, channelId)
+				categorized[channelId] = true
+			}
+		}
+		category.Channels = channelIds
+	}
+
+	uncategorized := []*model.Channel{}
+	for channelId, members := range st.channelMembers {
+		if _, ok := members[userId]; ok && !categorized[channelId] && st.inSidebar(userId, teamId, channelId) {
+			uncategorized = append(uncategorized, st.channels[channelId])
+		}
+	}
+	sort.Slice(uncategorized, func(i, j int) bool { return uncategorized[i].Name < uncategorized[j].Name })
+	for _, channel := range uncategorized {
+		categoryType := sidebarCategoryChannels
+		if channel.Type == model.CHANNEL_DIRECT || channel.Type == model.CHANNEL_GROUP {
+			categoryType = sidebarCategoryDirectMessages
+		}
+		for _, category := range sb.categories {
+			if category.Type == categoryType {
+				category.Channels = append(category.Channels, channel.Id)
+				break
+			}
+		}
+	}
+
+	return sb
+}
+
+// ordered returns copies of the categories in order.
+func (sb *sidebar) ordered() *orderedSidebarCategories {
+	ordered := &orderedSidebarCategories{
+		Categories: make([]*sidebarCategory, 0, len(sb.order)),
+		Order:      append([]string{}, sb.order...),
+	}
+	for i, id := range sb.order {
+		category := *sb.categories[id]
+		category.SortOrder = int64(i * 10)
+		category.Channels = append([]string{}, category.Channels...)
+		ordered.Categories = append(ordered.Categories, &category)
+	}
+
+	return ordered
+}
+
+// moveChannels removes the given channels from every category but the one they are moved to.
+func (sb *sidebar) moveChannels(categoryId string, channelIds []string) {
+	moved := make(map[string]bool, len(channelIds))
+	for _, channelId := range channelIds {
+		moved[channelId] = true
+	}
+
+	for id, category := range sb.categories {
+		if id == categoryId {
+			continue
+		}
+		channelIds := []string{}
+		for _, channelId := range category.Channels {
+			if !moved[channelId] {
+				channelIds = append(channelIds, channelId)
+			}
+		}
+		category.Channels = channelIds
+	}
+}
+
+// sidebarAccess checks that the user is changing their own sidebar in a team they belong to.
+func sidebarAccess(c *context, where string) bool {
+	if c.param("user_id") != c.userId {
+		c.writeError(where, http.StatusForbidden, "cannot access another user's sidebar")
+		return false
+	}
+	if member := c.s.store.teamMembers[c.param("team_id")][c.userId]; member == nil || member.DeleteAt != 0 {
+		c.notFound(where, "team member")
+		return false
+	}
+
+	return true
+}
+
+func getSidebarCategories(c *context) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if !sidebarAccess(c, "getSidebarCategories") {
+		return
+	}
+
+	c.writeJSON(http.StatusOK, c.s.store.sidebar(c.userId, c.param("team_id")).ordered())
+}
+
+func createSidebarCategory(c *context) {
+	var category sidebarCategory
+	if !c.decode(&category) {
+		return
+	}
+	if category.Type == "" {
+		category.Type = sidebarCategoryCustom
+	}
+	if category.Type != sidebarCategoryCustom || category.DisplayName == "" {
+		c.writeError("createSidebarCategory", http.StatusBadRequest, "only custom categories with a name can be created")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	if !sidebarAccess(c, "createSidebarCategory") {
+		c.s.store.mu.Unlock()
+		return
+	}
+	teamId := c.param("team_id")
+	sb := c.s.store.sidebar(c.userId, teamId)
+	for _, channelId := range category.Channels {
+		if !c.s.store.inSidebar(c.userId, teamId, channelId) {
+			c.s.store.mu.Unlock()
+			c.writeError("createSidebarCategory", http.StatusBadRequest, "channel "+channelId+" cannot be in the sidebar")
+			return
+		}
+	}
+
+	category.Id = model.NewId()
+	category.UserId = c.userId
+	category.TeamId = teamId
+	if category.Channels == nil {
+		category.Channels = []string{}
+	}
+	sb.moveChannels(category.Id, category.Channels)
+	stored := category
+	stored.Channels = append([]string{}, category.Channels...)
+	sb.categories[category.Id] = &stored
+	// New categories are shown first.
+	sb.order = append([]string{category.Id}, sb.order...)
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(websocketEventSidebarCategoryCreated, teamId, "", c.userId, nil)
+	event.Add("category_id", category.Id)
+	c.s.hub.broadcast(event)
+
+	c.writeJSON(http.StatusCreated, &category)
+}
+
+// updateSidebarCategories replaces the given categories, moving their channels out of the user's
+// other categories.
+func updateSidebarCategories(c *context) {
+	var categories []*sidebarCategory
+	if !c.decode(&categories) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	if !sidebarAccess(c, "updateSidebarCategories") {
+		c.s.store.mu.Unlock()
+		return
+	}
+	teamId := c.param("team_id")
+	sb := c.s.store.sidebar(c.userId, teamId)
+	for _, category := range categories {
+		stored := sb.categories[category.Id]
+		if stored == nil {
+			c.s.store.mu.Unlock()
+			c.notFound("updateSidebarCategories", "sidebar category")
+			return
+		}
+		if category.Type != stored.Type {
+			c.s.store.mu.Unlock()
+			c.writeError("updateSidebarCategories", http.StatusBadRequest, "cannot change the type of a category")
+			return
+		}
+		for _, channelId := range category.Channels {
+			if !c.s.store.inSidebar(c.userId, teamId, channelId) {
+				c.s.store.mu.Unlock()
+				c.writeError("updateSidebarCategories", http.StatusBadRequest, "channel "+channelId+" cannot be in the sidebar")
+				return
+			}
+		}
+	}
+
+	updated := make([]*sidebarCategory, 0, len(categories))
+	for _, category := range categories {
+		stored := sb.categories[category.Id]
+		if category.Channels == nil {
+			category.Channels = []string{}
+		}
+		sb.moveChannels(stored.Id, category.Channels)
+		stored.Channels = append([]string{}, category.Channels...)
+		stored.Muted = category.Muted
+		stored.Collapsed = category.Collapsed
+		if stored.Type == sidebarCategoryCustom && category.DisplayName != "" {
+			stored.DisplayName = category.DisplayName
+		}
+
+		copied := *stored
+		copied.Channels = append([]string{}, stored.Channels...)
+		updated = append(updated, &copied)
+	}
+	c.s.store.mu.Unlock()
+
+	data, _ := json.Marshal(updated)
+	event := model.NewWebSocketEvent(websocketEventSidebarCategoryUpdated, teamId, "", c.userId, nil)
+	event.Add("updatedCategories", string(data))
+	c.s.hub.broadcast(event)
+
+	c.writeJSON(http.StatusOK, updated)
+}
+
+// updateSidebarCategoryOrder sets the order of the user's categories, which must list each of
+// them once.
+func updateSidebarCategoryOrder(c *context) {
+	order := model.ArrayFromJson(c.r.Body)
+
+	c.s.store.mu.Lock()
+	if !sidebarAccess(c, "updateSidebarCategoryOrder") {
+		c.s.store.mu.Unlock()
+		return
+	}
+	teamId := c.param("team_id")
+	sb := c.s.store.sidebar(c.userId, teamId)
+	seen := make(map[string]bool, len(order))
+	for _, id := range order {
+		if sb.categories[id] == nil || seen[id] {
+			seen = nil
+			break
+		}
+		seen[id] = true
+	}
+	if seen == nil || len(order) != len(sb.order) {
+		c.s.store.mu.Unlock()
+		c.writeError("updateSidebarCategoryOrder", http.StatusBadRequest, "order must list every category once")
+		return
+	}
+	sb.order = append([]string{}, order...)
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(websocketEventSidebarCategoryOrderUpdated, teamId, "", c.userId, nil)
+	event.Add("order", order)
+	c.s.hub.broadcast(event)
+
+	c.writeJSON(http.StatusOK, order)
+}
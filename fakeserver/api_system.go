@@ -0,0 +1,261 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func (s *Server) initSystemRoutes() {
+	s.handle(http.MethodGet, "/api/v4/system/ping", false, getPing)
+	s.handle(http.MethodGet, "/api/v4/websocket", false, connectWebSocket)
+
+	s.handle(http.MethodGet, "/api/v4/config", true, getConfig)
+	s.handle(http.MethodPut, "/api/v4/config", true, updateConfig)
+	s.handle(http.MethodPost, "/api/v4/caches/invalidate", true, invalidateCaches)
+
+	s.handle(http.MethodGet, "/api/v4/roles/name/{role_name}", true, getRoleByName)
+	s.handle(http.MethodPut, "/api/v4/roles/{role_id}/patch", true, patchRole)
+	s.handle(http.MethodGet, "/api/v4/schemes", true, getSchemes)
+
+	s.handle(http.MethodGet, "/api/v4/plugins", true, getPlugins)
+	s.handle(http.MethodPost, "/api/v4/plugins", true, uploadPlugin)
+	s.handle(http.MethodGet, "/api/v4/plugins/webapp", true, getWebappPlugins)
+	s.handle(http.MethodDelete, "/api/v4/plugins/{plugin_id}", true, removePlugin)
+	s.handle(http.MethodPost, "/api/v4/plugins/{plugin_id}/enable", true, enablePlugin)
+}
+
+func getPing(c *context) {
+	c.writeOK()
+}
+
+func connectWebSocket(c *context) {
+	c.s.hub.serve(c)
+}
+
+func getConfig(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	c.writeJSON(http.StatusOK, c.s.store.config)
+}
+
+func updateConfig(c *context) {
+	config := model.ConfigFromJson(c.r.Body)
+	if config == nil {
+		c.writeError("updateConfig", http.StatusBadRequest, "invalid config")
+		return
+	}
+	config.SetDefaults()
+
+	c.s.store.mu.Lock()
+	c.s.store.config = config
+	c.s.store.mu.Unlock()
+
+	c.writeJSON(http.StatusOK, config)
+}
+
+func invalidateCaches(c *context) {
+	c.writeOK()
+}
+
+func getRoleByName(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	role := c.s.store.roles[c.param("role_name")]
+	if role == nil {
+		c.notFound("getRoleByName", "role")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, role)
+}
+
+func patchRole(c *context) {
+	var patch model.RolePatch
+	if !c.decode(&patch) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	if !c.s.store.isSystemAdmin(c.userId) {
+		c.s.store.mu.Unlock()
+		c.writeError("patchRole", http.StatusForbidden, "only system admins may patch roles")
+		return
+	}
+	var patched *model.Role
+	for _, role := range c.s.store.roles {
+		if role.Id == c.param("role_id") {
+			role.Patch(&patch)
+			role.UpdateAt = model.GetMillis()
+			copied := *role
+			patched = &copied
+			break
+		}
+	}
+	c.s.store.mu.Unlock()
+
+	if patched == nil {
+		c.notFound("patchRole", "role")
+		return
+	}
+
+	// Every user is told, so that their clients reload the role's permissions.
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_ROLE_UPDATED, "", "", "", nil)
+	event.Add("role", patched.ToJson())
+	c.s.hub.broadcast(event)
+
+	c.writeJSON(http.StatusOK, patched)
+}
+
+// getSchemes lists the permission schemes of the given scope, or of any scope, to system admins.
+func getSchemes(c *context) {
+	page, perPage := c.pageParams(60)
+	scope := c.r.URL.Query().Get("scope")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	if !c.s.store.isSystemAdmin(c.userId) {
+		c.writeError("getSchemes", http.StatusForbidden, "only system admins may list schemes")
+		return
+	}
+
+	schemes := []*model.Scheme{}
+	for _, scheme := range c.s.store.schemes {
+		if scheme.DeleteAt == 0 && (scope == "" || scheme.Scope == scope) {
+			schemes = append(schemes, scheme)
+		}
+	}
+	sort.Slice(schemes, func(i, j int) bool { return schemes[i].Name < schemes[j].Name })
+
+	start, end := paginate(len(schemes), page, perPage)
+	c.writeJSON(http.StatusOK, schemes[start:end])
+}
+
+func pluginsResponse(st *store) *model.PluginsResponse {
+	response := &model.PluginsResponse{
+		Active:   []*model.PluginInfo{},
+		Inactive: []*model.PluginInfo{},
+	}
+
+	for _, plugin := range st.plugins {
+		info := &model.PluginInfo{Manifest: *plugin.manifest}
+		if plugin.active {
+			response.Active = append(response.Active, info)
+		} else {
+			response.Inactive = append(response.Inactive, info)
+		}
+	}
+
+	sort.Slice(response.Active, func(i, j int) bool { return response.Active[i].Id < response.Active[j].Id })
+	sort.Slice(response.Inactive, func(i, j int) bool { return response.Inactive[i].Id < response.Inactive[j].Id })
+
+	return response
+}
+
+func getPlugins(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	c.writeJSON(http.StatusOK, pluginsResponse(c.s.store))
+}
+
+func getWebappPlugins(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	manifests := []*model.Manifest{}
+	for _, plugin := range c.s.store.plugins {
+		if plugin.active && plugin.manifest.HasWebapp() {
+			manifests = append(manifests, plugin.manifest.ClientManifest())
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Id < manifests[j].Id })
+
+	c.writeJSON(http.StatusOK, manifests)
+}
+
+// readPluginManifest finds and parses the plugin.json at the root of a gzipped plugin bundle.
+func readPluginManifest(bundle io.Reader) *model.Manifest {
+	gzipReader, err := gzip.NewReader(bundle)
+	if err != nil {
+		return nil
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			return nil
+		}
+
+		// Bundles usually wrap their contents in a single top level directory.
+		if name := path.Clean(header.Name); name == "plugin.json" || path.Base(name) == "plugin.json" && path.Dir(path.Dir(name)) == "." {
+			return model.ManifestFromJson(tarReader)
+		}
+	}
+}
+
+func uploadPlugin(c *context) {
+	file, _, err := c.r.FormFile("plugin")
+	if err != nil {
+		c.writeError("uploadPlugin", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	manifest := readPluginManifest(file)
+	if manifest == nil || manifest.Id == "" {
+		c.writeError("uploadPlugin", http.StatusBadRequest, "plugin bundle has no valid manifest")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if _, ok := c.s.store.plugins[manifest.Id]; ok && c.r.FormValue("force") != "true" {
+		c.writeError("uploadPlugin", http.StatusBadRequest, "plugin already installed")
+		return
+	}
+	c.s.store.plugins[manifest.Id] = &pluginState{manifest: manifest}
+
+	c.writeJSON(http.StatusCreated, manifest)
+}
+
+func removePlugin(c *context) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if _, ok := c.s.store.plugins[c.param("plugin_id")]; !ok {
+		c.notFound("removePlugin", "plugin")
+		return
+	}
+	delete(c.s.store.plugins, c.param("plugin_id"))
+
+	c.writeOK()
+}
+
+func enablePlugin(c *context) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	plugin := c.s.store.plugins[c.param("plugin_id")]
+	if plugin == nil {
+		c.notFound("enablePlugin", "plugin")
+		return
+	}
+	plugin.active = true
+
+	c.writeOK()
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"image"
+	_ "image/png"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func (s *Server) initTeamRoutes() {
+	s.handle(http.MethodGet, "/api/v4/teams", true, getAllTeams)
+	s.handle(http.MethodPost, "/api/v4/teams", true, createTeam)
+	s.handle(http.MethodPost, "/api/v4/teams/members/invite", true, addTeamMemberFromInvite)
+	s.handle(http.MethodGet, "/api/v4/teams/invite/{invite_id}", false, getTeamInviteInfo)
+	s.handle(http.MethodGet, "/api/v4/teams/{team_id}", true, getTeam)
+	s.handle(http.MethodDelete, "/api/v4/teams/{team_id}", true, softDeleteTeam)
+	s.handle(http.MethodPut, "/api/v4/teams/{team_id}/patch", true, patchTeam)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/regenerate_invite_id", true, regenerateTeamInviteId)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/image", true, setTeamIcon)
+	s.handle(http.MethodPut, "/api/v4/teams/{team_id}/scheme", true, updateTeamScheme)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/invite/email", true, inviteUsersToTeam)
+	s.handle(http.MethodGet, "/api/v4/teams/{team_id}/members", true, getTeamMembers)
+	s.handle(http.MethodPost, "/api/v4/teams/{team_id}/members", true, addTeamMember)
+	s.handle(http.MethodGet, "/api/v4/teams/{team_id}/members/{user_id}", true, getTeamMember)
+	s.handle(http.MethodDelete, "/api/v4/teams/{team_id}/members/{user_id}", true, removeTeamMember)
+}
+
+func getAllTeams(c *context) {
+	page, perPage := c.pageParams(60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	teams := make([]*model.Team, 0, len(c.s.store.teams))
+	for _, team := range c.s.store.teams {
+		if team.DeleteAt == 0 {
+			teams = append(teams, team)
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+
+	start, end := paginate(len(teams), page, perPage)
+	c.writeJSON(http.StatusOK, teams[start:end])
+}
+
+func getTeam(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	team := c.s.store.teams[c.param("team_id")]
+	if team == nil {
+		c.notFound("getTeam", "team")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, team)
+}
+
+// canManageTeam returns whether the user is a system admin or an admin of the team.
+func (st *store) canManageTeam(teamId, userId string) bool {
+	if st.isSystemAdmin(userId) {
+		return true
+	}
+
+	member := st.teamMembers[teamId][userId]
+	return member != nil && member.DeleteAt == 0 && member.SchemeAdmin
+}
+
+// createTeam adds a team along with its default channels, making the user creating it its admin.
+func createTeam(c *context) {
+	var team model.Team
+	if !c.decode(&team) {
+		return
+	}
+	team.Id = ""
+	team.InviteId = ""
+	team.PreSave()
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	// The team's email is that of the user creating it.
+	team.Email = c.s.store.users[c.userId].Email
+	if appErr := team.IsValid(); appErr != nil {
+		c.writeError("createTeam", http.StatusBadRequest, appErr.Error())
+		return
+	}
+	for _, existing := range c.s.store.teams {
+		if existing.Name == team.Name {
+			c.writeError("createTeam", http.StatusBadRequest, "a team with that name already exists")
+			return
+		}
+	}
+
+	c.s.store.teams[team.Id] = &team
+	c.s.store.teamMembers[team.Id] = make(map[string]*model.TeamMember)
+	for _, channel := range []*model.Channel{
+		{Name: model.DEFAULT_CHANNEL, DisplayName: "Town Square"},
+		{Name: "off-topic", DisplayName: "Off-Topic"},
+	} {
+		channel.TeamId = team.Id
+		channel.Type = model.CHANNEL_OPEN
+		c.s.store.createChannel(channel)
+	}
+	member := c.s.store.addTeamMember(team.Id, c.userId)
+	member.Roles = model.TEAM_USER_ROLE_ID + " " + model.TEAM_ADMIN_ROLE_ID
+	member.SchemeAdmin = true
+
+	copied := team
+	c.writeJSON(http.StatusCreated, &copied)
+}
+
+// updateTeam replaces a team the user may manage with an updated copy, since the stored team may
+// be being written out concurrently, and tells everyone of the change. It returns the updated
+// team, or nil having written out the error.
+func (c *context) updateTeam(where string, update func(team *model.Team) *model.AppError) *model.Team {
+	c.s.store.mu.Lock()
+	stored := c.s.store.teams[c.param("team_id")]
+	if stored == nil || stored.DeleteAt != 0 {
+		c.s.store.mu.Unlock()
+		c.notFound(where, "team")
+		return nil
+	}
+	if !c.s.store.canManageTeam(stored.Id, c.userId) {
+		c.s.store.mu.Unlock()
+		c.writeError(where, http.StatusForbidden, "not an admin of the team")
+		return nil
+	}
+
+	team := *stored
+	if appErr := update(&team); appErr != nil {
+		c.s.store.mu.Unlock()
+		c.writeError(where, appErr.StatusCode, appErr.DetailedError)
+		return nil
+	}
+	team.UpdateAt = model.GetMillis()
+	c.s.store.teams[team.Id] = &team
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_UPDATE_TEAM, team.Id, "", "", nil)
+	event.Add("team", team.ToJson())
+	c.s.hub.broadcast(event)
+
+	return &team
+}
+
+func patchTeam(c *context) {
+	var patch model.TeamPatch
+	if !c.decode(&patch) {
+		return
+	}
+
+	team := c.updateTeam("patchTeam", func(team *model.Team) *model.AppError {
+		team.Patch(&patch)
+		if appErr := team.IsValid(); appErr != nil {
+			return model.NewAppError("patchTeam", "fakeserver.app_error", nil, appErr.Error(), http.StatusBadRequest)
+		}
+		return nil
+	})
+	if team != nil {
+		c.writeJSON(http.StatusOK, team)
+	}
+}
+
+func regenerateTeamInviteId(c *context) {
+	team := c.updateTeam("regenerateTeamInviteId", func(team *model.Team) *model.AppError {
+		team.InviteId = model.NewId()
+		return nil
+	})
+	if team != nil {
+		c.writeJSON(http.StatusOK, team)
+	}
+}
+
+// setTeamIcon checks that the uploaded icon is an image, which is not kept.
+func setTeamIcon(c *context) {
+	file, _, err := c.r.FormFile("image")
+	if err != nil {
+		c.writeError("setTeamIcon", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+	if _, _, err := image.DecodeConfig(file); err != nil {
+		c.writeError("setTeamIcon", http.StatusBadRequest, "the icon is not an image: "+err.Error())
+		return
+	}
+
+	team := c.updateTeam("setTeamIcon", func(team *model.Team) *model.AppError {
+		team.LastTeamIconUpdate = model.GetMillis()
+		return nil
+	})
+	if team != nil {
+		c.writeOK()
+	}
+}
+
+// updateTeamScheme sets the permission scheme of the team, or returns it to the default scheme.
+func updateTeamScheme(c *context) {
+	var patch model.SchemeIDPatch
+	if !c.decode(&patch) || patch.SchemeID == nil {
+		c.writeError("updateTeamScheme", http.StatusBadRequest, "invalid scheme id")
+		return
+	}
+
+	team := c.updateTeam("updateTeamScheme", func(team *model.Team) *model.AppError {
+		if appErr := c.s.store.checkScheme(*patch.SchemeID, model.SCHEME_SCOPE_TEAM, c.userId); appErr != nil {
+			return appErr
+		}
+		team.SchemeId = patch.SchemeID
+		return nil
+	})
+	if team != nil {
+		c.writeOK()
+	}
+}
+
+// softDeleteTeam archives a team the user may manage.
+func softDeleteTeam(c *context) {
+	teamId := c.param("team_id")
+
+	c.s.store.mu.Lock()
+	stored := c.s.store.teams[teamId]
+	if stored == nil || stored.DeleteAt != 0 {
+		c.s.store.mu.Unlock()
+		c.notFound("softDeleteTeam", "team")
+		return
+	}
+	if !c.s.store.canManageTeam(teamId, c.userId) {
+		c.s.store.mu.Unlock()
+		c.writeError("softDeleteTeam", http.StatusForbidden, "not an admin of the team")
+		return
+	}
+	team := *stored
+	team.DeleteAt = model.GetMillis()
+	team.UpdateAt = team.DeleteAt
+	c.s.store.teams[teamId] = &team
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_DELETE_TEAM, teamId, "", "", nil)
+	event.Add("team", team.ToJson())
+	c.s.hub.broadcast(event)
+
+	c.writeOK()
+}
+
+// getTeamInviteInfo describes the team an invite link is for, to anyone holding the link.
+func getTeamInviteInfo(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	team := c.s.store.teamByInviteId(c.param("invite_id"))
+	if team == nil || team.DeleteAt != 0 {
+		c.notFound("getTeamInviteInfo", "team")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, &model.Team{
+		Id:          team.Id,
+		Name:        team.Name,
+		DisplayName: team.DisplayName,
+		Description: team.Description,
+	})
+}
+
+// inviteUsersToTeam accepts email invitations to a team the user belongs to. No mail is sent.
+func inviteUsersToTeam(c *context) {
+	emails := model.ArrayFromJson(c.r.Body)
+	if len(emails) == 0 {
+		c.writeError("inviteUsersToTeam", http.StatusBadRequest, "no one to invite")
+		return
+	}
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	if !*c.s.store.config.ServiceSettings.EnableEmailInvitations {
+		c.writeError("inviteUsersToTeam", http.StatusNotImplemented, "email invitations are disabled")
+		return
+	}
+	team := c.s.store.teams[c.param("team_id")]
+	member := c.s.store.teamMembers[c.param("team_id")][c.userId]
+	if team == nil || team.DeleteAt != 0 || member == nil || member.DeleteAt != 0 {
+		c.notFound("inviteUsersToTeam", "team member")
+		return
+	}
+	for _, email := range emails {
+		if !model.IsValidEmail(email) {
+			c.writeError("inviteUsersToTeam", http.StatusBadRequest, "invalid email "+email)
+			return
+		}
+	}
+
+	c.writeOK()
+}
+
+func getTeamMembers(c *context) {
+	page, perPage := c.pageParams(60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	members := []*model.TeamMember{}
+	for _, member := range c.s.store.teamMembers[c.param("team_id")] {
+		if member.DeleteAt == 0 {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserId < members[j].UserId })
+
+	start, end := paginate(len(members), page, perPage)
+	c.writeJSON(http.StatusOK, members[start:end])
+}
+
+func getTeamMember(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	member := c.s.store.teamMembers[c.param("team_id")][c.param("user_id")]
+	if member == nil || member.DeleteAt != 0 {
+		c.notFound("getTeamMember", "team member")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, member)
+}
+
+func addTeamMember(c *context) {
+	var member model.TeamMember
+	if !c.decode(&member) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if c.s.store.teams[c.param("team_id")] == nil || c.s.store.users[member.UserId] == nil {
+		c.notFound("addTeamMember", "team or user")
+		return
+	}
+
+	c.writeJSON(http.StatusCreated, c.s.store.addTeamMember(c.param("team_id"), member.UserId))
+}
+
+func addTeamMemberFromInvite(c *context) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	team := c.s.store.teamByInviteId(c.r.URL.Query().Get("invite_id"))
+	if team == nil {
+		c.notFound("addTeamMemberFromInvite", "team")
+		return
+	}
+
+	c.writeJSON(http.StatusCreated, c.s.store.addTeamMember(team.Id, c.userId))
+}
+
+func removeTeamMember(c *context) {
+	teamId := c.param("team_id")
+	userId := c.param("user_id")
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	member := c.s.store.teamMembers[teamId][userId]
+	if member == nil || member.DeleteAt != 0 {
+		c.notFound("removeTeamMember", "team member")
+		return
+	}
+	member.DeleteAt = model.GetMillis()
+
+	// Leaving a team also leaves all of its channels.
+	for channelId, members := range c.s.store.channelMembers {
+		if channel := c.s.store.channels[channelId]; channel != nil && channel.TeamId == teamId {
+			delete(members, userId)
+		}
+	}
+
+	c.writeOK()
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// threadMembership is a user's view of a collapsed reply thread.
+type threadMembership struct {
+	following    bool
+	lastViewedAt int64
+}
+
+// threadResponse and threadsResponse are the wire format of the collapsed reply threads API,
+// which is newer than the model package.
+type threadResponse struct {
+	PostId         string `json:"id"`
+	ReplyCount     int64  `json:"reply_count"`
+	LastReplyAt    int64  `json:"last_reply_at"`
+	LastViewedAt   int64  `json:"last_viewed_at"`
+	UnreadReplies  int64  `json:"unread_replies"`
+	UnreadMentions int64  `json:"unread_mentions"`
+}
+
+type threadsResponse struct {
+	Total               int64             `json:"total"`
+	TotalUnreadMentions int64             `json:"total_unread_mentions"`
+	Threads             []*threadResponse `json:"threads"`
+}
+
+func (s *Server) initThreadRoutes() {
+	s.handle(http.MethodGet, "/api/v4/posts/{post_id}/thread", true, getPostThread)
+
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/teams/{team_id}/threads", true, getUserThreads)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/teams/{team_id}/threads/{thread_id}/following", true, followThread)
+	s.handle(http.MethodDelete, "/api/v4/users/{user_id}/teams/{team_id}/threads/{thread_id}/following", true, unfollowThread)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/teams/{team_id}/threads/{thread_id}/read/{timestamp}", true, updateThreadRead)
+}
+
+// threadMembership returns the user's membership of the thread, creating it if necessary.
+func (st *store) threadMembership(userId, rootId string) *threadMembership {
+	if st.threadMemberships[userId] == nil {
+		st.threadMemberships[userId] = make(map[string]*threadMembership)
+	}
+
+	membership := st.threadMemberships[userId][rootId]
+	if membership == nil {
+		membership = &threadMembership{}
+		st.threadMemberships[userId][rootId] = membership
+	}
+
+	return membership
+}
+
+// threadPostIds returns the ids of the root post and replies of a thread, oldest first.
+func (st *store) threadPostIds(root *model.Post) []string {
+	postIds := []string{root.Id}
+	for _, postId := range st.channelPosts[root.ChannelId] {
+		if post := st.posts[postId]; post.RootId == root.Id && post.DeleteAt == 0 {
+			postIds = append(postIds, postId)
+		}
+	}
+
+	return postIds
+}
+
+// thread summarizes a thread as seen by the given user.
+func (st *store) thread(userId string, root *model.Post) *threadResponse {
+	thread := &threadResponse{
+		PostId:       root.Id,
+		LastReplyAt:  root.CreateAt,
+		LastViewedAt: st.threadMembership(userId, root.Id).lastViewedAt,
+	}
+
+	for _, postId := range st.threadPostIds(root)[1:] {
+		post := st.posts[postId]
+		thread.ReplyCount++
+		if post.CreateAt > thread.LastReplyAt {
+			thread.LastReplyAt = post.CreateAt
+		}
+		if post.CreateAt > thread.LastViewedAt && post.UserId != userId {
+			thread.UnreadReplies++
+		}
+	}
+
+	return thread
+}
+
+// followThreadOnReply has the author of a reply, and of the post replied to, follow its thread.
+func (st *store) followThreadOnReply(reply *model.Post) {
+	if reply.RootId == "" {
+		return
+	}
+
+	st.threadMembership(reply.UserId, reply.RootId).following = true
+	if root := st.posts[reply.RootId]; root != nil {
+		st.threadMembership(root.UserId, root.Id).following = true
+	}
+}
+
+func getPostThread(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	post := c.s.store.posts[c.param("post_id")]
+	if post == nil || post.DeleteAt != 0 || !c.s.store.isChannelMember(post.ChannelId, c.userId) {
+		c.notFound("getPostThread", "post")
+		return
+	}
+	if post.RootId != "" {
+		post = c.s.store.posts[post.RootId]
+		if post == nil {
+			c.notFound("getPostThread", "root post")
+			return
+		}
+	}
+
+	c.writeJSON(http.StatusOK, c.s.store.postList(c.s.store.threadPostIds(post)))
+}
+
+func getUserThreads(c *context) {
+	page, perPage := c.pageParams(25)
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	var threads []*threadResponse
+	for rootId, membership := range c.s.store.threadMemberships[c.param("user_id")] {
+		root := c.s.store.posts[rootId]
+		if !membership.following || root == nil || root.DeleteAt != 0 {
+			continue
+		}
+		if channel := c.s.store.channels[root.ChannelId]; channel == nil || (channel.TeamId != "" && channel.TeamId != c.param("team_id")) {
+			continue
+		}
+
+		threads = append(threads, c.s.store.thread(c.param("user_id"), root))
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].LastReplyAt > threads[j].LastReplyAt
+	})
+
+	response := &threadsResponse{
+		Total:   int64(len(threads)),
+		Threads: []*threadResponse{},
+	}
+	start, end := paginate(len(threads), page, perPage)
+	response.Threads = append(response.Threads, threads[start:end]...)
+
+	c.writeJSON(http.StatusOK, response)
+}
+
+func setThreadFollowing(c *context, where string, following bool) {
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	root := c.s.store.posts[c.param("thread_id")]
+	if root == nil || root.RootId != "" {
+		c.notFound(where, "thread")
+		return
+	}
+
+	c.s.store.threadMembership(c.param("user_id"), root.Id).following = following
+	c.writeOK()
+}
+
+func followThread(c *context) {
+	setThreadFollowing(c, "followThread", true)
+}
+
+func unfollowThread(c *context) {
+	setThreadFollowing(c, "unfollowThread", false)
+}
+
+func updateThreadRead(c *context) {
+	timestamp, err := strconv.ParseInt(c.param("timestamp"), 10, 64)
+	if err != nil {
+		c.writeError("updateThreadRead", http.StatusBadRequest, "invalid timestamp")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	root := c.s.store.posts[c.param("thread_id")]
+	if root == nil || root.RootId != "" {
+		c.notFound("updateThreadRead", "thread")
+		return
+	}
+
+	c.s.store.threadMembership(c.param("user_id"), root.Id).lastViewedAt = timestamp
+	c.writeJSON(http.StatusOK, c.s.store.thread(c.param("user_id"), root))
+}
@@ -0,0 +1,702 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+func (s *Server) initUserRoutes() {
+	s.handle(http.MethodPost, "/api/v4/users/login", false, login)
+	s.handle(http.MethodPost, "/api/v4/users/logout", true, logout)
+
+	s.handle(http.MethodGet, "/api/v4/users", true, getUsers)
+	s.handle(http.MethodPost, "/api/v4/users/ids", true, getUsersByIds)
+	s.handle(http.MethodPost, "/api/v4/users/usernames", true, getUsersByUsernames)
+	s.handle(http.MethodPost, "/api/v4/users/search", true, searchUsers)
+	s.handle(http.MethodPost, "/api/v4/users/status/ids", true, getUserStatusesByIds)
+	s.handle(http.MethodGet, "/api/v4/users/email/{email}", true, getUserByEmail)
+	s.handle(http.MethodGet, "/api/v4/users/username/{username}", true, getUserByUsername)
+
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}", true, getUser)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}", true, updateUser)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/patch", true, patchUser)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/active", true, updateUserActive)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/status", true, updateUserStatus)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/status/custom", true, updateUserCustomStatus)
+	s.handle(http.MethodDelete, "/api/v4/users/{user_id}/status/custom", true, removeUserCustomStatus)
+	s.handle(http.MethodPost, "/api/v4/users/{user_id}/image", true, setProfileImage)
+	s.handle(http.MethodPost, "/api/v4/users/{user_id}/tokens", true, createUserAccessToken)
+	s.handle(http.MethodPost, "/api/v4/users/tokens/revoke", true, revokeUserAccessToken)
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/teams", true, getTeamsForUser)
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/teams/unread", true, getTeamsUnreadForUser)
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/teams/{team_id}/channels", true, getChannelsForTeamForUser)
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/channels/{channel_id}/unread", true, getChannelUnread)
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/channels/{channel_id}/posts/unread", true, getPostsAroundLastUnread)
+
+	s.handle(http.MethodGet, "/api/v4/users/{user_id}/preferences", true, getPreferences)
+	s.handle(http.MethodPut, "/api/v4/users/{user_id}/preferences", true, updatePreferences)
+	s.handle(http.MethodPost, "/api/v4/users/{user_id}/preferences/delete", true, deletePreferences)
+}
+
+func login(c *context) {
+	props := model.MapFromJson(c.r.Body)
+
+	c.s.store.mu.RLock()
+	user := c.s.store.userByLogin(props["login_id"])
+	var password string
+	if user != nil {
+		password = c.s.store.passwords[user.Id]
+		user = sanitizeUser(user)
+	}
+	c.s.store.mu.RUnlock()
+
+	if user == nil || password != props["password"] {
+		c.writeError("login", http.StatusUnauthorized, "invalid login credentials")
+		return
+	}
+	if user.DeleteAt != 0 {
+		c.writeError("login", http.StatusUnauthorized, "user is deactivated")
+		return
+	}
+
+	token := c.s.store.createSession(user.Id)
+	http.SetCookie(c.w, &http.Cookie{Name: model.SESSION_COOKIE_TOKEN, Value: token, Path: "/", HttpOnly: true})
+	c.w.Header().Set(model.HEADER_TOKEN, token)
+
+	c.writeJSON(http.StatusOK, user)
+}
+
+func logout(c *context) {
+	c.s.store.mu.Lock()
+	delete(c.s.store.sessions, tokenFromRequest(c.r))
+	c.s.store.mu.Unlock()
+
+	c.writeOK()
+}
+
+func getUsers(c *context) {
+	page, perPage := c.pageParams(60)
+	inTeam := c.r.URL.Query().Get("in_team")
+	inChannel := c.r.URL.Query().Get("in_channel")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	users := []*model.User{}
+	for _, user := range sortedUsers(c.s.store.users) {
+		if inTeam != "" {
+			if member := c.s.store.teamMembers[inTeam][user.Id]; member == nil || member.DeleteAt != 0 {
+				continue
+			}
+		}
+		if inChannel != "" && !c.s.store.isChannelMember(inChannel, user.Id) {
+			continue
+		}
+
+		users = append(users, sanitizeUser(user))
+	}
+
+	start, end := paginate(len(users), page, perPage)
+	c.writeJSON(http.StatusOK, users[start:end])
+}
+
+func getUsersByIds(c *context) {
+	userIds := model.ArrayFromJson(c.r.Body)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	users := []*model.User{}
+	for _, userId := range userIds {
+		if user := c.s.store.users[userId]; user != nil {
+			users = append(users, sanitizeUser(user))
+		}
+	}
+
+	c.writeJSON(http.StatusOK, users)
+}
+
+func getUsersByUsernames(c *context) {
+	usernames := model.ArrayFromJson(c.r.Body)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	users := []*model.User{}
+	for _, username := range usernames {
+		if user := c.s.store.userByUsername(username); user != nil {
+			users = append(users, sanitizeUser(user))
+		}
+	}
+
+	c.writeJSON(http.StatusOK, users)
+}
+
+func searchUsers(c *context) {
+	var search model.UserSearch
+	if !c.decode(&search) {
+		return
+	}
+	if search.Limit <= 0 {
+		search.Limit = 100
+	}
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	users := []*model.User{}
+	for _, user := range sortedUsers(c.s.store.users) {
+		if len(users) >= search.Limit {
+			break
+		}
+		if user.DeleteAt != 0 && !search.AllowInactive {
+			continue
+		}
+		if search.TeamId != "" && c.s.store.teamMembers[search.TeamId][user.Id] == nil {
+			continue
+		}
+		if search.InChannelId != "" && !c.s.store.isChannelMember(search.InChannelId, user.Id) {
+			continue
+		}
+		if search.NotInChannelId != "" && c.s.store.isChannelMember(search.NotInChannelId, user.Id) {
+			continue
+		}
+		term := strings.TrimPrefix(search.Term, "@")
+		if !hasPrefixFold(user.Username, term) && !hasPrefixFold(user.FirstName, term) &&
+			!hasPrefixFold(user.LastName, term) && !hasPrefixFold(user.Nickname, term) {
+			continue
+		}
+
+		users = append(users, sanitizeUser(user))
+	}
+
+	c.writeJSON(http.StatusOK, users)
+}
+
+func getUserStatusesByIds(c *context) {
+	userIds := model.ArrayFromJson(c.r.Body)
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	statuses := []*model.Status{}
+	for _, userId := range userIds {
+		if c.s.store.users[userId] != nil {
+			status := *c.s.store.status(userId)
+			statuses = append(statuses, &status)
+		}
+	}
+
+	c.writeJSON(http.StatusOK, statuses)
+}
+
+// updateUserStatus sets the user's status and tells every connected user about the change.
+func updateUserStatus(c *context) {
+	var status model.Status
+	if !c.decode(&status) {
+		return
+	}
+	if c.param("user_id") != c.userId || status.UserId != c.userId {
+		c.writeError("updateUserStatus", http.StatusForbidden, "cannot change another user's status")
+		return
+	}
+	switch status.Status {
+	case model.STATUS_ONLINE, model.STATUS_AWAY, model.STATUS_DND, model.STATUS_OFFLINE:
+	default:
+		c.writeError("updateUserStatus", http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	stored := c.s.store.status(c.userId)
+	stored.Status = status.Status
+	stored.Manual = true
+	stored.LastActivityAt = model.GetMillis()
+	updated := *stored
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_STATUS_CHANGE, "", "", "", nil)
+	event.Add("status", updated.Status)
+	event.Add("user_id", updated.UserId)
+	c.s.hub.broadcast(event)
+
+	c.writeJSON(http.StatusOK, &updated)
+}
+
+// customStatus is the custom status of a user, kept in the user's props as in the server.
+type customStatus struct {
+	Emoji string `json:"emoji"`
+	Text  string `json:"text"`
+}
+
+const customStatusProp = "customStatus"
+
+func updateUserCustomStatus(c *context) {
+	var status customStatus
+	if !c.decode(&status) {
+		return
+	}
+	if status.Emoji == "" && status.Text == "" {
+		c.writeError("updateUserCustomStatus", http.StatusBadRequest, "custom status must have an emoji or text")
+		return
+	}
+
+	data, _ := json.Marshal(&status)
+	setCustomStatus(c, "updateUserCustomStatus", string(data))
+}
+
+func removeUserCustomStatus(c *context) {
+	setCustomStatus(c, "removeUserCustomStatus", "")
+}
+
+// setCustomStatus sets the user's custom status prop, removing it if empty, and tells every
+// connected user about the change.
+func setCustomStatus(c *context, where, value string) {
+	if c.param("user_id") != c.userId {
+		c.writeError(where, http.StatusForbidden, "cannot change another user's custom status")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	user := c.s.store.users[c.userId]
+	if user == nil {
+		c.s.store.mu.Unlock()
+		c.notFound(where, "user")
+		return
+	}
+	// The props are replaced rather than changed, since copies of the user share them.
+	props := make(model.StringMap, len(user.Props)+1)
+	for key, prop := range user.Props {
+		props[key] = prop
+	}
+	if value == "" {
+		delete(props, customStatusProp)
+	} else {
+		props[customStatusProp] = value
+	}
+	user.Props = props
+	user.UpdateAt = model.GetMillis()
+	updated := sanitizeUser(user)
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_USER_UPDATED, "", "", "", nil)
+	event.Add("user", updated)
+	c.s.hub.broadcast(event)
+
+	c.writeOK()
+}
+
+func getUserByEmail(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	for _, user := range c.s.store.users {
+		if user.Email == c.param("email") {
+			c.writeJSON(http.StatusOK, sanitizeUser(user))
+			return
+		}
+	}
+
+	c.notFound("getUserByEmail", "user")
+}
+
+func getUserByUsername(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	user := c.s.store.userByUsername(c.param("username"))
+	if user == nil {
+		c.notFound("getUserByUsername", "user")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, sanitizeUser(user))
+}
+
+// createUserAccessToken creates a personal access token, which authenticates as the user like a
+// session token until revoked.
+func createUserAccessToken(c *context) {
+	var accessToken model.UserAccessToken
+	if !c.decode(&accessToken) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	if !*c.s.store.config.ServiceSettings.EnableUserAccessTokens {
+		c.writeError("createUserAccessToken", http.StatusNotImplemented, "personal access tokens are disabled")
+		return
+	}
+	if c.s.store.users[c.param("user_id")] == nil {
+		c.notFound("createUserAccessToken", "user")
+		return
+	}
+
+	accessToken.Id = model.NewId()
+	accessToken.Token = model.NewId()
+	accessToken.UserId = c.param("user_id")
+	accessToken.IsActive = true
+	stored := accessToken
+	c.s.store.accessTokens[accessToken.Token] = &stored
+
+	c.writeJSON(http.StatusOK, &accessToken)
+}
+
+// revokeUserAccessToken deletes a personal access token, ending its use for authentication.
+func revokeUserAccessToken(c *context) {
+	var body map[string]string
+	if !c.decode(&body) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	for token, accessToken := range c.s.store.accessTokens {
+		if accessToken.Id == body["token_id"] {
+			delete(c.s.store.accessTokens, token)
+			c.writeOK()
+			return
+		}
+	}
+
+	c.notFound("revokeUserAccessToken", "access token")
+}
+
+func getUser(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	user := c.s.store.users[c.param("user_id")]
+	if user == nil {
+		c.notFound("getUser", "user")
+		return
+	}
+
+	c.writeJSON(http.StatusOK, sanitizeUser(user))
+}
+
+func updateUser(c *context) {
+	var update model.User
+	if !c.decode(&update) {
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	user := c.s.store.users[c.param("user_id")]
+	if user == nil {
+		c.notFound("updateUser", "user")
+		return
+	}
+
+	user.Username = update.Username
+	user.Email = update.Email
+	user.Nickname = update.Nickname
+	user.FirstName = update.FirstName
+	user.LastName = update.LastName
+	user.Position = update.Position
+	user.Locale = update.Locale
+	if update.Props != nil {
+		user.Props = update.Props
+	}
+	if update.NotifyProps != nil {
+		user.NotifyProps = update.NotifyProps
+	}
+	user.UpdateAt = model.GetMillis()
+
+	c.writeJSON(http.StatusOK, sanitizeUser(user))
+}
+
+func patchUser(c *context) {
+	var patch model.UserPatch
+	if !c.decode(&patch) {
+		return
+	}
+	patch.Password = nil
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	user := c.s.store.users[c.param("user_id")]
+	if user == nil {
+		c.notFound("patchUser", "user")
+		return
+	}
+
+	user.Patch(&patch)
+	user.UpdateAt = model.GetMillis()
+
+	c.writeJSON(http.StatusOK, sanitizeUser(user))
+}
+
+func updateUserActive(c *context) {
+	props := model.StringInterfaceFromJson(c.r.Body)
+	active, ok := props["active"].(bool)
+	if !ok {
+		c.writeError("updateUserActive", http.StatusBadRequest, "missing active")
+		return
+	}
+
+	c.s.store.mu.Lock()
+	user := c.s.store.users[c.param("user_id")]
+	if user != nil {
+		if active {
+			user.DeleteAt = 0
+		} else {
+			user.DeleteAt = model.GetMillis()
+		}
+		user.UpdateAt = model.GetMillis()
+	}
+	c.s.store.mu.Unlock()
+
+	if user == nil {
+		c.notFound("updateUserActive", "user")
+		return
+	}
+	if !active {
+		c.s.store.revokeSessions(user.Id)
+	}
+
+	c.writeOK()
+}
+
+func setProfileImage(c *context) {
+	file, _, err := c.r.FormFile("image")
+	if err != nil {
+		c.writeError("setProfileImage", http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(ioutil.Discard, file); err != nil {
+		c.writeError("setProfileImage", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.s.store.mu.Lock()
+	defer c.s.store.mu.Unlock()
+
+	user := c.s.store.users[c.param("user_id")]
+	if user == nil {
+		c.notFound("setProfileImage", "user")
+		return
+	}
+	user.LastPictureUpdate = model.GetMillis()
+
+	c.writeOK()
+}
+
+func getTeamsForUser(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	teams := []*model.Team{}
+	for teamId, members := range c.s.store.teamMembers {
+		if member := members[c.param("user_id")]; member != nil && member.DeleteAt == 0 {
+			teams = append(teams, c.s.store.teams[teamId])
+		}
+	}
+
+	c.writeJSON(http.StatusOK, teams)
+}
+
+// channelUnread returns the number of messages and mentions the given member has not yet seen.
+func (st *store) channelUnread(channel *model.Channel, member *model.ChannelMember) (int64, int64) {
+	msgCount := channel.TotalMsgCount - member.MsgCount
+	if msgCount < 0 {
+		msgCount = 0
+	}
+
+	return msgCount, member.MentionCount
+}
+
+func getTeamsUnreadForUser(c *context) {
+	userId := c.param("user_id")
+	excludeTeam := c.r.URL.Query().Get("exclude_team")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	unreads := []*model.TeamUnread{}
+	for teamId, members := range c.s.store.teamMembers {
+		if teamId == excludeTeam {
+			continue
+		}
+		if member := members[userId]; member == nil || member.DeleteAt != 0 {
+			continue
+		}
+
+		unread := &model.TeamUnread{TeamId: teamId}
+		for channelId, channelMembers := range c.s.store.channelMembers {
+			channel := c.s.store.channels[channelId]
+			member := channelMembers[userId]
+			if channel == nil || member == nil || channel.TeamId != teamId {
+				continue
+			}
+
+			msgCount, mentionCount := c.s.store.channelUnread(channel, member)
+			unread.MsgCount += msgCount
+			unread.MentionCount += mentionCount
+		}
+		unreads = append(unreads, unread)
+	}
+
+	c.writeJSON(http.StatusOK, unreads)
+}
+
+func getChannelsForTeamForUser(c *context) {
+	userId := c.param("user_id")
+	teamId := c.param("team_id")
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channels := []*model.Channel{}
+	for channelId, members := range c.s.store.channelMembers {
+		channel := c.s.store.channels[channelId]
+		if channel == nil || channel.DeleteAt != 0 || members[userId] == nil {
+			continue
+		}
+		// Direct and group messages belong to every team.
+		if channel.TeamId != teamId && channel.TeamId != "" {
+			continue
+		}
+
+		channels = append(channels, channel)
+	}
+
+	c.writeJSON(http.StatusOK, sortedChannels(channels))
+}
+
+func getChannelUnread(c *context) {
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	channel := c.s.store.channels[c.param("channel_id")]
+	member := c.s.store.channelMembers[c.param("channel_id")][c.param("user_id")]
+	if channel == nil || member == nil {
+		c.notFound("getChannelUnread", "channel member")
+		return
+	}
+
+	msgCount, mentionCount := c.s.store.channelUnread(channel, member)
+	c.writeJSON(http.StatusOK, &model.ChannelUnread{
+		TeamId:       channel.TeamId,
+		ChannelId:    channel.Id,
+		MsgCount:     msgCount,
+		MentionCount: mentionCount,
+	})
+}
+
+func getPostsAroundLastUnread(c *context) {
+	query := c.r.URL.Query()
+	limitBefore := atoiDefault(query.Get("limit_before"), 60)
+	limitAfter := atoiDefault(query.Get("limit_after"), 60)
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	member := c.s.store.channelMembers[c.param("channel_id")][c.param("user_id")]
+	if member == nil {
+		c.notFound("getPostsAroundLastUnread", "channel member")
+		return
+	}
+
+	postIds := c.s.store.channelPosts[c.param("channel_id")]
+	split := len(postIds)
+	for i, postId := range postIds {
+		if c.s.store.posts[postId].CreateAt > member.LastViewedAt {
+			split = i
+			break
+		}
+	}
+
+	start := split - limitBefore
+	if start < 0 {
+		start = 0
+	}
+	end := split + limitAfter
+	if end > len(postIds) {
+		end = len(postIds)
+	}
+
+	c.writeJSON(http.StatusOK, c.s.store.postList(postIds[start:end]))
+}
+
+func preferenceKey(preference *model.Preference) string {
+	return preference.Category + ":" + preference.Name
+}
+
+func getPreferences(c *context) {
+	if c.param("user_id") != c.userId {
+		c.writeError("getPreferences", http.StatusForbidden, "cannot get another user's preferences")
+		return
+	}
+
+	c.s.store.mu.RLock()
+	defer c.s.store.mu.RUnlock()
+
+	preferences := model.Preferences{}
+	for _, preference := range c.s.store.preferences[c.userId] {
+		preferences = append(preferences, *preference)
+	}
+
+	c.writeJSON(http.StatusOK, preferences)
+}
+
+// changePreferences saves or deletes the session user's preferences, and notifies the user's
+// other connections.
+func changePreferences(c *context, where, eventType string, change func(preferences map[string]*model.Preference, preference *model.Preference)) {
+	var preferences model.Preferences
+	if !c.decode(&preferences) {
+		return
+	}
+	for i := range preferences {
+		if c.param("user_id") != c.userId || preferences[i].UserId != c.userId {
+			c.writeError(where, http.StatusForbidden, "cannot change another user's preferences")
+			return
+		}
+		if appErr := preferences[i].IsValid(); appErr != nil {
+			c.writeError(where, http.StatusBadRequest, appErr.Error())
+			return
+		}
+	}
+
+	c.s.store.mu.Lock()
+	if c.s.store.preferences[c.userId] == nil {
+		c.s.store.preferences[c.userId] = make(map[string]*model.Preference)
+	}
+	for i := range preferences {
+		change(c.s.store.preferences[c.userId], &preferences[i])
+	}
+	c.s.store.mu.Unlock()
+
+	event := model.NewWebSocketEvent(eventType, "", "", c.userId, nil)
+	event.Add("preferences", preferences.ToJson())
+	c.s.hub.broadcast(event)
+
+	c.writeOK()
+}
+
+func updatePreferences(c *context) {
+	changePreferences(c, "updatePreferences", model.WEBSOCKET_EVENT_PREFERENCES_CHANGED, func(preferences map[string]*model.Preference, preference *model.Preference) {
+		preferences[preferenceKey(preference)] = preference
+	})
+}
+
+func deletePreferences(c *context) {
+	changePreferences(c, "deletePreferences", model.WEBSOCKET_EVENT_PREFERENCES_DELETED, func(preferences map[string]*model.Preference, preference *model.Preference) {
+		delete(preferences, preferenceKey(preference))
+	})
+}
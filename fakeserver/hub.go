@@ -0,0 +1,277 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const webConnSendBufferSize = 256
+
+// hub tracks websocket connections and fans out events to them.
+type hub struct {
+	store *store
+
+	lock  sync.RWMutex
+	conns map[*webConn]bool
+}
+
+type webConn struct {
+	hub      *hub
+	conn     *websocket.Conn
+	send     chan []byte
+	sequence int64
+
+	lock      sync.Mutex
+	userId    string
+	closeOnce sync.Once
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  model.SOCKET_MAX_MESSAGE_SIZE_KB,
+	WriteBufferSize: model.SOCKET_MAX_MESSAGE_SIZE_KB,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+func newHub(st *store) *hub {
+	return &hub{
+		store: st,
+		conns: make(map[*webConn]bool),
+	}
+}
+
+func (h *hub) serve(c *context) {
+	conn, err := upgrader.Upgrade(c.w, c.r, nil)
+	if err != nil {
+		mlog.Error("Failed to upgrade fake server websocket", mlog.Err(err))
+		return
+	}
+
+	wc := &webConn{
+		hub:  h,
+		conn: conn,
+		send: make(chan []byte, webConnSendBufferSize),
+	}
+
+	h.lock.Lock()
+	h.conns[wc] = true
+	h.lock.Unlock()
+
+	// Clients may also authenticate during the upgrade, without a challenge. The connection is
+	// registered first, so that it receives every event sent after the hello.
+	if userId := h.store.sessionUserId(tokenFromRequest(c.r)); userId != "" {
+		wc.authenticate(userId)
+	}
+
+	go wc.writePump()
+	wc.readPump()
+}
+
+func (h *hub) remove(wc *webConn) {
+	h.lock.Lock()
+	delete(h.conns, wc)
+	h.lock.Unlock()
+
+	wc.close()
+}
+
+func (h *hub) closeAll() {
+	h.lock.Lock()
+	conns := h.conns
+	h.conns = make(map[*webConn]bool)
+	h.lock.Unlock()
+
+	for wc := range conns {
+		wc.close()
+	}
+}
+
+// broadcast sends the event to every authenticated connection whose user is allowed to see it
+// according to the event's broadcast settings.
+func (h *hub) broadcast(event *model.WebSocketEvent) {
+	var channelMembers map[string]bool
+	if event.Broadcast.ChannelId != "" {
+		h.store.mu.RLock()
+		channelMembers = make(map[string]bool, len(h.store.channelMembers[event.Broadcast.ChannelId]))
+		for userId := range h.store.channelMembers[event.Broadcast.ChannelId] {
+			channelMembers[userId] = true
+		}
+		h.store.mu.RUnlock()
+	}
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for wc := range h.conns {
+		userId := wc.authenticatedUserId()
+		if userId == "" {
+			continue
+		}
+		if event.Broadcast.UserId != "" && event.Broadcast.UserId != userId {
+			continue
+		}
+		if event.Broadcast.OmitUsers[userId] {
+			continue
+		}
+		if channelMembers != nil && !channelMembers[userId] {
+			continue
+		}
+
+		wc.sendEvent(event)
+	}
+}
+
+// connectedUserIds returns the users with an authenticated websocket connection.
+func (h *hub) connectedUserIds() map[string]bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	userIds := make(map[string]bool, len(h.conns))
+	for wc := range h.conns {
+		if userId := wc.authenticatedUserId(); userId != "" {
+			userIds[userId] = true
+		}
+	}
+
+	return userIds
+}
+
+func (wc *webConn) authenticate(userId string) {
+	wc.lock.Lock()
+	wc.userId = userId
+	wc.lock.Unlock()
+
+	hello := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_HELLO, "", "", userId, nil)
+	hello.Add("server_version", model.CurrentVersion)
+	wc.sendEvent(hello)
+}
+
+func (wc *webConn) authenticatedUserId() string {
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+
+	return wc.userId
+}
+
+func (wc *webConn) sendEvent(event *model.WebSocketEvent) {
+	copied := *event
+	copied.Sequence = atomic.AddInt64(&wc.sequence, 1) - 1
+	wc.queue([]byte(copied.ToJson()))
+}
+
+// queue sends a message without blocking, dropping it if the client is not keeping up.
+func (wc *webConn) queue(message []byte) {
+	defer func() {
+		// The send channel may have been closed by a concurrent disconnect.
+		recover()
+	}()
+
+	select {
+	case wc.send <- message:
+	default:
+		mlog.Warn("Dropping fake server websocket message for slow client", mlog.String("user_id", wc.authenticatedUserId()))
+	}
+}
+
+func (wc *webConn) close() {
+	wc.closeOnce.Do(func() {
+		close(wc.send)
+		wc.conn.Close()
+	})
+}
+
+func (wc *webConn) writePump() {
+	for message := range wc.send {
+		if err := wc.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			wc.hub.remove(wc)
+			return
+		}
+	}
+}
+
+func (wc *webConn) readPump() {
+	defer wc.hub.remove(wc)
+
+	wc.conn.SetReadLimit(model.SOCKET_MAX_MESSAGE_SIZE_KB)
+	for {
+		var req model.WebSocketRequest
+		if err := wc.conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		wc.handleRequest(&req)
+	}
+}
+
+func (wc *webConn) handleRequest(req *model.WebSocketRequest) {
+	if req.Action == model.WEBSOCKET_AUTHENTICATION_CHALLENGE {
+		token, _ := req.Data["token"].(string)
+		userId := wc.hub.store.sessionUserId(token)
+		if userId == "" {
+			wc.respondError(req, http.StatusUnauthorized, "invalid or expired session")
+			return
+		}
+
+		wc.respond(req, nil)
+		wc.authenticate(userId)
+		return
+	}
+
+	userId := wc.authenticatedUserId()
+	if userId == "" {
+		wc.respondError(req, http.StatusUnauthorized, "websocket not authenticated")
+		return
+	}
+
+	switch req.Action {
+	case "user_typing":
+		channelId, _ := req.Data["channel_id"].(string)
+		parentId, _ := req.Data["parent_id"].(string)
+
+		event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_TYPING, "", channelId, "", map[string]bool{userId: true})
+		event.Add("parent_id", parentId)
+		event.Add("user_id", userId)
+		wc.hub.broadcast(event)
+		wc.respond(req, nil)
+
+	case "get_statuses":
+		statuses := make(map[string]interface{})
+		wc.hub.store.mu.Lock()
+		for id := range wc.hub.store.users {
+			statuses[id] = wc.hub.store.status(id).Status
+		}
+		wc.hub.store.mu.Unlock()
+		wc.respond(req, statuses)
+
+	case "get_statuses_by_ids":
+		statuses := make(map[string]interface{})
+		userIds, _ := req.Data["user_ids"].([]interface{})
+		wc.hub.store.mu.Lock()
+		for _, id := range userIds {
+			if id, ok := id.(string); ok {
+				statuses[id] = wc.hub.store.status(id).Status
+			}
+		}
+		wc.hub.store.mu.Unlock()
+		wc.respond(req, statuses)
+
+	default:
+		wc.respondError(req, http.StatusNotImplemented, "unsupported websocket action: "+req.Action)
+	}
+}
+
+func (wc *webConn) respond(req *model.WebSocketRequest, data map[string]interface{}) {
+	wc.queue([]byte(model.NewWebSocketResponse(model.STATUS_OK, req.Seq, data).ToJson()))
+}
+
+func (wc *webConn) respondError(req *model.WebSocketRequest, status int, details string) {
+	appErr := model.NewAppError("websocket", "fakeserver.websocket.app_error", nil, details, status)
+	wc.queue([]byte(model.NewWebSocketError(req.Seq, appErr).ToJson()))
+}
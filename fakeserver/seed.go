@@ -0,0 +1,193 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// CreateUser adds a user with the given password, returning the stored copy.
+func (s *Server) CreateUser(user *model.User, password string) *model.User {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored := *user
+	// Passwords are kept in plain text alongside the user, so avoid hashing in PreSave.
+	stored.Password = ""
+	stored.PreSave()
+	if stored.Roles == "" {
+		stored.Roles = model.SYSTEM_USER_ROLE_ID
+	}
+	stored.EmailVerified = true
+
+	s.store.users[stored.Id] = &stored
+	s.store.passwords[stored.Id] = password
+
+	return sanitizeUser(&stored)
+}
+
+// CreateTeam adds a team along with its default channels, returning the stored copy.
+func (s *Server) CreateTeam(team *model.Team) *model.Team {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored := *team
+	stored.PreSave()
+	if stored.Type == "" {
+		stored.Type = model.TEAM_OPEN
+	}
+	s.store.teams[stored.Id] = &stored
+	s.store.teamMembers[stored.Id] = make(map[string]*model.TeamMember)
+
+	s.store.createChannel(&model.Channel{
+		TeamId:      stored.Id,
+		Name:        model.DEFAULT_CHANNEL,
+		DisplayName: "Town Square",
+		Type:        model.CHANNEL_OPEN,
+	})
+	s.store.createChannel(&model.Channel{
+		TeamId:      stored.Id,
+		Name:        "off-topic",
+		DisplayName: "Off-Topic",
+		Type:        model.CHANNEL_OPEN,
+	})
+
+	copied := stored
+	return &copied
+}
+
+// CreateScheme adds a permission scheme along with its default roles, which start with the
+// permissions of the built-in roles they stand in for. It returns the stored copy.
+func (s *Server) CreateScheme(scheme *model.Scheme) *model.Scheme {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored := *scheme
+	stored.Id = model.NewId()
+	stored.CreateAt = model.GetMillis()
+	stored.UpdateAt = stored.CreateAt
+	if stored.Name == "" {
+		stored.Name = stored.Id
+	}
+
+	for _, role := range []struct {
+		name      *string
+		builtIn   string
+		teamScope bool
+	}{
+		{&stored.DefaultTeamAdminRole, model.TEAM_ADMIN_ROLE_ID, true},
+		{&stored.DefaultTeamUserRole, model.TEAM_USER_ROLE_ID, true},
+		{&stored.DefaultChannelAdminRole, model.CHANNEL_ADMIN_ROLE_ID, false},
+		{&stored.DefaultChannelUserRole, model.CHANNEL_USER_ROLE_ID, false},
+	} {
+		if role.teamScope && stored.Scope != model.SCHEME_SCOPE_TEAM {
+			continue
+		}
+		*role.name = model.NewId()
+		s.store.roles[*role.name] = &model.Role{
+			Id:            model.NewId(),
+			Name:          *role.name,
+			DisplayName:   *role.name,
+			Permissions:   append([]string{}, s.store.roles[role.builtIn].Permissions...),
+			SchemeManaged: true,
+		}
+	}
+	s.store.schemes[stored.Id] = &stored
+
+	copied := stored
+	return &copied
+}
+
+// CreateChannel adds a channel, returning the stored copy.
+func (s *Server) CreateChannel(channel *model.Channel) *model.Channel {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored := *channel
+	s.store.createChannel(&stored)
+
+	copied := stored
+	return &copied
+}
+
+// AddTeamMember adds a user to a team and its default channels.
+func (s *Server) AddTeamMember(teamId, userId string) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	s.store.addTeamMember(teamId, userId)
+}
+
+// AddChannelMember adds a user to a channel.
+func (s *Server) AddChannelMember(channelId, userId string) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	s.store.addChannelMember(channelId, userId)
+}
+
+// CreateEmoji adds a custom emoji with the given name.
+func (s *Server) CreateEmoji(name string) *model.Emoji {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	emoji := &model.Emoji{
+		Id:       model.NewId(),
+		Name:     name,
+		CreateAt: model.GetMillis(),
+	}
+	s.store.emoji[name] = emoji
+
+	return emoji
+}
+
+// GetUserByEmail returns the user with the given email, if any.
+func (s *Server) GetUserByEmail(email string) *model.User {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	for _, user := range s.store.users {
+		if user.Email == email {
+			return sanitizeUser(user)
+		}
+	}
+
+	return nil
+}
+
+// GetTeamByName returns the team with the given name, if any.
+func (s *Server) GetTeamByName(name string) *model.Team {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	for _, team := range s.store.teams {
+		if team.Name == name {
+			copied := *team
+			return &copied
+		}
+	}
+
+	return nil
+}
+
+// GetChannelByName returns the channel with the given name on the given team, if any.
+func (s *Server) GetChannelByName(teamId, name string) *model.Channel {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	if channel := s.store.channelByName(teamId, name); channel != nil {
+		copied := *channel
+		return &copied
+	}
+
+	return nil
+}
+
+// GetPostsForChannel returns all posts made to the given channel, newest first.
+func (s *Server) GetPostsForChannel(channelId string) *model.PostList {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	return s.store.postList(s.store.channelPosts[channelId])
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package fakeserver implements an in-process stand-in for a Mattermost server. It supports the
+// subset of the v4 REST API and websocket protocol used by the loadtest actions, backed by
+// in-memory state, and can inject latency and errors into responses.
+package fakeserver
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Fault describes latency or errors to inject into requests matching a method and path prefix.
+type Fault struct {
+	// Method restricts the fault to a given HTTP method. Leave empty to match any method.
+	Method string
+	// PathPrefix restricts the fault to requests whose path starts with the given prefix.
+	PathPrefix string
+	// Latency is added to every matching request before it is handled.
+	Latency time.Duration
+	// LatencyJitter is the maximum additional random latency added to matching requests.
+	LatencyJitter time.Duration
+	// ErrorRate is the probability of failing a matching request.
+	ErrorRate float64
+	// StatusCode is the status with which failed requests are answered. Defaults to 500.
+	StatusCode int
+}
+
+// Config controls the behaviour of a fake server.
+type Config struct {
+	// Latency is added to every request before it is handled.
+	Latency time.Duration
+	// LatencyJitter is the maximum additional random latency added to every request.
+	LatencyJitter time.Duration
+	// ErrorRate is the probability of failing any given request with a 500.
+	ErrorRate float64
+	// Faults override the settings above for matching requests. The first match wins.
+	Faults []Fault
+}
+
+type handlerFunc func(c *context)
+
+type route struct {
+	method      string
+	segments    []string
+	requireAuth bool
+	handler     handlerFunc
+}
+
+// Server is a fake Mattermost server.
+type Server struct {
+	config Config
+	store  *store
+	hub    *hub
+	routes []*route
+
+	// integrationClient makes the requests of integrations, such as custom slash commands.
+	integrationClient *http.Client
+
+	httpServer *httptest.Server
+}
+
+// New creates a fake server with no data other than the default roles and configuration.
+func New(config Config) *Server {
+	s := &Server{
+		config:            config,
+		store:             newStore(),
+		integrationClient: &http.Client{Timeout: integrationTimeout},
+	}
+	s.hub = newHub(s.store)
+
+	s.initSystemRoutes()
+	s.initUserRoutes()
+	s.initBotRoutes()
+	s.initTeamRoutes()
+	s.initChannelRoutes()
+	s.initSidebarRoutes()
+	s.initPostRoutes()
+	s.initThreadRoutes()
+	s.initFileRoutes()
+	s.initIntegrationRoutes()
+
+	return s
+}
+
+// Start serves the fake server on a random local port, returning its URL.
+func (s *Server) Start() string {
+	s.httpServer = httptest.NewServer(s)
+
+	return s.httpServer.URL
+}
+
+// URL returns the address of a started server.
+func (s *Server) URL() string {
+	if s.httpServer == nil {
+		return ""
+	}
+
+	return s.httpServer.URL
+}
+
+// WebsocketURL returns the websocket address of a started server.
+func (s *Server) WebsocketURL() string {
+	return strings.Replace(s.URL(), "http", "ws", 1)
+}
+
+// Close stops a started server and disconnects all websockets.
+func (s *Server) Close() {
+	s.hub.closeAll()
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// ListenAndServe serves the fake server on the given address until an error occurs.
+func (s *Server) ListenAndServe(addr string) error {
+	mlog.Info("Starting fake server", mlog.String("address", addr))
+
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) handle(method, path string, requireAuth bool, handler handlerFunc) {
+	s.routes = append(s.routes, &route{
+		method:      method,
+		segments:    strings.Split(strings.Trim(path, "/"), "/"),
+		requireAuth: requireAuth,
+		handler:     handler,
+	})
+}
+
+// match returns the first route matching the given request, along with any path parameters.
+func (s *Server) match(method, path string) (*route, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	pathMatched := false
+
+	for _, rt := range s.routes {
+		if len(rt.segments) != len(segments) {
+			continue
+		}
+
+		params := make(map[string]string)
+		matched := true
+		for i, segment := range rt.segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				params[segment[1:len(segment)-1]] = segments[i]
+			} else if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		pathMatched = true
+		if rt.method == method {
+			return rt, params, true
+		}
+	}
+
+	return nil, nil, pathMatched
+}
+
+func (s *Server) faultFor(r *http.Request) Fault {
+	for _, fault := range s.config.Faults {
+		if fault.Method != "" && fault.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, fault.PathPrefix) {
+			continue
+		}
+
+		return fault
+	}
+
+	return Fault{
+		Latency:       s.config.Latency,
+		LatencyJitter: s.config.LatencyJitter,
+		ErrorRate:     s.config.ErrorRate,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := &context{s: s, w: w, r: r}
+
+	rt, params, pathMatched := s.match(r.Method, r.URL.Path)
+	if rt == nil {
+		if pathMatched {
+			c.writeError("ServeHTTP", http.StatusMethodNotAllowed, "method not allowed")
+		} else {
+			c.writeError("ServeHTTP", http.StatusNotFound, "no such route: "+r.URL.Path)
+		}
+		return
+	}
+	c.params = params
+
+	// The websocket upgrade is exempt from fault injection, since the client does not retry it.
+	if r.URL.Path != model.API_URL_SUFFIX+"/websocket" {
+		fault := s.faultFor(r)
+		latency := fault.Latency
+		if fault.LatencyJitter > 0 {
+			latency += time.Duration(rand.Int63n(int64(fault.LatencyJitter)))
+		}
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+			statusCode := fault.StatusCode
+			if statusCode == 0 {
+				statusCode = http.StatusInternalServerError
+			}
+			c.writeError("ServeHTTP", statusCode, "injected failure")
+			return
+		}
+	}
+
+	if rt.requireAuth {
+		c.userId = s.store.sessionUserId(tokenFromRequest(r))
+		if c.userId == "" {
+			c.writeError("ServeHTTP", http.StatusUnauthorized, "invalid or expired session")
+			return
+		}
+	}
+
+	rt.handler(c)
+}
+
+func tokenFromRequest(r *http.Request) string {
+	authHeader := r.Header.Get(model.HEADER_AUTH)
+	if fields := strings.Fields(authHeader); len(fields) == 2 && strings.EqualFold(fields[0], model.HEADER_BEARER) {
+		return fields[1]
+	}
+
+	if cookie, err := r.Cookie(model.SESSION_COOKIE_TOKEN); err == nil {
+		return cookie.Value
+	}
+
+	return r.URL.Query().Get("access_token")
+}
+
+// context carries the state of a single request through a handler.
+type context struct {
+	s      *Server
+	w      http.ResponseWriter
+	r      *http.Request
+	params map[string]string
+	userId string
+}
+
+// param returns the named path parameter, resolving "me" to the session user.
+func (c *context) param(name string) string {
+	value := c.params[name]
+	if value == "me" {
+		return c.userId
+	}
+
+	return value
+}
+
+func (c *context) decode(v interface{}) bool {
+	if err := json.NewDecoder(c.r.Body).Decode(v); err != nil {
+		c.writeError("decode", http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	return true
+}
+
+func (c *context) writeJSON(status int, v interface{}) {
+	c.w.Header().Set("Content-Type", "application/json")
+	c.w.WriteHeader(status)
+	if err := json.NewEncoder(c.w).Encode(v); err != nil {
+		mlog.Error("Failed to encode fake server response", mlog.String("path", c.r.URL.Path), mlog.Err(err))
+	}
+}
+
+func (c *context) writeOK() {
+	c.writeJSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (c *context) writeError(where string, status int, details string) {
+	appErr := model.NewAppError(where, "fakeserver.app_error", nil, details, status)
+	c.w.Header().Set("Content-Type", "application/json")
+	c.w.WriteHeader(status)
+	c.w.Write([]byte(appErr.ToJson()))
+}
+
+func (c *context) notFound(where, what string) {
+	c.writeError(where, http.StatusNotFound, what+" not found")
+}
+
+func (c *context) pageParams(defaultPerPage int) (int, int) {
+	query := c.r.URL.Query()
+	page := atoiDefault(query.Get("page"), 0)
+	perPage := atoiDefault(query.Get("per_page"), defaultPerPage)
+
+	return page, perPage
+}
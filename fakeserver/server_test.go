@@ -0,0 +1,587 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, config Config) (*Server, *model.Team, *model.Channel) {
+	s := New(config)
+	s.Start()
+
+	team := s.CreateTeam(&model.Team{Name: "loadtestteam", DisplayName: "Load Test Team"})
+	channel := s.GetChannelByName(team.Id, model.DEFAULT_CHANNEL)
+	require.NotNil(t, channel)
+
+	for _, username := range []string{"user1", "user2"} {
+		user := s.CreateUser(&model.User{Username: username, Email: "success+" + username + "@simulator.amazonses.com"}, "password")
+		s.AddTeamMember(team.Id, user.Id)
+	}
+
+	return s, team, channel
+}
+
+func TestPostingDeliversWebsocketEvent(t *testing.T) {
+	s, team, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	poster := model.NewAPIv4Client(s.URL())
+	_, resp := poster.Login("success+user1@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	listener := model.NewAPIv4Client(s.URL())
+	_, resp = listener.Login("success+user2@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), listener.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+
+	channels, resp := listener.GetChannelsForTeamForUser(team.Id, "me", "")
+	require.Nil(t, resp.Error)
+	assert.Len(t, channels, 2)
+
+	post, resp := poster.CreatePost(&model.Post{ChannelId: channel.Id, Message: "hello world"})
+	require.Nil(t, resp.Error)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-ws.EventChannel:
+			if event.Event != model.WEBSOCKET_EVENT_POSTED {
+				continue
+			}
+			received := model.PostFromJson(strings.NewReader(event.Data["post"].(string)))
+			assert.Equal(t, post.Id, received.Id)
+			assert.Equal(t, "hello world", received.Message)
+
+			posts, resp := listener.GetPostsForChannel(channel.Id, 0, 60, "")
+			require.Nil(t, resp.Error)
+			assert.Equal(t, []string{post.Id}, posts.Order)
+
+			unread, resp := listener.GetChannelUnread(channel.Id, "me")
+			require.Nil(t, resp.Error)
+			assert.Equal(t, int64(1), unread.MsgCount)
+			return
+		case <-timeout:
+			t.Fatal("timed out waiting for posted event")
+		}
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{
+		Faults: []Fault{
+			{Method: http.MethodPost, PathPrefix: "/api/v4/users/login", ErrorRate: 1, StatusCode: http.StatusTooManyRequests},
+			{PathPrefix: "/api/v4/system/ping", Latency: 50 * time.Millisecond},
+		},
+	})
+	defer s.Close()
+
+	client := model.NewAPIv4Client(s.URL())
+
+	_, resp := client.Login("success+user1@simulator.amazonses.com", "password")
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	start := time.Now()
+	status, resp := client.GetPing()
+	require.Nil(t, resp.Error)
+	assert.Equal(t, "OK", status)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	_, resp = client.GetMe("")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestThreads(t *testing.T) {
+	s, team, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	poster := model.NewAPIv4Client(s.URL())
+	_, resp := poster.Login("success+user1@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	replier := model.NewAPIv4Client(s.URL())
+	replierUser, resp := replier.Login("success+user2@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	root, resp := poster.CreatePost(&model.Post{ChannelId: channel.Id, Message: "root"})
+	require.Nil(t, resp.Error)
+	reply, resp := replier.CreatePost(&model.Post{ChannelId: channel.Id, RootId: root.Id, ParentId: root.Id, Message: "reply"})
+	require.Nil(t, resp.Error)
+
+	threadRes, err := poster.DoApiGet("/posts/"+reply.Id+"/thread", "")
+	require.Nil(t, err)
+	thread := model.PostListFromJson(threadRes.Body)
+	threadRes.Body.Close()
+	assert.Equal(t, []string{reply.Id, root.Id}, thread.Order)
+
+	threadsRoute := "/users/me/teams/" + team.Id + "/threads"
+	threadsRes, err := poster.DoApiGet(threadsRoute, "")
+	require.Nil(t, err)
+	var threads threadsResponse
+	require.NoError(t, json.NewDecoder(threadsRes.Body).Decode(&threads))
+	threadsRes.Body.Close()
+	require.Len(t, threads.Threads, 1, "replying should have the root post's author follow the thread")
+	assert.Equal(t, root.Id, threads.Threads[0].PostId)
+	assert.Equal(t, int64(1), threads.Threads[0].ReplyCount)
+	assert.Equal(t, int64(1), threads.Threads[0].UnreadReplies)
+
+	readRes, err := poster.DoApiPut(threadsRoute+"/"+root.Id+"/read/"+strconv.FormatInt(reply.CreateAt, 10), "")
+	require.Nil(t, err)
+	var read threadResponse
+	require.NoError(t, json.NewDecoder(readRes.Body).Decode(&read))
+	readRes.Body.Close()
+	assert.Equal(t, int64(0), read.UnreadReplies)
+
+	unfollowRes, err := replier.DoApiDelete("/users/" + replierUser.Id + "/teams/" + team.Id + "/threads/" + root.Id + "/following")
+	require.Nil(t, err)
+	unfollowRes.Body.Close()
+
+	threadsRes, err = replier.DoApiGet(threadsRoute, "")
+	require.Nil(t, err)
+	threads = threadsResponse{}
+	require.NoError(t, json.NewDecoder(threadsRes.Body).Decode(&threads))
+	threadsRes.Body.Close()
+	assert.Empty(t, threads.Threads)
+}
+
+func TestPostLifecycle(t *testing.T) {
+	s, _, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	poster := model.NewAPIv4Client(s.URL())
+	user, resp := poster.Login("success+user1@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	other := model.NewAPIv4Client(s.URL())
+	_, resp = other.Login("success+user2@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	post, resp := poster.CreatePost(&model.Post{ChannelId: channel.Id, Message: "hello world"})
+	require.Nil(t, resp.Error)
+
+	message := "goodbye world"
+	_, resp = other.PatchPost(post.Id, &model.PostPatch{Message: &message})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	edited, resp := poster.PatchPost(post.Id, &model.PostPatch{Message: &message})
+	require.Nil(t, resp.Error)
+	assert.Equal(t, message, edited.Message)
+	assert.NotZero(t, edited.EditAt)
+
+	_, resp = other.PinPost(post.Id)
+	require.Nil(t, resp.Error)
+	pinned, resp := poster.GetPinnedPosts(channel.Id, "")
+	require.Nil(t, resp.Error)
+	assert.Equal(t, []string{post.Id}, pinned.Order)
+
+	flag := &model.Preferences{{UserId: user.Id, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: post.Id, Value: "true"}}
+	_, resp = other.UpdatePreferences(user.Id, flag)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	_, resp = poster.UpdatePreferences(user.Id, flag)
+	require.Nil(t, resp.Error)
+	flagged, resp := poster.GetFlaggedPostsForUser(user.Id, 0, 20)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, []string{post.Id}, flagged.Order)
+
+	_, resp = poster.DeletePreferences(user.Id, flag)
+	require.Nil(t, resp.Error)
+	flagged, resp = poster.GetFlaggedPostsForUser(user.Id, 0, 20)
+	require.Nil(t, resp.Error)
+	assert.Empty(t, flagged.Order)
+
+	_, resp = poster.DeletePost(post.Id)
+	require.Nil(t, resp.Error)
+	posts, resp := other.GetPostsForChannel(channel.Id, 0, 60, "")
+	require.Nil(t, resp.Error)
+	assert.Empty(t, posts.Order)
+	_, resp = poster.PatchPost(post.Id, &model.PostPatch{Message: &message})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMentions(t *testing.T) {
+	s, _, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	poster := model.NewAPIv4Client(s.URL())
+	posterUser, resp := poster.Login("success+user1@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	listener := model.NewAPIv4Client(s.URL())
+	listenerUser, resp := listener.Login("success+user2@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), listener.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+
+	hello := <-ws.EventChannel
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	receivedMentions := func() []string {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event := <-ws.EventChannel:
+				if event.Event != model.WEBSOCKET_EVENT_POSTED {
+					continue
+				}
+				mentions, _ := event.Data["mentions"].(string)
+				return model.ArrayFromJson(strings.NewReader(mentions))
+			case <-timeout:
+				t.Fatal("timed out waiting for posted event")
+				return nil
+			}
+		}
+	}
+
+	for _, message := range []string{"hello @user2.", "hello @here", "hello user2", "hello @all"} {
+		_, resp = poster.CreatePost(&model.Post{ChannelId: channel.Id, Message: message})
+		require.Nil(t, resp.Error)
+	}
+	assert.Equal(t, []string{listenerUser.Id}, receivedMentions())
+	assert.Equal(t, []string{listenerUser.Id}, receivedMentions(), "connected users should be mentioned by @here")
+	assert.Equal(t, []string{listenerUser.Id}, receivedMentions(), "usernames are mention keys by default")
+	assert.Equal(t, []string{listenerUser.Id}, receivedMentions())
+
+	_, resp = listener.CreatePost(&model.Post{ChannelId: channel.Id, Message: "hello @user2 and @channel"})
+	require.Nil(t, resp.Error)
+	assert.Equal(t, []string{posterUser.Id}, receivedMentions(), "authors should not be mentioned by their own posts")
+
+	unread, resp := listener.GetChannelUnread(channel.Id, "me")
+	require.Nil(t, resp.Error)
+	assert.Equal(t, int64(4), unread.MentionCount)
+}
+
+func TestFiles(t *testing.T) {
+	s, team, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	client := model.NewAPIv4Client(s.URL())
+	_, resp := client.Login("success+user1@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	upload, resp := client.UploadFile([]byte("quarterly roadmap"), channel.Id, "roadmap.txt")
+	require.Nil(t, resp.Error)
+	fileId := upload.FileInfos[0].Id
+
+	preview, resp := client.GetFilePreview(fileId)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, "quarterly roadmap", string(preview))
+
+	link, resp := client.GetFileLink(fileId)
+	require.Nil(t, resp.Error)
+
+	public, err := http.Get(link)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(public.Body)
+	public.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, public.StatusCode)
+	assert.Equal(t, "quarterly roadmap", string(data))
+
+	tampered, err := http.Get(link + "x")
+	require.NoError(t, err)
+	tampered.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, tampered.StatusCode)
+
+	search := func(terms string) []string {
+		r, appErr := client.DoApiPost(client.GetTeamRoute(team.Id)+"/files/search", `{"terms": "`+terms+`"}`)
+		require.Nil(t, appErr)
+		defer r.Body.Close()
+
+		var list struct {
+			Order []string `json:"order"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&list))
+		return list.Order
+	}
+
+	assert.Empty(t, search("roadmap"), "files not yet attached to a post should not be found")
+
+	_, resp = client.CreatePost(&model.Post{ChannelId: channel.Id, Message: "see attached", FileIds: []string{fileId}})
+	require.Nil(t, resp.Error)
+
+	assert.Equal(t, []string{fileId}, search("ROADMAP"))
+	assert.Empty(t, search("roadmap budget"))
+}
+
+// newTestClient returns a client logged in as the user with the given email, whose password must
+// be "password".
+func newTestClient(t *testing.T, s *Server, email string) *model.Client4 {
+	client := model.NewAPIv4Client(s.URL())
+	_, resp := client.Login(email, "password")
+	require.Nil(t, resp.Error)
+
+	return client
+}
+
+// newTestAdminClient creates a system admin belonging to the team, and returns a client logged in
+// as them.
+func newTestAdminClient(t *testing.T, s *Server, teamId string) *model.Client4 {
+	admin := s.CreateUser(&model.User{Username: "admin", Email: "success+admin@simulator.amazonses.com", Roles: model.SYSTEM_ADMIN_ROLE_ID + " " + model.SYSTEM_USER_ROLE_ID}, "password")
+	s.AddTeamMember(teamId, admin.Id)
+
+	return newTestClient(t, s, admin.Email)
+}
+
+func TestUserStatus(t *testing.T) {
+	s, _, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	client := newTestClient(t, s, "success+user1@simulator.amazonses.com")
+	other := newTestClient(t, s, "success+user2@simulator.amazonses.com")
+	me, resp := client.GetMe("")
+	require.Nil(t, resp.Error)
+	them, resp := other.GetMe("")
+	require.Nil(t, resp.Error)
+
+	typist, appErr := model.NewWebSocketClient4(s.WebsocketURL(), client.AuthToken)
+	require.Nil(t, appErr)
+	defer typist.Close()
+	typist.Listen()
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), other.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+	hello := <-ws.EventChannel
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	typist.UserTyping(channel.Id, "")
+	_, resp = client.UpdateUserStatus(me.Id, &model.Status{UserId: me.Id, Status: model.STATUS_DND})
+	require.Nil(t, resp.Error)
+	_, resp = client.UpdateUserStatus(them.Id, &model.Status{UserId: them.Id, Status: model.STATUS_DND})
+	assert.Error(t, resp.Error, "another user's status should not be changed")
+	r, appErr := client.DoApiPut(client.GetUserRoute("me")+"/status/custom", `{"emoji": "calendar", "text": "In a meeting"}`)
+	require.Nil(t, appErr)
+	r.Body.Close()
+
+	var typing, statusChanged, userUpdated bool
+	timeout := time.After(5 * time.Second)
+	for !typing || !statusChanged || !userUpdated {
+		select {
+		case event := <-ws.EventChannel:
+			switch event.Event {
+			case model.WEBSOCKET_EVENT_TYPING:
+				typing = true
+				assert.Equal(t, me.Id, event.Data["user_id"])
+			case model.WEBSOCKET_EVENT_STATUS_CHANGE:
+				statusChanged = true
+				assert.Equal(t, model.STATUS_DND, event.Data["status"])
+			case model.WEBSOCKET_EVENT_USER_UPDATED:
+				userUpdated = true
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the events")
+		}
+	}
+
+	statuses, resp := other.GetUsersStatusesByIds([]string{me.Id})
+	require.Nil(t, resp.Error)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, model.STATUS_DND, statuses[0].Status)
+
+	user, resp := other.GetUser(me.Id, "")
+	require.Nil(t, resp.Error)
+	assert.Equal(t, `{"emoji":"calendar","text":"In a meeting"}`, user.Props["customStatus"])
+
+	r, appErr = client.DoApiDelete(client.GetUserRoute("me") + "/status/custom")
+	require.Nil(t, appErr)
+	r.Body.Close()
+	user, resp = other.GetUser(me.Id, "")
+	require.Nil(t, resp.Error)
+	assert.Empty(t, user.Props["customStatus"])
+}
+
+func TestSidebar(t *testing.T) {
+	s, team, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	client := newTestClient(t, s, "success+user1@simulator.amazonses.com")
+	other := newTestClient(t, s, "success+user2@simulator.amazonses.com")
+	route := client.GetUserRoute("me") + "/teams/" + team.Id + "/channels/categories"
+
+	getCategories := func() *orderedSidebarCategories {
+		r, appErr := client.DoApiGet(route, "")
+		require.Nil(t, appErr)
+		defer r.Body.Close()
+
+		var categories orderedSidebarCategories
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&categories))
+		return &categories
+	}
+	// Every channel of the user should be in exactly one category.
+	categorized := func(categories *orderedSidebarCategories) map[string]string {
+		types := make(map[string]string)
+		for _, category := range categories.Categories {
+			for _, channelId := range category.Channels {
+				assert.NotContains(t, types, channelId, "channel %s is in more than one category", channelId)
+				types[channelId] = category.Type
+			}
+		}
+		return types
+	}
+
+	before := getCategories()
+	require.Len(t, before.Categories, 3)
+	assert.Equal(t, sidebarCategoryChannels, categorized(before)[channel.Id])
+
+	r, appErr := client.DoApiPost(route, `{"display_name": "Work", "channel_ids": ["`+channel.Id+`"]}`)
+	require.Nil(t, appErr)
+	r.Body.Close()
+	assert.Equal(t, http.StatusCreated, r.StatusCode)
+
+	after := getCategories()
+	require.Len(t, after.Categories, 4)
+	assert.Equal(t, sidebarCategoryCustom, after.Categories[0].Type, "new categories should be shown first")
+	assert.Equal(t, sidebarCategoryCustom, categorized(after)[channel.Id], "a moved channel should leave its category")
+	assert.Equal(t, len(categorized(before)), len(categorized(after)))
+
+	_, appErr = client.DoApiPut(route+"/order", model.ArrayToJson(after.Order[1:]))
+	assert.NotNil(t, appErr, "every category should be ordered")
+	me, resp := client.GetMe("")
+	require.Nil(t, resp.Error)
+	_, appErr = other.DoApiGet(other.GetUserRoute(me.Id)+"/teams/"+team.Id+"/channels/categories", "")
+	assert.NotNil(t, appErr, "another user's sidebar should not be accessible")
+
+	_, resp = client.UpdateChannelNotifyProps(channel.Id, "me", map[string]string{model.DESKTOP_NOTIFY_PROP: "loud"})
+	assert.Error(t, resp.Error, "invalid notify props should be rejected")
+}
+
+func TestTeams(t *testing.T) {
+	s, team, _ := newTestServer(t, Config{})
+	defer s.Close()
+
+	adminClient := newTestAdminClient(t, s, team.Id)
+	client := newTestClient(t, s, "success+user1@simulator.amazonses.com")
+
+	_, resp := client.InviteUsersToTeam(team.Id, []string{"success+invite@simulator.amazonses.com"})
+	assert.Error(t, resp.Error, "email invitations should be disabled by default")
+	config, resp := adminClient.GetConfig()
+	require.Nil(t, resp.Error)
+	*config.ServiceSettings.EnableEmailInvitations = true
+	_, resp = adminClient.UpdateConfig(config)
+	require.Nil(t, resp.Error)
+	_, resp = client.InviteUsersToTeam(team.Id, []string{"success+invite@simulator.amazonses.com"})
+	assert.Nil(t, resp.Error)
+	_, resp = client.InviteUsersToTeam(team.Id, []string{"not an email"})
+	assert.Error(t, resp.Error, "invalid addresses should be rejected")
+
+	current, resp := client.GetTeam(team.Id, "")
+	require.Nil(t, resp.Error)
+	info, resp := client.GetTeamInviteInfo(current.InviteId)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, team.Id, info.Id)
+	assert.Empty(t, info.InviteId, "the invite id should not be given away")
+
+	_, resp = client.RegenerateTeamInviteId(team.Id)
+	assert.Error(t, resp.Error, "team members should not regenerate invite ids")
+	regenerated, resp := adminClient.RegenerateTeamInviteId(team.Id)
+	require.Nil(t, resp.Error)
+	assert.NotEqual(t, current.InviteId, regenerated.InviteId)
+	_, resp = client.GetTeamInviteInfo(current.InviteId)
+	assert.Error(t, resp.Error, "the old invite id should no longer work")
+
+	_, resp = adminClient.SetTeamIcon(team.Id, []byte("not an image"))
+	assert.Error(t, resp.Error)
+
+	created, resp := client.CreateTeam(&model.Team{Name: "createdteam", DisplayName: "Created Team", Type: model.TEAM_OPEN})
+	require.Nil(t, resp.Error)
+	_, resp = client.PatchTeam(created.Id, &model.TeamPatch{Description: model.NewString("Created by user1")})
+	assert.Nil(t, resp.Error, "the creator should administer the team")
+	_, resp = client.SoftDeleteTeam(created.Id)
+	require.Nil(t, resp.Error)
+	teams, resp := adminClient.GetAllTeams("", 0, 10)
+	require.Nil(t, resp.Error)
+	assert.Len(t, teams, 1, "archived teams should not be listed")
+}
+
+func TestSchemes(t *testing.T) {
+	s, team, channel := newTestServer(t, Config{})
+	defer s.Close()
+
+	adminClient := newTestAdminClient(t, s, team.Id)
+	client := newTestClient(t, s, "success+user1@simulator.amazonses.com")
+	me, resp := client.GetMe("")
+	require.Nil(t, resp.Error)
+	teamScheme := s.CreateScheme(&model.Scheme{Name: "teamscheme", Scope: model.SCHEME_SCOPE_TEAM})
+	channelScheme := s.CreateScheme(&model.Scheme{Name: "channelscheme", Scope: model.SCHEME_SCOPE_CHANNEL})
+
+	_, resp = client.GetSchemes("", 0, 10)
+	assert.Error(t, resp.Error, "only system admins should list schemes")
+	schemes, resp := adminClient.GetSchemes(model.SCHEME_SCOPE_TEAM, 0, 10)
+	require.Nil(t, resp.Error)
+	require.Len(t, schemes, 1)
+	assert.Equal(t, teamScheme.Id, schemes[0].Id)
+
+	_, resp = client.UpdateTeamScheme(team.Id, teamScheme.Id)
+	assert.Error(t, resp.Error, "only system admins should assign schemes")
+	_, resp = adminClient.UpdateTeamScheme(team.Id, channelScheme.Id)
+	assert.Error(t, resp.Error, "channel schemes should not be assigned to teams")
+	_, resp = adminClient.UpdateTeamScheme(team.Id, teamScheme.Id)
+	require.Nil(t, resp.Error)
+	updated, resp := client.GetTeam(team.Id, "")
+	require.Nil(t, resp.Error)
+	assert.Equal(t, teamScheme.Id, *updated.SchemeId)
+
+	_, resp = adminClient.UpdateChannelScheme(channel.Id, teamScheme.Id)
+	assert.Error(t, resp.Error, "team schemes should not be assigned to channels")
+	_, resp = adminClient.UpdateChannelScheme(channel.Id, channelScheme.Id)
+	require.Nil(t, resp.Error)
+	updatedChannel, resp := client.GetChannel(channel.Id, "")
+	require.Nil(t, resp.Error)
+	assert.Equal(t, channelScheme.Id, *updatedChannel.SchemeId)
+
+	_, resp = client.UpdateChannelMemberSchemeRoles(channel.Id, me.Id, &model.SchemeRoles{SchemeUser: true, SchemeAdmin: true})
+	assert.Error(t, resp.Error, "channel members should not promote themselves")
+	_, resp = adminClient.UpdateChannelMemberSchemeRoles(channel.Id, me.Id, &model.SchemeRoles{SchemeUser: true, SchemeAdmin: true})
+	require.Nil(t, resp.Error)
+	member, resp := client.GetChannelMember(channel.Id, me.Id, "")
+	require.Nil(t, resp.Error)
+	assert.True(t, member.SchemeAdmin)
+
+	role, resp := adminClient.GetRoleByName(channelScheme.DefaultChannelUserRole)
+	require.Nil(t, resp.Error)
+	_, resp = client.PatchRole(role.Id, &model.RolePatch{Permissions: &[]string{}})
+	assert.Error(t, resp.Error, "only system admins should patch roles")
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), client.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+	hello := <-ws.EventChannel
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	_, resp = adminClient.PatchRole(role.Id, &model.RolePatch{Permissions: &[]string{model.PERMISSION_CREATE_POST.Id}})
+	require.Nil(t, resp.Error)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-ws.EventChannel:
+			if event.Event != model.WEBSOCKET_EVENT_ROLE_UPDATED {
+				continue
+			}
+			updated := model.RoleFromJson(strings.NewReader(event.Data["role"].(string)))
+			assert.Equal(t, []string{model.PERMISSION_CREATE_POST.Id}, updated.Permissions)
+			return
+		case <-timeout:
+			t.Fatal("timed out waiting for the role to be updated")
+		}
+	}
+}
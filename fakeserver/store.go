@@ -0,0 +1,407 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package fakeserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// store holds all state of the fake server. A single lock protects everything, since the fake
+// server is not itself the subject of any load test.
+type store struct {
+	mu sync.RWMutex
+
+	users     map[string]*model.User
+	passwords map[string]string
+	sessions  map[string]string
+	statuses  map[string]*model.Status
+
+	bots map[string]*model.Bot
+	// accessTokens maps personal access tokens to their details.
+	accessTokens map[string]*model.UserAccessToken
+
+	teams       map[string]*model.Team
+	teamMembers map[string]map[string]*model.TeamMember
+
+	channels       map[string]*model.Channel
+	channelMembers map[string]map[string]*model.ChannelMember
+
+	posts        map[string]*model.Post
+	channelPosts map[string][]string
+	reactions    map[string][]*model.Reaction
+
+	// threadMemberships maps user ids and root post ids to the user's view of the thread.
+	threadMemberships map[string]map[string]*threadMembership
+
+	// preferences maps user ids and preference categories and names to the user's preferences.
+	preferences map[string]map[string]*model.Preference
+	// sidebars maps user ids and team ids to the user's sidebar categories in the team.
+	sidebars map[string]map[string]*sidebar
+
+	files    map[string]*model.FileInfo
+	fileData map[string][]byte
+
+	emoji         map[string]*model.Emoji
+	incomingHooks map[string]*model.IncomingWebhook
+	plugins       map[string]*pluginState
+	roles         map[string]*model.Role
+	schemes       map[string]*model.Scheme
+
+	commands map[string]*model.Command
+	// commandHooks maps the ids in the response URLs given to slash commands to the command
+	// executed.
+	commandHooks map[string]*commandHook
+
+	outgoingHooks map[string]*model.OutgoingWebhook
+
+	config *model.Config
+}
+
+type commandHook struct {
+	commandId string
+	args      model.CommandArgs
+}
+
+type pluginState struct {
+	manifest *model.Manifest
+	active   bool
+}
+
+func newStore() *store {
+	st := &store{
+		users:             make(map[string]*model.User),
+		passwords:         make(map[string]string),
+		sessions:          make(map[string]string),
+		statuses:          make(map[string]*model.Status),
+		bots:              make(map[string]*model.Bot),
+		accessTokens:      make(map[string]*model.UserAccessToken),
+		teams:             make(map[string]*model.Team),
+		teamMembers:       make(map[string]map[string]*model.TeamMember),
+		channels:          make(map[string]*model.Channel),
+		channelMembers:    make(map[string]map[string]*model.ChannelMember),
+		posts:             make(map[string]*model.Post),
+		channelPosts:      make(map[string][]string),
+		reactions:         make(map[string][]*model.Reaction),
+		threadMemberships: make(map[string]map[string]*threadMembership),
+		preferences:       make(map[string]map[string]*model.Preference),
+		sidebars:          make(map[string]map[string]*sidebar),
+		files:             make(map[string]*model.FileInfo),
+		fileData:          make(map[string][]byte),
+		emoji:             make(map[string]*model.Emoji),
+		incomingHooks:     make(map[string]*model.IncomingWebhook),
+		commands:          make(map[string]*model.Command),
+		commandHooks:      make(map[string]*commandHook),
+		outgoingHooks:     make(map[string]*model.OutgoingWebhook),
+		plugins:           make(map[string]*pluginState),
+		roles:             make(map[string]*model.Role),
+		schemes:           make(map[string]*model.Scheme),
+		config:            &model.Config{},
+	}
+	st.config.SetDefaults()
+
+	for _, roleName := range []string{
+		model.SYSTEM_USER_ROLE_ID,
+		model.SYSTEM_ADMIN_ROLE_ID,
+		model.TEAM_USER_ROLE_ID,
+		model.TEAM_ADMIN_ROLE_ID,
+		model.CHANNEL_USER_ROLE_ID,
+		model.CHANNEL_ADMIN_ROLE_ID,
+	} {
+		st.roles[roleName] = &model.Role{
+			Id:            model.NewId(),
+			Name:          roleName,
+			DisplayName:   roleName,
+			Permissions:   []string{},
+			SchemeManaged: true,
+			BuiltIn:       true,
+		}
+	}
+
+	return st
+}
+
+func (st *store) sessionUserId(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if accessToken := st.accessTokens[token]; accessToken != nil && accessToken.IsActive {
+		return accessToken.UserId
+	}
+
+	return st.sessions[token]
+}
+
+func (st *store) createSession(userId string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	token := model.NewId()
+	st.sessions[token] = userId
+
+	return token
+}
+
+func (st *store) revokeSessions(userId string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for token, sessionUserId := range st.sessions {
+		if sessionUserId == userId {
+			delete(st.sessions, token)
+		}
+	}
+}
+
+// The following methods assume the caller holds the lock.
+
+func (st *store) userByLogin(loginId string) *model.User {
+	for _, user := range st.users {
+		if user.Email == loginId || user.Username == loginId {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (st *store) userByUsername(username string) *model.User {
+	for _, user := range st.users {
+		if user.Username == username {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (st *store) teamByInviteId(inviteId string) *model.Team {
+	for _, team := range st.teams {
+		if team.InviteId == inviteId {
+			return team
+		}
+	}
+
+	return nil
+}
+
+func (st *store) channelByName(teamId, name string) *model.Channel {
+	for _, channel := range st.channels {
+		if channel.TeamId == teamId && channel.Name == name && channel.DeleteAt == 0 {
+			return channel
+		}
+	}
+
+	return nil
+}
+
+func (st *store) addTeamMember(teamId, userId string) *model.TeamMember {
+	members := st.teamMembers[teamId]
+	if members == nil {
+		members = make(map[string]*model.TeamMember)
+		st.teamMembers[teamId] = members
+	}
+
+	member := members[userId]
+	if member == nil {
+		member = &model.TeamMember{
+			TeamId:        teamId,
+			UserId:        userId,
+			Roles:         model.TEAM_USER_ROLE_ID,
+			SchemeUser:    true,
+			ExplicitRoles: "",
+		}
+		members[userId] = member
+	}
+	member.DeleteAt = 0
+
+	// Joining a team also joins its default channels, as on a real server.
+	for _, name := range []string{model.DEFAULT_CHANNEL, "off-topic"} {
+		if channel := st.channelByName(teamId, name); channel != nil {
+			st.addChannelMember(channel.Id, userId)
+		}
+	}
+
+	return member
+}
+
+func (st *store) addChannelMember(channelId, userId string) *model.ChannelMember {
+	members := st.channelMembers[channelId]
+	if members == nil {
+		members = make(map[string]*model.ChannelMember)
+		st.channelMembers[channelId] = members
+	}
+
+	member := members[userId]
+	if member == nil {
+		member = &model.ChannelMember{
+			ChannelId:    channelId,
+			UserId:       userId,
+			Roles:        model.CHANNEL_USER_ROLE_ID,
+			SchemeUser:   true,
+			NotifyProps:  model.GetDefaultChannelNotifyProps(),
+			LastViewedAt: model.GetMillis(),
+		}
+		members[userId] = member
+	}
+
+	return member
+}
+
+func (st *store) isChannelMember(channelId, userId string) bool {
+	_, ok := st.channelMembers[channelId][userId]
+	return ok
+}
+
+func (st *store) isSystemAdmin(userId string) bool {
+	user := st.users[userId]
+	return user != nil && user.IsInRole(model.SYSTEM_ADMIN_ROLE_ID)
+}
+
+// checkScheme checks that the user may assign the scheme, and that the scheme has the given
+// scope. No scheme at all stands for the default scheme.
+func (st *store) checkScheme(schemeId, scope, userId string) *model.AppError {
+	if !st.isSystemAdmin(userId) {
+		return model.NewAppError("checkScheme", "fakeserver.app_error", nil, "only system admins may assign schemes", http.StatusForbidden)
+	}
+	if schemeId == "" {
+		return nil
+	}
+	if scheme := st.schemes[schemeId]; scheme == nil || scheme.DeleteAt != 0 || scheme.Scope != scope {
+		return model.NewAppError("checkScheme", "fakeserver.app_error", nil, "no such "+scope+" scheme", http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (st *store) createChannel(channel *model.Channel) *model.Channel {
+	channel.PreSave()
+	st.channels[channel.Id] = channel
+	st.channelMembers[channel.Id] = make(map[string]*model.ChannelMember)
+
+	return channel
+}
+
+func (st *store) createPost(post *model.Post) *model.Post {
+	post.PreSave()
+	st.posts[post.Id] = post
+	st.channelPosts[post.ChannelId] = append(st.channelPosts[post.ChannelId], post.Id)
+	st.followThreadOnReply(post)
+
+	if channel := st.channels[post.ChannelId]; channel != nil {
+		channel.LastPostAt = post.CreateAt
+		channel.TotalMsgCount++
+	}
+
+	for _, fileId := range post.FileIds {
+		if info := st.files[fileId]; info != nil {
+			info.PostId = post.Id
+		}
+	}
+
+	return post
+}
+
+// clonePost copies a post along with its props, since model.Post.ToJson hides the integrations of
+// interactive messages by changing the attachments in the props of the post it is called on.
+func clonePost(post *model.Post) *model.Post {
+	copied := post.Clone()
+	if post.Props != nil {
+		props, _ := json.Marshal(post.Props)
+		copied.Props = nil
+		json.Unmarshal(props, &copied.Props)
+	}
+
+	return copied
+}
+
+// postList builds a post list from copies of the given posts, newest first.
+func (st *store) postList(postIds []string) *model.PostList {
+	list := model.NewPostList()
+	for i := len(postIds) - 1; i >= 0; i-- {
+		if post := st.posts[postIds[i]]; post != nil && post.DeleteAt == 0 {
+			list.AddPost(clonePost(post))
+			list.AddOrder(post.Id)
+		}
+	}
+
+	return list
+}
+
+func (st *store) status(userId string) *model.Status {
+	status := st.statuses[userId]
+	if status == nil {
+		status = &model.Status{
+			UserId:         userId,
+			Status:         model.STATUS_OFFLINE,
+			LastActivityAt: model.GetMillis(),
+		}
+		st.statuses[userId] = status
+	}
+
+	return status
+}
+
+func sanitizeUser(user *model.User) *model.User {
+	sanitized := *user
+	sanitized.Password = ""
+	sanitized.AuthData = nil
+
+	return &sanitized
+}
+
+func sortedUsers(users map[string]*model.User) []*model.User {
+	list := make([]*model.User, 0, len(users))
+	for _, user := range users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+
+	return list
+}
+
+func sortedChannels(channels []*model.Channel) []*model.Channel {
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+	return channels
+}
+
+func paginate(length, page, perPage int) (int, int) {
+	start := page * perPage
+	if start > length || start < 0 {
+		start = length
+	}
+	end := start + perPage
+	if end > length || perPage < 0 {
+		end = length
+	}
+
+	return start, end
+}
+
+func atoiDefault(value string, defaultValue int) int {
+	if value == "" {
+		return defaultValue
+	}
+
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+
+	return defaultValue
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return prefix != "" && strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Bot accounts are named BOT_USERNAME_PREFIX followed by their number, so that every loadtest
+// agent finds the same bots.
+const BOT_USERNAME_PREFIX = "loadtestbot"
+
+// BOT_TOKEN_DESCRIPTION describes the personal access tokens created for the bots.
+const BOT_TOKEN_DESCRIPTION = "loadtest"
+
+// BotAccount is a bot account that bot entities act as.
+type BotAccount struct {
+	UserId   string
+	Username string
+	// Token is a personal access token of the bot, created for this loadtest agent and revoked
+	// once the test ends.
+	Token   string
+	TokenId string
+	// ChannelIds are the channels the bot posts in.
+	ChannelIds []string
+}
+
+// checkConfigForBots configures the server to allow bot accounts and personal access tokens.
+func checkConfigForBots(adminClient *model.Client4) error {
+	serverConfig, resp := adminClient.GetConfig()
+	if serverConfig == nil {
+		mlog.Error("Failed to get the server config", mlog.Err(resp.Error))
+		return resp.Error
+	}
+
+	if !*serverConfig.ServiceSettings.EnableBotAccountCreation {
+		mlog.Info("Enabling bot accounts for the load test...")
+		*serverConfig.ServiceSettings.EnableBotAccountCreation = true
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EnableBotAccountCreation", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("EnableBotAccountCreation is true")
+
+	if !*serverConfig.ServiceSettings.EnableUserAccessTokens {
+		mlog.Info("Enabling personal access tokens for the load test...")
+		*serverConfig.ServiceSettings.EnableUserAccessTokens = true
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EnableUserAccessTokens", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("EnableUserAccessTokens is true")
+
+	return nil
+}
+
+// botChannelIds picks the channels bots post in: the first of each team's public channels by
+// name, leaving out town square.
+func botChannelIds(numChannelsPerTeam int, channelIdMap map[string]map[string]string) []string {
+	channelIds := []string{}
+	for _, channels := range channelIdMap {
+		names := make([]string, 0, len(channels))
+		for name := range channels {
+			if name != model.DEFAULT_CHANNEL {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		if len(names) > numChannelsPerTeam {
+			names = names[:numChannelsPerTeam]
+		}
+		for _, name := range names {
+			channelIds = append(channelIds, channels[name])
+		}
+	}
+
+	return channelIds
+}
+
+// setupBots creates the given number of bot accounts, or finds those created by earlier runs,
+// adds them to the teams and to the bot channels, and creates a personal access token for each.
+// The tokens are revoked by revokeBotTokens.
+func setupBots(adminClient *model.Client4, numBots, numChannelsPerTeam int, teamIdMap map[string]string, channelIdMap map[string]map[string]string) ([]BotAccount, error) {
+	channelIds := botChannelIds(numChannelsPerTeam, channelIdMap)
+
+	bots := make([]BotAccount, 0, numBots)
+	for i := 0; i < numBots; i++ {
+		username := fmt.Sprintf("%s%d", BOT_USERNAME_PREFIX, i)
+
+		var userId string
+		if user, resp := adminClient.GetUserByUsername(username, ""); resp.Error == nil {
+			if !user.IsBot {
+				return nil, fmt.Errorf("user %s already exists and is not a bot", username)
+			}
+			userId = user.Id
+		} else if resp.StatusCode == http.StatusNotFound {
+			bot, resp := adminClient.CreateBot(&model.Bot{
+				Username:    username,
+				DisplayName: fmt.Sprintf("Load Test Bot %d", i),
+				Description: "Posts for the load test",
+			})
+			if resp.Error != nil {
+				mlog.Error("Failed to create bot", mlog.String("username", username), mlog.Err(resp.Error))
+				return nil, resp.Error
+			}
+			userId = bot.UserId
+		} else {
+			mlog.Error("Failed to get bot", mlog.String("username", username), mlog.Err(resp.Error))
+			return nil, resp.Error
+		}
+
+		for teamName, teamId := range teamIdMap {
+			if _, resp := adminClient.AddTeamMember(teamId, userId); resp.Error != nil {
+				mlog.Error("Failed to add bot to team", mlog.String("username", username), mlog.String("team", teamName), mlog.Err(resp.Error))
+				return nil, resp.Error
+			}
+		}
+		for _, channelId := range channelIds {
+			if _, resp := adminClient.AddChannelMember(channelId, userId); resp.Error != nil {
+				mlog.Error("Failed to add bot to channel", mlog.String("username", username), mlog.String("channel_id", channelId), mlog.Err(resp.Error))
+				return nil, resp.Error
+			}
+		}
+
+		token, resp := adminClient.CreateUserAccessToken(userId, BOT_TOKEN_DESCRIPTION)
+		if resp.Error != nil {
+			mlog.Error("Failed to create bot access token", mlog.String("username", username), mlog.Err(resp.Error))
+			return nil, resp.Error
+		}
+
+		bots = append(bots, BotAccount{
+			UserId:     userId,
+			Username:   username,
+			Token:      token.Token,
+			TokenId:    token.Id,
+			ChannelIds: channelIds,
+		})
+	}
+
+	mlog.Info("Bots are set up", mlog.Int("bots", len(bots)), mlog.Int("channels", len(channelIds)))
+
+	return bots, nil
+}
+
+// hasBotEntities tells whether any of the test's entities act as bots.
+func hasBotEntities(test *TestRun) bool {
+	for _, choice := range test.UserEntities {
+		if choice.Weight > 0 && choice.Item.(UserEntityWithRateMultiplier).Entity.Bot {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revokeBotTokens revokes the personal access tokens created by setupBots, so that runs of the
+// loadtest do not pile up tokens on the bots.
+func revokeBotTokens(adminClient *model.Client4, bots []BotAccount) {
+	for _, bot := range bots {
+		if _, resp := adminClient.RevokeUserAccessToken(bot.TokenId); resp.Error != nil {
+			mlog.Error("Failed to revoke bot access token", mlog.String("username", bot.Username), mlog.Err(resp.Error))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotChannelIds(t *testing.T) {
+	channelIdMap := map[string]map[string]string{
+		"team0": {"town-square": "channelid0", "off-topic": "channelid1", "alpha": "channelid2"},
+		"team1": {"town-square": "channelid3"},
+	}
+
+	assert.Equal(t, []string{"channelid2"}, botChannelIds(1, channelIdMap))
+	assert.ElementsMatch(t, []string{"channelid1", "channelid2"}, botChannelIds(5, channelIdMap))
+	assert.Empty(t, botChannelIds(0, channelIdMap))
+}
+
+func TestHasBotEntities(t *testing.T) {
+	assert.True(t, hasBotEntities(&TestBots))
+	assert.False(t, hasBotEntities(&TestStatuses))
+	assert.False(t, hasBotEntities(&TestRun{UserEntities: []randutil.Choice{
+		{Item: UserEntityWithRateMultiplier{Entity: botUserEntity, RateMultiplier: 1}, Weight: 0},
+	}}), "entities that are never picked should not count")
+}
+
+func TestSetupBots(t *testing.T) {
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	team := s.CreateTeam(&model.Team{Name: "team0", DisplayName: "Team 0"})
+	channel := s.CreateChannel(&model.Channel{TeamId: team.Id, Name: "alpha", DisplayName: "Alpha", Type: model.CHANNEL_OPEN})
+	admin := s.CreateUser(&model.User{Username: "admin", Email: "success+admin@simulator.amazonses.com", Roles: model.SYSTEM_ADMIN_ROLE_ID + " " + model.SYSTEM_USER_ROLE_ID}, "password")
+	s.AddTeamMember(team.Id, admin.Id)
+
+	adminClient := model.NewAPIv4Client(serverURL)
+	_, resp := adminClient.Login("success+admin@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	teamIdMap := map[string]string{team.Name: team.Id}
+	channelIdMap := map[string]map[string]string{team.Name: {model.DEFAULT_CHANNEL: s.GetChannelByName(team.Id, model.DEFAULT_CHANNEL).Id, "alpha": channel.Id}}
+
+	_, err := setupBots(adminClient, 2, 1, teamIdMap, channelIdMap)
+	require.Error(t, err, "bot accounts should be disabled by default")
+
+	require.NoError(t, checkConfigForBots(adminClient))
+	bots, err := setupBots(adminClient, 2, 1, teamIdMap, channelIdMap)
+	require.NoError(t, err)
+	require.Len(t, bots, 2)
+	assert.Equal(t, "loadtestbot0", bots[0].Username)
+	assert.Equal(t, []string{channel.Id}, bots[0].ChannelIds)
+
+	again, err := setupBots(adminClient, 2, 1, teamIdMap, channelIdMap)
+	require.NoError(t, err)
+	require.Len(t, again, 2)
+	assert.Equal(t, bots[0].UserId, again[0].UserId, "setting up again should find the existing bots")
+	assert.NotEqual(t, bots[0].Token, again[0].Token)
+
+	revokeBotTokens(adminClient, again)
+	_, resp = newClientFromToken(&http.Client{}, again[0].Token, serverURL).GetMe("")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "revoked tokens should no longer authenticate")
+	_, resp = newClientFromToken(&http.Client{}, bots[0].Token, serverURL).GetMe("")
+	assert.Nil(t, resp.Error, "tokens of other setups should be left alone")
+
+	c, _, _, _ := newTestEntityConfig()
+	c.Client = &apiClient{newClientFromToken(&http.Client{}, bots[0].Token, serverURL)}
+	c.bot = &bots[0]
+	c.r = rand.New(rand.NewSource(1))
+
+	actionBotPost(c)
+	actionBotUpdatePost(c)
+
+	posts := s.GetPostsForChannel(channel.Id)
+	require.Len(t, posts.Order, 1)
+	posted := posts.Posts[posts.Order[0]]
+	assert.Equal(t, bots[0].UserId, posted.UserId)
+	assert.NotZero(t, posted.EditAt, "the bot should have updated its post")
+
+	s.CreateUser(&model.User{Username: "loadtestbot2", Email: "success+loadtestbot2@simulator.amazonses.com"}, "password")
+	_, err = setupBots(adminClient, 3, 1, teamIdMap, channelIdMap)
+	assert.Error(t, err, "users that are not bots should not be taken over")
+}
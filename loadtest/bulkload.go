@@ -21,6 +21,7 @@ import (
 
 	"github.com/go-sql-driver/mysql"
 	sqlx "github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 
 	_ "github.com/lib/pq"
 
@@ -37,6 +38,12 @@ const (
 	DEFAULT_PERMISSIONS_CHANNEL_USER  = "read_channel add_reaction remove_reaction manage_public_channel_members upload_file get_public_link create_post use_slash_commands manage_private_channel_members delete_post edit_post"
 )
 
+// Bulkloaded schemes are named with these prefixes, telling them apart from other schemes.
+const (
+	TEAM_SCHEME_NAME_PREFIX    = "loadtestteamscheme"
+	CHANNEL_SCHEME_NAME_PREFIX = "loadtestchannelscheme"
+)
+
 type LoadtestEnviromentConfig struct {
 	NumTeams                  int
 	NumChannelsPerTeam        int
@@ -48,6 +55,13 @@ type LoadtestEnviromentConfig struct {
 	NumChannelSchemes         int
 	NumEmoji                  int
 	NumPlugins                int
+	NumBots                   int
+	NumBotChannelsPerTeam     int
+
+	// PluginBundles are the plugins installed by the server setup, of which the first
+	// NumPlugins are installed.
+	PluginBundles          []string
+	LoadtestPluginSettings LoadtestPluginSettings
 
 	PercentHighVolumeChannels float64
 	PercentMidVolumeChannels  float64
@@ -142,6 +156,12 @@ type UserImportData struct {
 	CollapsePreviews   string `json:"link_previews,omitempty"`
 	MessageDisplay     string `json:"message_display,omitempty"`
 	ChannelDisplayMode string `json:"channel_display_mode,omitempty"`
+
+	NotifyProps *UserNotifyPropsImportData `json:"notify_props,omitempty"`
+}
+
+type UserNotifyPropsImportData struct {
+	MentionKeys string `json:"mention_keys,omitempty"`
 }
 
 type UserTeamImportData struct {
@@ -284,7 +304,7 @@ func generateTeamSchemes(numSchemes int) *[]SchemeImportData {
 
 	for schemeNum := 0; schemeNum < numSchemes; schemeNum++ {
 		teamSchemes = append(teamSchemes, SchemeImportData{
-			Name:        "loadtestteamscheme" + strconv.Itoa(schemeNum),
+			Name:        TEAM_SCHEME_NAME_PREFIX + strconv.Itoa(schemeNum),
 			DisplayName: "Loadtest Team Scheme " + strconv.Itoa(schemeNum),
 			Scope:       "team", // model.SCHEME_SCOPE_TEAM
 			DefaultTeamAdminRole: &RoleImportData{
@@ -318,7 +338,7 @@ func generateChannelSchemes(numSchemes int) *[]SchemeImportData {
 
 	for schemeNum := 0; schemeNum < numSchemes; schemeNum++ {
 		channelSchemes = append(channelSchemes, SchemeImportData{
-			Name:        "loadtestchannelscheme" + strconv.Itoa(schemeNum),
+			Name:        CHANNEL_SCHEME_NAME_PREFIX + strconv.Itoa(schemeNum),
 			DisplayName: "Loadtest Channel Scheme " + strconv.Itoa(schemeNum),
 			Scope:       "channel", // model.SCHEME_SCOPE_CHANNEL
 			DefaultChannelAdminRole: &RoleImportData{
@@ -350,6 +370,15 @@ func generateEmoji(numEmoji int) []EmojiImportData {
 	return emojis
 }
 
+// Users are each given one of these words as a mention key, so that posts can mention them by keyword.
+var MENTION_KEYWORDS = []string{"hotfix", "oncall", "postmortem", "roadmap", "standup"}
+
+// makeMentionKeys returns the mention keys of the given user: their username, as the server
+// would have by default, and a keyword shared with other users.
+func makeMentionKeys(username string, userNumber int) string {
+	return username + ",@" + username + "," + MENTION_KEYWORDS[userNumber%len(MENTION_KEYWORDS)]
+}
+
 func makeUserName(userNumber int) string {
 	return strings.ToLower(fake.UserName()) + "-" + strconv.Itoa(userNumber)
 }
@@ -536,6 +565,9 @@ func GenerateBulkloadFile(config *LoadtestEnviromentConfig) GenerateBulkloadFile
 			Email:    "success+user" + strconv.Itoa(userNum) + "@simulator.amazonses.com",
 			Password: "Loadtestpassword1@#%",
 		}
+		user.NotifyProps = &UserNotifyPropsImportData{
+			MentionKeys: makeMentionKeys(user.Username, userNum),
+		}
 		// give 30% of users a name and/or nickname
 		if r.Intn(10) < 3 {
 			user.FirstName = fake.FirstName()
@@ -782,25 +814,34 @@ func GenerateBulkloadFile(config *LoadtestEnviromentConfig) GenerateBulkloadFile
 }
 
 func ConnectToDB(driverName, dataSource string) *sqlx.DB {
-	url, err := url.Parse(dataSource)
+	db, err := openDB(driverName, dataSource)
 	if err != nil {
-		mlog.Error("Unable to parse datasource", mlog.Err(err))
+		mlog.Error("Unable to connect to database", mlog.Err(err))
 		return nil
 	}
+
+	return db
+}
+
+// openDB opens a connection to the database and checks that it can be reached.
+func openDB(driverName, dataSource string) (*sqlx.DB, error) {
+	url, err := url.Parse(dataSource)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse datasource")
+	}
 	if driverName == "mysql" {
 		url.RawQuery = "charset=utf8mb4,utf8"
 	}
 	db, err := sqlx.Open(driverName, url.String())
 	if err != nil {
-		mlog.Error("Unable to open database", mlog.Err(err))
-		return nil
+		return nil, errors.Wrap(err, "unable to open database")
 	}
 	if err := db.Ping(); err != nil {
-		mlog.Error("Unable to ping DB", mlog.Err(err))
-		return nil
+		db.Close()
+		return nil, errors.Wrap(err, "unable to ping DB")
 	}
 
-	return db
+	return db, nil
 }
 
 func LoadPosts(cfg *LoadTestConfig, driverName, dataSource string) {
@@ -812,7 +853,14 @@ func LoadPosts(cfg *LoadTestConfig, driverName, dataSource string) {
 		return
 	}
 
+	httpClient, err := newHTTPClient(&cfg.ConnectionConfiguration)
+	if err != nil {
+		mlog.Error("Unable to configure connections for loadposts", mlog.Err(err))
+		return
+	}
+
 	adminClient := model.NewAPIv4Client(cfg.ConnectionConfiguration.ServerURL)
+	adminClient.HttpClient = httpClient
 	if _, resp := adminClient.Login(cfg.ConnectionConfiguration.AdminEmail, cfg.ConnectionConfiguration.AdminPassword); resp.Error != nil {
 		mlog.Error("Unable to login as admin for loadposts", mlog.Err(resp.Error))
 	}
@@ -4,17 +4,489 @@
 package loadtest
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
+
 	"github.com/mattermost/mattermost-server/v5/mlog"
 	"github.com/mattermost/mattermost-server/v5/model"
 )
 
+// Client is the subset of the Mattermost API used by user entities. It is satisfied by
+// apiClient, and exists so that actions can be exercised against a mock.
+type Client interface {
+	Login(loginId string, password string) (*model.User, *model.Response)
+	GetMe(etag string) (*model.User, *model.Response)
+	UpdateUser(user *model.User) (*model.User, *model.Response)
+	PatchUser(userId string, patch *model.UserPatch) (*model.User, *model.Response)
+	SetProfileImage(userId string, data []byte) (bool, *model.Response)
+	GetUsers(page int, perPage int, etag string) ([]*model.User, *model.Response)
+	SearchUsers(search *model.UserSearch) ([]*model.User, *model.Response)
+	GetUsersByIds(userIds []string) ([]*model.User, *model.Response)
+	GetUsersByUsernames(usernames []string) ([]*model.User, *model.Response)
+	GetUsersStatusesByIds(userIds []string) ([]*model.Status, *model.Response)
+	UpdateUserStatus(userId string, userStatus *model.Status) (*model.Status, *model.Response)
+	UpdateUserCustomStatus(userId string, customStatus *CustomStatus) (bool, *model.Response)
+	RemoveUserCustomStatus(userId string) (bool, *model.Response)
+
+	CreateTeam(team *model.Team) (*model.Team, *model.Response)
+	GetTeam(teamId, etag string) (*model.Team, *model.Response)
+	GetAllTeams(etag string, page int, perPage int) ([]*model.Team, *model.Response)
+	SoftDeleteTeam(teamId string) (bool, *model.Response)
+	GetTeamInviteInfo(inviteId string) (*model.Team, *model.Response)
+	InviteUsersToTeam(teamId string, userEmails []string) (bool, *model.Response)
+	AddTeamMember(teamId, userId string) (*model.TeamMember, *model.Response)
+	AddTeamMemberFromInvite(token, inviteId string) (*model.TeamMember, *model.Response)
+	RemoveTeamMember(teamId, userId string) (bool, *model.Response)
+	GetTeamsUnreadForUser(userId, teamIdToExclude string) ([]*model.TeamUnread, *model.Response)
+
+	CreateChannel(channel *model.Channel) (*model.Channel, *model.Response)
+	CreateDirectChannel(userId1, userId2 string) (*model.Channel, *model.Response)
+	CreateGroupChannel(userIds []string) (*model.Channel, *model.Response)
+	GetChannel(channelId, etag string) (*model.Channel, *model.Response)
+	DeleteChannel(channelId string) (bool, *model.Response)
+	GetChannelStats(channelId string, etag string) (*model.ChannelStats, *model.Response)
+	GetChannelMember(channelId, userId, etag string) (*model.ChannelMember, *model.Response)
+	GetChannelMembers(channelId string, page, perPage int, etag string) (*model.ChannelMembers, *model.Response)
+	AddChannelMember(channelId, userId string) (*model.ChannelMember, *model.Response)
+	RemoveUserFromChannel(channelId, userId string) (bool, *model.Response)
+	GetChannelsForTeamForUser(teamId, userId, etag string) ([]*model.Channel, *model.Response)
+	GetPublicChannelsForTeam(teamId string, page int, perPage int, etag string) ([]*model.Channel, *model.Response)
+	AutocompleteChannelsForTeam(teamId, name string) (*model.ChannelList, *model.Response)
+	SearchChannels(teamId string, search *model.ChannelSearch) ([]*model.Channel, *model.Response)
+	ViewChannel(userId string, view *model.ChannelView) (*model.ChannelViewResponse, *model.Response)
+	UpdateChannelNotifyProps(channelId, userId string, props map[string]string) (bool, *model.Response)
+	GetChannelUnread(channelId, userId string) (*model.ChannelUnread, *model.Response)
+
+	CreatePost(post *model.Post) (*model.Post, *model.Response)
+	GetPostsForChannel(channelId string, page, perPage int, etag string) (*model.PostList, *model.Response)
+	GetPostsBefore(channelId, postId string, page, perPage int, etag string) (*model.PostList, *model.Response)
+	GetPostsAfter(channelId, postId string, page, perPage int, etag string) (*model.PostList, *model.Response)
+	GetPostsAroundLastUnread(userId, channelId string, limitBefore, limitAfter int) (*model.PostList, *model.Response)
+	GetPostsSince(channelId string, time int64) (*model.PostList, *model.Response)
+	GetPostThread(postId string, etag string) (*model.PostList, *model.Response)
+	GetPinnedPosts(channelId string, etag string) (*model.PostList, *model.Response)
+	GetFlaggedPostsForUser(userId string, page int, perPage int) (*model.PostList, *model.Response)
+	PatchPost(postId string, patch *model.PostPatch) (*model.Post, *model.Response)
+	DeletePost(postId string) (bool, *model.Response)
+	PinPost(postId string) (bool, *model.Response)
+	UnpinPost(postId string) (bool, *model.Response)
+	SearchPosts(teamId string, terms string, isOrSearch bool) (*model.PostList, *model.Response)
+	SaveReaction(reaction *model.Reaction) (*model.Reaction, *model.Response)
+	GetReactions(postId string) ([]*model.Reaction, *model.Response)
+
+	UpdatePreferences(userId string, preferences *model.Preferences) (bool, *model.Response)
+	DeletePreferences(userId string, preferences *model.Preferences) (bool, *model.Response)
+
+	GetSidebarCategoriesForTeamForUser(userId, teamId, etag string) (*OrderedSidebarCategories, *model.Response)
+	CreateSidebarCategoryForTeamForUser(userId, teamId string, category *SidebarCategoryWithChannels) (*SidebarCategoryWithChannels, *model.Response)
+	UpdateSidebarCategoriesForTeamForUser(userId, teamId string, categories []*SidebarCategoryWithChannels) ([]*SidebarCategoryWithChannels, *model.Response)
+	UpdateSidebarCategoryOrderForTeamForUser(userId, teamId string, order []string) ([]string, *model.Response)
+
+	GetUserThreads(userId, teamId string, page, perPage int) (*Threads, *model.Response)
+	UpdateThreadFollowForUser(userId, teamId, threadId string, state bool) (bool, *model.Response)
+	UpdateThreadReadForUser(userId, teamId, threadId string, timestamp int64) (bool, *model.Response)
+
+	UploadFile(data []byte, channelId string, filename string) (*model.FileUploadResponse, *model.Response)
+	GetFile(fileId string) ([]byte, *model.Response)
+	GetFilePreview(fileId string) ([]byte, *model.Response)
+	GetFileLink(fileId string) (string, *model.Response)
+	GetPublicFile(link string) ([]byte, *model.Response)
+	SearchFiles(teamId string, terms string, isOrSearch bool) (*FileInfoList, *model.Response)
+	ExecuteCommand(channelId, command string) (*model.CommandResponse, *model.Response)
+	DoPostActionWithCookie(postId, actionId, selected, cookieStr string) (bool, *model.Response)
+	PostIncomingWebhook(hookId string, request *model.IncomingWebhookRequest) (bool, *model.Response)
+	DoPluginRequest(method, pluginId, path string, data []byte) ([]byte, *model.Response)
+	GetFileInfosForPost(postId string, etag string) ([]*model.FileInfo, *model.Response)
+	GetFileThumbnail(fileId string) ([]byte, *model.Response)
+
+	GetEmojiByName(name string) (*model.Emoji, *model.Response)
+	OpenGraph(url string) (map[string]string, *model.Response)
+	GetWebappPlugins() ([]*model.Manifest, *model.Response)
+}
+
+// AdminClient is the subset of the Mattermost API used by user entities when acting as the
+// system admin. It is satisfied by *model.Client4.
+type AdminClient interface {
+	GetChannelByName(channelName, teamId string, etag string) (*model.Channel, *model.Response)
+	CreateIncomingWebhook(hook *model.IncomingWebhook) (*model.IncomingWebhook, *model.Response)
+	UpdateUserActive(userId string, active bool) (bool, *model.Response)
+	PatchTeam(teamId string, patch *model.TeamPatch) (*model.Team, *model.Response)
+	SetTeamIcon(teamId string, data []byte) (bool, *model.Response)
+	RegenerateTeamInviteId(teamId string) (*model.Team, *model.Response)
+	GetSchemes(scope string, page int, perPage int) ([]*model.Scheme, *model.Response)
+	GetRoleByName(name string) (*model.Role, *model.Response)
+	PatchRole(roleId string, patch *model.RolePatch) (*model.Role, *model.Response)
+	UpdateTeamScheme(teamId, schemeId string) (bool, *model.Response)
+	UpdateChannelScheme(channelId, schemeId string) (bool, *model.Response)
+	UpdateChannelMemberSchemeRoles(channelId string, userId string, schemeRoles *model.SchemeRoles) (bool, *model.Response)
+	GetTeam(teamId, etag string) (*model.Team, *model.Response)
+	GetChannel(channelId, etag string) (*model.Channel, *model.Response)
+}
+
+// WebSocketClient is the websocket connection used by user entities.
+type WebSocketClient interface {
+	Connect() *model.AppError
+	Listen()
+	Close()
+	// Events returns the channel on which events are delivered. It is closed when the
+	// connection is lost.
+	Events() <-chan *model.WebSocketEvent
+	// ListenError returns the error which caused the connection to be lost, if any.
+	ListenError() *model.AppError
+	// Responses returns the channel on which the responses to requests are delivered. It must be
+	// drained, since the connection stops reading once it is full, and is closed along with the
+	// events channel.
+	Responses() <-chan *model.WebSocketResponse
+	UserTyping(channelId, parentId string)
+	GetStatusesByIds(userIds []string)
+}
+
+// webSocketClient adapts *model.WebSocketClient to the WebSocketClient interface.
+type webSocketClient struct {
+	*model.WebSocketClient
+	dialer *websocket.Dialer
+
+	// sendLock serializes requests, which may be sent by actions and by status polling at the
+	// same time, and connecting, which replaces the connection they are sent on.
+	sendLock sync.Mutex
+}
+
+func newWebSocketClient(dialer *websocket.Dialer, url, authToken string) (WebSocketClient, *model.AppError) {
+	client, err := model.NewWebSocketClient4WithDialer(dialer, url, authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webSocketClient{WebSocketClient: client, dialer: dialer}, nil
+}
+
+// Connect reconnects using the same dialer the connection was first established with.
+func (wsc *webSocketClient) Connect() *model.AppError {
+	wsc.sendLock.Lock()
+	defer wsc.sendLock.Unlock()
+
+	return wsc.WebSocketClient.ConnectWithDialer(wsc.dialer)
+}
+
+func (wsc *webSocketClient) Events() <-chan *model.WebSocketEvent {
+	return wsc.WebSocketClient.EventChannel
+}
+
+func (wsc *webSocketClient) ListenError() *model.AppError {
+	return wsc.WebSocketClient.ListenError
+}
+
+func (wsc *webSocketClient) Responses() <-chan *model.WebSocketResponse {
+	return wsc.WebSocketClient.ResponseChannel
+}
+
+func (wsc *webSocketClient) UserTyping(channelId, parentId string) {
+	wsc.sendLock.Lock()
+	defer wsc.sendLock.Unlock()
+
+	wsc.WebSocketClient.UserTyping(channelId, parentId)
+}
+
+func (wsc *webSocketClient) GetStatusesByIds(userIds []string) {
+	wsc.sendLock.Lock()
+	defer wsc.sendLock.Unlock()
+
+	wsc.WebSocketClient.GetStatusesByIds(userIds)
+}
+
+// apiClient extends *model.Client4 with the parts of the API added to the server after the
+// version of the model package in use.
+type apiClient struct {
+	*model.Client4
+}
+
+var _ Client = &apiClient{}
+
+// Threads is a page of the collapsed reply threads a user follows in a team.
+type Threads struct {
+	Total               int64             `json:"total"`
+	TotalUnreadMentions int64             `json:"total_unread_mentions"`
+	Threads             []*ThreadResponse `json:"threads"`
+}
+
+// ThreadResponse is a thread followed by a user, along with how much of it they have read.
+type ThreadResponse struct {
+	PostId         string `json:"id"`
+	ReplyCount     int64  `json:"reply_count"`
+	LastReplyAt    int64  `json:"last_reply_at"`
+	LastViewedAt   int64  `json:"last_viewed_at"`
+	UnreadReplies  int64  `json:"unread_replies"`
+	UnreadMentions int64  `json:"unread_mentions"`
+}
+
+func (c *apiClient) userThreadsRoute(userId, teamId string) string {
+	return fmt.Sprintf("/users/%v/teams/%v/threads", userId, teamId)
+}
+
+func (c *apiClient) GetUserThreads(userId, teamId string, page, perPage int) (*Threads, *model.Response) {
+	r, appErr := c.DoApiGet(c.userThreadsRoute(userId, teamId)+fmt.Sprintf("?page=%v&per_page=%v", page, perPage), "")
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	var threads Threads
+	if err := json.NewDecoder(r.Body).Decode(&threads); err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("GetUserThreads", "api.unmarshal_error", nil, err.Error(), http.StatusInternalServerError))
+	}
+
+	return &threads, model.BuildResponse(r)
+}
+
+// UpdateThreadFollowForUser starts or stops following the thread with the given root post.
+func (c *apiClient) UpdateThreadFollowForUser(userId, teamId, threadId string, state bool) (bool, *model.Response) {
+	route := c.userThreadsRoute(userId, teamId) + fmt.Sprintf("/%v/following", threadId)
+
+	var r *http.Response
+	var appErr *model.AppError
+	if state {
+		r, appErr = c.DoApiPut(route, "")
+	} else {
+		r, appErr = c.DoApiDelete(route)
+	}
+	if appErr != nil {
+		return false, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	return model.CheckStatusOK(r), model.BuildResponse(r)
+}
+
+// UpdateThreadReadForUser marks the thread with the given root post as read up to the given time.
+func (c *apiClient) UpdateThreadReadForUser(userId, teamId, threadId string, timestamp int64) (bool, *model.Response) {
+	r, appErr := c.DoApiPut(c.userThreadsRoute(userId, teamId)+fmt.Sprintf("/%v/read/%v", threadId, timestamp), "")
+	if appErr != nil {
+		return false, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	return r.StatusCode == http.StatusOK, model.BuildResponse(r)
+}
+
+// The types of sidebar categories. Every user has one category of each type but custom in every
+// team, in which channels are shown unless moved elsewhere.
+const (
+	SIDEBAR_CATEGORY_CUSTOM          = "custom"
+	SIDEBAR_CATEGORY_CHANNELS        = "channels"
+	SIDEBAR_CATEGORY_DIRECT_MESSAGES = "direct_messages"
+	SIDEBAR_CATEGORY_FAVORITES       = "favorites"
+)
+
+// SidebarCategory is a group of channels in a user's sidebar.
+type SidebarCategory struct {
+	Id          string `json:"id"`
+	UserId      string `json:"user_id"`
+	TeamId      string `json:"team_id"`
+	SortOrder   int64  `json:"sort_order"`
+	Type        string `json:"type"`
+	DisplayName string `json:"display_name"`
+	Muted       bool   `json:"muted"`
+	Collapsed   bool   `json:"collapsed"`
+}
+
+// SidebarCategoryWithChannels is a sidebar category along with its channels, in order.
+type SidebarCategoryWithChannels struct {
+	SidebarCategory
+	Channels []string `json:"channel_ids"`
+}
+
+// OrderedSidebarCategories are a user's sidebar categories in a team, and the order of their ids.
+type OrderedSidebarCategories struct {
+	Categories []*SidebarCategoryWithChannels `json:"categories"`
+	Order      []string                       `json:"order"`
+}
+
+func (c *apiClient) sidebarCategoriesRoute(userId, teamId string) string {
+	return fmt.Sprintf("/users/%v/teams/%v/channels/categories", userId, teamId)
+}
+
+func (c *apiClient) GetSidebarCategoriesForTeamForUser(userId, teamId, etag string) (*OrderedSidebarCategories, *model.Response) {
+	r, appErr := c.DoApiGet(c.sidebarCategoriesRoute(userId, teamId), etag)
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	var categories OrderedSidebarCategories
+	if err := json.NewDecoder(r.Body).Decode(&categories); err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("GetSidebarCategoriesForTeamForUser", "api.unmarshal_error", nil, err.Error(), http.StatusInternalServerError))
+	}
+
+	return &categories, model.BuildResponse(r)
+}
+
+func (c *apiClient) CreateSidebarCategoryForTeamForUser(userId, teamId string, category *SidebarCategoryWithChannels) (*SidebarCategoryWithChannels, *model.Response) {
+	data, _ := json.Marshal(category)
+	r, appErr := c.DoApiPost(c.sidebarCategoriesRoute(userId, teamId), string(data))
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	var created SidebarCategoryWithChannels
+	if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("CreateSidebarCategoryForTeamForUser", "api.unmarshal_error", nil, err.Error(), http.StatusInternalServerError))
+	}
+
+	return &created, model.BuildResponse(r)
+}
+
+// UpdateSidebarCategoriesForTeamForUser replaces the given categories, moving any of their channels
+// out of the user's other categories.
+func (c *apiClient) UpdateSidebarCategoriesForTeamForUser(userId, teamId string, categories []*SidebarCategoryWithChannels) ([]*SidebarCategoryWithChannels, *model.Response) {
+	data, _ := json.Marshal(categories)
+	r, appErr := c.DoApiPut(c.sidebarCategoriesRoute(userId, teamId), string(data))
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	var updated []*SidebarCategoryWithChannels
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("UpdateSidebarCategoriesForTeamForUser", "api.unmarshal_error", nil, err.Error(), http.StatusInternalServerError))
+	}
+
+	return updated, model.BuildResponse(r)
+}
+
+func (c *apiClient) UpdateSidebarCategoryOrderForTeamForUser(userId, teamId string, order []string) ([]string, *model.Response) {
+	r, appErr := c.DoApiPut(c.sidebarCategoriesRoute(userId, teamId)+"/order", model.ArrayToJson(order))
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	return model.ArrayFromJson(r.Body), model.BuildResponse(r)
+}
+
+// CustomStatus is the emoji and text a user shows next to their name.
+type CustomStatus struct {
+	Emoji string `json:"emoji"`
+	Text  string `json:"text"`
+}
+
+func (c *apiClient) userCustomStatusRoute(userId string) string {
+	return fmt.Sprintf("/users/%v/status/custom", userId)
+}
+
+// UpdateUserCustomStatus sets the custom status of the user.
+func (c *apiClient) UpdateUserCustomStatus(userId string, customStatus *CustomStatus) (bool, *model.Response) {
+	data, _ := json.Marshal(customStatus)
+	r, appErr := c.DoApiPut(c.userCustomStatusRoute(userId), string(data))
+	if appErr != nil {
+		return false, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	return model.CheckStatusOK(r), model.BuildResponse(r)
+}
+
+// RemoveUserCustomStatus clears the custom status of the user.
+func (c *apiClient) RemoveUserCustomStatus(userId string) (bool, *model.Response) {
+	r, appErr := c.DoApiDelete(c.userCustomStatusRoute(userId))
+	if appErr != nil {
+		return false, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	return model.CheckStatusOK(r), model.BuildResponse(r)
+}
+
+// FileInfoList is a page of files found by a search, in the order they should be shown.
+type FileInfoList struct {
+	Order     []string                   `json:"order"`
+	FileInfos map[string]*model.FileInfo `json:"file_infos"`
+}
+
+// SearchFiles searches the names and contents of the files attached to posts in the given team.
+func (c *apiClient) SearchFiles(teamId string, terms string, isOrSearch bool) (*FileInfoList, *model.Response) {
+	params := map[string]interface{}{"terms": terms, "is_or_search": isOrSearch}
+	data, _ := json.Marshal(params)
+
+	r, appErr := c.DoApiPost(c.GetTeamRoute(teamId)+"/files/search", string(data))
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	var list FileInfoList
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("SearchFiles", "api.unmarshal_error", nil, err.Error(), http.StatusInternalServerError))
+	}
+
+	return &list, model.BuildResponse(r)
+}
+
+// PostIncomingWebhook posts through an incoming webhook, as an external system would, without
+// authenticating.
+func (c *apiClient) PostIncomingWebhook(hookId string, request *model.IncomingWebhookRequest) (bool, *model.Response) {
+	data, _ := json.Marshal(request)
+
+	r, err := c.HttpClient.Post(c.Url+"/hooks/"+hookId, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return false, &model.Response{Error: model.NewAppError("PostIncomingWebhook", "model.client.connecting.app_error", nil, err.Error(), 0)}
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return false, model.BuildErrorResponse(r, model.AppErrorFromJson(r.Body))
+	}
+
+	return true, model.BuildResponse(r)
+}
+
+// DoPluginRequest makes a request to the HTTP endpoints of a server plugin, returning the body of
+// the response.
+func (c *apiClient) DoPluginRequest(method, pluginId, path string, data []byte) ([]byte, *model.Response) {
+	r, appErr := c.DoApiRequest(method, c.Url+"/plugins/"+pluginId+path, string(data), "")
+	if appErr != nil {
+		return nil, model.BuildErrorResponse(r, appErr)
+	}
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("DoPluginRequest", "model.client.read_body.app_error", nil, err.Error(), http.StatusInternalServerError))
+	}
+
+	return body, model.BuildResponse(r)
+}
+
+// GetPublicFile downloads a file through a public link, without authenticating.
+func (c *apiClient) GetPublicFile(link string) ([]byte, *model.Response) {
+	r, err := c.HttpClient.Get(link)
+	if err != nil {
+		return nil, &model.Response{Error: model.NewAppError("GetPublicFile", "model.client.connecting.app_error", nil, err.Error(), 0)}
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("GetPublicFile", "api.file.get_public_file.app_error", nil, "", r.StatusCode))
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, model.BuildErrorResponse(r, model.NewAppError("GetPublicFile", "model.client.read_file.app_error", nil, err.Error(), r.StatusCode))
+	}
+
+	return data, model.BuildResponse(r)
+}
+
 func newClientFromToken(httpClient *http.Client, token string, serverUrl string) *model.Client4 {
 	// Lifted from model.NewAPIv4Client
 	return &model.Client4{
@@ -36,6 +508,7 @@ func loginAsUsers(cfg *LoadTestConfig, adminClient *model.Client4, entityStartNu
 		entityNum := i + entityStartNum
 		userNum := entityNum
 		client := model.NewAPIv4Client(cfg.ConnectionConfiguration.ServerURL)
+		client.HttpClient = adminClient.HttpClient
 
 		// Random selection if picked.
 		if cfg.UserEntitiesConfiguration.RandomizeEntitySelection {
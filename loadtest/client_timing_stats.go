@@ -5,6 +5,7 @@ package loadtest
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
 	"time"
@@ -29,6 +30,8 @@ type RouteStats struct {
 	NumHits            int64
 	NumErrors          int64
 	ErrorRate          float64
+	NumRateLimited     int64
+	RateLimitedRate    float64
 	Duration           []float64
 	DurationLastMinute *ratecounter.AvgRateCounter `json:"-"`
 	Max                float64
@@ -38,6 +41,19 @@ type RouteStats struct {
 	Percentile90       float64
 	Percentile95       float64
 	InterQuartileRange float64
+
+	// CorrectedDuration holds latencies measured from each action's intended start time
+	// rather than from when the request was actually sent. It is only populated when
+	// coordinated omission correction is enabled.
+	CorrectedDuration     []float64
+	CorrectedMax          float64
+	CorrectedMean         float64
+	CorrectedMedian       float64
+	CorrectedPercentile90 float64
+	CorrectedPercentile95 float64
+
+	// Protocols counts the responses received over each negotiated protocol.
+	Protocols map[string]int64 `json:",omitempty"`
 }
 
 type ClientTimingStats struct {
@@ -58,24 +74,57 @@ func (s *RouteStats) AddSample(duration int64, status int) {
 	// Don't count non-ok status in statistics
 	if status >= 200 && status < 300 {
 		s.Duration = append(s.Duration, float64(duration))
+	} else if status == http.StatusTooManyRequests {
+		// Count rate limited requests separately from errors
+		s.NumRateLimited += 1
 	} else {
 		s.NumErrors += 1
 	}
 }
 
+// AddProtocol records the protocol a response was received over.
+func (s *RouteStats) AddProtocol(protocol string) {
+	s.addProtocolCount(protocol, 1)
+}
+
+func (s *RouteStats) addProtocolCount(protocol string, count int64) {
+	if s.Protocols == nil {
+		s.Protocols = make(map[string]int64)
+	}
+	s.Protocols[protocol] += count
+}
+
+// AddCorrectedSample records a latency corrected for coordinated omission. Unlike AddSample,
+// it does not count towards the number of hits.
+func (s *RouteStats) AddCorrectedSample(duration int64, status int) {
+	if status >= 200 && status < 300 {
+		s.CorrectedDuration = append(s.CorrectedDuration, float64(duration))
+	}
+}
+
 func (s *RouteStats) Merge(other *RouteStats) *RouteStats {
 	newRouteStats := &RouteStats{}
 	if s != nil {
 		newRouteStats.Name = s.Name
 		newRouteStats.NumHits = newRouteStats.NumHits + s.NumHits
 		newRouteStats.NumErrors = newRouteStats.NumErrors + s.NumErrors
+		newRouteStats.NumRateLimited = newRouteStats.NumRateLimited + s.NumRateLimited
 		newRouteStats.Duration = append(newRouteStats.Duration, s.Duration...)
+		newRouteStats.CorrectedDuration = append(newRouteStats.CorrectedDuration, s.CorrectedDuration...)
+		for protocol, count := range s.Protocols {
+			newRouteStats.addProtocolCount(protocol, count)
+		}
 	}
 	if other != nil {
 		newRouteStats.Name = other.Name
 		newRouteStats.NumHits = newRouteStats.NumHits + other.NumHits
 		newRouteStats.NumErrors = newRouteStats.NumErrors + other.NumErrors
+		newRouteStats.NumRateLimited = newRouteStats.NumRateLimited + other.NumRateLimited
 		newRouteStats.Duration = append(newRouteStats.Duration, other.Duration...)
+		newRouteStats.CorrectedDuration = append(newRouteStats.CorrectedDuration, other.CorrectedDuration...)
+		for protocol, count := range other.Protocols {
+			newRouteStats.addProtocolCount(protocol, count)
+		}
 	}
 
 	newRouteStats.CalcResults()
@@ -86,8 +135,10 @@ func (s *RouteStats) Merge(other *RouteStats) *RouteStats {
 func (s *RouteStats) CalcResults() {
 	if s.NumHits > 0 {
 		s.ErrorRate = float64(s.NumErrors) / float64(s.NumHits)
+		s.RateLimitedRate = float64(s.NumRateLimited) / float64(s.NumHits)
 	} else {
 		s.ErrorRate = 0
+		s.RateLimitedRate = 0
 	}
 	if len(s.Duration) > 0 {
 		s.Max, _ = stats.Max(s.Duration)
@@ -103,6 +154,16 @@ func (s *RouteStats) CalcResults() {
 		s.Percentile90, _ = stats.Percentile(s.Duration, 90)
 		s.Percentile95, _ = stats.Percentile(s.Duration, 95)
 	}
+
+	if len(s.CorrectedDuration) > 0 {
+		s.CorrectedMax, _ = stats.Max(s.CorrectedDuration)
+		s.CorrectedMean, _ = stats.Mean(s.CorrectedDuration)
+		s.CorrectedMedian, _ = stats.Median(s.CorrectedDuration)
+	}
+	if len(s.CorrectedDuration) > 2 {
+		s.CorrectedPercentile90, _ = stats.Percentile(s.CorrectedDuration, 90)
+		s.CorrectedPercentile95, _ = stats.Percentile(s.CorrectedDuration, 95)
+	}
 }
 
 func NewClientTimingStats() *ClientTimingStats {
@@ -121,6 +182,16 @@ func (ts *ClientTimingStats) AddRouteSample(route string, duration int64, status
 	}
 }
 
+func (ts *ClientTimingStats) AddCorrectedRouteSample(route string, duration int64, status int) {
+	if routestats, ok := ts.Routes[route]; ok {
+		routestats.AddCorrectedSample(duration, status)
+	} else {
+		newroutestats := NewRouteStats(route)
+		newroutestats.AddCorrectedSample(duration, status)
+		ts.Routes[route] = newroutestats
+	}
+}
+
 func (ts *ClientTimingStats) Merge(timings *ClientTimingStats) *ClientTimingStats {
 	newStats := NewClientTimingStats()
 
@@ -142,11 +213,13 @@ var teamPathRegex *regexp.Regexp = regexp.MustCompile("/teams/[a-z0-9]{26}/")
 var emojiPathRegex *regexp.Regexp = regexp.MustCompile("/emoji/name/[A-Za-z0-9]+")
 var channelPathRegex *regexp.Regexp = regexp.MustCompile("/channels/[a-z0-9]{26}/")
 var channelNamePathRegex *regexp.Regexp = regexp.MustCompile("/channels/name/[^/]+")
-var postPathRegex *regexp.Regexp = regexp.MustCompile("/posts/[a-z0-9]{26}/")
-var filePathRegex *regexp.Regexp = regexp.MustCompile("/files/[a-z0-9]{26}/")
+var postPathRegex *regexp.Regexp = regexp.MustCompile("/posts/[a-z0-9]{26}(/|$)")
+var filePathRegex *regexp.Regexp = regexp.MustCompile("/files/[a-z0-9]{26}(/|$)")
 var userPathRegex *regexp.Regexp = regexp.MustCompile("/users/[a-z0-9]{26}/")
 var userEmailPathRegex *regexp.Regexp = regexp.MustCompile("/users/email/[^/]+")
 var teamMembersForUserPathRegex *regexp.Regexp = regexp.MustCompile("/teams/[a-z0-9]{26}/members/[a-z0-9]{26}")
+var hookPathRegex *regexp.Regexp = regexp.MustCompile("^/hooks/[a-z0-9]{26}$")
+var pluginKVPathRegex *regexp.Regexp = regexp.MustCompile("^(/plugins/[^/]+)/kv/[^/]+$")
 
 func processCommonPaths(path string) string {
 	result := strings.TrimPrefix(path, model.API_URL_SUFFIX)
@@ -154,18 +227,30 @@ func processCommonPaths(path string) string {
 	result = teamPathRegex.ReplaceAllString(result, "/teams/[team id]/")
 	result = channelPathRegex.ReplaceAllString(result, "/channels/[channel id]/")
 	result = channelNamePathRegex.ReplaceAllString(result, "/channels/name/[channel name]/")
-	result = postPathRegex.ReplaceAllString(result, "/posts/[post id]/")
-	result = filePathRegex.ReplaceAllString(result, "/files/[post id]/")
+	result = postPathRegex.ReplaceAllString(result, "/posts/[post id]$1")
+	result = filePathRegex.ReplaceAllString(result, "/files/[post id]$1")
 	result = userPathRegex.ReplaceAllString(result, "/users/[user id]/")
 	result = userEmailPathRegex.ReplaceAllString(result, "/users/email/[email]")
 	result = emojiPathRegex.ReplaceAllString(result, "/emoji/name/[emoji name]")
+	result = hookPathRegex.ReplaceAllString(result, "/hooks/[hook id]")
+	result = pluginKVPathRegex.ReplaceAllString(result, "$1/kv/[key]")
 
 	return result
 }
 
 func (ts *ClientTimingStats) AddTimingReport(timingReport TimedRoundTripperReport) {
 	path := processCommonPaths(timingReport.Path)
-	ts.AddRouteSample(fmt.Sprintf("%s %s", timingReport.Method, path), int64(timingReport.RequestDuration/time.Millisecond), timingReport.StatusCode)
+	route := fmt.Sprintf("%s %s", timingReport.Method, path)
+	if timingReport.Endpoint != "" {
+		route = fmt.Sprintf("%s @%s", route, timingReport.Endpoint)
+	}
+	ts.AddRouteSample(route, int64(timingReport.RequestDuration/time.Millisecond), timingReport.StatusCode)
+	if timingReport.Protocol != "" {
+		ts.Routes[route].AddProtocol(timingReport.Protocol)
+	}
+	if timingReport.CorrectedDuration > 0 {
+		ts.AddCorrectedRouteSample(route, int64(timingReport.CorrectedDuration/time.Millisecond), timingReport.StatusCode)
+	}
 }
 
 // Score is the average of the 95th percentile, median and interquartile range of all routes.
@@ -19,37 +19,60 @@ type LoadTestConfig struct {
 }
 
 type UserEntitiesConfiguration struct {
-	TestLengthMinutes                 int
-	NumActiveEntities                 int
-	ActionRateMilliseconds            int
-	ActionRateMaxVarianceMilliseconds int
-	EnableRequestTiming               bool
-	ChannelLinkChance                 float64
-	UploadImageChance                 float64
-	LinkPreviewChance                 float64
-	CustomEmojiChance                 float64
-	CustomEmojiReactionChance         float64
-	SystemEmojiReactionChance         float64
-	NeedsProfilesByIdChance           float64
-	NeedsProfilesByUsernameChance     float64
-	NeedsProfileStatusChance          float64
-	DoStatusPolling                   bool
-	RandomizeEntitySelection          bool
-	UserProfileUpdateFullnameChance   float64
-	UserProfileUpdateUsernameChance   float64
-	UserProfileUpdateNicknameChance   float64
-	UserProfileUpdatePositionChance   float64
-	UserProfileUpdateEmailChance      float64
-	UserProfileUpdateImageChance      float64
-	PublicChannelCreationChance       float64
-	PrivateChannelCreationChance      float64
-	DirectChannelCreationChance       float64
-	GroupChannelCreationChance        float64
-	NumPostReactionsPerUser           int
-	PostReactionsRateMilliseconds     int
-	NumPostsGetBeforeAfter            int
-	GetPostsAroundLastUnreadChance    float64
-	NumGetPostsAroundLastUnread       int
+	TestLengthMinutes                     int
+	NumActiveEntities                     int
+	ActionRateMilliseconds                int
+	ActionRateMaxVarianceMilliseconds     int
+	EnableRequestTiming                   bool
+	CorrectCoordinatedOmission            bool
+	HonorRateLimitHeaders                 bool
+	ChannelLinkChance                     float64
+	UploadImageChance                     float64
+	LinkPreviewChance                     float64
+	CustomEmojiChance                     float64
+	CustomEmojiReactionChance             float64
+	SystemEmojiReactionChance             float64
+	NeedsProfilesByIdChance               float64
+	NeedsProfilesByUsernameChance         float64
+	NeedsProfileStatusChance              float64
+	DoStatusPolling                       bool
+	StatusPollingOverWebsocket            bool
+	RandomizeEntitySelection              bool
+	UserProfileUpdateFullnameChance       float64
+	UserProfileUpdateUsernameChance       float64
+	UserProfileUpdateNicknameChance       float64
+	UserProfileUpdatePositionChance       float64
+	UserProfileUpdateEmailChance          float64
+	UserProfileUpdateImageChance          float64
+	PublicChannelCreationChance           float64
+	PrivateChannelCreationChance          float64
+	DirectChannelCreationChance           float64
+	GroupChannelCreationChance            float64
+	NumPostReactionsPerUser               int
+	PostReactionsRateMilliseconds         int
+	NumPostsGetBeforeAfter                int
+	GetPostsAroundLastUnreadChance        float64
+	NumGetPostsAroundLastUnread           int
+	PostReplyChance                       float64
+	TypingCharactersPerEvent              int
+	CustomStatusClearChance               float64
+	MobileBackgroundSeconds               int
+	UserMentionChance                     float64
+	HereMentionChance                     float64
+	ChannelMentionChance                  float64
+	KeywordMentionChance                  float64
+	FileUploads                           []FileUpload
+	SlashCommandResponses                 []SlashCommandResponse
+	SlashCommandDelayMilliseconds         int
+	OutgoingWebhookChance                 float64
+	OutgoingWebhookReplyChance            float64
+	NumIncomingWebhooks                   int
+	IncomingWebhookPayloads               []IncomingWebhookPayload
+	IncomingWebhookUsernameOverrideChance float64
+	IncomingWebhookIconOverrideChance     float64
+	IncomingWebhookChannelOverrideChance  float64
+	NetworkConditions                     []NetworkConditions
+	ActionWeights                         []ActionWeight
 }
 
 type ConnectionConfiguration struct {
@@ -72,6 +95,20 @@ type ConnectionConfiguration struct {
 	MaxIdleConns                int
 	MaxIdleConnsPerHost         int
 	IdleConnTimeoutMilliseconds int
+	ConnectionModel             string
+	MaxConnsPerEntity           int
+	HTTPProtocol                string
+	TLSCAFile                   string
+	TLSClientCertFile           string
+	TLSClientKeyFile            string
+	TLSInsecureSkipVerify       bool
+	ServerEndpoints             []ServerEndpoint
+	EndpointStrategy            string
+	ReportTimingsByEndpoint     bool
+	IntegrationListenAddress    string
+	IntegrationURL              string
+	SMTPListenAddress           string
+	SMTPServerAddress           string
 }
 
 type ResultsConfiguration struct {
@@ -107,6 +144,11 @@ func ReadConfig() error {
 	viper.SetDefault("ConnectionConfiguration.MaxIdleConns", 100)
 	viper.SetDefault("ConnectionConfiguration.MaxIdleConnsPerHost", 128)
 	viper.SetDefault("ConnectionConfiguration.IdleConnTimeoutMilliseconds", 90000)
+	viper.SetDefault("ConnectionConfiguration.ConnectionModel", ConnectionModelShared)
+	viper.SetDefault("ConnectionConfiguration.MaxConnsPerEntity", 6)
+	viper.SetDefault("ConnectionConfiguration.HTTPProtocol", HTTPProtocolAuto)
+	viper.SetDefault("ConnectionConfiguration.EndpointStrategy", EndpointStrategyRoundRobin)
+	viper.SetDefault("UserEntitiesConfiguration.IncomingWebhookUsernameOverrideChance", 1)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return errors.Wrap(err, "unable to read configuration file")
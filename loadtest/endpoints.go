@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/url"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+)
+
+const (
+	// EndpointStrategyRoundRobin assigns entities to endpoints in turn by entity number.
+	EndpointStrategyRoundRobin = "round_robin"
+	// EndpointStrategyRandom assigns each entity to a uniformly random endpoint.
+	EndpointStrategyRandom = "random"
+	// EndpointStrategySticky assigns each user to the same endpoint on every run.
+	EndpointStrategySticky = "sticky"
+	// EndpointStrategyWeighted assigns entities to endpoints at random in proportion to their weights.
+	EndpointStrategyWeighted = "weighted"
+)
+
+// ServerEndpoint is a Mattermost app node that entities may target directly, bypassing the proxy.
+type ServerEndpoint struct {
+	Name         string
+	ServerURL    string
+	WebsocketURL string
+	Weight       int
+}
+
+// EndpointPicker assigns each entity the endpoint it will send all of its requests to.
+type EndpointPicker struct {
+	strategy  string
+	endpoints []ServerEndpoint
+	choices   []randutil.Choice
+	r         *rand.Rand
+}
+
+// NewEndpointPicker returns a picker for the endpoints configured in the connection configuration.
+// If no endpoints are configured, every entity is assigned the ServerURL and WebsocketURL.
+func NewEndpointPicker(cfg *ConnectionConfiguration, r *rand.Rand) (*EndpointPicker, error) {
+	endpoints := cfg.ServerEndpoints
+	if len(endpoints) == 0 {
+		endpoints = []ServerEndpoint{{ServerURL: cfg.ServerURL, WebsocketURL: cfg.WebsocketURL, Weight: 1}}
+	}
+
+	strategy := cfg.EndpointStrategy
+	if strategy == "" {
+		strategy = EndpointStrategyRoundRobin
+	}
+	switch strategy {
+	case EndpointStrategyRoundRobin, EndpointStrategyRandom, EndpointStrategySticky, EndpointStrategyWeighted:
+	default:
+		return nil, fmt.Errorf("unknown endpoint strategy %q", strategy)
+	}
+
+	picker := &EndpointPicker{
+		strategy:  strategy,
+		endpoints: make([]ServerEndpoint, 0, len(endpoints)),
+		r:         r,
+	}
+	for i, endpoint := range endpoints {
+		if endpoint.ServerURL == "" || endpoint.WebsocketURL == "" {
+			return nil, fmt.Errorf("endpoint %d is missing a server or websocket URL", i)
+		}
+		if endpoint.Name == "" {
+			serverURL, err := url.Parse(endpoint.ServerURL)
+			if err != nil {
+				return nil, fmt.Errorf("endpoint %d has an invalid server URL: %v", i, err)
+			}
+			endpoint.Name = serverURL.Host
+		}
+		if endpoint.Weight < 0 {
+			return nil, fmt.Errorf("endpoint %s has a negative weight", endpoint.Name)
+		}
+		if strategy == EndpointStrategyWeighted && endpoint.Weight == 0 {
+			continue
+		}
+
+		picker.endpoints = append(picker.endpoints, endpoint)
+		picker.choices = append(picker.choices, randutil.Choice{Item: endpoint, Weight: endpoint.Weight})
+	}
+	if len(picker.endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints with a positive weight")
+	}
+
+	return picker, nil
+}
+
+// Endpoints returns the endpoints entities may be assigned.
+func (p *EndpointPicker) Endpoints() []ServerEndpoint {
+	return p.endpoints
+}
+
+// Pick returns the endpoint for the given entity, logged in as the given user.
+func (p *EndpointPicker) Pick(entityNum int, username string) ServerEndpoint {
+	switch p.strategy {
+	case EndpointStrategyRandom:
+		return p.endpoints[p.r.Intn(len(p.endpoints))]
+	case EndpointStrategySticky:
+		hash := fnv.New32a()
+		hash.Write([]byte(username))
+		return p.endpoints[hash.Sum32()%uint32(len(p.endpoints))]
+	case EndpointStrategyWeighted:
+		if choice, err := randutil.WeightedChoice(p.r, p.choices); err == nil {
+			return choice.Item.(ServerEndpoint)
+		}
+	}
+
+	return p.endpoints[entityNum%len(p.endpoints)]
+}
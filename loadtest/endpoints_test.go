@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointPicker(t *testing.T) {
+	endpoints := []ServerEndpoint{
+		{Name: "app0", ServerURL: "http://app0:8065", WebsocketURL: "ws://app0:8065", Weight: 1},
+		{ServerURL: "http://app1:8065", WebsocketURL: "ws://app1:8065", Weight: 0},
+		{Name: "app2", ServerURL: "http://app2:8065", WebsocketURL: "ws://app2:8065", Weight: 3},
+	}
+
+	t.Run("defaults to the server url", func(t *testing.T) {
+		picker, err := NewEndpointPicker(&ConnectionConfiguration{ServerURL: "http://proxy:8065", WebsocketURL: "ws://proxy:8065"}, rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+
+		endpoint := picker.Pick(7, "user7")
+		assert.Equal(t, "proxy:8065", endpoint.Name)
+		assert.Equal(t, "http://proxy:8065", endpoint.ServerURL)
+		assert.Equal(t, "ws://proxy:8065", endpoint.WebsocketURL)
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		picker, err := NewEndpointPicker(&ConnectionConfiguration{ServerEndpoints: endpoints}, rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+
+		var names []string
+		for i := 0; i < 4; i++ {
+			names = append(names, picker.Pick(i, "").Name)
+		}
+		assert.Equal(t, []string{"app0", "app1:8065", "app2", "app0"}, names)
+	})
+
+	t.Run("sticky", func(t *testing.T) {
+		picker, err := NewEndpointPicker(&ConnectionConfiguration{ServerEndpoints: endpoints, EndpointStrategy: EndpointStrategySticky}, rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+
+		for _, username := range []string{"user0", "user1", "user2"} {
+			assert.Equal(t, picker.Pick(0, username), picker.Pick(5, username))
+		}
+	})
+
+	t.Run("weighted skips unweighted endpoints", func(t *testing.T) {
+		picker, err := NewEndpointPicker(&ConnectionConfiguration{ServerEndpoints: endpoints, EndpointStrategy: EndpointStrategyWeighted}, rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+		require.Len(t, picker.Endpoints(), 2)
+
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			counts[picker.Pick(i, "").Name]++
+		}
+		assert.Zero(t, counts["app1:8065"])
+		assert.True(t, counts["app2"] > counts["app0"])
+	})
+
+	t.Run("rejects an unknown strategy", func(t *testing.T) {
+		_, err := NewEndpointPicker(&ConnectionConfiguration{ServerEndpoints: endpoints, EndpointStrategy: "fastest"}, rand.New(rand.NewSource(1)))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects an endpoint without a websocket url", func(t *testing.T) {
+		_, err := NewEndpointPicker(&ConnectionConfiguration{ServerEndpoints: []ServerEndpoint{{ServerURL: "http://app0:8065"}}}, rand.New(rand.NewSource(1)))
+		assert.Error(t, err)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,22 +22,77 @@ type EntityConfig struct {
 	EntityNumber        int
 	EntityName          string
 	EntityActions       []randutil.Choice
+	EntityOnConnect     func(*EntityConfig)
 	UserData            UserImportData
 	Users               []UserImportData
 	ChannelMap          map[string]map[string]string
 	TeamMap             map[string]string
 	TownSquareMap       map[string]string
-	Client              *model.Client4
-	AdminClient         *model.Client4
-	WebSocketClient     *model.WebSocketClient
+	Client              Client
+	AdminClient         AdminClient
+	WebSocketClient     WebSocketClient
+	Endpoint            ServerEndpoint
 	ActionRate          time.Duration
 	LoadTestConfig      *LoadTestConfig
 	StatusReportChannel chan<- UserEntityStatusReport
 	StopChannel         <-chan bool
 	StopWaitGroup       *sync.WaitGroup
-	Info                map[string]interface{}
 
-	r *rand.Rand
+	r            *rand.Rand
+	roundTripper *TimedRoundTripper
+	network      *networkSimulator
+	*entityState
+	// webhooks are the incoming webhooks shared by the entities, used instead of the entity's own
+	// webhook when a number of shared webhooks is configured.
+	webhooks *incomingWebhookPool
+	// channelMembers are the members of the channels, shared by the entities.
+	channelMembers channelMembers
+	// permissions records the permissions changed by the entities, shared by the entities.
+	permissions *permissionChanges
+	// bot is the bot account the entity acts as, if it is a bot entity.
+	bot *BotAccount
+	// liveConfig replaces LoadTestConfig before each action, so changes made while the test
+	// runs apply from the next action onwards. LoadTestConfig should only be read from actions.
+	liveConfig *LiveConfig
+	// background is the view of the entity that polls statuses and reacts to the websocket
+	// connecting alongside the entity's actions. Its requests are not corrected for the lag of
+	// the actions.
+	background *EntityConfig
+	// slept is how long the current action deliberately slept, which is not counted as lag when
+	// correcting for coordinated omission.
+	slept time.Duration
+}
+
+// entityState is what an entity remembers from one action to the next. It is shared by every
+// view of the entity.
+type entityState struct {
+	mobile      mobileState
+	user        userState
+	statuses    statusState
+	threads     threadState
+	posts       postState
+	mentions    mentionState
+	files       fileState
+	commands    commandState
+	interactive interactiveState
+	sidebar     sidebarState
+	// ownWebhooks holds the entity's own incoming webhook.
+	ownWebhooks incomingWebhookPool
+}
+
+// withClient returns a view of the entity that sends its requests with the given client, but
+// otherwise shares the entity's state.
+func (config *EntityConfig) withClient(client Client) *EntityConfig {
+	view := *config
+	view.Client = client
+	view.background = nil
+	return &view
+}
+
+// sleep pauses the current action for the given duration, without counting it as lag.
+func (config *EntityConfig) sleep(d time.Duration) {
+	time.Sleep(d)
+	config.slept += d
 }
 
 func runEntity(ec *EntityConfig) {
@@ -60,31 +116,89 @@ func runEntity(ec *EntityConfig) {
 	}
 	delay := start.Sub(now)
 
+	correctLatency := ec.LoadTestConfig.UserEntitiesConfiguration.CorrectCoordinatedOmission && ec.roundTripper != nil
+	honorRateLimits := ec.LoadTestConfig.UserEntitiesConfiguration.HonorRateLimitHeaders && ec.roundTripper != nil
+
+	// intendedStart is when the next action would have started had every previous action
+	// completed instantly, apart from the time they deliberately slept or waited for rate limits.
+	// Actions are scheduled relative to when the previous one completed, so when correcting for
+	// coordinated omission, the requests of each action also report how far behind this
+	// schedule it started.
+	intendedStart := start
+
+	nextActionDelay := func() time.Duration {
+		halfVarianceDuration := time.Duration(actionRateMaxVarianceMilliseconds / 2.0)
+		randomDurationWithinVariance := time.Duration(rand.Intn(actionRateMaxVarianceMilliseconds))
+		return ec.ActionRate + randomDurationWithinVariance - halfVarianceDuration
+	}
+
+	// actions are the entity's actions weighted according to actionsConfig.
+	var actions []randutil.Choice
+	var actionsConfig *LoadTestConfig
+
 	timer := time.NewTimer(delay)
 	for {
 		select {
 		case <-ec.StopChannel:
 			return
 		case <-timer.C:
-			action, err := randutil.WeightedChoice(ec.r, ec.EntityActions)
+			if ec.mobile.backgroundedUntil().After(time.Now()) {
+				// Apps in the background make no requests until they resume.
+				nextDelay := nextActionDelay()
+				intendedStart = intendedStart.Add(nextDelay)
+				timer.Reset(nextDelay)
+				continue
+			}
+			if ec.liveConfig != nil {
+				ec.LoadTestConfig = ec.liveConfig.Current()
+			}
+			if ec.LoadTestConfig != actionsConfig {
+				actions = weightedActions(ec.EntityActions, ec.EntityName, ec.LoadTestConfig.UserEntitiesConfiguration.ActionWeights)
+				actionsConfig = ec.LoadTestConfig
+			}
+			action, err := randutil.WeightedChoice(ec.r, actions)
 			if err != nil {
 				mlog.Error("Failed to pick weighted choice", mlog.Err(err))
 				return
 			}
+			if honorRateLimits {
+				// Back off until the server is willing to accept requests again.
+				if wait := time.Until(ec.roundTripper.ThrottledUntil()); wait > 0 {
+					mlog.Debug("Entity is rate limited, waiting", mlog.Int("entity_num", ec.EntityNumber), mlog.Duration("wait", wait))
+					select {
+					case <-ec.StopChannel:
+						return
+					case <-time.After(wait):
+					}
+					intendedStart = intendedStart.Add(wait)
+				}
+			}
+			if correctLatency {
+				ec.roundTripper.SetActionLag(time.Since(intendedStart))
+			}
+			ec.slept = 0
+			if ec.network != nil && ec.WebSocketClient != nil && ec.network.chance(ec.network.conditions.WebsocketDropChance) {
+				actionDisconnectWebsocket(ec)
+			}
 			action.Item.(func(*EntityConfig))(ec)
-			halfVarianceDuration := time.Duration(actionRateMaxVarianceMilliseconds / 2.0)
-			randomDurationWithinVariance := time.Duration(rand.Intn(actionRateMaxVarianceMilliseconds))
-			timer.Reset(ec.ActionRate + randomDurationWithinVariance - halfVarianceDuration)
+			if correctLatency {
+				ec.roundTripper.ClearActionLag()
+			}
+			nextDelay := nextActionDelay()
+			intendedStart = intendedStart.Add(ec.slept + nextDelay)
+			timer.Reset(nextDelay)
 		}
 	}
 }
 
-func doStatusPolling(ec *EntityConfig) {
+// doStatusPolling periodically gets the statuses of the users in one of the entity's channels,
+// over the websocket if overWebsocket is set and the entity has one.
+func doStatusPolling(ec *EntityConfig, overWebsocket bool) {
 	defer func() {
 		if r := recover(); r != nil {
 			mlog.Error("Recovered", mlog.Any("recover", r), mlog.String("stack", string(debug.Stack())))
 			ec.StopWaitGroup.Add(1)
-			go doStatusPolling(ec)
+			go doStatusPolling(ec, overWebsocket)
 		}
 	}()
 	defer ec.StopWaitGroup.Done()
@@ -95,7 +209,14 @@ func doStatusPolling(ec *EntityConfig) {
 		case <-ec.StopChannel:
 			return
 		case <-ticker.C:
-			actionGetStatuses(ec)
+			if ec.mobile.backgroundedUntil().After(time.Now()) {
+				continue
+			}
+			if overWebsocket && ec.WebSocketClient != nil {
+				actionGetStatusesWebsocket(ec)
+			} else {
+				actionGetStatuses(ec)
+			}
 		}
 	}
 }
@@ -108,7 +229,8 @@ func websocketListen(ec *EntityConfig) {
 	}
 
 	ec.WebSocketClient.Listen()
-	actionWakeup(ec)
+	ec.onConnect()
+	responses := ec.WebSocketClient.Responses()
 
 	websocketRetryCount := 0
 
@@ -116,26 +238,50 @@ func websocketListen(ec *EntityConfig) {
 		select {
 		case <-ec.StopChannel:
 			return
-		case _, ok := <-ec.WebSocketClient.EventChannel:
+		case response, ok := <-responses:
 			if !ok {
+				// The connection was lost, which is handled once the events channel is closed.
+				responses = nil
+			} else if response.Error != nil {
+				mlog.Error("Websocket request failed", mlog.Int64("seq_reply", response.SeqReply), mlog.String("username", ec.UserData.Username), mlog.Err(response.Error))
+			}
+		case event, ok := <-ec.WebSocketClient.Events():
+			if ok {
+				ec.user.receivedEvent(event)
+				userId := ec.user.id()
+				ec.mentions.receivedEvent(event, userId)
+				ec.commands.receivedEvent(event, time.Now())
+				ec.interactive.receivedEvent(event, userId, time.Now())
+				switch event.Event {
+				case model.WEBSOCKET_EVENT_POSTED:
+					rememberPostedThread(ec, event)
+				case model.WEBSOCKET_EVENT_POST_DELETED:
+					forgetDeletedThread(ec, event)
+				}
+			} else {
 				// If we are set to retry connection, first retry immediately, then backoff until retry max is reached
 				for {
 					if websocketRetryCount > 5 {
-						if ec.WebSocketClient.ListenError != nil {
-							mlog.Error("Websocket Error", mlog.Err(ec.WebSocketClient.ListenError))
+						if err := ec.WebSocketClient.ListenError(); err != nil {
+							mlog.Error("Websocket Error", mlog.Err(err))
 						} else {
 							mlog.Error("Server closed websocket")
 						}
 						mlog.Error("Websocket disconneced. Max retries reached.")
 						return
 					}
+					if !waitInBackground(ec) {
+						return
+					}
 					time.Sleep(time.Duration(websocketRetryCount) * time.Second)
 					if err := ec.WebSocketClient.Connect(); err != nil {
 						websocketRetryCount++
 						continue
 					}
 					ec.WebSocketClient.Listen()
-					actionWakeup(ec)
+					websocketRetryCount = 0
+					ec.onConnect()
+					responses = ec.WebSocketClient.Responses()
 					break
 				}
 			}
@@ -143,6 +289,61 @@ func websocketListen(ec *EntityConfig) {
 	}
 }
 
+// waitInBackground holds off reconnecting the websocket while the entity's app is in the
+// background, returning false if the entity is stopped meanwhile.
+func waitInBackground(ec *EntityConfig) bool {
+	wait := time.Until(ec.mobile.backgroundedUntil())
+	if wait <= 0 {
+		return true
+	}
+
+	select {
+	case <-ec.StopChannel:
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// rememberPostedThread records the thread of a post the entity was notified of, so that it
+// may later reply to it.
+func rememberPostedThread(config *EntityConfig, event *model.WebSocketEvent) {
+	postJson, ok := event.Data["post"].(string)
+	if !ok {
+		return
+	}
+	teamId, _ := event.Data["team_id"].(string)
+
+	config.threads.remember(model.PostFromJson(strings.NewReader(postJson)), teamId)
+}
+
+// forgetDeletedThread drops a deleted post from the threads the entity may reply to.
+func forgetDeletedThread(config *EntityConfig, event *model.WebSocketEvent) {
+	postJson, ok := event.Data["post"].(string)
+	if !ok {
+		return
+	}
+
+	if post := model.PostFromJson(strings.NewReader(postJson)); post != nil && post.RootId == "" {
+		config.threads.forget(post.ChannelId, post.Id)
+	}
+}
+
+// onConnect runs the entity's reaction to its websocket connecting or reconnecting, alongside
+// its actions.
+func (config *EntityConfig) onConnect() {
+	if config.background != nil {
+		config = config.background
+	}
+
+	if config.EntityOnConnect != nil {
+		config.EntityOnConnect(config)
+		return
+	}
+
+	actionWakeup(config)
+}
+
 func (config *EntityConfig) SendStatus(status int, err error, details string) {
 	config.StatusReportChannel <- UserEntityStatusReport{
 		Status:  status,
@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunEntityCorrectsLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	reports := make(chan TimedRoundTripperReport, 100)
+	roundTripper := NewTimedRoundTripper(reports)
+	get := func(transport http.RoundTripper, path string) {
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	const actionRate = 50 * time.Millisecond
+	const workDuration = 50 * time.Millisecond
+	const sleepDuration = 100 * time.Millisecond
+	var lock sync.Mutex
+	var starts, ends []time.Time
+	action := func(c *EntityConfig) {
+		lock.Lock()
+		starts = append(starts, time.Now())
+		lock.Unlock()
+
+		get(roundTripper, "/action")
+		get(roundTripper.Uncorrected(), "/background")
+		time.Sleep(workDuration)
+		c.sleep(sleepDuration)
+
+		lock.Lock()
+		ends = append(ends, time.Now())
+		lock.Unlock()
+	}
+
+	c, _, _, _ := newTestEntityConfig()
+	c.EntityActions = []randutil.Choice{{Item: action, Weight: 1}}
+	c.ActionRate = actionRate
+	c.LoadTestConfig.UserEntitiesConfiguration.ActionRateMaxVarianceMilliseconds = 1
+	c.LoadTestConfig.UserEntitiesConfiguration.CorrectCoordinatedOmission = true
+	c.roundTripper = roundTripper
+	stop := make(chan bool)
+	c.StopChannel = stop
+	c.StopWaitGroup = &sync.WaitGroup{}
+
+	c.StopWaitGroup.Add(1)
+	go runEntity(c)
+	time.Sleep(actionRate + 4*(actionRate+workDuration+sleepDuration))
+	close(stop)
+	c.StopWaitGroup.Wait()
+	close(reports)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.True(t, len(ends) >= 3, "only %d actions completed", len(ends))
+	for i := 1; i < len(starts); i++ {
+		assert.True(t, starts[i].Sub(ends[i-1]) >= actionRate-5*time.Millisecond, "action %d should wait for the action rate after the previous one completed", i)
+	}
+
+	var lags []time.Duration
+	backgroundReports := 0
+	for report := range reports {
+		switch report.Path {
+		case "/action":
+			lags = append(lags, report.CorrectedDuration-report.RequestDuration)
+		case "/background":
+			assert.Zero(t, report.CorrectedDuration, "requests besides those of actions should not be corrected")
+			backgroundReports++
+		}
+	}
+	require.Equal(t, len(starts), len(lags))
+	assert.Equal(t, len(lags), backgroundReports)
+
+	// The intended schedule advances by the action rate and the time slept, however long the
+	// actions took.
+	intendedStart := starts[0].Add(-lags[0])
+	for i := 1; i < len(lags); i++ {
+		intendedStart = intendedStart.Add(actionRate + sleepDuration)
+		assert.True(t, lags[i] >= lags[i-1]+workDuration, "action %d should add the work of the previous action to its lag, but reported %v after %v", i, lags[i], lags[i-1])
+		assert.InDelta(t, starts[i].Sub(intendedStart), lags[i], float64(5*time.Millisecond), "action %d should report how far behind the schedule it started", i)
+	}
+}
+
+func TestRunEntitySkipsActionsInBackground(t *testing.T) {
+	var lock sync.Mutex
+	actions := 0
+	action := func(c *EntityConfig) {
+		lock.Lock()
+		actions++
+		lock.Unlock()
+	}
+
+	c, _, _, _ := newTestEntityConfig()
+	c.EntityActions = []randutil.Choice{{Item: action, Weight: 1}}
+	c.ActionRate = 10 * time.Millisecond
+	c.LoadTestConfig.UserEntitiesConfiguration.ActionRateMaxVarianceMilliseconds = 1
+	stop := make(chan bool)
+	c.StopChannel = stop
+	c.StopWaitGroup = &sync.WaitGroup{}
+	c.mobile.background(time.Now().Add(200 * time.Millisecond))
+
+	c.StopWaitGroup.Add(1)
+	go runEntity(c)
+	time.Sleep(150 * time.Millisecond)
+	lock.Lock()
+	assert.Zero(t, actions, "the entity should not act in the background")
+	lock.Unlock()
+
+	time.Sleep(150 * time.Millisecond)
+	close(stop)
+	c.StopWaitGroup.Wait()
+	assert.NotZero(t, actions, "the entity should act again once it resumes")
+}
+
+func TestOnConnect(t *testing.T) {
+	c, client, _, _ := newTestEntityConfig()
+	background := newMockClient()
+	c.background = c.withClient(background)
+
+	c.onConnect()
+
+	assert.Empty(t, client.Methods())
+	assert.Equal(t, []string{"GetWebappPlugins"}, background.Methods(), "the reaction should send its requests with the background client")
+	assert.True(t, c.background.entityState == c.entityState, "the background view should share the entity's state")
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	FILE_TYPE_PNG    = "png"
+	FILE_TYPE_JPG    = "jpg"
+	FILE_TYPE_GIF    = "gif"
+	FILE_TYPE_PDF    = "pdf"
+	FILE_TYPE_TEXT   = "text"
+	FILE_TYPE_BINARY = "binary"
+)
+
+// fileExtensions maps each file type to the extension of the files generated for it.
+var fileExtensions = map[string]string{
+	FILE_TYPE_PNG:    "png",
+	FILE_TYPE_JPG:    "jpg",
+	FILE_TYPE_GIF:    "gif",
+	FILE_TYPE_PDF:    "pdf",
+	FILE_TYPE_TEXT:   "txt",
+	FILE_TYPE_BINARY: "bin",
+}
+
+// The approximate size of each pixel of a generated image once encoded. Images are random noise,
+// which compresses poorly, so their size mostly depends on their dimensions.
+var imageBytesPerPixel = map[string]float64{
+	FILE_TYPE_PNG: 3,
+	FILE_TYPE_JPG: 0.77,
+	FILE_TYPE_GIF: 1.38,
+}
+
+// Files other than binary ones are slow to generate, so this many of each configured kind of file
+// are kept for reuse.
+const FILE_PAYLOADS_CACHED = 16
+
+// FileUpload describes a kind of file attached to posts. Files are generated as they are uploaded,
+// with sizes spread evenly on a logarithmic scale between the minimum and maximum.
+type FileUpload struct {
+	// Type is one of png, jpg, gif, pdf, text or binary.
+	Type             string
+	Weight           int
+	MinSizeKilobytes int
+	MaxSizeKilobytes int
+}
+
+// defaultFileUploads is used when no file uploads are configured.
+var defaultFileUploads = []FileUpload{
+	{Type: FILE_TYPE_PNG, Weight: 40, MinSizeKilobytes: 20, MaxSizeKilobytes: 2000},
+	{Type: FILE_TYPE_JPG, Weight: 25, MinSizeKilobytes: 50, MaxSizeKilobytes: 4000},
+	{Type: FILE_TYPE_GIF, Weight: 5, MinSizeKilobytes: 20, MaxSizeKilobytes: 1000},
+	{Type: FILE_TYPE_PDF, Weight: 10, MinSizeKilobytes: 50, MaxSizeKilobytes: 5000},
+	{Type: FILE_TYPE_TEXT, Weight: 15, MinSizeKilobytes: 1, MaxSizeKilobytes: 200},
+	{Type: FILE_TYPE_BINARY, Weight: 5, MinSizeKilobytes: 1000, MaxSizeKilobytes: 20000},
+}
+
+// pickSize returns a random size in bytes within the configured range.
+func (upload FileUpload) pickSize(r *rand.Rand) int {
+	min := math.Log(float64(upload.MinSizeKilobytes))
+	max := math.Log(float64(upload.MaxSizeKilobytes))
+
+	return int(math.Exp(min+r.Float64()*(max-min)) * 1024)
+}
+
+type generatedFile struct {
+	data []byte
+	name string
+}
+
+// fileCache holds generated files for reuse across entities, by the kind of file they were
+// generated for.
+type fileCache struct {
+	lock  sync.Mutex
+	files map[FileUpload][]generatedFile
+}
+
+var generatedFiles = &fileCache{files: make(map[FileUpload][]generatedFile)}
+
+// get returns a cached file of the given kind, or nil if more should be generated first.
+func (fc *fileCache) get(r *rand.Rand, upload FileUpload) *generatedFile {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	files := fc.files[upload]
+	if len(files) < FILE_PAYLOADS_CACHED {
+		return nil
+	}
+
+	return &files[r.Intn(len(files))]
+}
+
+func (fc *fileCache) add(upload FileUpload, file generatedFile) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if len(fc.files[upload]) < FILE_PAYLOADS_CACHED {
+		fc.files[upload] = append(fc.files[upload], file)
+	}
+}
+
+// randomBuffer holds random bytes that binary files are cut from, growing as larger files are
+// needed.
+type randomBuffer struct {
+	lock sync.Mutex
+	data []byte
+}
+
+var binaryData = &randomBuffer{}
+
+// get returns the given number of random bytes, which must not be modified.
+func (rb *randomBuffer) get(r *rand.Rand, size int) []byte {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if len(rb.data) < size {
+		rb.data = make([]byte, size)
+		r.Read(rb.data)
+	}
+
+	return rb.data[:size]
+}
+
+// generateUpload picks a kind of file from those configured and generates it, returning its
+// contents and file name.
+func generateUpload(r *rand.Rand, uploads []FileUpload) ([]byte, string, error) {
+	if len(uploads) == 0 {
+		uploads = defaultFileUploads
+	}
+
+	choices := make([]randutil.Choice, len(uploads))
+	for i, upload := range uploads {
+		choices[i] = randutil.Choice{Item: upload, Weight: upload.Weight}
+	}
+	choice, err := randutil.WeightedChoice(r, choices)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to pick file upload")
+	}
+	upload := choice.Item.(FileUpload)
+
+	if upload.Type != FILE_TYPE_BINARY {
+		if cached := generatedFiles.get(r, upload); cached != nil {
+			return cached.data, cached.name, nil
+		}
+	}
+
+	data, err := generateFile(r, upload.Type, upload.pickSize(r))
+	if err != nil {
+		return nil, "", err
+	}
+	name := fmt.Sprintf("%s.%s", strings.ToLower(fake.Word()), fileExtensions[upload.Type])
+
+	if upload.Type != FILE_TYPE_BINARY {
+		generatedFiles.add(upload, generatedFile{data, name})
+	}
+
+	return data, name, nil
+}
+
+// generateFile returns a file of the given type and roughly the given size in bytes.
+func generateFile(r *rand.Rand, fileType string, size int) ([]byte, error) {
+	switch fileType {
+	case FILE_TYPE_PNG, FILE_TYPE_JPG, FILE_TYPE_GIF:
+		return generateImage(r, fileType, size)
+	case FILE_TYPE_PDF:
+		return generatePDF(size), nil
+	case FILE_TYPE_TEXT:
+		return generateText(size), nil
+	case FILE_TYPE_BINARY:
+		return binaryData.get(r, size), nil
+	}
+
+	return nil, fmt.Errorf("unknown file type %q", fileType)
+}
+
+// generateImage returns an image of random noise with a 4:3 aspect ratio.
+func generateImage(r *rand.Rand, fileType string, size int) ([]byte, error) {
+	pixels := float64(size) / imageBytesPerPixel[fileType]
+	width := int(math.Max(1, math.Sqrt(pixels*4/3)))
+	height := int(math.Max(1, pixels/float64(width)))
+	bounds := image.Rect(0, 0, width, height)
+
+	buffer := &bytes.Buffer{}
+	var err error
+	switch fileType {
+	case FILE_TYPE_GIF:
+		img := image.NewPaletted(bounds, palette.Plan9)
+		r.Read(img.Pix)
+		err = gif.Encode(buffer, img, nil)
+	default:
+		img := image.NewRGBA(bounds)
+		r.Read(img.Pix)
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xff
+		}
+		if fileType == FILE_TYPE_PNG {
+			err = png.Encode(buffer, img)
+		} else {
+			err = jpeg.Encode(buffer, img, &jpeg.Options{Quality: 85})
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %s", fileType)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// generateText returns paragraphs of text.
+func generateText(size int) []byte {
+	buffer := &bytes.Buffer{}
+	for buffer.Len() < size {
+		buffer.WriteString(fake.Paragraph())
+		buffer.WriteString("\n\n")
+	}
+
+	return buffer.Bytes()[:size]
+}
+
+// generatePDF returns a single page PDF document, padded with text to the given size.
+func generatePDF(size int) []byte {
+	escaper := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	content := &bytes.Buffer{}
+	content.WriteString("BT /F1 12 Tf 72 720 Td 14 TL\n")
+	for content.Len() < size {
+		fmt.Fprintf(content, "(%s) '\n", escaper.Replace(fake.Sentence()))
+	}
+	content.WriteString("ET")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	pdf := &bytes.Buffer{}
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := pdf.Len()
+	fmt.Fprintf(pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return pdf.Bytes()
+}
+
+// checkFileUploads checks that the configured file uploads could be generated.
+func (vr *ValidationResult) checkFileUploads(section string, uploads []FileUpload) {
+	for i, upload := range uploads {
+		name := fmt.Sprintf("%s.FileUploads[%d]", section, i)
+		if _, ok := fileExtensions[upload.Type]; !ok {
+			vr.problem("%s has unknown type %q, must be one of png, jpg, gif, pdf, text or binary", name, upload.Type)
+		}
+		if upload.Weight < 0 {
+			vr.problem("%s must not have a negative weight", name)
+		}
+		if upload.MinSizeKilobytes < 1 {
+			vr.problem("%s.MinSizeKilobytes must be at least 1", name)
+		}
+		if upload.MaxSizeKilobytes < upload.MinSizeKilobytes {
+			vr.problem("%s.MaxSizeKilobytes must be at least MinSizeKilobytes", name)
+		}
+	}
+}
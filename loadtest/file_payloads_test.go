@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateFile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	size := 100 * 1024
+
+	for _, fileType := range []string{FILE_TYPE_PNG, FILE_TYPE_JPG, FILE_TYPE_GIF} {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := generateFile(r, fileType, size)
+			require.NoError(t, err)
+
+			_, format, err := image.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{FILE_TYPE_PNG: "png", FILE_TYPE_JPG: "jpeg", FILE_TYPE_GIF: "gif"}[fileType], format)
+			assert.InDelta(t, size, len(data), float64(size)/4)
+		})
+	}
+
+	t.Run(FILE_TYPE_PDF, func(t *testing.T) {
+		data, err := generateFile(r, FILE_TYPE_PDF, size)
+		require.NoError(t, err)
+
+		assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+		assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+		assert.InDelta(t, size, len(data), float64(size)/10)
+	})
+
+	t.Run(FILE_TYPE_TEXT, func(t *testing.T) {
+		data, err := generateFile(r, FILE_TYPE_TEXT, size)
+		require.NoError(t, err)
+
+		assert.Len(t, data, size)
+		assert.True(t, utf8.Valid(data))
+	})
+
+	t.Run(FILE_TYPE_BINARY, func(t *testing.T) {
+		data, err := generateFile(r, FILE_TYPE_BINARY, size)
+		require.NoError(t, err)
+		assert.Len(t, data, size)
+
+		larger, err := generateFile(r, FILE_TYPE_BINARY, 2*size)
+		require.NoError(t, err)
+		assert.Len(t, larger, 2*size)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := generateFile(r, "docx", size)
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateUpload(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	uploads := []FileUpload{
+		{Type: FILE_TYPE_TEXT, Weight: 1, MinSizeKilobytes: 2, MaxSizeKilobytes: 4},
+		{Type: FILE_TYPE_BINARY, Weight: 0, MinSizeKilobytes: 1, MaxSizeKilobytes: 1},
+	}
+
+	for i := 0; i < 20; i++ {
+		data, name, err := generateUpload(r, uploads)
+		require.NoError(t, err)
+
+		assert.Regexp(t, `^[a-z]+\.txt$`, name)
+		assert.True(t, len(data) >= 2*1024 && len(data) <= 4*1024, "size %d out of range", len(data))
+	}
+}
+
+func TestGenerateUploadCache(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	small := FileUpload{Type: FILE_TYPE_PDF, Weight: 1, MinSizeKilobytes: 3, MaxSizeKilobytes: 3}
+	large := FileUpload{Type: FILE_TYPE_PDF, Weight: 1, MinSizeKilobytes: 30, MaxSizeKilobytes: 30}
+
+	for i := 0; i < 2*FILE_PAYLOADS_CACHED; i++ {
+		data, _, err := generateUpload(r, []FileUpload{small})
+		require.NoError(t, err)
+		assert.True(t, len(data) < 10*1024, "size %d of a small pdf", len(data))
+	}
+	for i := 0; i < 2*FILE_PAYLOADS_CACHED; i++ {
+		data, _, err := generateUpload(r, []FileUpload{large})
+		require.NoError(t, err)
+		assert.True(t, len(data) >= 30*1024, "size %d of a large pdf, the small ones should not be reused", len(data))
+	}
+}
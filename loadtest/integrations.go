@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/montanaflynn/stats"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// IntegrationServer is the loadtest agent's local HTTP endpoint, which the Mattermost server calls
+// for the integrations exercised by the load test, such as custom slash commands, outgoing
+// webhooks and interactive messages. Requests carry everything needed to answer them, so with several agents the server
+// may call any one of them.
+type IntegrationServer struct {
+	listener net.Listener
+	server   *http.Server
+	// client sends delayed responses back to the Mattermost server.
+	client *http.Client
+
+	outgoingWebhooks outgoingWebhookState
+
+	stop chan struct{}
+	wait sync.WaitGroup
+}
+
+// NewIntegrationServer starts serving integration requests on the given address.
+func NewIntegrationServer(listenAddress string, client *http.Client) (*IntegrationServer, error) {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen for integration requests on %s", listenAddress)
+	}
+
+	is := &IntegrationServer{
+		listener: listener,
+		client:   client,
+		stop:     make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(SLASH_COMMAND_PATH, is.handleSlashCommand)
+	mux.HandleFunc(OUTGOING_WEBHOOK_PATH, is.handleOutgoingWebhook)
+	mux.HandleFunc(OUTGOING_WEBHOOK_CHANNEL_PATH, is.handleOutgoingChannelWebhook)
+	mux.HandleFunc(INTERACTIVE_ACTION_PATH, is.handleInteractiveAction)
+	is.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := is.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			mlog.Error("Integration server stopped", mlog.Err(err))
+		}
+	}()
+
+	return is, nil
+}
+
+// Addr returns the address the server is listening on.
+func (is *IntegrationServer) Addr() string {
+	return is.listener.Addr().String()
+}
+
+// Close stops serving, and abandons any delayed responses not yet sent.
+func (is *IntegrationServer) Close() {
+	close(is.stop)
+	is.server.Close()
+	is.wait.Wait()
+}
+
+// checkConfigForIntegrations configures the server to allow the integrations that call the
+// loadtest agent back at the given URL.
+func checkConfigForIntegrations(adminClient *model.Client4, integrationURL string) error {
+	parsed, err := url.Parse(integrationURL)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse integration URL")
+	}
+
+	serverConfig, resp := adminClient.GetConfig()
+	if serverConfig == nil {
+		mlog.Error("Failed to get the server config", mlog.Err(resp.Error))
+		return resp.Error
+	}
+
+	if !*serverConfig.ServiceSettings.EnableCommands {
+		mlog.Info("Enabling custom slash commands for the load test...")
+		*serverConfig.ServiceSettings.EnableCommands = true
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EnableCommands", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("EnableCommands is true")
+
+	if !*serverConfig.ServiceSettings.EnableOutgoingWebhooks {
+		mlog.Info("Enabling outgoing webhooks for the load test...")
+		*serverConfig.ServiceSettings.EnableOutgoingWebhooks = true
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EnableOutgoingWebhooks", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("EnableOutgoingWebhooks is true")
+
+	// The agent is usually on the same private network as the server, which the server only
+	// connects to for integrations when told to.
+	allowed := strings.Fields(*serverConfig.ServiceSettings.AllowedUntrustedInternalConnections)
+	found := false
+	for _, host := range allowed {
+		if host == parsed.Hostname() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		mlog.Info("Allowing integration requests to the loadtest agent...", mlog.String("host", parsed.Hostname()))
+		*serverConfig.ServiceSettings.AllowedUntrustedInternalConnections = strings.Join(append(allowed, parsed.Hostname()), " ")
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set AllowedUntrustedInternalConnections", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("AllowedUntrustedInternalConnections includes the loadtest agent", mlog.String("host", parsed.Hostname()))
+
+	return nil
+}
+
+// latencySummary summarises the times in milliseconds taken by the server to call or answer
+// integrations.
+type latencySummary struct {
+	Count        int
+	Mean         float64
+	Median       float64
+	Percentile95 float64
+	Max          float64
+}
+
+func summarizeLatencies(values []float64) latencySummary {
+	summary := latencySummary{Count: len(values)}
+	if len(values) == 0 {
+		return summary
+	}
+
+	summary.Mean, _ = stats.Mean(values)
+	summary.Median, _ = stats.Median(values)
+	summary.Max, _ = stats.Max(values)
+	// As with route timings, small datasets have no meaningful percentiles.
+	if len(values) > 2 {
+		summary.Percentile95, _ = stats.Percentile(values, 95)
+	}
+
+	return summary
+}
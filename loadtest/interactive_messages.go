@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Interactive messages have a button and a select menu whose actions call the integration server
+// at INTERACTIVE_ACTION_PATH. The action ids are fixed, so that clicks can be recognised and the
+// updated message keeps the same actions.
+const (
+	INTERACTIVE_ACTION_PATH = "/actions"
+	INTERACTIVE_BUTTON_ID   = "loadtestbutton"
+	INTERACTIVE_SELECT_ID   = "loadtestselect"
+)
+
+// INTERACTIVE_OPTIONS are the values offered by the select menu.
+var INTERACTIVE_OPTIONS = []string{"approve", "reject", "escalate", "snooze"}
+
+// interactiveUpdateRegex finds the id of the user whose click last updated an interactive message.
+var interactiveUpdateRegex = regexp.MustCompile(`last clicked by ([a-z0-9]{26})`)
+
+func interactiveUpdateText(userId, selected string) string {
+	if selected != "" {
+		return fmt.Sprintf("Load test message, %s was last clicked by %s", selected, userId)
+	}
+	return fmt.Sprintf("Load test message, last clicked by %s", userId)
+}
+
+// interactiveAttachments returns the attachment holding the actions of an interactive message,
+// which call the given URL when clicked.
+func interactiveAttachments(actionURL string) []*model.SlackAttachment {
+	integration := func() *model.PostActionIntegration {
+		return &model.PostActionIntegration{
+			URL:     actionURL,
+			Context: map[string]interface{}{"action_url": actionURL},
+		}
+	}
+
+	options := make([]*model.PostActionOptions, len(INTERACTIVE_OPTIONS))
+	for i, option := range INTERACTIVE_OPTIONS {
+		options[i] = &model.PostActionOptions{Text: option, Value: option}
+	}
+
+	return []*model.SlackAttachment{{
+		Fallback: "Load test actions",
+		Text:     "Pick one",
+		Actions: []*model.PostAction{
+			{
+				Id:          INTERACTIVE_BUTTON_ID,
+				Type:        model.POST_ACTION_TYPE_BUTTON,
+				Name:        "Acknowledge",
+				Integration: integration(),
+			},
+			{
+				Id:          INTERACTIVE_SELECT_ID,
+				Type:        model.POST_ACTION_TYPE_SELECT,
+				Name:        "Choose an outcome",
+				Options:     options,
+				Integration: integration(),
+			},
+		},
+	}}
+}
+
+// isInteractivePost returns whether the post is an interactive message made by the load test.
+func isInteractivePost(post *model.Post) bool {
+	for _, attachment := range post.Attachments() {
+		for _, action := range attachment.Actions {
+			if action.Id == INTERACTIVE_BUTTON_ID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// handleInteractiveAction answers a click on an interactive message by updating the message to
+// name the user who clicked, keeping its actions so that it can be clicked again.
+func (is *IntegrationServer) handleInteractiveAction(w http.ResponseWriter, r *http.Request) {
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actionURL, _ := request.Context["action_url"].(string)
+	if actionURL == "" {
+		http.Error(w, "expected the action URL in the context", http.StatusBadRequest)
+		return
+	}
+	selected, _ := request.Context["selected_option"].(string)
+
+	update := &model.Post{Message: interactiveUpdateText(request.UserId, selected)}
+	update.AddProp("attachments", interactiveAttachments(actionURL))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&model.PostActionIntegrationResponse{Update: update})
+}
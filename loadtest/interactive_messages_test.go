@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInteractiveMessageRoundTrip(t *testing.T) {
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	team := s.CreateTeam(&model.Team{Name: "team0", DisplayName: "Team 0"})
+	channel := s.GetChannelByName(team.Id, model.DEFAULT_CHANNEL)
+	require.NotNil(t, channel)
+	user := s.CreateUser(&model.User{Username: "user0", Email: "success+user0@simulator.amazonses.com"}, "password")
+	s.AddTeamMember(team.Id, user.Id)
+
+	integrationServer, err := NewIntegrationServer("127.0.0.1:0", &http.Client{})
+	require.NoError(t, err)
+	defer integrationServer.Close()
+
+	client := model.NewAPIv4Client(serverURL)
+	_, resp := client.Login("success+user0@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), client.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+	hello := <-ws.EventChannel
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	var state interactiveState
+	userId := hello.Broadcast.UserId
+	waitFor := func(done func() bool) {
+		timeout := time.After(5 * time.Second)
+		for !done() {
+			select {
+			case event := <-ws.EventChannel:
+				state.receivedEvent(event, userId, time.Now())
+			case <-timeout:
+				t.Fatal("timed out waiting for websocket events")
+			}
+		}
+	}
+
+	post := &model.Post{ChannelId: channel.Id, Message: "hello"}
+	post.AddProp("attachments", interactiveAttachments("http://"+integrationServer.Addr()+INTERACTIVE_ACTION_PATH))
+	post, resp = client.CreatePost(post)
+	require.Nil(t, resp.Error)
+
+	waitFor(func() bool {
+		_, ok := state.pick(rand.New(rand.NewSource(1)))
+		return ok
+	})
+
+	for _, actionType := range []string{model.POST_ACTION_TYPE_BUTTON, model.POST_ACTION_TYPE_SELECT} {
+		t.Run(actionType, func(t *testing.T) {
+			actionId, selected := INTERACTIVE_BUTTON_ID, ""
+			if actionType == model.POST_ACTION_TYPE_SELECT {
+				actionId, selected = INTERACTIVE_SELECT_ID, INTERACTIVE_OPTIONS[0]
+			}
+
+			state.start(post.Id, actionType, time.Now())
+			_, resp := client.DoPostActionWithCookie(post.Id, actionId, selected, "")
+			require.Nil(t, resp.Error)
+
+			waitFor(func() bool {
+				durations, _, _ := state.results()
+				return len(durations[actionType]) == 1
+			})
+
+			updated, resp := client.GetPost(post.Id, "")
+			require.Nil(t, resp.Error)
+			assert.Equal(t, interactiveUpdateText(user.Id, selected), updated.Message)
+			assert.True(t, isInteractivePost(updated), "the update should keep the actions")
+		})
+	}
+
+	_, lost, errors := state.results()
+	assert.Empty(t, lost)
+	assert.Empty(t, errors)
+}
+
+func TestInteractiveState(t *testing.T) {
+	var state interactiveState
+	now := time.Now()
+
+	event := func(eventType, postId, message string) *model.WebSocketEvent {
+		post := &model.Post{Id: postId, Message: message}
+		post.AddProp("attachments", interactiveAttachments("http://localhost:8077/actions"))
+		event := model.NewWebSocketEvent(eventType, "", "channelid0", "", nil)
+		event.Add("post", post.ToJson())
+		return event
+	}
+
+	const userId = "useridaaaaaaaaaaaaaaaaaaaa"
+	state.receivedEvent(event(model.WEBSOCKET_EVENT_POSTED, "postid0", "hello"), userId, now)
+	postId, ok := state.pick(rand.New(rand.NewSource(1)))
+	require.True(t, ok)
+	assert.Equal(t, "postid0", postId)
+
+	state.start("postid0", model.POST_ACTION_TYPE_BUTTON, now)
+	state.start("postid1", model.POST_ACTION_TYPE_SELECT, now)
+	state.receivedEvent(event(model.WEBSOCKET_EVENT_POST_EDITED, "postid0", interactiveUpdateText("useridbbbbbbbbbbbbbbbbbbbb", "")), userId, now.Add(50*time.Millisecond))
+	state.receivedEvent(event(model.WEBSOCKET_EVENT_POST_EDITED, "postid0", interactiveUpdateText(userId, "")), userId, now.Add(100*time.Millisecond))
+	state.fail("postid1")
+
+	durations, lost, errors := state.results()
+	assert.Equal(t, map[string][]float64{model.POST_ACTION_TYPE_BUTTON: {100}}, durations, "updates caused by other users should not be timed")
+	assert.Empty(t, lost)
+	assert.Equal(t, map[string]int64{model.POST_ACTION_TYPE_SELECT: 1}, errors)
+
+	state.start("postid0", model.POST_ACTION_TYPE_BUTTON, now)
+	state.start("postid2", model.POST_ACTION_TYPE_BUTTON, now.Add(2*INTERACTIVE_UPDATE_TIMEOUT))
+	_, lost, _ = state.results()
+	assert.Equal(t, map[string]int64{model.POST_ACTION_TYPE_BUTTON: 2}, lost)
+}
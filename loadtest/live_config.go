@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+)
+
+// ActionWeight overrides how often an action is picked relative to the other actions of an entity.
+type ActionWeight struct {
+	// EntityName is the name of the entity type to change. Weights with no entity name apply to
+	// every entity type with the action, unless it has a weight of its own.
+	EntityName string
+	// Action is the name of the action function, such as actionPost.
+	Action string
+	Weight int
+}
+
+// actionName returns the name of an action function, such as actionPost.
+func actionName(action interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(action).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// weightedActions returns the actions of the given entity type with any configured weights applied.
+func weightedActions(actions []randutil.Choice, entityName string, weights []ActionWeight) []randutil.Choice {
+	if len(weights) == 0 {
+		return actions
+	}
+
+	weighted := make([]randutil.Choice, len(actions))
+	for i, action := range actions {
+		weighted[i] = action
+
+		name := actionName(action.Item)
+		for _, weight := range weights {
+			if weight.Action != name {
+				continue
+			}
+			if weight.EntityName == entityName {
+				weighted[i].Weight = weight.Weight
+				break
+			} else if weight.EntityName == "" {
+				weighted[i].Weight = weight.Weight
+			}
+		}
+	}
+
+	return weighted
+}
+
+// LiveConfig holds the configuration shared by the entities of a running test, so that changes to
+// the chances and action weights can be applied without restarting it. Entities pick up the
+// current configuration before each action, so an action never sees a partial change.
+type LiveConfig struct {
+	lock    sync.Mutex
+	current atomic.Value
+}
+
+func NewLiveConfig(cfg *LoadTestConfig) *LiveConfig {
+	lc := &LiveConfig{}
+	lc.current.Store(cfg)
+
+	return lc
+}
+
+// Current returns the configuration with all changes applied so far.
+func (lc *LiveConfig) Current() *LoadTestConfig {
+	return lc.current.Load().(*LoadTestConfig)
+}
+
+// Update applies the chances and action weights from the given configuration, keeping every
+// other setting as the test started with. It returns the names of the settings that changed, and
+// leaves the configuration untouched if the new settings are invalid.
+func (lc *LiveConfig) Update(cfg *LoadTestConfig) ([]string, error) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	current := lc.Current()
+	updated := *current
+
+	var changes []string
+	currentValue := reflect.ValueOf(&updated.UserEntitiesConfiguration).Elem()
+	newValue := reflect.ValueOf(&cfg.UserEntitiesConfiguration).Elem()
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		if field.Type.Kind() != reflect.Float64 || !strings.HasSuffix(field.Name, "Chance") {
+			continue
+		}
+
+		if currentValue.Field(i).Float() != newValue.Field(i).Float() {
+			currentValue.Field(i).SetFloat(newValue.Field(i).Float())
+			changes = append(changes, field.Name)
+		}
+	}
+
+	if !reflect.DeepEqual(current.UserEntitiesConfiguration.ActionWeights, cfg.UserEntitiesConfiguration.ActionWeights) {
+		updated.UserEntitiesConfiguration.ActionWeights = cfg.UserEntitiesConfiguration.ActionWeights
+		changes = append(changes, "ActionWeights")
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	vr := &ValidationResult{}
+	vr.checkUserEntities(&updated.UserEntitiesConfiguration)
+	if err := vr.Err(); err != nil {
+		return nil, err
+	}
+
+	lc.current.Store(&updated)
+
+	return changes, nil
+}
+
+// checkActionWeights checks that the configured action weights could be applied.
+func (vr *ValidationResult) checkActionWeights(section string, weights []ActionWeight) {
+	for i, weight := range weights {
+		name := fmt.Sprintf("%s.ActionWeights[%d]", section, i)
+		if weight.Action == "" {
+			vr.problem("%s must name an action", name)
+		}
+		if weight.Weight < 0 {
+			vr.problem("%s must not have a negative weight", name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+)
+
+func TestActionName(t *testing.T) {
+	assert.Equal(t, "actionPost", actionName(actionPost))
+	assert.Equal(t, "actionMobileResume", actionName(actionMobileResume))
+}
+
+func TestWeightedActions(t *testing.T) {
+	actions := []randutil.Choice{
+		{Item: actionPost, Weight: 10},
+		{Item: actionGetChannel, Weight: 5},
+	}
+
+	assert.Equal(t, actions, weightedActions(actions, "Poster", nil))
+
+	weighted := weightedActions(actions, "Poster", []ActionWeight{
+		{EntityName: "Poster", Action: "actionPost", Weight: 1},
+		{Action: "actionPost", Weight: 2},
+		{Action: "actionGetChannel", Weight: 0},
+	})
+	assert.Equal(t, 1, weighted[0].Weight)
+	assert.Equal(t, 0, weighted[1].Weight)
+	assert.Equal(t, 10, actions[0].Weight, "the entity's own actions should be unchanged")
+
+	weighted = weightedActions(actions, "Search", []ActionWeight{
+		{EntityName: "Poster", Action: "actionPost", Weight: 1},
+		{Action: "actionPost", Weight: 2},
+	})
+	assert.Equal(t, 2, weighted[0].Weight)
+	assert.Equal(t, 5, weighted[1].Weight)
+}
+
+func TestLiveConfigUpdate(t *testing.T) {
+	cfg := &LoadTestConfig{
+		UserEntitiesConfiguration: UserEntitiesConfiguration{
+			TestLengthMinutes:                 20,
+			NumActiveEntities:                 10,
+			ActionRateMilliseconds:            1000,
+			ActionRateMaxVarianceMilliseconds: 100,
+			LinkPreviewChance:                 0.2,
+			UploadImageChance:                 0.1,
+			PublicChannelCreationChance:       1,
+		},
+	}
+	liveConfig := NewLiveConfig(cfg)
+
+	t.Run("no changes", func(t *testing.T) {
+		changes, err := liveConfig.Update(cfg)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.True(t, cfg == liveConfig.Current())
+	})
+
+	t.Run("chances and weights", func(t *testing.T) {
+		changedCfg := *cfg
+		changedCfg.UserEntitiesConfiguration.LinkPreviewChance = 0.5
+		changedCfg.UserEntitiesConfiguration.TestLengthMinutes = 60
+		changedCfg.UserEntitiesConfiguration.ActionWeights = []ActionWeight{{Action: "actionPost", Weight: 1}}
+
+		changes, err := liveConfig.Update(&changedCfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"LinkPreviewChance", "ActionWeights"}, changes)
+
+		current := liveConfig.Current()
+		assert.Equal(t, 0.5, current.UserEntitiesConfiguration.LinkPreviewChance)
+		assert.Equal(t, 0.1, current.UserEntitiesConfiguration.UploadImageChance)
+		assert.Equal(t, 20, current.UserEntitiesConfiguration.TestLengthMinutes, "only chances and weights should change")
+		assert.Len(t, current.UserEntitiesConfiguration.ActionWeights, 1)
+		assert.Equal(t, 0.2, cfg.UserEntitiesConfiguration.LinkPreviewChance, "the previous configuration should be unchanged")
+	})
+
+	t.Run("invalid change", func(t *testing.T) {
+		before := liveConfig.Current()
+
+		changedCfg := *before
+		changedCfg.UserEntitiesConfiguration.UploadImageChance = 2
+
+		_, err := liveConfig.Update(&changedCfg)
+		assert.Error(t, err)
+		assert.True(t, before == liveConfig.Current())
+	})
+}
@@ -0,0 +1,681 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// mockCall is a single call recorded by a mock client.
+type mockCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// mockClient is a recording implementation of Client and AdminClient. Every call is recorded
+// along with its arguments, and answered with the value configured in Returns for the method,
+// or with the error configured in Errors.
+type mockClient struct {
+	Returns map[string]interface{}
+	Errors  map[string]*model.AppError
+
+	lock  sync.Mutex
+	calls []mockCall
+}
+
+var _ Client = &mockClient{}
+var _ AdminClient = &mockClient{}
+
+func newMockClient() *mockClient {
+	return &mockClient{
+		Returns: make(map[string]interface{}),
+		Errors:  make(map[string]*model.AppError),
+	}
+}
+
+// fail configures the given method to fail with a server error.
+func (m *mockClient) fail(method string) {
+	m.Errors[method] = model.NewAppError(method, "mock.app_error", nil, "", http.StatusInternalServerError)
+}
+
+func (m *mockClient) record(method string, args ...interface{}) (interface{}, *model.Response) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.calls = append(m.calls, mockCall{Method: method, Args: args})
+
+	if err := m.Errors[method]; err != nil {
+		return nil, &model.Response{StatusCode: err.StatusCode, Error: err}
+	}
+
+	return m.Returns[method], &model.Response{StatusCode: http.StatusOK}
+}
+
+// Calls returns the recorded calls in the order they were made.
+func (m *mockClient) Calls() []mockCall {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	calls := make([]mockCall, len(m.calls))
+	copy(calls, m.calls)
+
+	return calls
+}
+
+// Methods returns the names of the recorded calls in the order they were made.
+func (m *mockClient) Methods() []string {
+	methods := []string{}
+	for _, call := range m.Calls() {
+		methods = append(methods, call.Method)
+	}
+
+	return methods
+}
+
+func (m *mockClient) Login(loginId string, password string) (*model.User, *model.Response) {
+	value, resp := m.record("Login", loginId, password)
+	result, _ := value.(*model.User)
+	return result, resp
+}
+
+func (m *mockClient) GetMe(etag string) (*model.User, *model.Response) {
+	value, resp := m.record("GetMe", etag)
+	result, _ := value.(*model.User)
+	return result, resp
+}
+
+func (m *mockClient) UpdateUser(user *model.User) (*model.User, *model.Response) {
+	value, resp := m.record("UpdateUser", user)
+	result, _ := value.(*model.User)
+	return result, resp
+}
+
+func (m *mockClient) PatchUser(userId string, patch *model.UserPatch) (*model.User, *model.Response) {
+	value, resp := m.record("PatchUser", userId, patch)
+	result, _ := value.(*model.User)
+	return result, resp
+}
+
+func (m *mockClient) SetProfileImage(userId string, data []byte) (bool, *model.Response) {
+	_, resp := m.record("SetProfileImage", userId, data)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetUsers(page int, perPage int, etag string) ([]*model.User, *model.Response) {
+	value, resp := m.record("GetUsers", page, perPage, etag)
+	result, _ := value.([]*model.User)
+	return result, resp
+}
+
+func (m *mockClient) SearchUsers(search *model.UserSearch) ([]*model.User, *model.Response) {
+	value, resp := m.record("SearchUsers", search)
+	result, _ := value.([]*model.User)
+	return result, resp
+}
+
+func (m *mockClient) GetUsersByIds(userIds []string) ([]*model.User, *model.Response) {
+	value, resp := m.record("GetUsersByIds", userIds)
+	result, _ := value.([]*model.User)
+	return result, resp
+}
+
+func (m *mockClient) GetUsersByUsernames(usernames []string) ([]*model.User, *model.Response) {
+	value, resp := m.record("GetUsersByUsernames", usernames)
+	result, _ := value.([]*model.User)
+	return result, resp
+}
+
+func (m *mockClient) GetUsersStatusesByIds(userIds []string) ([]*model.Status, *model.Response) {
+	value, resp := m.record("GetUsersStatusesByIds", userIds)
+	result, _ := value.([]*model.Status)
+	return result, resp
+}
+
+func (m *mockClient) UpdateUserStatus(userId string, userStatus *model.Status) (*model.Status, *model.Response) {
+	_, resp := m.record("UpdateUserStatus", userId, userStatus)
+	if resp.Error != nil {
+		return nil, resp
+	}
+	return userStatus, resp
+}
+
+func (m *mockClient) UpdateUserCustomStatus(userId string, customStatus *CustomStatus) (bool, *model.Response) {
+	_, resp := m.record("UpdateUserCustomStatus", userId, customStatus)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) RemoveUserCustomStatus(userId string) (bool, *model.Response) {
+	_, resp := m.record("RemoveUserCustomStatus", userId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) CreateTeam(team *model.Team) (*model.Team, *model.Response) {
+	value, resp := m.record("CreateTeam", team)
+	result, _ := value.(*model.Team)
+	return result, resp
+}
+
+func (m *mockClient) GetTeam(teamId, etag string) (*model.Team, *model.Response) {
+	value, resp := m.record("GetTeam", teamId, etag)
+	result, _ := value.(*model.Team)
+	return result, resp
+}
+
+func (m *mockClient) GetAllTeams(etag string, page int, perPage int) ([]*model.Team, *model.Response) {
+	value, resp := m.record("GetAllTeams", etag, page, perPage)
+	result, _ := value.([]*model.Team)
+	return result, resp
+}
+
+func (m *mockClient) SoftDeleteTeam(teamId string) (bool, *model.Response) {
+	_, resp := m.record("SoftDeleteTeam", teamId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetTeamInviteInfo(inviteId string) (*model.Team, *model.Response) {
+	value, resp := m.record("GetTeamInviteInfo", inviteId)
+	result, _ := value.(*model.Team)
+	return result, resp
+}
+
+func (m *mockClient) InviteUsersToTeam(teamId string, userEmails []string) (bool, *model.Response) {
+	_, resp := m.record("InviteUsersToTeam", teamId, userEmails)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) AddTeamMember(teamId, userId string) (*model.TeamMember, *model.Response) {
+	value, resp := m.record("AddTeamMember", teamId, userId)
+	result, _ := value.(*model.TeamMember)
+	return result, resp
+}
+
+func (m *mockClient) AddTeamMemberFromInvite(token, inviteId string) (*model.TeamMember, *model.Response) {
+	value, resp := m.record("AddTeamMemberFromInvite", token, inviteId)
+	result, _ := value.(*model.TeamMember)
+	return result, resp
+}
+
+func (m *mockClient) RemoveTeamMember(teamId, userId string) (bool, *model.Response) {
+	_, resp := m.record("RemoveTeamMember", teamId, userId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetTeamsUnreadForUser(userId, teamIdToExclude string) ([]*model.TeamUnread, *model.Response) {
+	value, resp := m.record("GetTeamsUnreadForUser", userId, teamIdToExclude)
+	result, _ := value.([]*model.TeamUnread)
+	return result, resp
+}
+
+func (m *mockClient) CreateChannel(channel *model.Channel) (*model.Channel, *model.Response) {
+	value, resp := m.record("CreateChannel", channel)
+	result, _ := value.(*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) CreateDirectChannel(userId1, userId2 string) (*model.Channel, *model.Response) {
+	value, resp := m.record("CreateDirectChannel", userId1, userId2)
+	result, _ := value.(*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) CreateGroupChannel(userIds []string) (*model.Channel, *model.Response) {
+	value, resp := m.record("CreateGroupChannel", userIds)
+	result, _ := value.(*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) GetChannel(channelId, etag string) (*model.Channel, *model.Response) {
+	value, resp := m.record("GetChannel", channelId, etag)
+	result, _ := value.(*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) DeleteChannel(channelId string) (bool, *model.Response) {
+	_, resp := m.record("DeleteChannel", channelId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetChannelStats(channelId string, etag string) (*model.ChannelStats, *model.Response) {
+	value, resp := m.record("GetChannelStats", channelId, etag)
+	result, _ := value.(*model.ChannelStats)
+	return result, resp
+}
+
+func (m *mockClient) GetChannelMember(channelId, userId, etag string) (*model.ChannelMember, *model.Response) {
+	value, resp := m.record("GetChannelMember", channelId, userId, etag)
+	result, _ := value.(*model.ChannelMember)
+	return result, resp
+}
+
+func (m *mockClient) GetChannelMembers(channelId string, page, perPage int, etag string) (*model.ChannelMembers, *model.Response) {
+	value, resp := m.record("GetChannelMembers", channelId, page, perPage, etag)
+	result, _ := value.(*model.ChannelMembers)
+	return result, resp
+}
+
+func (m *mockClient) AddChannelMember(channelId, userId string) (*model.ChannelMember, *model.Response) {
+	value, resp := m.record("AddChannelMember", channelId, userId)
+	result, _ := value.(*model.ChannelMember)
+	return result, resp
+}
+
+func (m *mockClient) RemoveUserFromChannel(channelId, userId string) (bool, *model.Response) {
+	_, resp := m.record("RemoveUserFromChannel", channelId, userId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetChannelsForTeamForUser(teamId, userId, etag string) ([]*model.Channel, *model.Response) {
+	value, resp := m.record("GetChannelsForTeamForUser", teamId, userId, etag)
+	result, _ := value.([]*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) GetPublicChannelsForTeam(teamId string, page int, perPage int, etag string) ([]*model.Channel, *model.Response) {
+	value, resp := m.record("GetPublicChannelsForTeam", teamId, page, perPage, etag)
+	result, _ := value.([]*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) AutocompleteChannelsForTeam(teamId, name string) (*model.ChannelList, *model.Response) {
+	value, resp := m.record("AutocompleteChannelsForTeam", teamId, name)
+	result, _ := value.(*model.ChannelList)
+	return result, resp
+}
+
+func (m *mockClient) SearchChannels(teamId string, search *model.ChannelSearch) ([]*model.Channel, *model.Response) {
+	value, resp := m.record("SearchChannels", teamId, search)
+	result, _ := value.([]*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) UpdateChannelNotifyProps(channelId, userId string, props map[string]string) (bool, *model.Response) {
+	_, resp := m.record("UpdateChannelNotifyProps", channelId, userId, props)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) ViewChannel(userId string, view *model.ChannelView) (*model.ChannelViewResponse, *model.Response) {
+	value, resp := m.record("ViewChannel", userId, view)
+	result, _ := value.(*model.ChannelViewResponse)
+	return result, resp
+}
+
+func (m *mockClient) GetChannelUnread(channelId, userId string) (*model.ChannelUnread, *model.Response) {
+	value, resp := m.record("GetChannelUnread", channelId, userId)
+	result, _ := value.(*model.ChannelUnread)
+	return result, resp
+}
+
+func (m *mockClient) CreatePost(post *model.Post) (*model.Post, *model.Response) {
+	value, resp := m.record("CreatePost", post)
+	result, _ := value.(*model.Post)
+	return result, resp
+}
+
+func (m *mockClient) GetPostsForChannel(channelId string, page, perPage int, etag string) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPostsForChannel", channelId, page, perPage, etag)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetPostsBefore(channelId, postId string, page, perPage int, etag string) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPostsBefore", channelId, postId, page, perPage, etag)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetPostsAfter(channelId, postId string, page, perPage int, etag string) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPostsAfter", channelId, postId, page, perPage, etag)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetPostsAroundLastUnread(userId, channelId string, limitBefore, limitAfter int) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPostsAroundLastUnread", userId, channelId, limitBefore, limitAfter)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetPostsSince(channelId string, time int64) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPostsSince", channelId, time)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetPostThread(postId string, etag string) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPostThread", postId, etag)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetPinnedPosts(channelId string, etag string) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetPinnedPosts", channelId, etag)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) GetFlaggedPostsForUser(userId string, page int, perPage int) (*model.PostList, *model.Response) {
+	value, resp := m.record("GetFlaggedPostsForUser", userId, page, perPage)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) PatchPost(postId string, patch *model.PostPatch) (*model.Post, *model.Response) {
+	value, resp := m.record("PatchPost", postId, patch)
+	result, _ := value.(*model.Post)
+	return result, resp
+}
+
+func (m *mockClient) DeletePost(postId string) (bool, *model.Response) {
+	_, resp := m.record("DeletePost", postId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) PinPost(postId string) (bool, *model.Response) {
+	_, resp := m.record("PinPost", postId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) UnpinPost(postId string) (bool, *model.Response) {
+	_, resp := m.record("UnpinPost", postId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) SearchPosts(teamId string, terms string, isOrSearch bool) (*model.PostList, *model.Response) {
+	value, resp := m.record("SearchPosts", teamId, terms, isOrSearch)
+	result, _ := value.(*model.PostList)
+	return result, resp
+}
+
+func (m *mockClient) SaveReaction(reaction *model.Reaction) (*model.Reaction, *model.Response) {
+	value, resp := m.record("SaveReaction", reaction)
+	result, _ := value.(*model.Reaction)
+	return result, resp
+}
+
+func (m *mockClient) GetReactions(postId string) ([]*model.Reaction, *model.Response) {
+	value, resp := m.record("GetReactions", postId)
+	result, _ := value.([]*model.Reaction)
+	return result, resp
+}
+
+func (m *mockClient) UpdatePreferences(userId string, preferences *model.Preferences) (bool, *model.Response) {
+	_, resp := m.record("UpdatePreferences", userId, preferences)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) DeletePreferences(userId string, preferences *model.Preferences) (bool, *model.Response) {
+	_, resp := m.record("DeletePreferences", userId, preferences)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetSidebarCategoriesForTeamForUser(userId, teamId, etag string) (*OrderedSidebarCategories, *model.Response) {
+	value, resp := m.record("GetSidebarCategoriesForTeamForUser", userId, teamId, etag)
+	result, _ := value.(*OrderedSidebarCategories)
+	return result, resp
+}
+
+func (m *mockClient) CreateSidebarCategoryForTeamForUser(userId, teamId string, category *SidebarCategoryWithChannels) (*SidebarCategoryWithChannels, *model.Response) {
+	value, resp := m.record("CreateSidebarCategoryForTeamForUser", userId, teamId, category)
+	result, _ := value.(*SidebarCategoryWithChannels)
+	return result, resp
+}
+
+func (m *mockClient) UpdateSidebarCategoriesForTeamForUser(userId, teamId string, categories []*SidebarCategoryWithChannels) ([]*SidebarCategoryWithChannels, *model.Response) {
+	_, resp := m.record("UpdateSidebarCategoriesForTeamForUser", userId, teamId, categories)
+	if resp.Error != nil {
+		return nil, resp
+	}
+	return categories, resp
+}
+
+func (m *mockClient) UpdateSidebarCategoryOrderForTeamForUser(userId, teamId string, order []string) ([]string, *model.Response) {
+	_, resp := m.record("UpdateSidebarCategoryOrderForTeamForUser", userId, teamId, order)
+	if resp.Error != nil {
+		return nil, resp
+	}
+	return order, resp
+}
+
+func (m *mockClient) GetUserThreads(userId, teamId string, page, perPage int) (*Threads, *model.Response) {
+	value, resp := m.record("GetUserThreads", userId, teamId, page, perPage)
+	result, _ := value.(*Threads)
+	return result, resp
+}
+
+func (m *mockClient) UpdateThreadFollowForUser(userId, teamId, threadId string, state bool) (bool, *model.Response) {
+	_, resp := m.record("UpdateThreadFollowForUser", userId, teamId, threadId, state)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) UpdateThreadReadForUser(userId, teamId, threadId string, timestamp int64) (bool, *model.Response) {
+	_, resp := m.record("UpdateThreadReadForUser", userId, teamId, threadId, timestamp)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) GetFile(fileId string) ([]byte, *model.Response) {
+	value, resp := m.record("GetFile", fileId)
+	result, _ := value.([]byte)
+	return result, resp
+}
+
+func (m *mockClient) GetFilePreview(fileId string) ([]byte, *model.Response) {
+	value, resp := m.record("GetFilePreview", fileId)
+	result, _ := value.([]byte)
+	return result, resp
+}
+
+func (m *mockClient) GetFileLink(fileId string) (string, *model.Response) {
+	value, resp := m.record("GetFileLink", fileId)
+	result, _ := value.(string)
+	return result, resp
+}
+
+func (m *mockClient) GetPublicFile(link string) ([]byte, *model.Response) {
+	value, resp := m.record("GetPublicFile", link)
+	result, _ := value.([]byte)
+	return result, resp
+}
+
+func (m *mockClient) SearchFiles(teamId string, terms string, isOrSearch bool) (*FileInfoList, *model.Response) {
+	value, resp := m.record("SearchFiles", teamId, terms, isOrSearch)
+	result, _ := value.(*FileInfoList)
+	return result, resp
+}
+
+func (m *mockClient) ExecuteCommand(channelId, command string) (*model.CommandResponse, *model.Response) {
+	value, resp := m.record("ExecuteCommand", channelId, command)
+	result, _ := value.(*model.CommandResponse)
+	return result, resp
+}
+
+func (m *mockClient) DoPostActionWithCookie(postId, actionId, selected, cookieStr string) (bool, *model.Response) {
+	_, resp := m.record("DoPostActionWithCookie", postId, actionId, selected, cookieStr)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) PostIncomingWebhook(hookId string, request *model.IncomingWebhookRequest) (bool, *model.Response) {
+	_, resp := m.record("PostIncomingWebhook", hookId, request)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) DoPluginRequest(method, pluginId, path string, data []byte) ([]byte, *model.Response) {
+	value, resp := m.record("DoPluginRequest", method, pluginId, path, data)
+	result, _ := value.([]byte)
+	return result, resp
+}
+
+func (m *mockClient) UploadFile(data []byte, channelId string, filename string) (*model.FileUploadResponse, *model.Response) {
+	value, resp := m.record("UploadFile", data, channelId, filename)
+	result, _ := value.(*model.FileUploadResponse)
+	return result, resp
+}
+
+func (m *mockClient) GetFileInfosForPost(postId string, etag string) ([]*model.FileInfo, *model.Response) {
+	value, resp := m.record("GetFileInfosForPost", postId, etag)
+	result, _ := value.([]*model.FileInfo)
+	return result, resp
+}
+
+func (m *mockClient) GetFileThumbnail(fileId string) ([]byte, *model.Response) {
+	value, resp := m.record("GetFileThumbnail", fileId)
+	result, _ := value.([]byte)
+	return result, resp
+}
+
+func (m *mockClient) GetEmojiByName(name string) (*model.Emoji, *model.Response) {
+	value, resp := m.record("GetEmojiByName", name)
+	result, _ := value.(*model.Emoji)
+	return result, resp
+}
+
+func (m *mockClient) OpenGraph(url string) (map[string]string, *model.Response) {
+	value, resp := m.record("OpenGraph", url)
+	result, _ := value.(map[string]string)
+	return result, resp
+}
+
+func (m *mockClient) GetWebappPlugins() ([]*model.Manifest, *model.Response) {
+	value, resp := m.record("GetWebappPlugins")
+	result, _ := value.([]*model.Manifest)
+	return result, resp
+}
+
+func (m *mockClient) GetChannelByName(channelName, teamId string, etag string) (*model.Channel, *model.Response) {
+	value, resp := m.record("GetChannelByName", channelName, teamId, etag)
+	result, _ := value.(*model.Channel)
+	return result, resp
+}
+
+func (m *mockClient) CreateIncomingWebhook(hook *model.IncomingWebhook) (*model.IncomingWebhook, *model.Response) {
+	value, resp := m.record("CreateIncomingWebhook", hook)
+	result, _ := value.(*model.IncomingWebhook)
+	return result, resp
+}
+
+func (m *mockClient) UpdateUserActive(userId string, active bool) (bool, *model.Response) {
+	_, resp := m.record("UpdateUserActive", userId, active)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) PatchTeam(teamId string, patch *model.TeamPatch) (*model.Team, *model.Response) {
+	value, resp := m.record("PatchTeam", teamId, patch)
+	result, _ := value.(*model.Team)
+	return result, resp
+}
+
+func (m *mockClient) SetTeamIcon(teamId string, data []byte) (bool, *model.Response) {
+	_, resp := m.record("SetTeamIcon", teamId, data)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) RegenerateTeamInviteId(teamId string) (*model.Team, *model.Response) {
+	value, resp := m.record("RegenerateTeamInviteId", teamId)
+	result, _ := value.(*model.Team)
+	return result, resp
+}
+
+func (m *mockClient) GetSchemes(scope string, page int, perPage int) ([]*model.Scheme, *model.Response) {
+	value, resp := m.record("GetSchemes", scope, page, perPage)
+	result, _ := value.([]*model.Scheme)
+	return result, resp
+}
+
+func (m *mockClient) GetRoleByName(name string) (*model.Role, *model.Response) {
+	value, resp := m.record("GetRoleByName", name)
+	result, _ := value.(*model.Role)
+	return result, resp
+}
+
+func (m *mockClient) PatchRole(roleId string, patch *model.RolePatch) (*model.Role, *model.Response) {
+	value, resp := m.record("PatchRole", roleId, patch)
+	result, _ := value.(*model.Role)
+	return result, resp
+}
+
+func (m *mockClient) UpdateTeamScheme(teamId, schemeId string) (bool, *model.Response) {
+	_, resp := m.record("UpdateTeamScheme", teamId, schemeId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) UpdateChannelScheme(channelId, schemeId string) (bool, *model.Response) {
+	_, resp := m.record("UpdateChannelScheme", channelId, schemeId)
+	return resp.Error == nil, resp
+}
+
+func (m *mockClient) UpdateChannelMemberSchemeRoles(channelId string, userId string, schemeRoles *model.SchemeRoles) (bool, *model.Response) {
+	_, resp := m.record("UpdateChannelMemberSchemeRoles", channelId, userId, schemeRoles)
+	return resp.Error == nil, resp
+}
+
+// mockWebSocketClient is a recording implementation of WebSocketClient.
+type mockWebSocketClient struct {
+	EventChannel    chan *model.WebSocketEvent
+	ResponseChannel chan *model.WebSocketResponse
+
+	lock  sync.Mutex
+	calls []string
+}
+
+var _ WebSocketClient = &mockWebSocketClient{}
+
+func newMockWebSocketClient() *mockWebSocketClient {
+	return &mockWebSocketClient{
+		EventChannel:    make(chan *model.WebSocketEvent, 100),
+		ResponseChannel: make(chan *model.WebSocketResponse, 100),
+	}
+}
+
+func (m *mockWebSocketClient) record(method string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.calls = append(m.calls, method)
+}
+
+// Methods returns the names of the recorded calls in the order they were made.
+func (m *mockWebSocketClient) Methods() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	methods := make([]string, len(m.calls))
+	copy(methods, m.calls)
+
+	return methods
+}
+
+func (m *mockWebSocketClient) Connect() *model.AppError {
+	m.record("Connect")
+	return nil
+}
+
+func (m *mockWebSocketClient) Listen() {
+	m.record("Listen")
+}
+
+func (m *mockWebSocketClient) Close() {
+	m.record("Close")
+}
+
+func (m *mockWebSocketClient) Events() <-chan *model.WebSocketEvent {
+	return m.EventChannel
+}
+
+func (m *mockWebSocketClient) ListenError() *model.AppError {
+	return nil
+}
+
+func (m *mockWebSocketClient) Responses() <-chan *model.WebSocketResponse {
+	return m.ResponseChannel
+}
+
+func (m *mockWebSocketClient) UserTyping(channelId, parentId string) {
+	m.record("UserTyping")
+}
+
+func (m *mockWebSocketClient) GetStatusesByIds(userIds []string) {
+	m.record("GetStatusesByIds")
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// errSimulatedDrop is returned for requests deliberately failed to simulate an unreliable network.
+var errSimulatedDrop = errors.New("simulated connection drop")
+
+// NetworkConditions describes the network between an entity and the server, such as that of a
+// mobile client or a remote office. The zero value adds no impairment.
+type NetworkConditions struct {
+	// EntityName is the name of the entity type these conditions apply to. Conditions with no
+	// entity name apply to all entity types without conditions of their own.
+	EntityName string
+	// LatencyMilliseconds is added before every request, and to every message received over the
+	// websocket.
+	LatencyMilliseconds int
+	// JitterMilliseconds is the most by which the added latency randomly varies either way.
+	JitterMilliseconds int
+	// BandwidthKilobitsPerSecond limits the rate at which data is sent and received.
+	BandwidthKilobitsPerSecond int
+	// RequestDropChance is the chance the connection drops before a response is received.
+	RequestDropChance float64
+	// WebsocketDropChance is the chance, before each action, that the websocket drops.
+	WebsocketDropChance float64
+}
+
+// networkConditionsFor returns the conditions configured for the given entity type, if any.
+func networkConditionsFor(conditions []NetworkConditions, entityName string) *NetworkConditions {
+	var defaultConditions *NetworkConditions
+	for i := range conditions {
+		if conditions[i].EntityName == entityName {
+			return &conditions[i]
+		} else if conditions[i].EntityName == "" {
+			defaultConditions = &conditions[i]
+		}
+	}
+
+	return defaultConditions
+}
+
+// networkSimulator applies network conditions to the traffic of a single entity.
+type networkSimulator struct {
+	conditions NetworkConditions
+
+	lock sync.Mutex
+	r    *rand.Rand
+}
+
+func newNetworkSimulator(conditions NetworkConditions, seed int64) *networkSimulator {
+	return &networkSimulator{
+		conditions: conditions,
+		r:          rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (ns *networkSimulator) chance(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	return ns.r.Float64() < probability
+}
+
+// latency returns the configured latency, randomly varied by the configured jitter.
+func (ns *networkSimulator) latency() time.Duration {
+	latency := time.Duration(ns.conditions.LatencyMilliseconds) * time.Millisecond
+	if jitter := ns.conditions.JitterMilliseconds; jitter > 0 {
+		ns.lock.Lock()
+		latency += time.Duration(ns.r.Intn(2*jitter+1)-jitter) * time.Millisecond
+		ns.lock.Unlock()
+	}
+
+	return latency
+}
+
+// delay sleeps for the configured latency.
+func (ns *networkSimulator) delay() {
+	if latency := ns.latency(); latency > 0 {
+		time.Sleep(latency)
+	}
+}
+
+// transfer sleeps for as long as it would take to transfer the given number of bytes.
+func (ns *networkSimulator) transfer(n int) {
+	if ns.conditions.BandwidthKilobitsPerSecond <= 0 || n <= 0 {
+		return
+	}
+
+	time.Sleep(time.Duration(n) * 8 * time.Second / time.Duration(ns.conditions.BandwidthKilobitsPerSecond*1000))
+}
+
+// throttledReader limits the rate at which data can be read to the simulated bandwidth.
+type throttledReader struct {
+	io.ReadCloser
+	simulator *networkSimulator
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.ReadCloser.Read(p)
+	tr.simulator.transfer(n)
+	return n, err
+}
+
+// networkRoundTripper delays, throttles and drops requests according to the network conditions.
+type networkRoundTripper struct {
+	next      http.RoundTripper
+	simulator *networkSimulator
+}
+
+func (nrt *networkRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	nrt.simulator.delay()
+	if r.Body != nil && nrt.simulator.conditions.BandwidthKilobitsPerSecond > 0 {
+		// Round trippers must not modify the request they are given.
+		throttled := new(http.Request)
+		*throttled = *r
+		throttled.Body = &throttledReader{r.Body, nrt.simulator}
+		r = throttled
+	}
+
+	resp, err := nrt.next.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+
+	if nrt.simulator.chance(nrt.simulator.conditions.RequestDropChance) {
+		resp.Body.Close()
+		return nil, errSimulatedDrop
+	}
+
+	if nrt.simulator.conditions.BandwidthKilobitsPerSecond > 0 {
+		resp.Body = &throttledReader{resp.Body, nrt.simulator}
+	}
+
+	return resp, nil
+}
+
+// networkConn delays and throttles the traffic over a websocket connection. Data is received as
+// soon as it arrives and handed on once the latency has passed since its arrival, so that each
+// message is delayed once, however many reads it takes, and a busy connection never falls behind.
+type networkConn struct {
+	net.Conn
+	simulator *networkSimulator
+
+	arrivals  chan networkArrival
+	closed    chan struct{}
+	closeOnce sync.Once
+	// receiveErr is the error which stopped receiving, set before arrivals is closed.
+	receiveErr error
+	// pending is the part of the last arrival not read yet.
+	pending []byte
+}
+
+// networkArrival is data received over a connection, along with when it may be read.
+type networkArrival struct {
+	data      []byte
+	deliverAt time.Time
+}
+
+func newNetworkConn(conn net.Conn, simulator *networkSimulator) *networkConn {
+	nc := &networkConn{
+		Conn:      conn,
+		simulator: simulator,
+		arrivals:  make(chan networkArrival, 64),
+		closed:    make(chan struct{}),
+	}
+	go nc.receive()
+
+	return nc
+}
+
+func (nc *networkConn) receive() {
+	defer close(nc.arrivals)
+
+	for {
+		data := make([]byte, 32*1024)
+		n, err := nc.Conn.Read(data)
+		if n > 0 {
+			select {
+			case nc.arrivals <- networkArrival{data[:n], time.Now().Add(nc.simulator.latency())}:
+			case <-nc.closed:
+				return
+			}
+		}
+		if err != nil {
+			nc.receiveErr = err
+			return
+		}
+	}
+}
+
+func (nc *networkConn) Read(p []byte) (int, error) {
+	if len(nc.pending) == 0 {
+		arrival, ok := <-nc.arrivals
+		if !ok {
+			return 0, nc.receiveErr
+		}
+		time.Sleep(time.Until(arrival.deliverAt))
+		nc.pending = arrival.data
+	}
+
+	n := copy(p, nc.pending)
+	nc.pending = nc.pending[n:]
+	nc.simulator.transfer(n)
+
+	return n, nil
+}
+
+func (nc *networkConn) Write(p []byte) (int, error) {
+	nc.simulator.transfer(len(p))
+	return nc.Conn.Write(p)
+}
+
+func (nc *networkConn) Close() error {
+	nc.closeOnce.Do(func() { close(nc.closed) })
+	return nc.Conn.Close()
+}
+
+// simulateOnDialer makes connections from the given websocket dialer subject to the network
+// conditions.
+func (ns *networkSimulator) simulateOnDialer(dialer *websocket.Dialer) {
+	netDialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dialer.NetDial = func(network, address string) (net.Conn, error) {
+		ns.delay()
+		conn, err := netDialer.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return newNetworkConn(conn, ns), nil
+	}
+}
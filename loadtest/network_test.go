@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkConditionsFor(t *testing.T) {
+	conditions := []NetworkConditions{
+		{LatencyMilliseconds: 10},
+		{EntityName: "Poster", LatencyMilliseconds: 200},
+	}
+
+	assert.Equal(t, 200, networkConditionsFor(conditions, "Poster").LatencyMilliseconds)
+	assert.Equal(t, 10, networkConditionsFor(conditions, "Search").LatencyMilliseconds)
+	assert.Nil(t, networkConditionsFor(conditions[1:], "Search"))
+}
+
+func TestNetworkRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+
+	get := func(conditions NetworkConditions) (time.Duration, error) {
+		client := &http.Client{
+			Transport: &networkRoundTripper{http.DefaultTransport, newNetworkSimulator(conditions, 1)},
+		}
+
+		start := time.Now()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Len(t, data, 1000)
+
+		return time.Since(start), nil
+	}
+
+	t.Run("latency", func(t *testing.T) {
+		elapsed, err := get(NetworkConditions{LatencyMilliseconds: 50, JitterMilliseconds: 10})
+		require.NoError(t, err)
+		assert.True(t, elapsed >= 40*time.Millisecond, "took %v", elapsed)
+	})
+
+	t.Run("bandwidth", func(t *testing.T) {
+		// 1000 bytes at 80 kilobits per second takes 100 milliseconds.
+		elapsed, err := get(NetworkConditions{BandwidthKilobitsPerSecond: 80})
+		require.NoError(t, err)
+		assert.True(t, elapsed >= 100*time.Millisecond, "took %v", elapsed)
+	})
+
+	t.Run("drops", func(t *testing.T) {
+		_, err := get(NetworkConditions{RequestDropChance: 1})
+		assert.Error(t, err)
+	})
+
+	t.Run("leaves the request alone", func(t *testing.T) {
+		transport := &networkRoundTripper{http.DefaultTransport, newNetworkSimulator(NetworkConditions{BandwidthKilobitsPerSecond: 8000}, 1)}
+		body := ioutil.NopCloser(strings.NewReader("body"))
+		req, err := http.NewRequest(http.MethodPost, server.URL, body)
+		require.NoError(t, err)
+
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, body, req.Body)
+	})
+}
+
+func TestNetworkConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	conn := newNetworkConn(client, newNetworkSimulator(NetworkConditions{LatencyMilliseconds: 100}, 1))
+	defer conn.Close()
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			server.Write([]byte(strings.Repeat("x", 100)))
+		}
+		server.Close()
+	}()
+
+	start := time.Now()
+	data := []byte{}
+	buffer := make([]byte, 10)
+	for {
+		n, err := conn.Read(buffer)
+		data = append(data, buffer[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	elapsed := time.Since(start)
+
+	assert.Len(t, data, 1000)
+	assert.True(t, elapsed >= 100*time.Millisecond, "took %v", elapsed)
+	assert.True(t, elapsed < 500*time.Millisecond, "the latency should not add up over reads, took %v", elapsed)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The outgoing webhooks registered in every team, which call the integration server. The trigger
+// word webhook fires for posts in any public channel starting with one of its trigger words, and
+// the channel webhook for every post in town square.
+const (
+	OUTGOING_WEBHOOK_PATH         = "/webhooks/outgoing"
+	OUTGOING_WEBHOOK_CHANNEL_PATH = "/webhooks/outgoing/channel"
+
+	OUTGOING_WEBHOOK_TRIGGER_WORD_NAME = "Load Test Trigger Words"
+	OUTGOING_WEBHOOK_CHANNEL_NAME      = "Load Test Town Square"
+)
+
+// Posts starting with these words trigger the trigger word webhook. The integration server replies
+// in the thread of posts starting with OUTGOING_WEBHOOK_TRIGGER_REPLY.
+const (
+	OUTGOING_WEBHOOK_TRIGGER       = "ltwebhook"
+	OUTGOING_WEBHOOK_TRIGGER_REPLY = "ltwebhook-reply"
+)
+
+// The kinds of outgoing webhook reported on.
+const (
+	OUTGOING_WEBHOOK_KIND_TRIGGER_WORD = "trigger_word"
+	OUTGOING_WEBHOOK_KIND_CHANNEL      = "channel"
+)
+
+func outgoingWebhookReplyText(postId string) string {
+	return fmt.Sprintf("Reply to load test post %s", postId)
+}
+
+// outgoingWebhookState records how long the server took to call the integration server for the
+// posts that triggered outgoing webhooks.
+type outgoingWebhookState struct {
+	lock sync.Mutex
+	// delays lists the times in milliseconds from each post's creation to its webhook call, by
+	// kind of webhook.
+	delays map[string][]float64
+	// replies counts the replies sent by kind of webhook.
+	replies map[string]int64
+}
+
+// received records a webhook call made at the given time.
+func (ws *outgoingWebhookState) received(kind string, payload *model.OutgoingWebhookPayload, replied bool, now time.Time) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.delays == nil {
+		ws.delays = make(map[string][]float64)
+	}
+	if ws.replies == nil {
+		ws.replies = make(map[string]int64)
+	}
+
+	delay := now.UnixNano()/int64(time.Millisecond) - payload.Timestamp
+	ws.delays[kind] = append(ws.delays[kind], float64(delay))
+	if replied {
+		ws.replies[kind]++
+	}
+}
+
+// outgoingWebhookResults summarises the calls made by one kind of outgoing webhook.
+type outgoingWebhookResults struct {
+	latencySummary
+	Replies int64
+}
+
+// results summarises the webhook calls received so far by kind of webhook.
+func (ws *outgoingWebhookState) results() map[string]outgoingWebhookResults {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	byKind := make(map[string]outgoingWebhookResults, len(ws.delays))
+	for kind, delays := range ws.delays {
+		byKind[kind] = outgoingWebhookResults{
+			latencySummary: summarizeLatencies(delays),
+			Replies:        ws.replies[kind],
+		}
+	}
+
+	return byKind
+}
+
+// handleOutgoingWebhook records the delay of a call from the trigger word webhook, replying in
+// the thread of the post when it asks for one.
+func (is *IntegrationServer) handleOutgoingWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, ok := decodeOutgoingWebhookPayload(w, r)
+	if !ok {
+		return
+	}
+
+	response := &model.OutgoingWebhookResponse{}
+	replied := payload.TriggerWord == OUTGOING_WEBHOOK_TRIGGER_REPLY
+	if replied {
+		text := outgoingWebhookReplyText(payload.PostId)
+		response.Text = &text
+		response.ResponseType = model.OUTGOING_HOOK_RESPONSE_TYPE_COMMENT
+	}
+	is.outgoingWebhooks.received(OUTGOING_WEBHOOK_KIND_TRIGGER_WORD, payload, replied, time.Now())
+
+	writeOutgoingWebhookResponse(w, response)
+}
+
+// handleOutgoingChannelWebhook records the delay of a call from the channel webhook, which is
+// never replied to so as not to double the posts in town square.
+func (is *IntegrationServer) handleOutgoingChannelWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, ok := decodeOutgoingWebhookPayload(w, r)
+	if !ok {
+		return
+	}
+
+	is.outgoingWebhooks.received(OUTGOING_WEBHOOK_KIND_CHANNEL, payload, false, time.Now())
+
+	writeOutgoingWebhookResponse(w, &model.OutgoingWebhookResponse{})
+}
+
+func decodeOutgoingWebhookPayload(w http.ResponseWriter, r *http.Request) (*model.OutgoingWebhookPayload, bool) {
+	var payload model.OutgoingWebhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &payload, true
+}
+
+// writeOutgoingWebhookResponse always writes a JSON body, even when not replying, since the server
+// logs an error for responses it cannot decode.
+func writeOutgoingWebhookResponse(w http.ResponseWriter, response *model.OutgoingWebhookResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(response.ToJson()))
+}
+
+// reportOutgoingWebhooks logs how long the server took to call the integration server for the
+// posts that triggered outgoing webhooks.
+func reportOutgoingWebhooks(is *IntegrationServer, instanceId string) {
+	byKind := is.outgoingWebhooks.results()
+	if len(byKind) == 0 {
+		return
+	}
+
+	mlog.Info(
+		"Outgoing webhooks",
+		mlog.String("tag", "outgoing_webhooks"),
+		mlog.Any("by_kind", byKind),
+		mlog.String("instance_id", instanceId),
+	)
+}
+
+// setupOutgoingWebhooks registers the outgoing webhooks in every team, pointing them at the given
+// integration URL. Webhooks left by earlier tests are updated rather than registered again.
+func setupOutgoingWebhooks(adminClient *model.Client4, integrationURL string, teamIdMap, townSquareIdMap map[string]string) error {
+	integrationURL = strings.TrimSuffix(integrationURL, "/")
+
+	for teamName, teamId := range teamIdMap {
+		hooks, resp := adminClient.GetOutgoingWebhooksForTeam(teamId, 0, 200, "")
+		if resp.Error != nil {
+			mlog.Error("Failed to list outgoing webhooks", mlog.String("team", teamName), mlog.Err(resp.Error))
+			return resp.Error
+		}
+
+		wanted := []*model.OutgoingWebhook{{
+			TeamId:       teamId,
+			DisplayName:  OUTGOING_WEBHOOK_TRIGGER_WORD_NAME,
+			TriggerWords: []string{OUTGOING_WEBHOOK_TRIGGER, OUTGOING_WEBHOOK_TRIGGER_REPLY},
+			TriggerWhen:  0,
+			CallbackURLs: []string{integrationURL + OUTGOING_WEBHOOK_PATH},
+		}}
+		if townSquareId := townSquareIdMap[teamName]; townSquareId != "" {
+			wanted = append(wanted, &model.OutgoingWebhook{
+				TeamId:       teamId,
+				ChannelId:    townSquareId,
+				DisplayName:  OUTGOING_WEBHOOK_CHANNEL_NAME,
+				CallbackURLs: []string{integrationURL + OUTGOING_WEBHOOK_CHANNEL_PATH},
+			})
+		}
+
+		for _, hook := range wanted {
+			hook.ContentType = "application/json"
+			hook.Username = "loadtest"
+			hook.Description = "Calls the load test"
+
+			var existing *model.OutgoingWebhook
+			for _, candidate := range hooks {
+				if candidate.DisplayName == hook.DisplayName {
+					existing = candidate
+					break
+				}
+			}
+
+			if existing == nil {
+				if _, resp := adminClient.CreateOutgoingWebhook(hook); resp.Error != nil {
+					mlog.Error("Failed to create outgoing webhook", mlog.String("team", teamName), mlog.String("name", hook.DisplayName), mlog.Err(resp.Error))
+					return resp.Error
+				}
+				continue
+			}
+
+			hook.Id = existing.Id
+			if _, resp := adminClient.UpdateOutgoingWebhook(hook); resp.Error != nil {
+				mlog.Error("Failed to update outgoing webhook", mlog.String("team", teamName), mlog.String("name", hook.DisplayName), mlog.Err(resp.Error))
+				return resp.Error
+			}
+		}
+	}
+
+	mlog.Info("Outgoing webhooks are set up", mlog.String("url", integrationURL), mlog.Int("teams", len(teamIdMap)))
+
+	return nil
+}
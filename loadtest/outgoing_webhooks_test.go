@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutgoingWebhookRoundTrip(t *testing.T) {
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	team := s.CreateTeam(&model.Team{Name: "team0", DisplayName: "Team 0"})
+	channel := s.GetChannelByName(team.Id, model.DEFAULT_CHANNEL)
+	require.NotNil(t, channel)
+	user := s.CreateUser(&model.User{Username: "user0", Email: "success+user0@simulator.amazonses.com"}, "password")
+	s.AddTeamMember(team.Id, user.Id)
+
+	integrationServer, err := NewIntegrationServer("127.0.0.1:0", &http.Client{})
+	require.NoError(t, err)
+	defer integrationServer.Close()
+
+	adminClient := model.NewAPIv4Client(serverURL)
+	_, resp := adminClient.Login("success+user0@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	integrationURL := "http://" + integrationServer.Addr()
+	teamIdMap := map[string]string{team.Name: team.Id}
+	townSquareIdMap := map[string]string{team.Name: channel.Id}
+	require.NoError(t, setupOutgoingWebhooks(adminClient, "http://localhost:1", teamIdMap, townSquareIdMap))
+	require.NoError(t, setupOutgoingWebhooks(adminClient, integrationURL+"/", teamIdMap, townSquareIdMap))
+
+	hooks, resp := adminClient.GetOutgoingWebhooksForTeam(team.Id, 0, 200, "")
+	require.Nil(t, resp.Error)
+	require.Len(t, hooks, 2, "setting up again should update the existing webhooks")
+	for _, hook := range hooks {
+		require.Len(t, hook.CallbackURLs, 1)
+		assert.True(t, strings.HasPrefix(hook.CallbackURLs[0], integrationURL+OUTGOING_WEBHOOK_PATH))
+	}
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), adminClient.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+	hello := <-ws.EventChannel
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	post, resp := adminClient.CreatePost(&model.Post{ChannelId: channel.Id, Message: OUTGOING_WEBHOOK_TRIGGER_REPLY + " hello"})
+	require.Nil(t, resp.Error)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-ws.EventChannel:
+			if event.Event != model.WEBSOCKET_EVENT_POSTED {
+				continue
+			}
+			reply := model.PostFromJson(strings.NewReader(event.Data["post"].(string)))
+			if reply.Id == post.Id {
+				continue
+			}
+			assert.Equal(t, outgoingWebhookReplyText(post.Id), reply.Message)
+			assert.Equal(t, post.Id, reply.RootId)
+		case <-timeout:
+			t.Fatal("timed out waiting for the reply")
+		}
+		break
+	}
+
+	require.Eventually(t, func() bool {
+		return len(integrationServer.outgoingWebhooks.results()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	results := integrationServer.outgoingWebhooks.results()
+	assert.Equal(t, 1, results[OUTGOING_WEBHOOK_KIND_TRIGGER_WORD].Count)
+	assert.Equal(t, int64(1), results[OUTGOING_WEBHOOK_KIND_TRIGGER_WORD].Replies)
+	assert.Equal(t, 1, results[OUTGOING_WEBHOOK_KIND_CHANNEL].Count)
+	assert.Equal(t, int64(0), results[OUTGOING_WEBHOOK_KIND_CHANNEL].Replies)
+
+	// Neither the reply nor a post without a trigger word calls the trigger word webhook again.
+	_, resp = adminClient.CreatePost(&model.Post{ChannelId: channel.Id, Message: "hello " + OUTGOING_WEBHOOK_TRIGGER})
+	require.Nil(t, resp.Error)
+	require.Eventually(t, func() bool {
+		return integrationServer.outgoingWebhooks.results()[OUTGOING_WEBHOOK_KIND_CHANNEL].Count == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, integrationServer.outgoingWebhooks.results()[OUTGOING_WEBHOOK_KIND_TRIGGER_WORD].Count)
+}
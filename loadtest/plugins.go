@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"os"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// LOADTEST_PLUGIN_ID is the id of the server plugin built from loadtestplugin with `make plugin`.
+const LOADTEST_PLUGIN_ID = "com.mattermost.loadtest-plugin"
+
+// LOADTEST_PLUGIN_BUNDLE is where `make plugin` builds the load test plugin.
+const LOADTEST_PLUGIN_BUNDLE = "testfiles/com.mattermost.loadtest-plugin.tar.gz"
+
+// defaultPluginBundles are installed when no plugin bundles are configured.
+var defaultPluginBundles = []string{
+	"testfiles/com.mattermost.sample-plugin-webapp-only.tar.gz",
+}
+
+// LoadtestPluginSettings is the cost of the hooks and endpoints of the load test plugin.
+type LoadtestPluginSettings struct {
+	HookCPUMicroseconds int
+	HookKVReads         int
+	HookKVWrites        int
+	HookBroadcast       bool
+	HTTPCPUMicroseconds int
+}
+
+// pluginBundles returns the plugin bundles to install.
+func pluginBundles(cfg *LoadtestEnviromentConfig) []string {
+	if cfg.NumPlugins <= 0 {
+		return nil
+	}
+
+	bundles := cfg.PluginBundles
+	if len(bundles) == 0 {
+		bundles = defaultPluginBundles
+	}
+	if cfg.NumPlugins < len(bundles) {
+		bundles = bundles[:cfg.NumPlugins]
+	}
+
+	return bundles
+}
+
+// setupPlugins installs and enables the plugin bundles, replacing any earlier versions, and
+// configures the load test plugin.
+func setupPlugins(adminClient *model.Client4, cfg *LoadtestEnviromentConfig) error {
+	for _, bundle := range pluginBundles(cfg) {
+		manifest, err := installPlugin(adminClient, bundle)
+		if err != nil {
+			return err
+		}
+
+		if manifest.Id == LOADTEST_PLUGIN_ID {
+			if err := configureLoadtestPlugin(adminClient, &cfg.LoadtestPluginSettings); err != nil {
+				return err
+			}
+		}
+
+		mlog.Info("Enabling plugin.", mlog.String("plugin_id", manifest.Id))
+		if _, resp := adminClient.EnablePlugin(manifest.Id); resp.Error != nil {
+			mlog.Error("Failed to enable plugin", mlog.String("plugin_id", manifest.Id), mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	return nil
+}
+
+func installPlugin(adminClient *model.Client4, bundle string) (*model.Manifest, error) {
+	file, err := os.Open(bundle)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mlog.Info("Uploading plugin.", mlog.String("bundle", bundle))
+	manifest, resp := adminClient.UploadPluginForced(file)
+	if resp.Error != nil {
+		mlog.Error("Failed to upload plugin", mlog.String("bundle", bundle), mlog.Err(resp.Error))
+		return nil, resp.Error
+	}
+
+	return manifest, nil
+}
+
+// configureLoadtestPlugin sets the settings of the load test plugin in the server config.
+func configureLoadtestPlugin(adminClient *model.Client4, settings *LoadtestPluginSettings) error {
+	serverConfig, resp := adminClient.GetConfig()
+	if serverConfig == nil {
+		mlog.Error("Failed to get the server config", mlog.Err(resp.Error))
+		return resp.Error
+	}
+
+	if serverConfig.PluginSettings.Plugins == nil {
+		serverConfig.PluginSettings.Plugins = make(map[string]map[string]interface{})
+	}
+	// The server keeps the keys of plugin settings in lower case.
+	serverConfig.PluginSettings.Plugins[LOADTEST_PLUGIN_ID] = map[string]interface{}{
+		"hookcpumicroseconds": settings.HookCPUMicroseconds,
+		"hookkvreads":         settings.HookKVReads,
+		"hookkvwrites":        settings.HookKVWrites,
+		"hookbroadcast":       settings.HookBroadcast,
+		"httpcpumicroseconds": settings.HTTPCPUMicroseconds,
+	}
+	if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+		mlog.Error("Failed to configure the load test plugin", mlog.Err(resp.Error))
+		return resp.Error
+	}
+
+	mlog.Info("Load test plugin is configured", mlog.Any("settings", *settings))
+
+	return nil
+}
+
+// checkPlugins checks that the plugins to install are configured sensibly.
+func (vr *ValidationResult) checkPlugins(section string, cfg *LoadtestEnviromentConfig) {
+	bundles := cfg.PluginBundles
+	if len(bundles) == 0 {
+		bundles = defaultPluginBundles
+	}
+	if cfg.NumPlugins > len(bundles) {
+		vr.problem("%s.NumPlugins is %d, but only %d plugin bundles are configured", section, cfg.NumPlugins, len(bundles))
+	}
+
+	for _, count := range []struct {
+		name  string
+		value int
+	}{
+		{"HookCPUMicroseconds", cfg.LoadtestPluginSettings.HookCPUMicroseconds},
+		{"HookKVReads", cfg.LoadtestPluginSettings.HookKVReads},
+		{"HookKVWrites", cfg.LoadtestPluginSettings.HookKVWrites},
+		{"HTTPCPUMicroseconds", cfg.LoadtestPluginSettings.HTTPCPUMicroseconds},
+	} {
+		if count.value < 0 {
+			vr.problem("%s.LoadtestPluginSettings.%s must not be negative", section, count.name)
+		}
+	}
+}
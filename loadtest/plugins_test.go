@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginBundles(t *testing.T) {
+	assert.Nil(t, pluginBundles(&LoadtestEnviromentConfig{NumPlugins: 0}))
+	assert.Nil(t, pluginBundles(&LoadtestEnviromentConfig{NumPlugins: -1}))
+	assert.Equal(t, defaultPluginBundles[:1], pluginBundles(&LoadtestEnviromentConfig{NumPlugins: 1}))
+	assert.Equal(t, defaultPluginBundles, pluginBundles(&LoadtestEnviromentConfig{NumPlugins: 5}))
+	assert.Equal(t, []string{"a.tar.gz"}, pluginBundles(&LoadtestEnviromentConfig{NumPlugins: 1, PluginBundles: []string{"a.tar.gz", "b.tar.gz"}}))
+}
+
+// writePluginBundle writes a plugin bundle holding only a manifest with the given id.
+func writePluginBundle(t *testing.T, dir, id string) string {
+	bundle := filepath.Join(dir, id+".tar.gz")
+	file, err := os.Create(bundle)
+	require.NoError(t, err)
+	defer file.Close()
+
+	manifest := []byte((&model.Manifest{Id: id, Name: id, Version: "0.1.0"}).ToJson())
+	gzw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: id + "/plugin.json", Mode: 0644, Size: int64(len(manifest))}))
+	_, err = tw.Write(manifest)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	return bundle
+}
+
+func TestSetupPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	s.CreateUser(&model.User{Username: "admin", Email: "success+admin@simulator.amazonses.com", Roles: model.SYSTEM_ADMIN_ROLE_ID + " " + model.SYSTEM_USER_ROLE_ID}, "password")
+	adminClient := model.NewAPIv4Client(serverURL)
+	_, resp := adminClient.Login("success+admin@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	cfg := &LoadtestEnviromentConfig{
+		NumPlugins:             2,
+		PluginBundles:          []string{writePluginBundle(t, dir, "com.example.other"), writePluginBundle(t, dir, LOADTEST_PLUGIN_ID)},
+		LoadtestPluginSettings: LoadtestPluginSettings{HookCPUMicroseconds: 100, HookKVWrites: 2, HookBroadcast: true},
+	}
+	require.NoError(t, setupPlugins(adminClient, cfg))
+	require.NoError(t, setupPlugins(adminClient, cfg), "setting up again should replace the plugins")
+
+	plugins, resp := adminClient.GetPlugins()
+	require.Nil(t, resp.Error)
+	assert.Len(t, plugins.Active, 2)
+	assert.Empty(t, plugins.Inactive)
+
+	serverConfig, resp := adminClient.GetConfig()
+	require.Nil(t, resp.Error)
+	settings := serverConfig.PluginSettings.Plugins[LOADTEST_PLUGIN_ID]
+	require.NotNil(t, settings)
+	assert.EqualValues(t, 100, settings["hookcpumicroseconds"])
+	assert.EqualValues(t, 2, settings["hookkvwrites"])
+	assert.Equal(t, true, settings["hookbroadcast"])
+	assert.Nil(t, serverConfig.PluginSettings.Plugins["com.example.other"])
+
+	cfg.PluginBundles = []string{filepath.Join(dir, "missing.tar.gz")}
+	assert.Error(t, setupPlugins(adminClient, cfg))
+}
+
+func TestDoPluginRequest(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(model.NewAppError("ServeHTTP", "plugin.loadtest.app_error", nil, "not found", http.StatusNotFound).ToJson()))
+			return
+		}
+		w.Write([]byte(`{"status":"OK"}`))
+	}))
+	defer server.Close()
+
+	client := &apiClient{model.NewAPIv4Client(server.URL)}
+
+	data, resp := client.DoPluginRequest(http.MethodPost, LOADTEST_PLUGIN_ID, "/kv/x", []byte("value"))
+	require.Nil(t, resp.Error)
+	assert.Equal(t, `{"status":"OK"}`, string(data))
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/plugins/"+LOADTEST_PLUGIN_ID+"/kv/x", path)
+	assert.Equal(t, "value", body)
+
+	_, resp = client.DoPluginRequest(http.MethodGet, LOADTEST_PLUGIN_ID, "/kv/y", nil)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -9,7 +9,6 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -19,6 +18,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 
@@ -40,6 +40,13 @@ func RunTest(test *TestRun) error {
 		return errors.Wrap(err, "failed to read loadtest configuration")
 	}
 
+	mlog.Info("Validating configuration.")
+	validation := ValidateConfig(cfg, 1, true)
+	validation.LogWarnings()
+	if err := validation.Err(); err != nil {
+		return err
+	}
+
 	db := ConnectToDB(cfg.ConnectionConfiguration.DriverName, cfg.ConnectionConfiguration.DataSource)
 	if db == nil {
 		return fmt.Errorf("failed to connect to database")
@@ -71,6 +78,10 @@ func RunTest(test *TestRun) error {
 		)
 	}
 
+	if cfg.LoadtestEnviromentConfig.NumBots <= 0 && hasBotEntities(test) {
+		return fmt.Errorf("Cannot start bot entities with NumBots set to %d", cfg.LoadtestEnviromentConfig.NumBots)
+	}
+
 	mlog.Info("Setting up server.")
 	serverData, err := SetupServer(cfg)
 	if err != nil {
@@ -90,48 +101,135 @@ func RunTest(test *TestRun) error {
 	// Channels to receive timing information from the clients
 	clientTimingChannel := make(chan TimedRoundTripperReport, 10000)
 
+	// Channel to receive the names of settings changed while the test runs
+	configChangeChannel := make(chan []string, 10)
+	// Closed once timings are no longer logged, so that changes are no longer sent
+	timingsDone := make(chan struct{})
+
 	waitMonitors.Add(1)
 	go func() {
 		defer waitMonitors.Done()
+		defer close(timingsDone)
 
-		for timingReport := range clientTimingChannel {
-			clientTimingStats.AddTimingReport(timingReport)
+		logTimings := func() {
+			mlog.Info("Timings", mlog.String("tag", "timings"), mlog.Any("timings", *clientTimingStats), mlog.String("instance_id", loadtestInstance.Id))
+			clientTimingStats.Reset()
+		}
 
-			if clientTimingStats.CountResults() > 100 {
-				mlog.Info("Timings", mlog.String("tag", "timings"), mlog.Any("timings", *clientTimingStats), mlog.String("instance_id", loadtestInstance.Id))
-				clientTimingStats.Reset()
+		// Timings are logged whenever the configuration changes, so that the results for each
+		// phase of the test can be told apart.
+		phase := 1
+		for {
+			select {
+			case timingReport, ok := <-clientTimingChannel:
+				if !ok {
+					if clientTimingStats.CountResults() > 0 {
+						logTimings()
+					}
+					return
+				}
+
+				clientTimingStats.AddTimingReport(timingReport)
+
+				if clientTimingStats.CountResults() > 100 {
+					logTimings()
+				}
+			case changes := <-configChangeChannel:
+				if clientTimingStats.CountResults() > 0 {
+					logTimings()
+				}
+
+				phase++
+				mlog.Info("Configuration changed", mlog.String("tag", "config_change"), mlog.Int("phase", phase), mlog.Any("changes", changes), mlog.String("instance_id", loadtestInstance.Id))
 			}
 		}
+	}()
 
-		if clientTimingStats.CountResults() > 0 {
-			mlog.Info("Timings", mlog.String("tag", "timings"), mlog.Any("timings", *clientTimingStats), mlog.String("instance_id", loadtestInstance.Id))
-			clientTimingStats.Reset()
+	liveConfig := NewLiveConfig(cfg)
+	viper.OnConfigChange(func(event fsnotify.Event) {
+		changedCfg := &LoadTestConfig{}
+		if err := viper.Unmarshal(changedCfg); err != nil {
+			mlog.Error("Failed to read changed loadtest configuration", mlog.Err(err))
+			return
 		}
-	}()
 
-	// Mirror http.DefaultTransport to start
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          cfg.ConnectionConfiguration.MaxIdleConns,
-		MaxIdleConnsPerHost:   cfg.ConnectionConfiguration.MaxIdleConnsPerHost,
-		IdleConnTimeout:       time.Duration(cfg.ConnectionConfiguration.IdleConnTimeoutMilliseconds) * time.Millisecond,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
+		changes, err := liveConfig.Update(changedCfg)
+		if err != nil {
+			mlog.Error("Ignoring invalid change to loadtest configuration", mlog.Err(err))
+			return
+		} else if len(changes) == 0 {
+			return
+		}
+
+		// Every applied change must start a new phase, or the phases told apart by ltparse would
+		// no longer match the configuration.
+		select {
+		case configChangeChannel <- changes:
+		case <-timingsDone:
+		}
+	})
+	viper.WatchConfig()
+
+	transports, err := NewTransportFactory(&cfg.ConnectionConfiguration)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure connections")
 	}
 
-	httpClient := &http.Client{Transport: transport}
+	httpClient := &http.Client{Transport: transports.Shared()}
+
+	var integrationServer *IntegrationServer
+	if listenAddress := cfg.ConnectionConfiguration.IntegrationListenAddress; listenAddress != "" {
+		integrationServer, err = NewIntegrationServer(listenAddress, httpClient)
+		if err != nil {
+			return err
+		}
+		defer integrationServer.Close()
+		mlog.Info("Serving integration requests", mlog.String("address", integrationServer.Addr()))
+	}
+
+	var smtpServer *SMTPServer
+	if listenAddress := cfg.ConnectionConfiguration.SMTPListenAddress; listenAddress != "" {
+		smtpServer, err = NewSMTPServer(listenAddress)
+		if err != nil {
+			return err
+		}
+		defer smtpServer.Close()
+		mlog.Info("Accepting mail", mlog.String("address", smtpServer.Addr()))
+	}
 
 	adminClient := getAdminClient(httpClient, cfg.ConnectionConfiguration.ServerURL, cfg.ConnectionConfiguration.AdminEmail, cfg.ConnectionConfiguration.AdminPassword, nil)
 	if adminClient == nil {
 		return fmt.Errorf("Unable create admin client.")
 	}
 
-	adminClient.HttpClient.Transport = NewTimedRoundTripper(clientTimingChannel)
+	adminRoundTripper := NewTimedRoundTripper(clientTimingChannel)
+	adminRoundTripper.SetTransport(transports.Shared())
+	adminClient.HttpClient.Transport = adminRoundTripper
+
+	// The picker has its own source, so that picking endpoints leaves the entity types picked
+	// from r unchanged.
+	endpointPicker, err := NewEndpointPicker(&cfg.ConnectionConfiguration, rand.New(rand.NewSource(loadtestInstance.Seed)))
+	if err != nil {
+		return errors.Wrap(err, "failed to configure server endpoints")
+	}
+
+	stopConnectionReports := make(chan bool)
+	waitMonitors.Add(1)
+	go func() {
+		defer waitMonitors.Done()
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reportConnections(transports.Stats(), loadtestInstance.Id)
+			case <-stopConnectionReports:
+				reportConnections(transports.Stats(), loadtestInstance.Id)
+				return
+			}
+		}
+	}()
 
 	mlog.Info("Logging in as users.")
 	tokens := loginAsUsers(cfg, adminClient, loadtestInstance.EntityStartNum, loadtestInstance.Seed)
@@ -142,6 +240,11 @@ func RunTest(test *TestRun) error {
 	}
 
 	numEntities := len(tokens)
+	entityRoundTrippers := make([]*TimedRoundTripper, 0, numEntities)
+	entities := make([]*EntityConfig, 0, numEntities)
+	webhooks := &incomingWebhookPool{}
+	members := newChannelMembers(serverData.BulkloadResult.Users, serverData.ChannelIdMap, serverData.TownSquareIdMap)
+	permissions := &permissionChanges{}
 	mlog.Info("Starting entities", mlog.Int("num_entities", numEntities), mlog.Int("entity_start_num", loadtestInstance.EntityStartNum))
 	for i := 0; i < numEntities; i++ {
 		entityNum := loadtestInstance.EntityStartNum + i
@@ -155,17 +258,53 @@ func RunTest(test *TestRun) error {
 			usertype = userTypeChoice.Item.(UserEntityWithRateMultiplier)
 		}
 
-		mlog.Info("Starting entity", mlog.Int("entity_num", entityNum), mlog.String("entity_name", usertype.Entity.Name))
+		// Bot entities act as one of the bots in place of their user.
+		var bot *BotAccount
+		if usertype.Entity.Bot {
+			if len(serverData.Bots) == 0 {
+				mlog.Error("Failed to start bot entity, no bots are set up", mlog.Int("entity_num", entityNum), mlog.String("entity_name", usertype.Entity.Name))
+				continue
+			}
+			bot = &serverData.Bots[entityNum%len(serverData.Bots)]
+			entityToken = bot.Token
+		}
 
-		// Create some clients
-		userClient := newClientFromToken(httpClient, entityToken, cfg.ConnectionConfiguration.ServerURL)
-		userClient.HttpClient.Transport = NewTimedRoundTripper(clientTimingChannel)
+		userData := serverData.BulkloadResult.Users[entityNum]
+		endpoint := endpointPicker.Pick(entityNum, userData.Username)
 
-		// Websocket client
-		websocketURL := cfg.ConnectionConfiguration.WebsocketURL
-		userWebsocketClient, err := model.NewWebSocketClient4(websocketURL, entityToken)
-		if err != nil {
-			mlog.Error("Unable to connect websocket: " + err.Error())
+		mlog.Info("Starting entity", mlog.Int("entity_num", entityNum), mlog.String("entity_name", usertype.Entity.Name), mlog.String("endpoint", endpoint.Name))
+
+		// Create some clients. Each entity gets its own round tripper so that per-action
+		// timing state, such as the coordinated omission correction, is not shared.
+		var entityTransport http.RoundTripper = transports.EntityTransport()
+		websocketDialer := transports.WebSocketDialer()
+		var network *networkSimulator
+		if conditions := networkConditionsFor(cfg.UserEntitiesConfiguration.NetworkConditions, usertype.Entity.Name); conditions != nil {
+			network = newNetworkSimulator(*conditions, time.Now().UnixNano())
+			entityTransport = &networkRoundTripper{entityTransport, network}
+			network.simulateOnDialer(websocketDialer)
+		}
+
+		if usertype.Entity.UserAgent != "" {
+			entityTransport = &userAgentRoundTripper{entityTransport, usertype.Entity.UserAgent}
+		}
+
+		userRoundTripper := NewTimedRoundTripper(clientTimingChannel)
+		userRoundTripper.SetTransport(entityTransport)
+		if cfg.ConnectionConfiguration.ReportTimingsByEndpoint {
+			userRoundTripper.SetEndpoint(endpoint.Name)
+		}
+		userClient := newClientFromToken(&http.Client{Transport: userRoundTripper}, entityToken, endpoint.ServerURL)
+		backgroundClient := newClientFromToken(&http.Client{Transport: userRoundTripper.Uncorrected()}, entityToken, endpoint.ServerURL)
+		entityRoundTrippers = append(entityRoundTrippers, userRoundTripper)
+
+		// Websocket client. Bots only use the REST API.
+		var userWebsocketClient WebSocketClient
+		if bot == nil {
+			var appErr *model.AppError
+			if userWebsocketClient, appErr = newWebSocketClient(websocketDialer, endpoint.WebsocketURL, entityToken); appErr != nil {
+				mlog.Error("Unable to connect websocket: " + appErr.Error())
+			}
 		}
 
 		// How fast to spam the server
@@ -175,22 +314,34 @@ func RunTest(test *TestRun) error {
 			EntityNumber:        entityNum,
 			EntityName:          usertype.Entity.Name,
 			EntityActions:       usertype.Entity.Actions,
-			UserData:            serverData.BulkloadResult.Users[entityNum],
+			EntityOnConnect:     usertype.Entity.OnConnect,
+			UserData:            userData,
 			Users:               serverData.BulkloadResult.Users,
 			ChannelMap:          serverData.ChannelIdMap,
 			TeamMap:             serverData.TeamIdMap,
 			TownSquareMap:       serverData.TownSquareIdMap,
 			AdminClient:         adminClient,
-			Client:              userClient,
+			Client:              &apiClient{userClient},
 			WebSocketClient:     userWebsocketClient,
+			Endpoint:            endpoint,
 			ActionRate:          actionRate,
 			LoadTestConfig:      cfg,
 			StatusReportChannel: statusChannel,
 			StopChannel:         stopEntity,
 			StopWaitGroup:       &waitEntity,
-			Info:                make(map[string]interface{}),
 			r:                   rand.New(rand.NewSource(time.Now().UnixNano())),
+			roundTripper:        userRoundTripper,
+			network:             network,
+			liveConfig:          liveConfig,
+			webhooks:            webhooks,
+			channelMembers:      members,
+			permissions:         permissions,
+			bot:                 bot,
+			entityState:         &entityState{},
 		}
+		entityConfig.background = entityConfig.withClient(&apiClient{backgroundClient})
+
+		entities = append(entities, entityConfig)
 
 		waitEntity.Add(1)
 		go runEntity(entityConfig)
@@ -198,9 +349,9 @@ func RunTest(test *TestRun) error {
 		waitEntity.Add(1)
 		go websocketListen(entityConfig)
 
-		if cfg.UserEntitiesConfiguration.DoStatusPolling {
+		if cfg.UserEntitiesConfiguration.DoStatusPolling && bot == nil {
 			waitEntity.Add(1)
-			go doStatusPolling(entityConfig)
+			go doStatusPolling(entityConfig.background, cfg.UserEntitiesConfiguration.StatusPollingOverWebsocket)
 		}
 
 		sleepTime := actionRate / time.Duration(numEntities)
@@ -208,6 +359,8 @@ func RunTest(test *TestRun) error {
 		select {
 		case <-interruptChannel:
 			close(stopEntity)
+			revokeBotTokens(adminClient, serverData.Bots)
+			permissions.restore(adminClient)
 			return nil
 		case <-time.After(sleepTime):
 		}
@@ -238,7 +391,22 @@ func RunTest(test *TestRun) error {
 	mlog.Info("Waiting for user entities. Timout is 10 seconds.")
 	waitWithTimeout(&waitEntity, 10*time.Second)
 
+	revokeBotTokens(adminClient, serverData.Bots)
+	permissions.restore(adminClient)
+
+	reportRateLimiting(entityRoundTrippers, loadtestInstance.Id)
+	reportMentions(entities, loadtestInstance.Id)
+	reportSlashCommands(entities, loadtestInstance.Id)
+	reportInteractiveMessages(entities, loadtestInstance.Id)
+	if integrationServer != nil {
+		reportOutgoingWebhooks(integrationServer, loadtestInstance.Id)
+	}
+	if smtpServer != nil {
+		reportEmails(smtpServer, loadtestInstance.Id)
+	}
+
 	mlog.Info("Stopping monitor routines. Timeout is 10 seconds.")
+	close(stopConnectionReports)
 	close(clientTimingChannel)
 	waitWithTimeout(&waitMonitors, 10*time.Second)
 
@@ -247,6 +415,50 @@ func RunTest(test *TestRun) error {
 	return nil
 }
 
+// reportConnections logs the HTTP connections opened by the loadtest agent.
+func reportConnections(connectionStats ConnectionStats, instanceId string) {
+	mlog.Info(
+		"Connections",
+		mlog.String("tag", "connections"),
+		mlog.Int64("open", connectionStats.Open),
+		mlog.Int64("peak", connectionStats.Peak),
+		mlog.Int64("total", connectionStats.Total),
+		mlog.String("instance_id", instanceId),
+	)
+}
+
+// reportRateLimiting logs the fraction of time entities spent throttled by a rate limiter.
+func reportRateLimiting(roundTrippers []*TimedRoundTripper, instanceId string) {
+	if len(roundTrippers) == 0 {
+		return
+	}
+
+	now := time.Now()
+	total := 0.0
+	maxFraction := 0.0
+	numThrottled := 0
+	for _, roundTripper := range roundTrippers {
+		fraction := roundTripper.ThrottledFraction(now)
+		total += fraction
+		if fraction > 0 {
+			numThrottled++
+		}
+		if fraction > maxFraction {
+			maxFraction = fraction
+		}
+	}
+
+	mlog.Info(
+		"Rate limiting",
+		mlog.String("tag", "ratelimits"),
+		mlog.Any("mean_throttled_fraction", total/float64(len(roundTrippers))),
+		mlog.Any("max_throttled_fraction", maxFraction),
+		mlog.Int("num_entities_throttled", numThrottled),
+		mlog.Int("num_entities", len(roundTrippers)),
+		mlog.String("instance_id", instanceId),
+	)
+}
+
 func goCmd(args ...string) ([]byte, error) {
 	cmd := exec.Command("go", args...)
 
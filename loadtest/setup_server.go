@@ -7,8 +7,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"net/http"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -24,37 +23,51 @@ type ServerSetupData struct {
 	ChannelIdMap map[string]map[string]string
 	// TownSquareIdMap maps team name to the channel id of the corresponding default channel.
 	TownSquareIdMap map[string]string
+	// Bots are the bot accounts that bot entities act as.
+	Bots []BotAccount
 
 	BulkloadResult GenerateBulkloadFileResult
 }
 
-func SetupServer(cfg *LoadTestConfig) (*ServerSetupData, error) {
+// connectCommandRunner connects to the app server, locally or over SSH, and checks that mattermost
+// CLI commands can be run there.
+func connectCommandRunner(cfg *ConnectionConfiguration) (ServerCLICommandRunner, error) {
 	var cmdrun ServerCLICommandRunner
-	var cmderr error
-	if cfg.ConnectionConfiguration.LocalCommands {
+	var err error
+	if cfg.LocalCommands {
 		mlog.Info("Connecting to local app server")
-		cmdrun, cmderr = NewLocalConnection(cfg.ConnectionConfiguration.MattermostInstallDir)
+		cmdrun, err = NewLocalConnection(cfg.MattermostInstallDir)
 	} else {
 		mlog.Info("Connecting to app server over SSH")
-		cmdrun, cmderr = ConnectSSH(cfg.ConnectionConfiguration.SSHHostnamePort, cfg.ConnectionConfiguration.SSHKey, cfg.ConnectionConfiguration.SSHUsername, cfg.ConnectionConfiguration.SSHPassword, cfg.ConnectionConfiguration.MattermostInstallDir, cfg.ConnectionConfiguration.ConfigFileLoc)
+		cmdrun, err = ConnectSSH(cfg.SSHHostnamePort, cfg.SSHKey, cfg.SSHUsername, cfg.SSHPassword, cfg.MattermostInstallDir, cfg.ConfigFileLoc)
 	}
-	if cmderr != nil {
-		mlog.Error("Unable to connect issue mattermost commands. Continuing anyway... Got error: " + cmderr.Error())
-		cmdrun = nil
-	} else {
-		mlog.Info("Testing ability to run commands.")
-		if success, output := cmdrun.RunPlatformCommand("version"); !success {
-			mlog.Error("Unable to connect issue mattermost commands. Continuing anyway... Got Output: " + output)
-			cmdrun.Close()
-			cmdrun = nil
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	if cmdrun != nil {
+	mlog.Info("Testing ability to run commands.")
+	if success, output := cmdrun.RunPlatformCommand("version"); !success {
+		cmdrun.Close()
+		return nil, fmt.Errorf("failed to run mattermost version: %s", output)
+	}
+
+	return cmdrun, nil
+}
+
+func SetupServer(cfg *LoadTestConfig) (*ServerSetupData, error) {
+	cmdrun, err := connectCommandRunner(&cfg.ConnectionConfiguration)
+	if err != nil {
+		mlog.Error("Unable to connect issue mattermost commands. Continuing anyway... Got error: " + err.Error())
+	} else {
 		defer cmdrun.Close()
 	}
 
-	adminClient := getAdminClient(&http.Client{}, cfg.ConnectionConfiguration.ServerURL, cfg.ConnectionConfiguration.AdminEmail, cfg.ConnectionConfiguration.AdminPassword, cmdrun)
+	httpClient, err := newHTTPClient(&cfg.ConnectionConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to configure connections")
+	}
+
+	adminClient := getAdminClient(httpClient, cfg.ConnectionConfiguration.ServerURL, cfg.ConnectionConfiguration.AdminEmail, cfg.ConnectionConfiguration.AdminPassword, cmdrun)
 	if adminClient == nil {
 		return nil, fmt.Errorf("Unable create admin client.")
 	}
@@ -66,46 +79,9 @@ func SetupServer(cfg *LoadTestConfig) (*ServerSetupData, error) {
 
 	if cfg.LoadtestEnviromentConfig.NumPlugins > 0 {
 		mlog.Info("Setting up plugins.")
-		if cfg.LoadtestEnviromentConfig.NumPlugins > 1 {
-			mlog.Error("Bulk-loading supports at most one plugin deployment at this time")
-		}
-
-		pluginId := "com.mattermost.sample-plugin"
-		plugin, err := os.Open("testfiles/com.mattermost.sample-plugin-webapp-only.tar.gz")
-		if err != nil {
+		if err := setupPlugins(adminClient, &cfg.LoadtestEnviromentConfig); err != nil {
 			return nil, err
 		}
-
-		mlog.Info(fmt.Sprintf("Checking if plugin is installed: %s", pluginId))
-		remotePlugins, resp := adminClient.GetPlugins()
-		if resp.Error != nil {
-			mlog.Error("Failed to get list of installed plugins", mlog.Err(resp.Error))
-			return nil, resp.Error
-		}
-		if len(remotePlugins.Active) > 0 {
-			mlog.Info(fmt.Sprintf("Plugin found, removing: %s", pluginId))
-			for _, remotePlugin := range append(remotePlugins.Active, remotePlugins.Inactive...) {
-				if remotePlugin.Id == pluginId {
-					status, resp := adminClient.RemovePlugin(pluginId)
-					if resp.Error != nil {
-						mlog.Error("Failed to remove plugin, attempting to continue", mlog.Err(resp.Error))
-					}
-					if status {
-						mlog.Info(fmt.Sprintf("Removed plugin: %s", pluginId))
-					}
-				}
-			}
-		}
-
-		mlog.Info("Uploading plugin.")
-		if _, resp := adminClient.UploadPlugin(plugin); resp.Error != nil {
-			return nil, resp.Error
-		}
-
-		mlog.Info("Enabling plugin.")
-		if _, resp := adminClient.EnablePlugin("com.mattermost.sample-plugin"); resp.Error != nil {
-			return nil, resp.Error
-		}
 	}
 
 	mlog.Info("Generating users for loadtest.")
@@ -213,10 +189,42 @@ func SetupServer(cfg *LoadTestConfig) (*ServerSetupData, error) {
 		mlog.Info("Found team channels", mlog.String("team", team.Name), mlog.Int("channels", len(channelIdMap[team.Name])))
 	}
 
+	if integrationURL := cfg.ConnectionConfiguration.IntegrationURL; integrationURL != "" {
+		mlog.Info("Setting up integrations.")
+		if err := checkConfigForIntegrations(adminClient, integrationURL); err != nil {
+			return nil, err
+		}
+		if err := setupSlashCommands(adminClient, strings.TrimSuffix(integrationURL, "/")+SLASH_COMMAND_PATH, teamIdMap); err != nil {
+			return nil, err
+		}
+		if err := setupOutgoingWebhooks(adminClient, integrationURL, teamIdMap, townSquareIdMap); err != nil {
+			return nil, err
+		}
+	}
+
+	if smtpAddress := cfg.ConnectionConfiguration.SMTPServerAddress; smtpAddress != "" {
+		mlog.Info("Setting up email.")
+		if err := checkConfigForEmail(adminClient, smtpAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	var bots []BotAccount
+	if numBots := cfg.LoadtestEnviromentConfig.NumBots; numBots > 0 {
+		mlog.Info("Setting up bots.")
+		if err := checkConfigForBots(adminClient); err != nil {
+			return nil, err
+		}
+		if bots, err = setupBots(adminClient, numBots, cfg.LoadtestEnviromentConfig.NumBotChannelsPerTeam, teamIdMap, channelIdMap); err != nil {
+			return nil, err
+		}
+	}
+
 	return &ServerSetupData{
 		TeamIdMap:       teamIdMap,
 		ChannelIdMap:    channelIdMap,
 		TownSquareIdMap: townSquareIdMap,
+		Bots:            bots,
 		BulkloadResult:  bulkloadResult,
 	}, nil
 }
@@ -278,6 +286,29 @@ func checkConfigForLoadtests(adminClient *model.Client4) error {
 
 	mlog.Info("EnableIncomingWebhooks is true")
 
+	if !*serverConfig.ServiceSettings.EnablePostUsernameOverride || !*serverConfig.ServiceSettings.EnablePostIconOverride {
+		mlog.Info("Allowing webhooks to override usernames and icons for the load test...")
+		*serverConfig.ServiceSettings.EnablePostUsernameOverride = true
+		*serverConfig.ServiceSettings.EnablePostIconOverride = true
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EnablePostUsernameOverride and EnablePostIconOverride", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("EnablePostUsernameOverride and EnablePostIconOverride are true")
+
+	if !*serverConfig.FileSettings.EnablePublicLink {
+		mlog.Info("Enabling public file links for the load test...")
+		*serverConfig.FileSettings.EnablePublicLink = true
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EnablePublicLink", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("EnablePublicLink is true")
+
 	mlog.Info("Disabling only admin integrations for loadtest. 1/2")
 	if role, resp := adminClient.GetRoleByName(model.TEAM_USER_ROLE_ID); resp.Error != nil {
 		mlog.Error("Failed to get role", mlog.String("role", model.TEAM_USER_ROLE_ID), mlog.Err(resp.Error))
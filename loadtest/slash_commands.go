@@ -0,0 +1,170 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The custom slash command registered in every team, which calls the integration server.
+const (
+	SLASH_COMMAND_TRIGGER = "loadtest"
+	SLASH_COMMAND_PATH    = "/commands"
+)
+
+// The ways the integration server responds to the slash command. Delayed responses are sent to
+// the command's response URL after a while, rather than in reply to the command.
+const (
+	SLASH_COMMAND_RESPONSE_EPHEMERAL  = "ephemeral"
+	SLASH_COMMAND_RESPONSE_IN_CHANNEL = "in_channel"
+	SLASH_COMMAND_RESPONSE_DELAYED    = "delayed"
+)
+
+// slashCommandResponseRegex finds the token of the command a response post answers.
+var slashCommandResponseRegex = regexp.MustCompile(`load test command ([a-z0-9]{26})`)
+
+func slashCommandResponseText(token string) string {
+	return fmt.Sprintf("Response to load test command %s", token)
+}
+
+// slashCommand returns the command executed to have the integration server respond to the given
+// token in the given way, delaying delayed responses by the given time.
+func slashCommand(responseType, token string, delay time.Duration) string {
+	command := fmt.Sprintf("/%s %s %s", SLASH_COMMAND_TRIGGER, responseType, token)
+	if responseType == SLASH_COMMAND_RESPONSE_DELAYED {
+		command = fmt.Sprintf("%s %d", command, delay/time.Millisecond)
+	}
+
+	return command
+}
+
+// handleSlashCommand responds to the slash command. The command's text gives the response type,
+// the token to echo back, and for delayed responses, the delay in milliseconds.
+func (is *IntegrationServer) handleSlashCommand(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := strings.Fields(r.FormValue("text"))
+	if len(args) < 2 {
+		http.Error(w, "expected a response type and a token", http.StatusBadRequest)
+		return
+	}
+	responseType, token := args[0], args[1]
+
+	var response *model.CommandResponse
+	switch responseType {
+	case SLASH_COMMAND_RESPONSE_EPHEMERAL, SLASH_COMMAND_RESPONSE_IN_CHANNEL:
+		response = &model.CommandResponse{ResponseType: responseType, Text: slashCommandResponseText(token)}
+	case SLASH_COMMAND_RESPONSE_DELAYED:
+		var delay time.Duration
+		if len(args) > 2 {
+			milliseconds, _ := strconv.Atoi(args[2])
+			delay = time.Duration(milliseconds) * time.Millisecond
+		}
+		is.respondLater(r.FormValue("response_url"), &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_IN_CHANNEL,
+			Text:         slashCommandResponseText(token),
+		}, delay)
+		response = &model.CommandResponse{ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL, Text: "Working on it..."}
+	default:
+		http.Error(w, "unknown response type "+responseType, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(response.ToJson()))
+}
+
+// respondLater sends a response to the given response URL after the given delay.
+func (is *IntegrationServer) respondLater(responseURL string, response *model.CommandResponse, delay time.Duration) {
+	if responseURL == "" {
+		mlog.Error("Unable to send delayed slash command response without a response URL")
+		return
+	}
+
+	is.wait.Add(1)
+	go func() {
+		defer is.wait.Done()
+
+		select {
+		case <-is.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		resp, err := is.client.Post(responseURL, "application/json", bytes.NewBufferString(response.ToJson()))
+		if err != nil {
+			mlog.Error("Failed to send delayed slash command response", mlog.Err(err))
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			mlog.Error("Failed to send delayed slash command response", mlog.Int("status_code", resp.StatusCode))
+		}
+	}()
+}
+
+// setupSlashCommands registers the slash command in every team, pointing it at the given URL.
+// Commands left by earlier tests are updated rather than registered again.
+func setupSlashCommands(adminClient *model.Client4, commandURL string, teamIdMap map[string]string) error {
+	for teamName, teamId := range teamIdMap {
+		commands, resp := adminClient.ListCommands(teamId, true)
+		if resp.Error != nil {
+			mlog.Error("Failed to list slash commands", mlog.String("team", teamName), mlog.Err(resp.Error))
+			return resp.Error
+		}
+
+		var existing *model.Command
+		for _, command := range commands {
+			if command.Trigger == SLASH_COMMAND_TRIGGER {
+				existing = command
+				break
+			}
+		}
+
+		if existing == nil {
+			if _, resp := adminClient.CreateCommand(&model.Command{
+				TeamId:           teamId,
+				Trigger:          SLASH_COMMAND_TRIGGER,
+				Method:           model.COMMAND_METHOD_POST,
+				URL:              commandURL,
+				Username:         "loadtest",
+				DisplayName:      "Load Test",
+				Description:      "Responds to the load test",
+				AutoComplete:     true,
+				AutoCompleteDesc: "Responds to the load test",
+				AutoCompleteHint: "[ephemeral|in_channel|delayed] [token]",
+			}); resp.Error != nil {
+				mlog.Error("Failed to create slash command", mlog.String("team", teamName), mlog.Err(resp.Error))
+				return resp.Error
+			}
+			continue
+		}
+
+		if existing.URL != commandURL || existing.Method != model.COMMAND_METHOD_POST {
+			existing.URL = commandURL
+			existing.Method = model.COMMAND_METHOD_POST
+			if _, resp := adminClient.UpdateCommand(existing); resp.Error != nil {
+				mlog.Error("Failed to update slash command", mlog.String("team", teamName), mlog.Err(resp.Error))
+				return resp.Error
+			}
+		}
+	}
+
+	mlog.Info("Slash commands are set up", mlog.String("url", commandURL), mlog.Int("teams", len(teamIdMap)))
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlashCommandRoundTrip(t *testing.T) {
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	team := s.CreateTeam(&model.Team{Name: "team0", DisplayName: "Team 0"})
+	channel := s.GetChannelByName(team.Id, model.DEFAULT_CHANNEL)
+	require.NotNil(t, channel)
+	user := s.CreateUser(&model.User{Username: "user0", Email: "success+user0@simulator.amazonses.com"}, "password")
+	s.AddTeamMember(team.Id, user.Id)
+
+	integrationServer, err := NewIntegrationServer("127.0.0.1:0", &http.Client{})
+	require.NoError(t, err)
+	defer integrationServer.Close()
+
+	adminClient := model.NewAPIv4Client(serverURL)
+	_, resp := adminClient.Login("success+user0@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	commandURL := "http://" + integrationServer.Addr() + SLASH_COMMAND_PATH
+	teamIdMap := map[string]string{team.Name: team.Id}
+	require.NoError(t, setupSlashCommands(adminClient, "http://localhost:1"+SLASH_COMMAND_PATH, teamIdMap))
+	require.NoError(t, setupSlashCommands(adminClient, commandURL, teamIdMap))
+
+	commands, resp := adminClient.ListCommands(team.Id, true)
+	require.Nil(t, resp.Error)
+	require.Len(t, commands, 1, "setting up again should update the existing command")
+	assert.Equal(t, commandURL, commands[0].URL)
+
+	ws, appErr := model.NewWebSocketClient4(s.WebsocketURL(), adminClient.AuthToken)
+	require.Nil(t, appErr)
+	defer ws.Close()
+	ws.Listen()
+	hello := <-ws.EventChannel
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	client := &apiClient{adminClient}
+	var state commandState
+	for _, responseType := range []string{SLASH_COMMAND_RESPONSE_EPHEMERAL, SLASH_COMMAND_RESPONSE_IN_CHANNEL, SLASH_COMMAND_RESPONSE_DELAYED} {
+		t.Run(responseType, func(t *testing.T) {
+			token := model.NewId()
+			state.start(token, responseType, time.Now())
+			_, resp := client.ExecuteCommand(channel.Id, slashCommand(responseType, token, 10*time.Millisecond))
+			require.Nil(t, resp.Error)
+
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case event := <-ws.EventChannel:
+					state.receivedEvent(event, time.Now())
+				case <-timeout:
+					t.Fatal("timed out waiting for the response")
+				}
+
+				if durations, _ := state.results(); len(durations[responseType]) == 1 {
+					break
+				}
+			}
+		})
+	}
+
+	_, lost := state.results()
+	assert.Empty(t, lost)
+}
+
+func TestCommandState(t *testing.T) {
+	var state commandState
+	now := time.Now()
+
+	responsePosted := func(token string) *model.WebSocketEvent {
+		event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_POSTED, "", "channelid0", "", nil)
+		event.Add("post", (&model.Post{Message: slashCommandResponseText(token)}).ToJson())
+		return event
+	}
+
+	state.start("aaaaaaaaaaaaaaaaaaaaaaaaaa", SLASH_COMMAND_RESPONSE_IN_CHANNEL, now)
+	state.start("bbbbbbbbbbbbbbbbbbbbbbbbbb", SLASH_COMMAND_RESPONSE_EPHEMERAL, now)
+	state.receivedEvent(responsePosted("aaaaaaaaaaaaaaaaaaaaaaaaaa"), now.Add(150*time.Millisecond))
+	state.receivedEvent(responsePosted("aaaaaaaaaaaaaaaaaaaaaaaaaa"), now.Add(time.Second))
+	state.receivedEvent(responsePosted("cccccccccccccccccccccccccc"), now.Add(time.Second))
+
+	durations, lost := state.results()
+	assert.Equal(t, map[string][]float64{SLASH_COMMAND_RESPONSE_IN_CHANNEL: {150}}, durations)
+	assert.Equal(t, map[string]int64{SLASH_COMMAND_RESPONSE_EPHEMERAL: 1}, lost, "commands awaiting a response should count as lost")
+
+	state.start("dddddddddddddddddddddddddd", SLASH_COMMAND_RESPONSE_DELAYED, now.Add(2*SLASH_COMMAND_RESPONSE_TIMEOUT))
+	state.receivedEvent(responsePosted("bbbbbbbbbbbbbbbbbbbbbbbbbb"), now.Add(2*SLASH_COMMAND_RESPONSE_TIMEOUT))
+	durations, lost = state.results()
+	assert.Len(t, durations, 1, "responses after the timeout should not be timed")
+	assert.Equal(t, map[string]int64{SLASH_COMMAND_RESPONSE_EPHEMERAL: 1, SLASH_COMMAND_RESPONSE_DELAYED: 1}, lost)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// SMTP_IDLE_TIMEOUT closes connections the server leaves idle for longer.
+const SMTP_IDLE_TIMEOUT = time.Minute
+
+// SMTPServer stands in for the mail server of the Mattermost server under test, so that email
+// invitations and notifications can be sent without delivering mail anywhere. It accepts every
+// message and discards it, counting the messages and their recipients.
+type SMTPServer struct {
+	listener net.Listener
+
+	messages   int64
+	recipients int64
+
+	lock  sync.Mutex
+	conns map[net.Conn]bool
+	stop  bool
+	wait  sync.WaitGroup
+}
+
+// NewSMTPServer starts accepting mail on the given address.
+func NewSMTPServer(listenAddress string) (*SMTPServer, error) {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen for mail on %s", listenAddress)
+	}
+
+	ss := &SMTPServer{
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+	}
+
+	ss.wait.Add(1)
+	go func() {
+		defer ss.wait.Done()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !ss.stopped() {
+					mlog.Error("SMTP server stopped", mlog.Err(err))
+				}
+				return
+			}
+			if !ss.track(conn) {
+				conn.Close()
+				return
+			}
+
+			ss.wait.Add(1)
+			go func() {
+				defer ss.wait.Done()
+				defer ss.untrack(conn)
+				ss.serve(conn)
+			}()
+		}
+	}()
+
+	return ss, nil
+}
+
+// Addr returns the address the server is listening on.
+func (ss *SMTPServer) Addr() string {
+	return ss.listener.Addr().String()
+}
+
+// Messages returns the number of messages accepted so far, and the number of recipients they
+// were addressed to.
+func (ss *SMTPServer) Messages() (int64, int64) {
+	return atomic.LoadInt64(&ss.messages), atomic.LoadInt64(&ss.recipients)
+}
+
+// Close stops accepting mail, dropping any connections still open.
+func (ss *SMTPServer) Close() {
+	ss.lock.Lock()
+	ss.stop = true
+	for conn := range ss.conns {
+		conn.Close()
+	}
+	ss.lock.Unlock()
+
+	ss.listener.Close()
+	ss.wait.Wait()
+}
+
+func (ss *SMTPServer) stopped() bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	return ss.stop
+}
+
+func (ss *SMTPServer) track(conn net.Conn) bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.stop {
+		return false
+	}
+	ss.conns[conn] = true
+
+	return true
+}
+
+func (ss *SMTPServer) untrack(conn net.Conn) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	conn.Close()
+	delete(ss.conns, conn)
+}
+
+// serve speaks just enough SMTP to accept messages from the server's mail client.
+func (ss *SMTPServer) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	reply := func(line string) bool {
+		conn.SetWriteDeadline(time.Now().Add(SMTP_IDLE_TIMEOUT))
+		_, err := conn.Write([]byte(line + "\r\n"))
+		return err == nil
+	}
+	readLine := func() (string, bool) {
+		conn.SetReadDeadline(time.Now().Add(SMTP_IDLE_TIMEOUT))
+		line, err := reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+
+	if !reply("220 loadtest ESMTP") {
+		return
+	}
+
+	recipients := int64(0)
+	for {
+		line, ok := readLine()
+		if !ok {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			ok = reply("250 loadtest")
+		case "MAIL", "NOOP":
+			ok = reply("250 OK")
+		case "RSET":
+			recipients = 0
+			ok = reply("250 OK")
+		case "RCPT":
+			recipients++
+			ok = reply("250 OK")
+		case "DATA":
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			for {
+				line, ok := readLine()
+				if !ok {
+					return
+				}
+				if line == "." {
+					break
+				}
+			}
+			atomic.AddInt64(&ss.messages, 1)
+			atomic.AddInt64(&ss.recipients, recipients)
+			recipients = 0
+			ok = reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			ok = reply("502 Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func reportEmails(ss *SMTPServer, instanceId string) {
+	messages, recipients := ss.Messages()
+
+	mlog.Info(
+		"Emails",
+		mlog.String("tag", "emails"),
+		mlog.Int64("messages", messages),
+		mlog.Int64("recipients", recipients),
+		mlog.String("instance_id", instanceId),
+	)
+}
+
+// checkConfigForEmail configures the server to send email invitations and notifications through
+// the SMTP server at the given address, which should be the agent's stand-in.
+func checkConfigForEmail(adminClient *model.Client4, smtpAddress string) error {
+	host, port, err := net.SplitHostPort(smtpAddress)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse SMTP server address")
+	}
+
+	serverConfig, resp := adminClient.GetConfig()
+	if serverConfig == nil {
+		mlog.Error("Failed to get the server config", mlog.Err(resp.Error))
+		return resp.Error
+	}
+
+	emailSettings := &serverConfig.EmailSettings
+	if !*serverConfig.ServiceSettings.EnableEmailInvitations ||
+		!*emailSettings.SendEmailNotifications ||
+		*emailSettings.SMTPServer != host ||
+		*emailSettings.SMTPPort != port ||
+		*emailSettings.EnableSMTPAuth ||
+		*emailSettings.ConnectionSecurity != model.CONN_SECURITY_NONE ||
+		*emailSettings.FeedbackEmail == "" {
+		mlog.Info("Sending email through the loadtest agent...", mlog.String("address", smtpAddress))
+		*serverConfig.ServiceSettings.EnableEmailInvitations = true
+		*emailSettings.SendEmailNotifications = true
+		*emailSettings.SMTPServer = host
+		*emailSettings.SMTPPort = port
+		*emailSettings.EnableSMTPAuth = false
+		*emailSettings.ConnectionSecurity = model.CONN_SECURITY_NONE
+		if *emailSettings.FeedbackEmail == "" {
+			*emailSettings.FeedbackEmail = "success+loadtest@simulator.amazonses.com"
+		}
+		if _, resp := adminClient.UpdateConfig(serverConfig); resp.Error != nil {
+			mlog.Error("Failed to set EmailSettings", mlog.Err(resp.Error))
+			return resp.Error
+		}
+	}
+
+	mlog.Info("Email is sent through the loadtest agent", mlog.String("address", smtpAddress))
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"net/smtp"
+	"testing"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTPServer(t *testing.T) {
+	ss, err := NewSMTPServer("localhost:0")
+	require.NoError(t, err)
+	defer ss.Close()
+
+	message := []byte("Subject: Invitation\r\n\r\nJoin us.\r\n.. with a dot\r\n")
+	require.NoError(t, smtp.SendMail(ss.Addr(), nil, "success+from@simulator.amazonses.com", []string{
+		"success+to0@simulator.amazonses.com",
+		"success+to1@simulator.amazonses.com",
+	}, message))
+	require.NoError(t, smtp.SendMail(ss.Addr(), nil, "success+from@simulator.amazonses.com", []string{
+		"success+to2@simulator.amazonses.com",
+	}, message))
+
+	messages, recipients := ss.Messages()
+	assert.EqualValues(t, 2, messages)
+	assert.EqualValues(t, 3, recipients)
+}
+
+func TestCheckConfigForEmail(t *testing.T) {
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	s.CreateUser(&model.User{Username: "admin", Email: "success+admin@simulator.amazonses.com", Roles: model.SYSTEM_ADMIN_ROLE_ID + " " + model.SYSTEM_USER_ROLE_ID}, "password")
+	adminClient := model.NewAPIv4Client(serverURL)
+	_, resp := adminClient.Login("success+admin@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	assert.Error(t, checkConfigForEmail(adminClient, "localhost"), "the address should need a port")
+	require.NoError(t, checkConfigForEmail(adminClient, "agent:8025"))
+
+	serverConfig, resp := adminClient.GetConfig()
+	require.Nil(t, resp.Error)
+	assert.True(t, *serverConfig.ServiceSettings.EnableEmailInvitations)
+	assert.True(t, *serverConfig.EmailSettings.SendEmailNotifications)
+	assert.Equal(t, "agent", *serverConfig.EmailSettings.SMTPServer)
+	assert.Equal(t, "8025", *serverConfig.EmailSettings.SMTPPort)
+	assert.False(t, *serverConfig.EmailSettings.EnableSMTPAuth)
+	assert.NotEmpty(t, *serverConfig.EmailSettings.FeedbackEmail)
+}
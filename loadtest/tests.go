@@ -4,16 +4,13 @@
 package loadtest
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
-	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"bytes"
@@ -40,6 +37,13 @@ type UserEntityWithRateMultiplier struct {
 type UserEntity struct {
 	Name    string
 	Actions []randutil.Choice
+	// UserAgent, if set, is sent with every API request in place of Go's default.
+	UserAgent string
+	// OnConnect, if set, is run whenever the websocket connects in place of actionWakeup.
+	OnConnect func(*EntityConfig)
+	// Bot, if set, makes the entity act as one of the bot accounts set up on the server,
+	// authenticating with its personal access token and without a websocket.
+	Bot bool
 }
 
 func readTestFile(name string) ([]byte, error) {
@@ -57,51 +61,92 @@ func readTestFile(name string) ([]byte, error) {
 	}
 }
 
-func readRandomTestFile() ([]byte, error, string) {
-	files, err := ioutil.ReadDir("./testfiles")
+// statusUserIds returns the users whose statuses the entity polls, the members of one of its
+// channels picked the first time. Status polling calls it alongside the entity's actions.
+func statusUserIds(c *EntityConfig) ([]string, bool) {
+	c.statuses.lock.Lock()
+	defer c.statuses.lock.Unlock()
+
+	if c.statuses.userIds != nil {
+		return c.statuses.userIds, true
+	}
+
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return nil, false
+	}
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
 	if err != nil {
-		panic("Can't read testfiles directory.")
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return nil, false
+	}
+
+	members, resp := c.Client.GetChannelMembers(channelId, 0, 60, "")
+	if resp.Error != nil {
+		mlog.Error("Unable to get members for channel to seed action get status.", mlog.String("channel_id", channelId), mlog.Err(resp.Error))
+		return nil, false
 	}
 
-	fileI := rand.Intn(len(files))
-	file := files[fileI]
-	for file.IsDir() {
-		fileI = rand.Intn(len(files))
-		file = files[fileI]
+	ids := make([]string, len(*members), len(*members))
+	for i := 0; i < len(*members); i++ {
+		ids[i] = (*members)[i].UserId
 	}
 
-	b, err := readTestFile(file.Name())
-	return b, err, filepath.Join("./testfiles", file.Name())
+	c.statuses.userIds = ids
+
+	return ids, true
 }
 
-func actionGetStatuses(c *EntityConfig) {
-	idsI, ok := c.Info["statusUserIds"+c.UserData.Username]
-	var ids []string
-	if !ok {
-		team, channel := c.UserData.PickTeamChannel(c.r)
-		if team == nil || channel == nil {
-			return
-		}
-		channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
-		if err != nil {
-			mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
-			return
-		}
+// userState remembers the id of the entity's own user.
+type userState struct {
+	lock   sync.Mutex
+	userId string
+}
 
-		members, resp := c.Client.GetChannelMembers(channelId, 0, 60, "")
-		if resp.Error != nil {
-			mlog.Error("Unable to get members for channel to seed action get status.", mlog.String("channel_id", channelId), mlog.Err(resp.Error))
-			return
-		}
+// receivedEvent learns the user id from the websocket hello event.
+func (us *userState) receivedEvent(event *model.WebSocketEvent) {
+	if event.Event != model.WEBSOCKET_EVENT_HELLO || event.Broadcast == nil {
+		return
+	}
 
-		ids = make([]string, len(*members), len(*members))
-		for i := 0; i < len(*members); i++ {
-			ids[i] = (*members)[i].UserId
-		}
+	us.lock.Lock()
+	defer us.lock.Unlock()
 
-		c.Info["statusUserIds"+c.UserData.Username] = ids
-	} else {
-		ids = idsI.([]string)
+	us.userId = event.Broadcast.UserId
+}
+
+// id returns the id of the entity's user, if it has been learned yet.
+func (us *userState) id() string {
+	us.lock.Lock()
+	defer us.lock.Unlock()
+
+	return us.userId
+}
+
+// ownUserId returns the id of the entity's user, getting the user only if the id wasn't learned
+// from the websocket or an earlier action.
+func ownUserId(c *EntityConfig) (string, bool) {
+	if userId := c.user.id(); userId != "" {
+		return userId, true
+	}
+
+	user, resp := c.Client.GetMe("")
+	if resp.Error != nil {
+		mlog.Error("Failed to get me", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return "", false
+	}
+
+	c.user.lock.Lock()
+	c.user.userId = user.Id
+	c.user.lock.Unlock()
+
+	return user.Id, true
+}
+
+func actionGetStatuses(c *EntityConfig) {
+	ids, ok := statusUserIds(c)
+	if !ok {
+		return
 	}
 
 	if _, resp := c.Client.GetUsersStatusesByIds(ids); resp.Error != nil {
@@ -138,7 +183,7 @@ func actionLeaveJoinChannel(c *EntityConfig) {
 	removed, _ := c.Client.RemoveUserFromChannel(channelId, userId)
 
 	if removed {
-		time.Sleep(1 * time.Second)
+		c.sleep(1 * time.Second)
 	}
 
 	_, resp := c.Client.AddChannelMember(channelId, userId)
@@ -148,7 +193,7 @@ func actionLeaveJoinChannel(c *EntityConfig) {
 	}
 
 	if !removed {
-		time.Sleep(1 * time.Second)
+		c.sleep(1 * time.Second)
 		_, resp = c.Client.RemoveUserFromChannel(channelId, userId)
 		if resp.Error != nil {
 			mlog.Error("Failed remove user from channel", mlog.String("channel_id", channelId), mlog.String("user_id", userId), mlog.Err(resp.Error))
@@ -190,7 +235,7 @@ func actionLeaveJoinTeam(c *EntityConfig) {
 		return
 	}
 
-	time.Sleep(time.Second * 1)
+	c.sleep(time.Second * 1)
 
 	if rand.Float64() > 0.5 {
 		if _, resp := c.Client.AddTeamMemberFromInvite("", inviteId); resp.Error != nil {
@@ -243,6 +288,13 @@ func createPost(c *EntityConfig, team *UserTeamImportData, channelId string) {
 		Message:   fake.Sentences(),
 	}
 
+	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.PostReplyChance {
+		if thread, ok := c.threads.pick(c.r, channelId); ok {
+			post.RootId = thread.RootId
+			post.ParentId = thread.RootId
+		}
+	}
+
 	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.ChannelLinkChance {
 		if channel := team.PickChannel(c.r); channel != nil {
 			post.Message = post.Message + " ~" + channel.Name
@@ -250,19 +302,9 @@ func createPost(c *EntityConfig, team *UserTeamImportData, channelId string) {
 	}
 
 	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.UploadImageChance {
-		numFiles := rand.Intn(3) + 1
-		fileIds := make([]string, numFiles, numFiles)
-		for i := 0; i < numFiles; i++ {
-			if data, err, filename := readRandomTestFile(); err != nil {
-				mlog.Error("Problem reading test file.", mlog.Err(err))
-			} else {
-				if file, resp := c.Client.UploadFile(data, channelId, filename); resp.Error != nil {
-					mlog.Error("Unable to upload file. Error: " + resp.Error.Error())
-					return
-				} else {
-					fileIds[i] = file.FileInfos[0].Id
-				}
-			}
+		fileIds, ok := uploadFiles(c, channelId)
+		if !ok {
+			return
 		}
 		post.FileIds = fileIds
 	}
@@ -276,9 +318,28 @@ func createPost(c *EntityConfig, team *UserTeamImportData, channelId string) {
 		post.Message = post.Message + " :" + name + ":"
 	}
 
+	post.Message = addMentions(c, channelId, post.Message)
+
+	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.OutgoingWebhookChance {
+		triggerWord := OUTGOING_WEBHOOK_TRIGGER
+		if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.OutgoingWebhookReplyChance {
+			triggerWord = OUTGOING_WEBHOOK_TRIGGER_REPLY
+		}
+		post.Message = triggerWord + " " + post.Message
+	}
+
+	sendTyping(c, channelId, post.ParentId, post.Message)
+
 	post, resp := c.Client.CreatePost(post)
 	if resp.Error != nil {
-		mlog.Info("Failed to post", mlog.String("team_name", team.Name), mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.String("auth_token", c.Client.AuthToken), mlog.Err(resp.Error))
+		mlog.Info("Failed to post", mlog.String("team_name", team.Name), mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.threads.remember(post, c.TeamMap[team.Name])
+	c.posts.rememberOwn(post)
+	if post.RootId != "" {
+		c.threads.setFollowing(post.RootId, true)
 	}
 
 	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.CustomEmojiReactionChance && c.LoadTestConfig.LoadtestEnviromentConfig.NumEmoji > 0 {
@@ -308,7 +369,7 @@ func searchRandomUsers(c *EntityConfig, teamId string, n int) ([]*model.User, er
 				list = append(list, users[0])
 				break
 			}
-			time.Sleep(time.Millisecond * 150)
+			c.sleep(time.Millisecond * 150)
 		}
 	}
 	return list, nil
@@ -496,7 +557,7 @@ func actionPostReactions(c *EntityConfig) {
 		emojiName := c.LoadTestConfig.LoadtestEnviromentConfig.PickEmoji(c.r)
 		addReaction(c, user.Id, list.Order[idx], emojiName)
 		if i != (numReactions - 1) {
-			time.Sleep(time.Duration(c.LoadTestConfig.UserEntitiesConfiguration.PostReactionsRateMilliseconds) * time.Millisecond)
+			c.sleep(time.Duration(c.LoadTestConfig.UserEntitiesConfiguration.PostReactionsRateMilliseconds) * time.Millisecond)
 		}
 	}
 }
@@ -557,9 +618,11 @@ func actionGetChannel(c *EntityConfig) {
 			mlog.Error(fmt.Sprintf("Got nil posts for get posts for channel. Resp was: %#v", resp))
 			return
 		}
+		c.threads.rememberList(posts, c.TeamMap[team.Name])
 		for _, post := range posts.Posts {
 			if post.Metadata != nil {
 				for _, file := range post.Metadata.Files {
+					c.files.remember(file)
 					if file.IsImage() {
 						if _, resp := c.Client.GetFileThumbnail(file.Id); resp.Error != nil {
 							mlog.Error("Unable to get file thumbnail for file.", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.String("post_id", post.Id), mlog.String("file_id", file.Id), mlog.Err(resp.Error))
@@ -577,6 +640,7 @@ func actionGetChannel(c *EntityConfig) {
 						mlog.Error("Unable to get file infos for post.", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.String("post_id", post.Id), mlog.Err(resp.Error))
 					} else {
 						for _, file := range files {
+							c.files.remember(file)
 							if file.IsImage() {
 								if _, resp := c.Client.GetFileThumbnail(file.Id); resp.Error != nil {
 									mlog.Error("Unable to get file thumbnail for file.", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.String("post_id", post.Id), mlog.String("file_id", file.Id), mlog.Err(resp.Error))
@@ -714,7 +778,7 @@ func actionAutocompleteChannel(c *EntityConfig) {
 				mlog.Error("Unable to autocomplete channel", mlog.String("team_name", team.Name), mlog.String("channel_name", channel.Name), mlog.String("fragment", currentSubstring))
 			}
 		}()
-		time.Sleep(time.Millisecond * 150)
+		c.sleep(time.Millisecond * 150)
 	}
 }
 
@@ -735,7 +799,7 @@ func actionSearchChannel(c *EntityConfig) {
 				mlog.Error("Unable to search channel", mlog.String("team_name", team.Name), mlog.String("channel_name", channel.Name), mlog.String("fragment", currentSubstring))
 			}
 		}()
-		time.Sleep(time.Millisecond * 150)
+		c.sleep(time.Millisecond * 150)
 	}
 }
 
@@ -777,7 +841,7 @@ func actionSearchUser(c *EntityConfig) {
 				mlog.Error("Unable to search users", mlog.String("team_name", team.Name), mlog.String("term", currentSubstring))
 			}
 		}()
-		time.Sleep(time.Millisecond * 150)
+		c.sleep(time.Millisecond * 150)
 	}
 }
 
@@ -785,54 +849,100 @@ func actionDisconnectWebsocket(c *EntityConfig) {
 	c.WebSocketClient.Close()
 }
 
-func actionPostWebhook(c *EntityConfig) {
-	infokey := "webhookid" + strconv.Itoa(c.EntityNumber)
-	hookIdI, ok := c.Info[infokey]
-	hookId := ""
-	if !ok {
-		team, channel := c.UserData.PickTeamChannel(c.r)
-		if team == nil || channel == nil {
-			return
-		}
-		channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
-		if err != nil {
-			mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
-			return
-		}
+// incomingWebhook is an incoming webhook the entities post through.
+type incomingWebhook struct {
+	Id       string
+	TeamName string
+}
 
-		webhook, resp := c.AdminClient.CreateIncomingWebhook(&model.IncomingWebhook{
-			ChannelId:   channelId,
-			DisplayName: model.NewId(),
-			Description: model.NewId(),
-		})
-		if resp.Error != nil {
-			mlog.Error("Unable to create incoming webhook. Error: " + resp.Error.Error())
-			return
-		}
-		c.Info[infokey] = webhook.Id
-		hookId = webhook.Id
-	} else {
-		hookId = hookIdI.(string)
+// incomingWebhookPool shares a number of incoming webhooks between entities, creating them as they
+// are first needed.
+type incomingWebhookPool struct {
+	lock  sync.Mutex
+	hooks []incomingWebhook
+}
+
+// pick returns one of the webhooks at random, first creating a webhook in a random channel of the
+// entity if fewer than the given number exist. The pool isn't locked while the webhook is created,
+// so a webhook created once the pool has filled up is used only this once.
+func (p *incomingWebhookPool) pick(c *EntityConfig, size int) (incomingWebhook, bool) {
+	p.lock.Lock()
+	if len(p.hooks) >= size {
+		hook := p.hooks[c.r.Intn(len(p.hooks))]
+		p.lock.Unlock()
+		return hook, true
 	}
+	p.lock.Unlock()
 
-	webhookRequest := &model.IncomingWebhookRequest{
-		Text:     fake.Paragraphs(),
-		Username: "ltwhuser",
-		Type:     "",
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return incomingWebhook{}, false
 	}
-	b, err := json.Marshal(webhookRequest)
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
 	if err != nil {
-		mlog.Error("Unable to marshal json for webhook request")
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return incomingWebhook{}, false
+	}
+
+	webhook, resp := c.AdminClient.CreateIncomingWebhook(&model.IncomingWebhook{
+		ChannelId:   channelId,
+		DisplayName: model.NewId(),
+		Description: model.NewId(),
+	})
+	if resp.Error != nil {
+		mlog.Error("Unable to create incoming webhook. Error: " + resp.Error.Error())
+		return incomingWebhook{}, false
+	}
+
+	hook := incomingWebhook{Id: webhook.Id, TeamName: team.Name}
+	p.lock.Lock()
+	if len(p.hooks) < size {
+		p.hooks = append(p.hooks, hook)
+	}
+	p.lock.Unlock()
+
+	return hook, true
+}
+
+// actionPostWebhook posts a generated payload through one of the incoming webhooks shared by the
+// entities, or through the entity's own webhook when no number of shared webhooks is configured.
+func actionPostWebhook(c *EntityConfig) {
+	pool, size := c.webhooks, c.LoadTestConfig.UserEntitiesConfiguration.NumIncomingWebhooks
+	if pool == nil || size <= 0 {
+		pool, size = &c.ownWebhooks, 1
+	}
+
+	hook, ok := pool.pick(c, size)
+	if !ok {
+		return
+	}
+
+	request, err := generateWebhookRequest(c.r, c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookPayloads)
+	if err != nil {
+		mlog.Error("Unable to generate webhook request", mlog.Err(err))
 		return
 	}
 
-	var buf bytes.Buffer
-	buf.WriteString(string(b))
+	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookUsernameOverrideChance {
+		request.Username = WEBHOOK_OVERRIDE_USERNAME
+	}
+	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookIconOverrideChance {
+		request.IconURL = WEBHOOK_OVERRIDE_ICON_URL
+	}
+	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookChannelOverrideChance {
+		// Webhooks can only post to the channels of their own team.
+		for i := range c.UserData.Teams {
+			if team := &c.UserData.Teams[i]; team.Name == hook.TeamName {
+				if channel := team.PickChannel(c.r); channel != nil {
+					request.ChannelName = channel.Name
+				}
+				break
+			}
+		}
+	}
 
-	if resp, err := http.Post(c.LoadTestConfig.ConnectionConfiguration.ServerURL+"/hooks/"+hookId, "application/json", &buf); err != nil {
-		mlog.Error("Failed to post by webhook. Error: " + err.Error())
-	} else if resp != nil {
-		resp.Body.Close()
+	if _, resp := c.Client.PostIncomingWebhook(hook.Id, request); resp.Error != nil {
+		mlog.Error("Failed to post by webhook", mlog.String("hook_id", hook.Id), mlog.String("channel_name", request.ChannelName), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
 	}
 }
 
@@ -863,7 +973,7 @@ func actionGetChannelUnreads(c *EntityConfig) {
 
 	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.GetPostsAroundLastUnreadChance {
 		numPosts := c.LoadTestConfig.UserEntitiesConfiguration.NumGetPostsAroundLastUnread
-		_, resp := c.Client.GetPostsAroundLastUnread(channelId, user.Id, numPosts, numPosts)
+		_, resp := c.Client.GetPostsAroundLastUnread(user.Id, channelId, numPosts, numPosts)
 		if resp.Error != nil {
 			mlog.Info("Failed to get posts around last unread", mlog.String("channel_id", channelId), mlog.Err(resp.Error))
 			return
@@ -1283,7 +1393,7 @@ func actionDeactivateReactivate(c *EntityConfig) {
 		mlog.Info("Deactivated user", mlog.String("user_id", user.Id))
 	}
 
-	time.Sleep(time.Second * 1)
+	c.sleep(time.Second * 1)
 
 	if ok, resp := c.AdminClient.UpdateUserActive(user.Id, true); !ok {
 		mlog.Error("Failed to reactivate user", mlog.String("user_id", user.Id), mlog.Err(resp.Error))
@@ -1357,7 +1467,7 @@ func actionMoreChannels(c *EntityConfig) {
 			return
 		}
 
-		time.Sleep(time.Millisecond * 1000)
+		c.sleep(time.Millisecond * 1000)
 	}
 }
 
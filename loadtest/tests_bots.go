@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// actionBotPost posts as the entity's bot to one of the bot channels, with the same kinds of
+// payload as incoming webhooks.
+func actionBotPost(c *EntityConfig) {
+	if c.bot == nil || len(c.bot.ChannelIds) == 0 {
+		return
+	}
+	channelId := c.bot.ChannelIds[c.r.Intn(len(c.bot.ChannelIds))]
+
+	request, err := generateWebhookRequest(c.r, c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookPayloads)
+	if err != nil {
+		mlog.Error("Unable to generate bot post", mlog.Err(err))
+		return
+	}
+
+	post := &model.Post{
+		ChannelId: channelId,
+		Message:   request.Text,
+	}
+	if len(request.Attachments) > 0 {
+		post.AddProp("attachments", request.Attachments)
+	}
+
+	post, resp := c.Client.CreatePost(post)
+	if resp.Error != nil {
+		mlog.Error("Failed to post as bot", mlog.String("channel_id", channelId), mlog.String("bot", c.bot.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.posts.rememberOwn(post)
+}
+
+// actionBotUpdatePost updates one of the bot's recent posts with a new message and attachments,
+// like a build server reporting the progress of a build.
+func actionBotUpdatePost(c *EntityConfig) {
+	if c.bot == nil {
+		return
+	}
+
+	post, ok := c.posts.pickOwn(c.r)
+	if !ok {
+		return
+	}
+
+	message := fake.Sentence()
+	props := model.StringInterface{"attachments": generateAttachments(c.r)}
+	if _, resp := c.Client.PatchPost(post.Id, &model.PostPatch{Message: &message, Props: &props}); resp.Error != nil {
+		mlog.Error("Failed to update post as bot", mlog.String("post_id", post.Id), mlog.String("bot", c.bot.Username), mlog.Err(resp.Error))
+	}
+}
+
+var botUserEntity UserEntity = UserEntity{
+	Name: "Bot",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionBotPost,
+			Weight: 3,
+		},
+		{
+			Item:   actionBotUpdatePost,
+			Weight: 2,
+		},
+	},
+	Bot: true,
+}
+
+var TestBots TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			// Bots post far more often than people.
+			Item: UserEntityWithRateMultiplier{
+				Entity:         botUserEntity,
+				RateMultiplier: 0.2,
+			},
+			Weight: 30,
+		},
+	},
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Responses that take longer than this to appear are counted as lost.
+const SLASH_COMMAND_RESPONSE_TIMEOUT = time.Minute
+
+// SlashCommandResponse describes how often the slash command asks for a type of response.
+type SlashCommandResponse struct {
+	// Type is one of ephemeral, in_channel or delayed.
+	Type   string
+	Weight int
+}
+
+// defaultSlashCommandResponses is used when no slash command responses are configured.
+var defaultSlashCommandResponses = []SlashCommandResponse{
+	{Type: SLASH_COMMAND_RESPONSE_EPHEMERAL, Weight: 50},
+	{Type: SLASH_COMMAND_RESPONSE_IN_CHANNEL, Weight: 40},
+	{Type: SLASH_COMMAND_RESPONSE_DELAYED, Weight: 10},
+}
+
+type pendingCommand struct {
+	responseType string
+	start        time.Time
+}
+
+// commandState times the slash commands the entity executed, from executing the command to its
+// response appearing over the websocket.
+type commandState struct {
+	lock sync.Mutex
+	// pending maps the tokens of commands awaiting a response to when they were executed.
+	pending map[string]pendingCommand
+	// durations lists the round trip times in milliseconds by response type.
+	durations map[string][]float64
+	// lost counts the commands by response type whose response never appeared.
+	lost map[string]int64
+}
+
+// start records that a command was executed, and gives up on earlier commands whose responses
+// have taken too long.
+func (cs *commandState) start(token, responseType string, now time.Time) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if cs.pending == nil {
+		cs.pending = make(map[string]pendingCommand)
+	}
+	if cs.lost == nil {
+		cs.lost = make(map[string]int64)
+	}
+
+	for pendingToken, command := range cs.pending {
+		if now.Sub(command.start) > SLASH_COMMAND_RESPONSE_TIMEOUT {
+			cs.lost[command.responseType]++
+			delete(cs.pending, pendingToken)
+		}
+	}
+
+	cs.pending[token] = pendingCommand{responseType, now}
+}
+
+// cancel forgets a command that failed to execute.
+func (cs *commandState) cancel(token string) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	delete(cs.pending, token)
+}
+
+// receivedEvent records the round trip time of a command whose response appeared in the given
+// websocket event.
+func (cs *commandState) receivedEvent(event *model.WebSocketEvent, now time.Time) {
+	if event.Event != model.WEBSOCKET_EVENT_POSTED && event.Event != model.WEBSOCKET_EVENT_EPHEMERAL_MESSAGE {
+		return
+	}
+
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if len(cs.pending) == 0 {
+		return
+	}
+
+	postJson, ok := event.Data["post"].(string)
+	if !ok {
+		return
+	}
+	post := model.PostFromJson(strings.NewReader(postJson))
+	if post == nil {
+		return
+	}
+
+	match := slashCommandResponseRegex.FindStringSubmatch(post.Message)
+	if match == nil {
+		return
+	}
+	command, ok := cs.pending[match[1]]
+	if !ok {
+		return
+	}
+	delete(cs.pending, match[1])
+
+	if cs.durations == nil {
+		cs.durations = make(map[string][]float64)
+	}
+	cs.durations[command.responseType] = append(cs.durations[command.responseType], float64(now.Sub(command.start)/time.Millisecond))
+}
+
+// results returns the round trip times and the number of lost responses by response type,
+// counting commands still awaiting a response as lost.
+func (cs *commandState) results() (map[string][]float64, map[string]int64) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	durations := make(map[string][]float64, len(cs.durations))
+	for responseType, values := range cs.durations {
+		durations[responseType] = append([]float64(nil), values...)
+	}
+	lost := make(map[string]int64, len(cs.lost))
+	for responseType, count := range cs.lost {
+		lost[responseType] = count
+	}
+	for _, command := range cs.pending {
+		lost[command.responseType]++
+	}
+
+	return durations, lost
+}
+
+// pickSlashCommandResponse picks a type of response from those configured.
+func pickSlashCommandResponse(c *EntityConfig) (string, error) {
+	responses := c.LoadTestConfig.UserEntitiesConfiguration.SlashCommandResponses
+	if len(responses) == 0 {
+		responses = defaultSlashCommandResponses
+	}
+
+	choices := make([]randutil.Choice, len(responses))
+	for i, response := range responses {
+		choices[i] = randutil.Choice{Item: response.Type, Weight: response.Weight}
+	}
+	choice, err := randutil.WeightedChoice(c.r, choices)
+	if err != nil {
+		return "", err
+	}
+
+	return choice.Item.(string), nil
+}
+
+// actionExecuteSlashCommand executes the load test's slash command in a random channel, timing
+// how long its response takes to appear. Nothing is executed unless the integration server is
+// configured.
+func actionExecuteSlashCommand(c *EntityConfig) {
+	if c.LoadTestConfig.ConnectionConfiguration.IntegrationURL == "" {
+		return
+	}
+
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return
+	}
+
+	responseType, err := pickSlashCommandResponse(c)
+	if err != nil {
+		mlog.Error("Failed to pick slash command response", mlog.Err(err))
+		return
+	}
+
+	token := model.NewId()
+	delay := time.Duration(c.LoadTestConfig.UserEntitiesConfiguration.SlashCommandDelayMilliseconds) * time.Millisecond
+	command := slashCommand(responseType, token, delay)
+
+	c.commands.start(token, responseType, time.Now())
+	if _, resp := c.Client.ExecuteCommand(channelId, command); resp.Error != nil {
+		c.commands.cancel(token)
+		mlog.Error("Failed to execute slash command", mlog.String("channel_id", channelId), mlog.String("command", command), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// slashCommandResults summarises the round trip times of one type of slash command response.
+type slashCommandResults struct {
+	latencySummary
+	Lost int64
+}
+
+// reportSlashCommands logs the round trip times of the slash commands executed by the entities.
+func reportSlashCommands(entities []*EntityConfig, instanceId string) {
+	allDurations := make(map[string][]float64)
+	allLost := make(map[string]int64)
+	for _, entity := range entities {
+		durations, lost := entity.commands.results()
+		for responseType, values := range durations {
+			allDurations[responseType] = append(allDurations[responseType], values...)
+		}
+		for responseType, count := range lost {
+			allLost[responseType] += count
+		}
+	}
+
+	if len(allDurations) == 0 && len(allLost) == 0 {
+		return
+	}
+
+	byResponseType := make(map[string]slashCommandResults)
+	for responseType, count := range allLost {
+		byResponseType[responseType] = slashCommandResults{Lost: count}
+	}
+	for responseType, durations := range allDurations {
+		results := byResponseType[responseType]
+		results.latencySummary = summarizeLatencies(durations)
+		byResponseType[responseType] = results
+	}
+
+	mlog.Info(
+		"Slash commands",
+		mlog.String("tag", "slash_commands"),
+		mlog.Any("by_response_type", byResponseType),
+		mlog.String("instance_id", instanceId),
+	)
+}
+
+var slashCommandUserEntity UserEntity = UserEntity{
+	Name: "SlashCommands",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 20,
+		},
+		{
+			Item:   actionPost,
+			Weight: 5,
+		},
+		{
+			Item:   actionExecuteSlashCommand,
+			Weight: 10,
+		},
+	},
+}
+
+var TestSlashCommands TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         slashCommandUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
+
+// checkSlashCommandResponses checks that the configured slash command responses can be asked for.
+func (vr *ValidationResult) checkSlashCommandResponses(section string, cfg *UserEntitiesConfiguration) {
+	for i, response := range cfg.SlashCommandResponses {
+		name := fmt.Sprintf("%s.SlashCommandResponses[%d]", section, i)
+		switch response.Type {
+		case SLASH_COMMAND_RESPONSE_EPHEMERAL, SLASH_COMMAND_RESPONSE_IN_CHANNEL, SLASH_COMMAND_RESPONSE_DELAYED:
+		default:
+			vr.problem("%s has unknown type %q, must be one of ephemeral, in_channel or delayed", name, response.Type)
+		}
+		if response.Weight < 0 {
+			vr.problem("%s must not have a negative weight", name)
+		}
+	}
+
+	if cfg.SlashCommandDelayMilliseconds < 0 {
+		vr.problem("%s.SlashCommandDelayMilliseconds must not be negative", section)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// An entity only downloads the files it saw or uploaded most recently.
+const FILES_REMEMBERED = 50
+
+// Posts are made with between one and this many attachments, like the webapp allows.
+const MAX_FILES_PER_POST = 3
+
+// seenFile is a file the entity uploaded or saw attached to a post.
+type seenFile struct {
+	Id      string
+	IsImage bool
+}
+
+// fileState remembers the files the entity uploaded or saw most recently.
+type fileState struct {
+	lock sync.Mutex
+	// seen lists the files, oldest first.
+	seen []seenFile
+}
+
+// remember records a file the entity uploaded or saw.
+func (fs *fileState) remember(file *model.FileInfo) {
+	if file == nil || file.Id == "" {
+		return
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	for _, seen := range fs.seen {
+		if seen.Id == file.Id {
+			return
+		}
+	}
+
+	fs.seen = append(fs.seen, seenFile{
+		Id:      file.Id,
+		IsImage: file.IsImage(),
+	})
+	if len(fs.seen) > FILES_REMEMBERED {
+		fs.seen = fs.seen[1:]
+	}
+}
+
+// pick returns one of the remembered files at random, only considering images if asked to.
+func (fs *fileState) pick(r *rand.Rand, imagesOnly bool) (seenFile, bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	var candidates []seenFile
+	for _, file := range fs.seen {
+		if file.IsImage || !imagesOnly {
+			candidates = append(candidates, file)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return seenFile{}, false
+	}
+
+	return candidates[r.Intn(len(candidates))], true
+}
+
+// uploadFiles generates and uploads up to MAX_FILES_PER_POST files to the given channel,
+// returning their ids.
+func uploadFiles(c *EntityConfig, channelId string) ([]string, bool) {
+	numFiles := c.r.Intn(MAX_FILES_PER_POST) + 1
+	fileIds := make([]string, 0, numFiles)
+	for i := 0; i < numFiles; i++ {
+		data, filename, err := generateUpload(c.r, c.LoadTestConfig.UserEntitiesConfiguration.FileUploads)
+		if err != nil {
+			mlog.Error("Unable to generate file.", mlog.Err(err))
+			return nil, false
+		}
+
+		file, resp := c.Client.UploadFile(data, channelId, filename)
+		if resp.Error != nil {
+			mlog.Error("Unable to upload file.", mlog.String("channel_id", channelId), mlog.String("filename", filename), mlog.Int("size", len(data)), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return nil, false
+		}
+
+		for _, info := range file.FileInfos {
+			c.files.remember(info)
+			fileIds = append(fileIds, info.Id)
+		}
+	}
+
+	return fileIds, true
+}
+
+// actionPostFiles posts a message with generated attachments to a random channel.
+func actionPostFiles(c *EntityConfig) {
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return
+	}
+
+	fileIds, ok := uploadFiles(c, channelId)
+	if !ok {
+		return
+	}
+
+	post, resp := c.Client.CreatePost(&model.Post{
+		ChannelId: channelId,
+		Message:   fake.Sentence(),
+		FileIds:   fileIds,
+	})
+	if resp.Error != nil {
+		mlog.Info("Failed to post files", mlog.String("team_name", team.Name), mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.threads.remember(post, c.TeamMap[team.Name])
+	c.posts.rememberOwn(post)
+}
+
+// actionDownloadFile downloads the original of a file the entity has seen.
+func actionDownloadFile(c *EntityConfig) {
+	file, ok := c.files.pick(c.r, false)
+	if !ok {
+		return
+	}
+
+	if _, resp := c.Client.GetFile(file.Id); resp.Error != nil {
+		mlog.Error("Failed to download file", mlog.String("file_id", file.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionGetFilePreview opens the preview of an image the entity has seen, as the webapp does when
+// an image is clicked.
+func actionGetFilePreview(c *EntityConfig) {
+	file, ok := c.files.pick(c.r, true)
+	if !ok {
+		return
+	}
+
+	if _, resp := c.Client.GetFilePreview(file.Id); resp.Error != nil {
+		mlog.Error("Failed to get file preview", mlog.String("file_id", file.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionGetFilePublicLink gets the public link of a file the entity has seen, and downloads the
+// file through it without authenticating.
+func actionGetFilePublicLink(c *EntityConfig) {
+	file, ok := c.files.pick(c.r, false)
+	if !ok {
+		return
+	}
+
+	link, resp := c.Client.GetFileLink(file.Id)
+	if resp.Error != nil {
+		mlog.Error("Failed to get public link", mlog.String("file_id", file.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	if _, resp := c.Client.GetPublicFile(link); resp.Error != nil {
+		mlog.Error("Failed to download public file", mlog.String("file_id", file.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionSearchFiles searches the files of a random team for a word.
+func actionSearchFiles(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+
+	teamId := c.TeamMap[team.Name]
+	if teamId == "" {
+		mlog.Error("Unable to get team from map", mlog.String("team", team.Name))
+		return
+	}
+
+	terms := strings.ToLower(fake.Word())
+	list, resp := c.Client.SearchFiles(teamId, terms, false)
+	if resp.Error != nil {
+		mlog.Error("Failed to search files", mlog.String("team_id", teamId), mlog.String("terms", terms), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	for _, fileId := range list.Order {
+		c.files.remember(list.FileInfos[fileId])
+	}
+}
+
+var filesUserEntity UserEntity = UserEntity{
+	Name: "Files",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 20,
+		},
+		{
+			Item:   actionPostFiles,
+			Weight: 5,
+		},
+		{
+			Item:   actionDownloadFile,
+			Weight: 8,
+		},
+		{
+			Item:   actionGetFilePreview,
+			Weight: 8,
+		},
+		{
+			Item:   actionGetFilePublicLink,
+			Weight: 2,
+		},
+		{
+			Item:   actionSearchFiles,
+			Weight: 4,
+		},
+	},
+}
+
+var TestFiles TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         filesUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
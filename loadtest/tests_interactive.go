@@ -0,0 +1,331 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// An entity only clicks the interactive messages it posted or saw most recently.
+const INTERACTIVE_POSTS_REMEMBERED = 20
+
+// Updates that take longer than this to appear are counted as lost.
+const INTERACTIVE_UPDATE_TIMEOUT = time.Minute
+
+type pendingClick struct {
+	actionType string
+	start      time.Time
+}
+
+// interactiveState remembers the interactive messages the entity posted or saw, and times its
+// clicks on them, from clicking to the updated message appearing over the websocket.
+type interactiveState struct {
+	lock sync.Mutex
+	// posts lists the ids of the interactive messages, oldest first.
+	posts []string
+	// pending maps the ids of the messages clicked but not yet updated to the click.
+	pending map[string]pendingClick
+	// durations lists the click to update times in milliseconds by action type.
+	durations map[string][]float64
+	// lost counts the clicks by action type whose update never appeared.
+	lost map[string]int64
+	// errors counts the clicks by action type that the server failed.
+	errors map[string]int64
+}
+
+// remember records an interactive message the entity posted or saw.
+func (is *interactiveState) remember(postId string) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	is.rememberLocked(postId)
+}
+
+func (is *interactiveState) rememberLocked(postId string) {
+	for _, id := range is.posts {
+		if id == postId {
+			return
+		}
+	}
+
+	is.posts = append(is.posts, postId)
+	if len(is.posts) > INTERACTIVE_POSTS_REMEMBERED {
+		is.posts = is.posts[1:]
+	}
+}
+
+// pick returns one of the remembered interactive messages at random.
+func (is *interactiveState) pick(r *rand.Rand) (string, bool) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	if len(is.posts) == 0 {
+		return "", false
+	}
+
+	return is.posts[r.Intn(len(is.posts))], true
+}
+
+// start records a click on a message, and gives up on earlier clicks whose updates have taken
+// too long.
+func (is *interactiveState) start(postId, actionType string, now time.Time) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	if is.pending == nil {
+		is.pending = make(map[string]pendingClick)
+	}
+	if is.lost == nil {
+		is.lost = make(map[string]int64)
+	}
+
+	for pendingPostId, click := range is.pending {
+		if now.Sub(click.start) > INTERACTIVE_UPDATE_TIMEOUT {
+			is.lost[click.actionType]++
+			delete(is.pending, pendingPostId)
+		}
+	}
+
+	is.pending[postId] = pendingClick{actionType, now}
+}
+
+// fail counts a click that the server failed, and forgets the message, which may have been
+// deleted.
+func (is *interactiveState) fail(postId string) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	if click, ok := is.pending[postId]; ok {
+		if is.errors == nil {
+			is.errors = make(map[string]int64)
+		}
+		is.errors[click.actionType]++
+		delete(is.pending, postId)
+	}
+
+	for i, id := range is.posts {
+		if id == postId {
+			is.posts = append(is.posts[:i], is.posts[i+1:]...)
+			break
+		}
+	}
+}
+
+// receivedEvent remembers the interactive messages posted in the entity's channels, and records
+// the click to update time of the entity's clicks. The id of the entity's user tells its updates
+// apart from those caused by other users clicking the same message.
+func (is *interactiveState) receivedEvent(event *model.WebSocketEvent, ownUserId string, now time.Time) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	if event.Event != model.WEBSOCKET_EVENT_POSTED && event.Event != model.WEBSOCKET_EVENT_POST_EDITED {
+		return
+	}
+
+	// Most posts are not interactive messages, so avoid decoding them.
+	postJson, ok := event.Data["post"].(string)
+	if !ok || !strings.Contains(postJson, INTERACTIVE_BUTTON_ID) {
+		return
+	}
+	post := model.PostFromJson(strings.NewReader(postJson))
+	if post == nil || !isInteractivePost(post) {
+		return
+	}
+
+	if event.Event == model.WEBSOCKET_EVENT_POSTED {
+		is.rememberLocked(post.Id)
+		return
+	}
+
+	click, ok := is.pending[post.Id]
+	if !ok {
+		return
+	}
+	match := interactiveUpdateRegex.FindStringSubmatch(post.Message)
+	if match == nil || match[1] != ownUserId {
+		return
+	}
+	delete(is.pending, post.Id)
+
+	if is.durations == nil {
+		is.durations = make(map[string][]float64)
+	}
+	is.durations[click.actionType] = append(is.durations[click.actionType], float64(now.Sub(click.start)/time.Millisecond))
+}
+
+// results returns the click to update times, and the numbers of lost updates and failed clicks,
+// by action type. Clicks still awaiting an update count as lost.
+func (is *interactiveState) results() (map[string][]float64, map[string]int64, map[string]int64) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	durations := make(map[string][]float64, len(is.durations))
+	for actionType, values := range is.durations {
+		durations[actionType] = append([]float64(nil), values...)
+	}
+	lost := make(map[string]int64, len(is.lost))
+	for actionType, count := range is.lost {
+		lost[actionType] = count
+	}
+	for _, click := range is.pending {
+		lost[click.actionType]++
+	}
+	errors := make(map[string]int64, len(is.errors))
+	for actionType, count := range is.errors {
+		errors[actionType] = count
+	}
+
+	return durations, lost, errors
+}
+
+// actionPostInteractive posts an interactive message to a random channel. Nothing is posted
+// unless the integration server is configured.
+func actionPostInteractive(c *EntityConfig) {
+	integrationURL := c.LoadTestConfig.ConnectionConfiguration.IntegrationURL
+	if integrationURL == "" {
+		return
+	}
+
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return
+	}
+
+	post := &model.Post{
+		ChannelId: channelId,
+		Message:   fake.Sentence(),
+	}
+	post.AddProp("attachments", interactiveAttachments(strings.TrimSuffix(integrationURL, "/")+INTERACTIVE_ACTION_PATH))
+
+	post, resp := c.Client.CreatePost(post)
+	if resp.Error != nil {
+		mlog.Info("Failed to post interactive message", mlog.String("team_name", team.Name), mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.interactive.remember(post.Id)
+}
+
+// actionClickInteractive clicks the button or picks an option of the select menu of an
+// interactive message the entity has seen, timing how long the update takes to appear.
+func actionClickInteractive(c *EntityConfig) {
+	postId, ok := c.interactive.pick(c.r)
+	if !ok {
+		return
+	}
+
+	actionType, actionId, selected := model.POST_ACTION_TYPE_BUTTON, INTERACTIVE_BUTTON_ID, ""
+	if c.r.Intn(2) == 0 {
+		actionType, actionId = model.POST_ACTION_TYPE_SELECT, INTERACTIVE_SELECT_ID
+		selected = INTERACTIVE_OPTIONS[c.r.Intn(len(INTERACTIVE_OPTIONS))]
+	}
+
+	c.interactive.start(postId, actionType, time.Now())
+	if _, resp := c.Client.DoPostActionWithCookie(postId, actionId, selected, ""); resp.Error != nil {
+		c.interactive.fail(postId)
+		mlog.Error("Failed to click interactive message", mlog.String("post_id", postId), mlog.String("action_type", actionType), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// interactiveResults summarises the clicks on one type of action.
+type interactiveResults struct {
+	latencySummary
+	Lost   int64
+	Errors int64
+}
+
+// reportInteractiveMessages logs the click to update times and error counts of the clicks made
+// by the entities.
+func reportInteractiveMessages(entities []*EntityConfig, instanceId string) {
+	byActionType := make(map[string]interactiveResults)
+	allDurations := make(map[string][]float64)
+	for _, entity := range entities {
+		durations, lost, errors := entity.interactive.results()
+		for actionType, values := range durations {
+			allDurations[actionType] = append(allDurations[actionType], values...)
+		}
+		for actionType, count := range lost {
+			results := byActionType[actionType]
+			results.Lost += count
+			byActionType[actionType] = results
+		}
+		for actionType, count := range errors {
+			results := byActionType[actionType]
+			results.Errors += count
+			byActionType[actionType] = results
+		}
+	}
+
+	for actionType, durations := range allDurations {
+		results := byActionType[actionType]
+		results.latencySummary = summarizeLatencies(durations)
+		byActionType[actionType] = results
+	}
+
+	if len(byActionType) == 0 {
+		return
+	}
+
+	mlog.Info(
+		"Interactive messages",
+		mlog.String("tag", "interactive_messages"),
+		mlog.Any("by_action_type", byActionType),
+		mlog.String("instance_id", instanceId),
+	)
+}
+
+var interactiveUserEntity UserEntity = UserEntity{
+	Name: "InteractiveMessages",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 20,
+		},
+		{
+			Item:   actionPost,
+			Weight: 5,
+		},
+		{
+			Item:   actionPostInteractive,
+			Weight: 3,
+		},
+		{
+			Item:   actionClickInteractive,
+			Weight: 12,
+		},
+	},
+}
+
+var TestInteractiveMessages TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         interactiveUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
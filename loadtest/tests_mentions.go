@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// mentionState counts the mentions an entity received over its websocket.
+type mentionState struct {
+	lock     sync.Mutex
+	received int64
+}
+
+// channelMembers maps channel ids to the usernames of the members of the channels, as loaded onto
+// the server. It is built once for all the entities when the test starts, and only read after.
+type channelMembers map[string][]string
+
+// newChannelMembers indexes the members of the public channels and town squares of the users'
+// teams.
+func newChannelMembers(users []UserImportData, channelMap map[string]map[string]string, townSquareMap map[string]string) channelMembers {
+	members := make(channelMembers)
+	for _, user := range users {
+		for _, team := range user.Teams {
+			channelIds := map[string]bool{}
+			if townSquareId := townSquareMap[team.Name]; townSquareId != "" {
+				channelIds[townSquareId] = true
+			}
+			for _, channel := range team.Channels {
+				if channelId := channelMap[team.Name][channel.Name]; channelId != "" {
+					channelIds[channelId] = true
+				}
+			}
+
+			for channelId := range channelIds {
+				members[channelId] = append(members[channelId], user.Username)
+			}
+		}
+	}
+
+	return members
+}
+
+// pickOther returns the username of a random member of the given channel other than the given
+// user.
+func (cm channelMembers) pickOther(r *rand.Rand, channelId, username string) (string, bool) {
+	members := cm[channelId]
+	if len(members) == 0 {
+		return "", false
+	}
+
+	i := r.Intn(len(members))
+	if members[i] == username {
+		if len(members) == 1 {
+			return "", false
+		}
+		i = (i + 1) % len(members)
+	}
+
+	return members[i], true
+}
+
+// receivedEvent counts the mentions of the entity's user, with the given id, in the given
+// websocket event.
+func (ms *mentionState) receivedEvent(event *model.WebSocketEvent, ownUserId string) {
+	if event.Event != model.WEBSOCKET_EVENT_POSTED || ownUserId == "" {
+		return
+	}
+
+	mentionsJson, ok := event.Data["mentions"].(string)
+	if !ok {
+		return
+	}
+
+	for _, userId := range model.ArrayFromJson(strings.NewReader(mentionsJson)) {
+		if userId == ownUserId {
+			ms.lock.Lock()
+			ms.received++
+			ms.lock.Unlock()
+			return
+		}
+	}
+}
+
+func (ms *mentionState) count() int64 {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	return ms.received
+}
+
+// addMentions adds the configured mentions to a message posted to the given channel.
+func addMentions(c *EntityConfig, channelId string, message string) string {
+	cfg := &c.LoadTestConfig.UserEntitiesConfiguration
+
+	if rand.Float64() < cfg.UserMentionChance {
+		if username, ok := c.channelMembers.pickOther(c.r, channelId, c.UserData.Username); ok {
+			message = message + " @" + username
+		}
+	}
+
+	if rand.Float64() < cfg.HereMentionChance {
+		message = message + " @here"
+	}
+
+	if rand.Float64() < cfg.ChannelMentionChance {
+		if c.r.Intn(2) == 0 {
+			message = message + " @channel"
+		} else {
+			message = message + " @all"
+		}
+	}
+
+	if rand.Float64() < cfg.KeywordMentionChance {
+		message = message + " " + MENTION_KEYWORDS[c.r.Intn(len(MENTION_KEYWORDS))]
+	}
+
+	return message
+}
+
+// reportMentions logs how many mentions each entity received over its websocket.
+func reportMentions(entities []*EntityConfig, instanceId string) {
+	if len(entities) == 0 {
+		return
+	}
+
+	var total, max int64
+	numMentioned := 0
+	byEntity := make(map[string]int64)
+	for _, entity := range entities {
+		count := entity.mentions.count()
+		total += count
+		if count > 0 {
+			numMentioned++
+			byEntity[entity.UserData.Username] = count
+		}
+		if count > max {
+			max = count
+		}
+	}
+
+	mlog.Info(
+		"Mentions",
+		mlog.String("tag", "mentions"),
+		mlog.Int64("total", total),
+		mlog.Any("mean", float64(total)/float64(len(entities))),
+		mlog.Int64("max", max),
+		mlog.Int("num_entities_mentioned", numMentioned),
+		mlog.Int("num_entities", len(entities)),
+		mlog.Any("by_entity", byEntity),
+		mlog.String("instance_id", instanceId),
+	)
+}
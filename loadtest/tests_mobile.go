@@ -0,0 +1,240 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The mobile apps fetch fewer posts than the webapp when first opening a channel.
+const MOBILE_POSTS_PAGE_SIZE = 30
+
+const MOBILE_USER_AGENT_IOS = "Mattermost Mobile/1.26.0 (iOS 13.3; iPhone)"
+const MOBILE_USER_AGENT_ANDROID = "Mattermost Mobile/1.26.0 (Android 10; Pixel 3)"
+
+// mobileState is what the mobile app remembers between channel switches and resumes. It is
+// shared between an entity's actions and its websocket listener.
+type mobileState struct {
+	lock             sync.Mutex
+	currentChannelId string
+	// lastViewedAt maps channel ids to the time their posts were last fetched.
+	lastViewedAt map[string]int64
+	// backgroundUntil is when the app returns to the foreground, reconnecting its websocket.
+	backgroundUntil time.Time
+}
+
+// viewChannel records the channel as current, returning the previous one and when the given
+// channel's posts were last fetched, if ever.
+func (ms *mobileState) viewChannel(channelId string, now int64) (prevChannelId string, lastViewedAt int64) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.lastViewedAt == nil {
+		ms.lastViewedAt = make(map[string]int64)
+	}
+
+	prevChannelId = ms.currentChannelId
+	lastViewedAt = ms.lastViewedAt[channelId]
+	ms.currentChannelId = channelId
+	ms.lastViewedAt[channelId] = now
+
+	return prevChannelId, lastViewedAt
+}
+
+// currentChannel returns the channel the app was showing, and when its posts were last fetched.
+func (ms *mobileState) currentChannel() (channelId string, lastViewedAt int64) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	return ms.currentChannelId, ms.lastViewedAt[ms.currentChannelId]
+}
+
+// actionMobileViewChannel switches channel the way the mobile apps do: posts are fetched once
+// and afterwards only synced, and the channel is viewed a single time.
+func actionMobileViewChannel(c *EntityConfig) {
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return
+	}
+
+	prevChannelId, lastViewedAt := c.mobile.viewChannel(channelId, model.GetMillis())
+
+	if lastViewedAt == 0 {
+		if posts, resp := c.Client.GetPostsForChannel(channelId, 0, MOBILE_POSTS_PAGE_SIZE, ""); resp.Error != nil {
+			mlog.Error("Unable to get posts for channel", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		} else {
+			c.threads.rememberList(posts, c.TeamMap[team.Name])
+		}
+	} else if posts, resp := c.Client.GetPostsSince(channelId, lastViewedAt); resp.Error != nil {
+		mlog.Error("Unable to get posts since", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	} else {
+		c.threads.rememberList(posts, c.TeamMap[team.Name])
+	}
+
+	if _, resp := c.Client.ViewChannel("me", &model.ChannelView{
+		ChannelId:     channelId,
+		PrevChannelId: prevChannelId,
+	}); resp.Error != nil {
+		mlog.Error("Unable to view channel.", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// background records that the app is in the background until the given time.
+func (ms *mobileState) background(until time.Time) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.backgroundUntil = until
+}
+
+// backgroundedUntil returns when the app returns to the foreground, if it is in the background.
+func (ms *mobileState) backgroundedUntil() time.Time {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	return ms.backgroundUntil
+}
+
+// actionMobileBackground sends the app to the background, which closes its websocket. The app
+// makes no requests for MobileBackgroundSeconds, after which it reconnects and resynchronizes
+// through actionMobileResume.
+func actionMobileBackground(c *EntityConfig) {
+	if c.WebSocketClient == nil {
+		return
+	}
+
+	c.mobile.background(time.Now().Add(time.Duration(c.LoadTestConfig.UserEntitiesConfiguration.MobileBackgroundSeconds) * time.Second))
+	c.WebSocketClient.Close()
+}
+
+// actionMobileResume synchronizes the app after launching or returning to the foreground.
+func actionMobileResume(c *EntityConfig) {
+	if _, resp := c.Client.GetMe(""); resp.Error != nil {
+		mlog.Error("Failed to get me", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	if _, resp := c.Client.GetTeamsUnreadForUser("me", ""); resp.Error != nil {
+		mlog.Error("Failed to get team unreads", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+
+	for _, team := range c.UserData.Teams {
+		teamId := c.TeamMap[team.Name]
+		if teamId == "" {
+			mlog.Error("Unable to get team from map", mlog.String("team", team.Name))
+			continue
+		}
+
+		if _, resp := c.Client.GetChannelsForTeamForUser(teamId, "me", ""); resp.Error != nil {
+			mlog.Error("Failed to get channels for team", mlog.String("team_id", teamId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		}
+	}
+
+	channelId, lastViewedAt := c.mobile.currentChannel()
+	if channelId == "" {
+		return
+	}
+
+	c.mobile.viewChannel(channelId, model.GetMillis())
+	if _, resp := c.Client.GetPostsSince(channelId, lastViewedAt); resp.Error != nil {
+		mlog.Error("Unable to get posts since", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+var mobileActions = []randutil.Choice{
+	{
+		Item:   actionMobileViewChannel,
+		Weight: 50,
+	},
+	{
+		Item:   actionPost,
+		Weight: 8,
+	},
+	{
+		Item:   actionMobileBackground,
+		Weight: 20,
+	},
+	{
+		Item:   actionGetTeamUnreads,
+		Weight: 10,
+	},
+	{
+		Item:   actionPerformSearch,
+		Weight: 1,
+	},
+	{
+		Item:   actionSearchUser,
+		Weight: 1,
+	},
+}
+
+var mobileIOSUserEntity UserEntity = UserEntity{
+	Name:      "MobileIOS",
+	Actions:   mobileActions,
+	UserAgent: MOBILE_USER_AGENT_IOS,
+	OnConnect: actionMobileResume,
+}
+
+var mobileAndroidUserEntity UserEntity = UserEntity{
+	Name:      "MobileAndroid",
+	Actions:   mobileActions,
+	UserAgent: MOBILE_USER_AGENT_ANDROID,
+	OnConnect: actionMobileResume,
+}
+
+var TestMobile TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         mobileIOSUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 50,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         mobileAndroidUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 50,
+		},
+	},
+}
+
+var TestMixedClients TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         mobileIOSUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 15,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         mobileAndroidUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 15,
+		},
+	},
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// Schemes are listed up to this many at a time, which covers those created by bulkload.
+const SCHEMES_FETCH_SIZE = 100
+
+// Channel members are fetched up to this many at a time when picking one to promote or demote.
+const CHANNEL_ADMIN_MEMBERS_FETCH_SIZE = 100
+
+// CHURNED_PERMISSIONS are granted and revoked by the permission admin. None of them are needed
+// by the other entities, so churning them only costs the server its permission caches.
+var CHURNED_PERMISSIONS = []string{
+	model.PERMISSION_EDIT_OTHERS_POSTS.Id,
+	model.PERMISSION_REMOVE_REACTION.Id,
+	model.PERMISSION_IMPORT_TEAM.Id,
+	model.PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS.Id,
+}
+
+// channelMember identifies a member of a channel.
+type channelMember struct {
+	channelId string
+	userId    string
+}
+
+// permissionChanges remembers the role permissions, schemes and channel admins as they were
+// before the permission admins first changed them, so that they can be restored when the test
+// ends. It is shared by the entities.
+type permissionChanges struct {
+	lock sync.Mutex
+	// rolePermissions maps role ids to their permissions.
+	rolePermissions map[string][]string
+	// teamSchemes and channelSchemes map team and channel ids to the ids of their schemes, which
+	// are empty for the default scheme.
+	teamSchemes    map[string]string
+	channelSchemes map[string]string
+	// channelAdmins tells whether channel members were channel admins.
+	channelAdmins map[channelMember]bool
+}
+
+func (pc *permissionChanges) recordRole(role *model.Role) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.rolePermissions == nil {
+		pc.rolePermissions = make(map[string][]string)
+	}
+	if _, ok := pc.rolePermissions[role.Id]; !ok {
+		pc.rolePermissions[role.Id] = append([]string{}, role.Permissions...)
+	}
+}
+
+// knowsTeamScheme tells whether the original scheme of the team is already recorded.
+func (pc *permissionChanges) knowsTeamScheme(teamId string) bool {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	_, ok := pc.teamSchemes[teamId]
+	return ok
+}
+
+func (pc *permissionChanges) recordTeamScheme(teamId, schemeId string) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.teamSchemes == nil {
+		pc.teamSchemes = make(map[string]string)
+	}
+	if _, ok := pc.teamSchemes[teamId]; !ok {
+		pc.teamSchemes[teamId] = schemeId
+	}
+}
+
+// knowsChannelScheme tells whether the original scheme of the channel is already recorded.
+func (pc *permissionChanges) knowsChannelScheme(channelId string) bool {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	_, ok := pc.channelSchemes[channelId]
+	return ok
+}
+
+func (pc *permissionChanges) recordChannelScheme(channelId, schemeId string) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.channelSchemes == nil {
+		pc.channelSchemes = make(map[string]string)
+	}
+	if _, ok := pc.channelSchemes[channelId]; !ok {
+		pc.channelSchemes[channelId] = schemeId
+	}
+}
+
+func (pc *permissionChanges) recordChannelAdmin(member *model.ChannelMember) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.channelAdmins == nil {
+		pc.channelAdmins = make(map[channelMember]bool)
+	}
+	key := channelMember{member.ChannelId, member.UserId}
+	if _, ok := pc.channelAdmins[key]; !ok {
+		pc.channelAdmins[key] = member.SchemeAdmin
+	}
+}
+
+// schemeIdOf returns the id of a team or channel's scheme, which is empty for the default scheme.
+func schemeIdOf(schemeId *string) string {
+	if schemeId == nil {
+		return ""
+	}
+
+	return *schemeId
+}
+
+// restore undoes the changes made by the permission admins.
+func (pc *permissionChanges) restore(adminClient AdminClient) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	for roleId, permissions := range pc.rolePermissions {
+		permissions := permissions
+		if _, resp := adminClient.PatchRole(roleId, &model.RolePatch{Permissions: &permissions}); resp.Error != nil {
+			mlog.Error("Failed to restore role permissions", mlog.String("role_id", roleId), mlog.Err(resp.Error))
+		}
+	}
+	for teamId, schemeId := range pc.teamSchemes {
+		if _, resp := adminClient.UpdateTeamScheme(teamId, schemeId); resp.Error != nil {
+			mlog.Error("Failed to restore team scheme", mlog.String("team_id", teamId), mlog.String("scheme_id", schemeId), mlog.Err(resp.Error))
+		}
+	}
+	for channelId, schemeId := range pc.channelSchemes {
+		if _, resp := adminClient.UpdateChannelScheme(channelId, schemeId); resp.Error != nil {
+			mlog.Error("Failed to restore channel scheme", mlog.String("channel_id", channelId), mlog.String("scheme_id", schemeId), mlog.Err(resp.Error))
+		}
+	}
+	for member, admin := range pc.channelAdmins {
+		schemeRoles := &model.SchemeRoles{SchemeUser: true, SchemeAdmin: admin}
+		if _, resp := adminClient.UpdateChannelMemberSchemeRoles(member.channelId, member.userId, schemeRoles); resp.Error != nil {
+			mlog.Error("Failed to restore channel member roles", mlog.String("channel_id", member.channelId), mlog.String("user_id", member.userId), mlog.Err(resp.Error))
+		}
+	}
+
+	if len(pc.rolePermissions)+len(pc.teamSchemes)+len(pc.channelSchemes)+len(pc.channelAdmins) > 0 {
+		mlog.Info("Restored permissions",
+			mlog.Int("roles", len(pc.rolePermissions)),
+			mlog.Int("team_schemes", len(pc.teamSchemes)),
+			mlog.Int("channel_schemes", len(pc.channelSchemes)),
+			mlog.Int("channel_admins", len(pc.channelAdmins)),
+		)
+	}
+}
+
+// pickScheme returns a random scheme of the given scope, or no scheme at all, standing for the
+// default scheme, half of the time or when there are none.
+func pickScheme(c *EntityConfig, scope string) (string, bool) {
+	schemes, resp := c.AdminClient.GetSchemes(scope, 0, SCHEMES_FETCH_SIZE)
+	if resp.Error != nil {
+		mlog.Error("Failed to get schemes", mlog.String("scope", scope), mlog.Err(resp.Error))
+		return "", false
+	}
+
+	if len(schemes) == 0 || c.r.Intn(2) == 0 {
+		return "", true
+	}
+
+	return schemes[c.r.Intn(len(schemes))].Id, true
+}
+
+// actionChurnRolePermissions grants or revokes one of the churned permissions on a default role
+// of one of the bulkloaded schemes. The server's built-in roles are left alone, so that a test
+// stopped before restoring permissions leaves no more than the bulkloaded schemes changed.
+func actionChurnRolePermissions(c *EntityConfig) {
+	schemes, resp := c.AdminClient.GetSchemes("", 0, SCHEMES_FETCH_SIZE)
+	if resp.Error != nil {
+		mlog.Error("Failed to get schemes", mlog.Err(resp.Error))
+		return
+	}
+
+	roleNames := []string{}
+	for _, scheme := range schemes {
+		if !strings.HasPrefix(scheme.Name, TEAM_SCHEME_NAME_PREFIX) && !strings.HasPrefix(scheme.Name, CHANNEL_SCHEME_NAME_PREFIX) {
+			continue
+		}
+		for _, roleName := range []string{
+			scheme.DefaultTeamUserRole,
+			scheme.DefaultTeamAdminRole,
+			scheme.DefaultChannelUserRole,
+			scheme.DefaultChannelAdminRole,
+		} {
+			if roleName != "" {
+				roleNames = append(roleNames, roleName)
+			}
+		}
+	}
+	if len(roleNames) == 0 {
+		return
+	}
+	roleName := roleNames[c.r.Intn(len(roleNames))]
+
+	role, resp := c.AdminClient.GetRoleByName(roleName)
+	if resp.Error != nil {
+		mlog.Error("Failed to get role", mlog.String("role_name", roleName), mlog.Err(resp.Error))
+		return
+	}
+
+	c.permissions.recordRole(role)
+
+	churned := CHURNED_PERMISSIONS[c.r.Intn(len(CHURNED_PERMISSIONS))]
+	permissions := []string{}
+	granted := false
+	for _, permission := range role.Permissions {
+		if permission == churned {
+			granted = true
+			continue
+		}
+		permissions = append(permissions, permission)
+	}
+	if !granted {
+		permissions = append(permissions, churned)
+	}
+
+	if _, resp := c.AdminClient.PatchRole(role.Id, &model.RolePatch{Permissions: &permissions}); resp.Error != nil {
+		mlog.Error("Failed to patch role", mlog.String("role_name", roleName), mlog.String("permission", churned), mlog.Err(resp.Error))
+	}
+}
+
+// actionAssignTeamScheme assigns one of the team schemes to one of the entity's teams, or
+// returns it to the default scheme.
+func actionAssignTeamScheme(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+
+	schemeId, ok := pickScheme(c, model.SCHEME_SCOPE_TEAM)
+	if !ok {
+		return
+	}
+
+	if !c.permissions.knowsTeamScheme(teamId) {
+		team, resp := c.AdminClient.GetTeam(teamId, "")
+		if resp.Error != nil {
+			mlog.Error("Failed to get team", mlog.String("team_id", teamId), mlog.Err(resp.Error))
+			return
+		}
+		c.permissions.recordTeamScheme(teamId, schemeIdOf(team.SchemeId))
+	}
+
+	if _, resp := c.AdminClient.UpdateTeamScheme(teamId, schemeId); resp.Error != nil {
+		mlog.Error("Failed to update team scheme", mlog.String("team_id", teamId), mlog.String("scheme_id", schemeId), mlog.Err(resp.Error))
+	}
+}
+
+// actionAssignChannelScheme assigns one of the channel schemes to one of the entity's channels,
+// or returns it to the scheme of its team.
+func actionAssignChannelScheme(c *EntityConfig) {
+	channelId, ok := pickSidebarChannel(c)
+	if !ok {
+		return
+	}
+
+	schemeId, ok := pickScheme(c, model.SCHEME_SCOPE_CHANNEL)
+	if !ok {
+		return
+	}
+
+	if !c.permissions.knowsChannelScheme(channelId) {
+		channel, resp := c.AdminClient.GetChannel(channelId, "")
+		if resp.Error != nil {
+			mlog.Error("Failed to get channel", mlog.String("channel_id", channelId), mlog.Err(resp.Error))
+			return
+		}
+		c.permissions.recordChannelScheme(channelId, schemeIdOf(channel.SchemeId))
+	}
+
+	if _, resp := c.AdminClient.UpdateChannelScheme(channelId, schemeId); resp.Error != nil {
+		mlog.Error("Failed to update channel scheme", mlog.String("channel_id", channelId), mlog.String("scheme_id", schemeId), mlog.Err(resp.Error))
+	}
+}
+
+// actionPromoteDemoteChannelAdmin promotes a member of one of the entity's channels to channel
+// admin, or demotes them if they already are one.
+func actionPromoteDemoteChannelAdmin(c *EntityConfig) {
+	channelId, ok := pickSidebarChannel(c)
+	if !ok {
+		return
+	}
+
+	members, resp := c.Client.GetChannelMembers(channelId, 0, CHANNEL_ADMIN_MEMBERS_FETCH_SIZE, "")
+	if resp.Error != nil {
+		mlog.Error("Failed to get channel members", mlog.String("channel_id", channelId), mlog.Err(resp.Error))
+		return
+	}
+	if members == nil || len(*members) == 0 {
+		return
+	}
+	member := (*members)[c.r.Intn(len(*members))]
+	c.permissions.recordChannelAdmin(&member)
+
+	schemeRoles := &model.SchemeRoles{
+		SchemeUser:  true,
+		SchemeAdmin: !member.SchemeAdmin,
+	}
+	if _, resp := c.AdminClient.UpdateChannelMemberSchemeRoles(channelId, member.UserId, schemeRoles); resp.Error != nil {
+		mlog.Error("Failed to update channel member roles", mlog.String("channel_id", channelId), mlog.String("user_id", member.UserId), mlog.Err(resp.Error))
+	}
+}
+
+// permissionAdminEntity changes permissions as the system admin, invalidating the permission
+// caches of the server. It acts far less often than other entities.
+var permissionAdminEntity UserEntity = UserEntity{
+	Name: "PermissionAdmin",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionChurnRolePermissions,
+			Weight: 3,
+		},
+		{
+			Item:   actionAssignTeamScheme,
+			Weight: 1,
+		},
+		{
+			Item:   actionAssignChannelScheme,
+			Weight: 2,
+		},
+		{
+			Item:   actionPromoteDemoteChannelAdmin,
+			Weight: 3,
+		},
+	},
+}
+
+var TestPermissions TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 95,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         permissionAdminEntity,
+				RateMultiplier: 10.0,
+			},
+			Weight: 5,
+		},
+	},
+}
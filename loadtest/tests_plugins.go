@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+)
+
+// Each entity reads and writes a few keys of its own in the KV store of the load test plugin.
+const PLUGIN_KV_KEYS_PER_ENTITY = 10
+
+func pluginKVPath(c *EntityConfig) string {
+	return fmt.Sprintf("/kv/key%d", c.r.Intn(PLUGIN_KV_KEYS_PER_ENTITY))
+}
+
+// actionPluginKVWrite writes one of the entity's values through the load test plugin.
+func actionPluginKVWrite(c *EntityConfig) {
+	path := pluginKVPath(c)
+	if _, resp := c.Client.DoPluginRequest(http.MethodPost, LOADTEST_PLUGIN_ID, path, []byte(fake.Sentence())); resp.Error != nil {
+		mlog.Error("Failed to write to the plugin KV store", mlog.String("path", path), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionPluginKVRead reads one of the entity's values through the load test plugin. Values not
+// yet written are not found.
+func actionPluginKVRead(c *EntityConfig) {
+	path := pluginKVPath(c)
+	if _, resp := c.Client.DoPluginRequest(http.MethodGet, LOADTEST_PLUGIN_ID, path, nil); resp.Error != nil && resp.StatusCode != http.StatusNotFound {
+		mlog.Error("Failed to read from the plugin KV store", mlog.String("path", path), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionPluginBroadcast asks the load test plugin to publish a websocket event to the entity.
+func actionPluginBroadcast(c *EntityConfig) {
+	if _, resp := c.Client.DoPluginRequest(http.MethodPost, LOADTEST_PLUGIN_ID, "/broadcast", nil); resp.Error != nil {
+		mlog.Error("Failed to broadcast through the plugin", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+var pluginUserEntity UserEntity = UserEntity{
+	Name: "Plugins",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 10,
+		},
+		{
+			// Every post runs through the plugin's MessageWillBePosted hook.
+			Item:   actionPost,
+			Weight: 15,
+		},
+		{
+			Item:   actionPluginKVRead,
+			Weight: 6,
+		},
+		{
+			Item:   actionPluginKVWrite,
+			Weight: 3,
+		},
+		{
+			Item:   actionPluginBroadcast,
+			Weight: 2,
+		},
+	},
+}
+
+var TestPlugins TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         pluginUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// An entity only edits and deletes the posts it made most recently.
+const OWN_POSTS_REMEMBERED = 20
+
+// The webapp fetches saved posts a page at a time.
+const FLAGGED_POSTS_PAGE_SIZE = 20
+
+// ownPost is a post made by the entity, which it may later edit or delete.
+type ownPost struct {
+	Id        string
+	ChannelId string
+	RootId    string
+}
+
+// postState remembers the entity's recent posts, and the posts it has pinned or flagged.
+type postState struct {
+	lock sync.Mutex
+	// own lists the entity's recent posts, oldest first.
+	own     []ownPost
+	pinned  map[string]bool
+	flagged map[string]bool
+}
+
+// rememberOwn records a post the entity made.
+func (ps *postState) rememberOwn(post *model.Post) {
+	if post == nil {
+		return
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.own = append(ps.own, ownPost{
+		Id:        post.Id,
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+	})
+	if len(ps.own) > OWN_POSTS_REMEMBERED {
+		ps.own = ps.own[1:]
+	}
+}
+
+// pickOwn returns one of the entity's recent posts at random.
+func (ps *postState) pickOwn(r *rand.Rand) (ownPost, bool) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if len(ps.own) == 0 {
+		return ownPost{}, false
+	}
+
+	return ps.own[r.Intn(len(ps.own))], true
+}
+
+// forgetOwn drops a post the entity deleted.
+func (ps *postState) forgetOwn(postId string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	for i, post := range ps.own {
+		if post.Id == postId {
+			ps.own = append(ps.own[:i], ps.own[i+1:]...)
+			break
+		}
+	}
+	delete(ps.pinned, postId)
+	delete(ps.flagged, postId)
+}
+
+// setPinned records whether the entity has pinned the given post.
+func (ps *postState) setPinned(postId string, pinned bool) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.pinned == nil {
+		ps.pinned = make(map[string]bool)
+	}
+	ps.pinned[postId] = pinned
+}
+
+func (ps *postState) isPinned(postId string) bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	return ps.pinned[postId]
+}
+
+// setFlagged records whether the entity has flagged the given post.
+func (ps *postState) setFlagged(postId string, flagged bool) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.flagged == nil {
+		ps.flagged = make(map[string]bool)
+	}
+	ps.flagged[postId] = flagged
+}
+
+func (ps *postState) isFlagged(postId string) bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	return ps.flagged[postId]
+}
+
+// actionEditPost edits the message of one of the entity's recent posts.
+func actionEditPost(c *EntityConfig) {
+	post, ok := c.posts.pickOwn(c.r)
+	if !ok {
+		return
+	}
+
+	message := fake.Sentences()
+	if _, resp := c.Client.PatchPost(post.Id, &model.PostPatch{Message: &message}); resp.Error != nil {
+		mlog.Error("Failed to edit post", mlog.String("post_id", post.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionDeletePost deletes one of the entity's recent posts.
+func actionDeletePost(c *EntityConfig) {
+	post, ok := c.posts.pickOwn(c.r)
+	if !ok {
+		return
+	}
+
+	if _, resp := c.Client.DeletePost(post.Id); resp.Error != nil {
+		mlog.Error("Failed to delete post", mlog.String("post_id", post.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.posts.forgetOwn(post.Id)
+	if post.RootId == "" {
+		c.threads.forget(post.ChannelId, post.Id)
+	}
+}
+
+// actionPinPost pins a post the entity has seen to its channel, or unpins it if the entity
+// pinned it before.
+func actionPinPost(c *EntityConfig) {
+	thread, ok := pickThread(c)
+	if !ok {
+		return
+	}
+
+	if c.posts.isPinned(thread.RootId) {
+		if _, resp := c.Client.UnpinPost(thread.RootId); resp.Error != nil {
+			mlog.Error("Failed to unpin post", mlog.String("post_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return
+		}
+		c.posts.setPinned(thread.RootId, false)
+		return
+	}
+
+	if _, resp := c.Client.PinPost(thread.RootId); resp.Error != nil {
+		mlog.Error("Failed to pin post", mlog.String("post_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+	c.posts.setPinned(thread.RootId, true)
+}
+
+// actionGetPinnedPosts opens the pinned posts of a random channel.
+func actionGetPinnedPosts(c *EntityConfig) {
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return
+	}
+
+	if _, resp := c.Client.GetPinnedPosts(channelId, ""); resp.Error != nil {
+		mlog.Error("Failed to get pinned posts", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionFlagPost flags a post the entity has seen, or unflags it if the entity flagged it before.
+// Flags are stored as preferences, like the webapp does.
+func actionFlagPost(c *EntityConfig) {
+	thread, ok := pickThread(c)
+	if !ok {
+		return
+	}
+
+	userId, ok := ownUserId(c)
+	if !ok {
+		return
+	}
+
+	preferences := &model.Preferences{{
+		UserId:   userId,
+		Category: model.PREFERENCE_CATEGORY_FLAGGED_POST,
+		Name:     thread.RootId,
+		Value:    "true",
+	}}
+
+	if c.posts.isFlagged(thread.RootId) {
+		if _, resp := c.Client.DeletePreferences(userId, preferences); resp.Error != nil {
+			mlog.Error("Failed to unflag post", mlog.String("post_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return
+		}
+		c.posts.setFlagged(thread.RootId, false)
+		return
+	}
+
+	if _, resp := c.Client.UpdatePreferences(userId, preferences); resp.Error != nil {
+		mlog.Error("Failed to flag post", mlog.String("post_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+	c.posts.setFlagged(thread.RootId, true)
+}
+
+// actionGetFlaggedPosts opens the entity's saved posts.
+func actionGetFlaggedPosts(c *EntityConfig) {
+	if _, resp := c.Client.GetFlaggedPostsForUser("me", 0, FLAGGED_POSTS_PAGE_SIZE); resp.Error != nil {
+		mlog.Error("Failed to get flagged posts", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+var postLifecycleUserEntity UserEntity = UserEntity{
+	Name: "PostLifecycle",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 20,
+		},
+		{
+			Item:   actionPost,
+			Weight: 10,
+		},
+		{
+			Item:   actionEditPost,
+			Weight: 5,
+		},
+		{
+			Item:   actionDeletePost,
+			Weight: 2,
+		},
+		{
+			Item:   actionPinPost,
+			Weight: 2,
+		},
+		{
+			Item:   actionGetPinnedPosts,
+			Weight: 4,
+		},
+		{
+			Item:   actionFlagPost,
+			Weight: 3,
+		},
+		{
+			Item:   actionGetFlaggedPosts,
+			Weight: 4,
+		},
+	},
+}
+
+var TestPostLifecycle TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         postLifecycleUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"sync"
+
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The webapp loads this many users at a time in the more direct messages dialog.
+const MORE_DIRECT_MESSAGES_PAGE_SIZE = 100
+
+// SIDEBAR_CUSTOM_CATEGORY_NAME names the custom sidebar category entities move channels into.
+const SIDEBAR_CUSTOM_CATEGORY_NAME = "Load Test"
+
+// The notification levels entities pick from for desktop and push notifications, and for email.
+var CHANNEL_NOTIFY_LEVELS = []string{model.CHANNEL_NOTIFY_DEFAULT, model.CHANNEL_NOTIFY_ALL, model.CHANNEL_NOTIFY_MENTION, model.CHANNEL_NOTIFY_NONE}
+var CHANNEL_EMAIL_NOTIFY_LEVELS = []string{model.CHANNEL_NOTIFY_DEFAULT, "true", "false"}
+
+// sidebarState remembers the channels the entity has favorited or muted.
+type sidebarState struct {
+	lock      sync.Mutex
+	favorites map[string]bool
+	muted     map[string]bool
+}
+
+func (ss *sidebarState) setFavorite(channelId string, favorite bool) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.favorites == nil {
+		ss.favorites = make(map[string]bool)
+	}
+	ss.favorites[channelId] = favorite
+}
+
+func (ss *sidebarState) isFavorite(channelId string) bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	return ss.favorites[channelId]
+}
+
+func (ss *sidebarState) setMuted(channelId string, muted bool) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.muted == nil {
+		ss.muted = make(map[string]bool)
+	}
+	ss.muted[channelId] = muted
+}
+
+func (ss *sidebarState) isMuted(channelId string) bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	return ss.muted[channelId]
+}
+
+// pickSidebarChannel picks one of the entity's channels.
+func pickSidebarChannel(c *EntityConfig) (string, bool) {
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return "", false
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return "", false
+	}
+
+	return channelId, true
+}
+
+// actionFavoriteChannel favorites one of the entity's channels, or unfavorites it if the entity
+// favorited it before. Favorites are stored as preferences, like the webapp does.
+func actionFavoriteChannel(c *EntityConfig) {
+	channelId, ok := pickSidebarChannel(c)
+	if !ok {
+		return
+	}
+
+	userId, ok := ownUserId(c)
+	if !ok {
+		return
+	}
+
+	preferences := &model.Preferences{{
+		UserId:   userId,
+		Category: model.PREFERENCE_CATEGORY_FAVORITE_CHANNEL,
+		Name:     channelId,
+		Value:    "true",
+	}}
+
+	if c.sidebar.isFavorite(channelId) {
+		if _, resp := c.Client.DeletePreferences(userId, preferences); resp.Error != nil {
+			mlog.Error("Failed to unfavorite channel", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return
+		}
+		c.sidebar.setFavorite(channelId, false)
+		return
+	}
+
+	if _, resp := c.Client.UpdatePreferences(userId, preferences); resp.Error != nil {
+		mlog.Error("Failed to favorite channel", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+	c.sidebar.setFavorite(channelId, true)
+}
+
+// actionMuteChannel mutes one of the entity's channels, or unmutes it if the entity muted it
+// before.
+func actionMuteChannel(c *EntityConfig) {
+	channelId, ok := pickSidebarChannel(c)
+	if !ok {
+		return
+	}
+
+	muted := !c.sidebar.isMuted(channelId)
+	markUnread := model.CHANNEL_MARK_UNREAD_MENTION
+	if !muted {
+		markUnread = model.CHANNEL_MARK_UNREAD_ALL
+	}
+
+	if _, resp := c.Client.UpdateChannelNotifyProps(channelId, "me", map[string]string{model.MARK_UNREAD_NOTIFY_PROP: markUnread}); resp.Error != nil {
+		mlog.Error("Failed to mute channel", mlog.String("channel_id", channelId), mlog.Bool("muted", muted), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+	c.sidebar.setMuted(channelId, muted)
+}
+
+// actionUpdateChannelNotifyProps changes how the entity is notified of posts in one of its
+// channels.
+func actionUpdateChannelNotifyProps(c *EntityConfig) {
+	channelId, ok := pickSidebarChannel(c)
+	if !ok {
+		return
+	}
+
+	props := map[string]string{
+		model.DESKTOP_NOTIFY_PROP: CHANNEL_NOTIFY_LEVELS[c.r.Intn(len(CHANNEL_NOTIFY_LEVELS))],
+		model.PUSH_NOTIFY_PROP:    CHANNEL_NOTIFY_LEVELS[c.r.Intn(len(CHANNEL_NOTIFY_LEVELS))],
+		model.EMAIL_NOTIFY_PROP:   CHANNEL_EMAIL_NOTIFY_LEVELS[c.r.Intn(len(CHANNEL_EMAIL_NOTIFY_LEVELS))],
+	}
+	if _, resp := c.Client.UpdateChannelNotifyProps(channelId, "me", props); resp.Error != nil {
+		mlog.Error("Failed to update channel notify props", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionMarkChannelRead marks one of the entity's channels as read from the sidebar, without
+// opening it.
+func actionMarkChannelRead(c *EntityConfig) {
+	channelId, ok := pickSidebarChannel(c)
+	if !ok {
+		return
+	}
+
+	if _, resp := c.Client.ViewChannel("me", &model.ChannelView{ChannelId: channelId}); resp.Error != nil {
+		mlog.Error("Failed to mark channel read", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// getSidebarCategories gets the entity's sidebar categories in one of its teams.
+func getSidebarCategories(c *EntityConfig) (string, *OrderedSidebarCategories, bool) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return "", nil, false
+	}
+	teamId := c.TeamMap[team.Name]
+
+	categories, resp := c.Client.GetSidebarCategoriesForTeamForUser("me", teamId, "")
+	if resp.Error != nil {
+		mlog.Error("Failed to get sidebar categories", mlog.String("team_id", teamId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return "", nil, false
+	}
+
+	return teamId, categories, true
+}
+
+// actionReorderSidebarCategories moves one of the entity's sidebar categories in one of its teams.
+func actionReorderSidebarCategories(c *EntityConfig) {
+	teamId, categories, ok := getSidebarCategories(c)
+	if !ok || len(categories.Order) < 2 {
+		return
+	}
+
+	order := make([]string, 0, len(categories.Order))
+	from := c.r.Intn(len(categories.Order))
+	for i, categoryId := range categories.Order {
+		if i != from {
+			order = append(order, categoryId)
+		}
+	}
+	to := c.r.Intn(len(order) + 1)
+	order = append(order[:to], append([]string{categories.Order[from]}, order[to:]...)...)
+
+	if _, resp := c.Client.UpdateSidebarCategoryOrderForTeamForUser("me", teamId, order); resp.Error != nil {
+		mlog.Error("Failed to reorder sidebar categories", mlog.String("team_id", teamId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionMoveChannelToCategory moves one of the entity's channels into its favorites or its custom
+// sidebar category in one of its teams, creating the custom category first if necessary.
+func actionMoveChannelToCategory(c *EntityConfig) {
+	teamId, categories, ok := getSidebarCategories(c)
+	if !ok || len(categories.Categories) == 0 {
+		return
+	}
+
+	// Channels of any type may be moved into these categories.
+	destinations := []*SidebarCategoryWithChannels{}
+	for _, category := range categories.Categories {
+		if category.Type == SIDEBAR_CATEGORY_CUSTOM || category.Type == SIDEBAR_CATEGORY_FAVORITES {
+			destinations = append(destinations, category)
+		}
+	}
+	if len(destinations) < 2 {
+		category, resp := c.Client.CreateSidebarCategoryForTeamForUser("me", teamId, &SidebarCategoryWithChannels{
+			SidebarCategory: SidebarCategory{
+				UserId:      categories.Categories[0].UserId,
+				TeamId:      teamId,
+				Type:        SIDEBAR_CATEGORY_CUSTOM,
+				DisplayName: SIDEBAR_CUSTOM_CATEGORY_NAME,
+			},
+			Channels: []string{},
+		})
+		if resp.Error != nil {
+			mlog.Error("Failed to create sidebar category", mlog.String("team_id", teamId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return
+		}
+		categories.Categories = append(categories.Categories, category)
+		destinations = append(destinations, category)
+	}
+	destination := destinations[c.r.Intn(len(destinations))]
+
+	sources := []*SidebarCategoryWithChannels{}
+	for _, category := range categories.Categories {
+		if category.Id != destination.Id && len(category.Channels) > 0 {
+			sources = append(sources, category)
+		}
+	}
+	if len(sources) == 0 {
+		return
+	}
+	source := sources[c.r.Intn(len(sources))]
+	channelId := source.Channels[c.r.Intn(len(source.Channels))]
+
+	updatedSource := *source
+	updatedSource.Channels = make([]string, 0, len(source.Channels)-1)
+	for _, id := range source.Channels {
+		if id != channelId {
+			updatedSource.Channels = append(updatedSource.Channels, id)
+		}
+	}
+	updatedDestination := *destination
+	updatedDestination.Channels = append([]string{channelId}, destination.Channels...)
+
+	if _, resp := c.Client.UpdateSidebarCategoriesForTeamForUser("me", teamId, []*SidebarCategoryWithChannels{&updatedSource, &updatedDestination}); resp.Error != nil {
+		mlog.Error("Failed to move channel to sidebar category", mlog.String("channel_id", channelId), mlog.String("category_id", destination.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionOpenMoreDirectMessages opens the dialog for starting direct messages, which lists users
+// with their statuses, and searches it for another user.
+func actionOpenMoreDirectMessages(c *EntityConfig) {
+	users, resp := c.Client.GetUsers(0, MORE_DIRECT_MESSAGES_PAGE_SIZE, "")
+	if resp.Error != nil {
+		mlog.Error("Failed to get users", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	if len(users) > 0 {
+		userIds := make([]string, len(users))
+		for i, user := range users {
+			userIds[i] = user.Id
+		}
+		if _, resp := c.Client.GetUsersStatusesByIds(userIds); resp.Error != nil {
+			mlog.Error("Failed to get user statuses", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		}
+	}
+
+	if len(c.Users) == 0 {
+		return
+	}
+	term := c.Users[c.r.Intn(len(c.Users))].Username
+	if len(term) > 3 {
+		term = term[:3]
+	}
+	if _, resp := c.Client.SearchUsers(&model.UserSearch{Term: term, Limit: MORE_DIRECT_MESSAGES_PAGE_SIZE}); resp.Error != nil {
+		mlog.Error("Failed to search users", mlog.String("term", term), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+var sidebarUserEntity UserEntity = UserEntity{
+	Name: "Sidebar",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 10,
+		},
+		{
+			Item:   actionPost,
+			Weight: 6,
+		},
+		{
+			Item:   actionMarkChannelRead,
+			Weight: 4,
+		},
+		{
+			Item:   actionFavoriteChannel,
+			Weight: 3,
+		},
+		{
+			Item:   actionMuteChannel,
+			Weight: 2,
+		},
+		{
+			Item:   actionMoveChannelToCategory,
+			Weight: 2,
+		},
+		{
+			Item:   actionOpenMoreDirectMessages,
+			Weight: 2,
+		},
+		{
+			Item:   actionUpdateChannelNotifyProps,
+			Weight: 1,
+		},
+		{
+			Item:   actionReorderSidebarCategories,
+			Weight: 1,
+		},
+	},
+}
+
+var TestSidebar TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         sidebarUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The statuses users set themselves, weighted by how often they do.
+var USER_STATUS_CHOICES = []randutil.Choice{
+	{Item: model.STATUS_ONLINE, Weight: 6},
+	{Item: model.STATUS_AWAY, Weight: 3},
+	{Item: model.STATUS_DND, Weight: 1},
+}
+
+// The emoji of the custom statuses set by entities.
+var CUSTOM_STATUS_EMOJI = []string{"calendar", "house", "palm_tree", "car", "hamburger", "speech_balloon"}
+
+// The server limits the text of custom statuses to this many characters.
+const CUSTOM_STATUS_TEXT_MAX_RUNES = 100
+
+// statusState remembers the users whose statuses the entity polls.
+type statusState struct {
+	lock    sync.Mutex
+	userIds []string
+}
+
+// Entities type messages at this many characters per second.
+const TYPING_CHARACTERS_PER_SECOND = 8
+
+// The webapp sends user_typing events at most this often while a message is typed.
+const TYPING_EVENT_INTERVAL = 5 * time.Second
+
+// Typing a longer message is taken to stop after this long, as if the rest was pasted.
+const TYPING_MAX_DURATION = 15 * time.Second
+
+// sendTyping sends the user_typing events of typing the message into the given channel or
+// thread over the entity's websocket. The events are sent in the background for as long as typing
+// the message takes, or until the entity is stopped, without holding up the action.
+func sendTyping(c *EntityConfig, channelId, parentId, message string) {
+	perEvent := c.LoadTestConfig.UserEntitiesConfiguration.TypingCharactersPerEvent
+	if perEvent <= 0 || c.WebSocketClient == nil {
+		return
+	}
+
+	stop := c.StopChannel
+	go typeMessage(c.WebSocketClient, perEvent, channelId, parentId, message, func(d time.Duration) bool {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	})
+}
+
+// typeMessage sends a user_typing event for every perEvent characters typed, but no more often
+// than the webapp does, waiting for as long as typing the message takes. It stops early once wait
+// returns false.
+func typeMessage(webSocketClient WebSocketClient, perEvent int, channelId, parentId, message string, wait func(time.Duration) bool) {
+	duration := time.Duration(len(message)) * time.Second / TYPING_CHARACTERS_PER_SECOND
+	if duration > TYPING_MAX_DURATION {
+		duration = TYPING_MAX_DURATION
+	}
+	interval := time.Duration(perEvent) * time.Second / TYPING_CHARACTERS_PER_SECOND
+	if interval < TYPING_EVENT_INTERVAL {
+		interval = TYPING_EVENT_INTERVAL
+	}
+
+	for typed := time.Duration(0); ; typed += interval {
+		webSocketClient.UserTyping(channelId, parentId)
+		if typed+interval >= duration {
+			wait(duration - typed)
+			return
+		}
+		if !wait(interval) {
+			return
+		}
+	}
+}
+
+// actionUpdateStatus sets the entity's status to online, away or do not disturb.
+func actionUpdateStatus(c *EntityConfig) {
+	choice, err := randutil.WeightedChoice(c.r, USER_STATUS_CHOICES)
+	if err != nil {
+		mlog.Error("Unable to pick status", mlog.Err(err))
+		return
+	}
+
+	userId, ok := ownUserId(c)
+	if !ok {
+		return
+	}
+
+	status := &model.Status{UserId: userId, Status: choice.Item.(string), Manual: true}
+	if _, resp := c.Client.UpdateUserStatus(userId, status); resp.Error != nil {
+		mlog.Error("Failed to update status", mlog.String("username", c.UserData.Username), mlog.String("status", status.Status), mlog.Err(resp.Error))
+	}
+}
+
+// actionUpdateCustomStatus sets the entity's custom status, or clears it.
+func actionUpdateCustomStatus(c *EntityConfig) {
+	if rand.Float64() < c.LoadTestConfig.UserEntitiesConfiguration.CustomStatusClearChance {
+		if _, resp := c.Client.RemoveUserCustomStatus("me"); resp.Error != nil {
+			mlog.Error("Failed to clear custom status", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		}
+		return
+	}
+
+	text := []rune(fake.Sentence())
+	if len(text) > CUSTOM_STATUS_TEXT_MAX_RUNES {
+		text = text[:CUSTOM_STATUS_TEXT_MAX_RUNES]
+	}
+	customStatus := &CustomStatus{
+		Emoji: CUSTOM_STATUS_EMOJI[c.r.Intn(len(CUSTOM_STATUS_EMOJI))],
+		Text:  string(text),
+	}
+	if _, resp := c.Client.UpdateUserCustomStatus("me", customStatus); resp.Error != nil {
+		mlog.Error("Failed to update custom status", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionGetStatusesWebsocket requests the same statuses as actionGetStatuses over the websocket.
+// The statuses arrive as a response, which is not waited for.
+func actionGetStatusesWebsocket(c *EntityConfig) {
+	if c.WebSocketClient == nil {
+		return
+	}
+
+	ids, ok := statusUserIds(c)
+	if !ok {
+		return
+	}
+
+	c.WebSocketClient.GetStatusesByIds(ids)
+}
+
+var statusUserEntity UserEntity = UserEntity{
+	Name: "Status",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 8,
+		},
+		{
+			Item:   actionPost,
+			Weight: 8,
+		},
+		{
+			Item:   actionUpdateStatus,
+			Weight: 4,
+		},
+		{
+			Item:   actionUpdateCustomStatus,
+			Weight: 2,
+		},
+		{
+			Item:   actionGetStatusesWebsocket,
+			Weight: 2,
+		},
+	},
+}
+
+var TestStatuses TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         statusUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 30,
+		},
+	},
+}
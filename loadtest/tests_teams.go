@@ -0,0 +1,233 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// The webapp loads this many teams at a time when browsing the teams a user can join.
+const TEAMS_FETCH_SIZE = 50
+
+// Each email invitation is sent to this many addresses.
+const TEAM_EMAIL_INVITES_PER_REQUEST = 3
+
+// Team icons are generated at roughly this size in bytes.
+const TEAM_ICON_BYTES = 32 * 1024
+
+// actionBrowseOpenTeams scrolls through the teams the entity can join, as when selecting a team.
+func actionBrowseOpenTeams(c *EntityConfig) {
+	for page := 0; ; page++ {
+		teams, resp := c.Client.GetAllTeams("", page, TEAMS_FETCH_SIZE)
+		if resp.Error != nil {
+			mlog.Error("Failed to get teams", mlog.Int("page", page), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return
+		}
+
+		// 30% chance of continuing to scroll to next page.
+		if len(teams) < TEAMS_FETCH_SIZE || rand.Float64() > 0.30 {
+			return
+		}
+
+		c.sleep(time.Millisecond * 1000)
+	}
+}
+
+// actionGetTeamInviteInfo looks up one of the entity's teams by its invite id, as the page
+// opened by an invite link does.
+func actionGetTeamInviteInfo(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+
+	got, resp := c.Client.GetTeam(teamId, "")
+	if resp.Error != nil {
+		mlog.Error("Failed to get team", mlog.String("team_id", teamId), mlog.Err(resp.Error))
+		return
+	}
+
+	if _, resp := c.Client.GetTeamInviteInfo(got.InviteId); resp.Error != nil {
+		mlog.Error("Failed to get team invite info", mlog.String("team_id", teamId), mlog.String("invite_id", got.InviteId), mlog.Err(resp.Error))
+	}
+}
+
+// actionInviteUsersToTeam invites a few new addresses to one of the entity's teams by email.
+// Invitations are only sent when the server sends email through the loadtest agent.
+func actionInviteUsersToTeam(c *EntityConfig) {
+	if c.LoadTestConfig.ConnectionConfiguration.SMTPServerAddress == "" {
+		return
+	}
+
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+
+	emails := make([]string, TEAM_EMAIL_INVITES_PER_REQUEST)
+	for i := range emails {
+		emails[i] = fmt.Sprintf("success+invite%s@simulator.amazonses.com", model.NewId())
+	}
+
+	if _, resp := c.Client.InviteUsersToTeam(teamId, emails); resp.Error != nil {
+		mlog.Error("Failed to invite users to team", mlog.String("team_id", teamId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionCreateArchiveTeam creates a team of the entity's own, which makes it the team's admin,
+// and archives it again.
+func actionCreateArchiveTeam(c *EntityConfig) {
+	team, resp := c.Client.CreateTeam(&model.Team{
+		Name:        "loadtest-" + model.NewId(),
+		DisplayName: fake.Company(),
+		Type:        model.TEAM_OPEN,
+	})
+	if resp.Error != nil {
+		mlog.Error("Failed to create team", mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	if _, resp := c.Client.SoftDeleteTeam(team.Id); resp.Error != nil {
+		mlog.Error("Failed to archive team", mlog.String("team_id", team.Id), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionUpdateTeam changes the description of one of the entity's teams as the system admin.
+// Settings affecting who may join are left alone.
+func actionUpdateTeam(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+
+	description := fake.Sentence()
+	if len(description) > model.TEAM_DESCRIPTION_MAX_LENGTH {
+		description = description[:model.TEAM_DESCRIPTION_MAX_LENGTH]
+	}
+	if _, resp := c.AdminClient.PatchTeam(teamId, &model.TeamPatch{Description: &description}); resp.Error != nil {
+		mlog.Error("Failed to update team", mlog.String("team_id", teamId), mlog.Err(resp.Error))
+	}
+}
+
+// actionSetTeamIcon uploads a new icon for one of the entity's teams as the system admin.
+func actionSetTeamIcon(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+
+	data, err := generateImage(c.r, FILE_TYPE_PNG, TEAM_ICON_BYTES)
+	if err != nil {
+		mlog.Error("Failed to generate team icon", mlog.Err(err))
+		return
+	}
+
+	if _, resp := c.AdminClient.SetTeamIcon(teamId, data); resp.Error != nil {
+		mlog.Error("Failed to set team icon", mlog.String("team_id", teamId), mlog.Err(resp.Error))
+	}
+}
+
+// actionRegenerateTeamInviteId invalidates the invite links of one of the entity's teams as the
+// system admin. Entities joining by invite id look it up just before joining.
+func actionRegenerateTeamInviteId(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+
+	if _, resp := c.AdminClient.RegenerateTeamInviteId(teamId); resp.Error != nil {
+		mlog.Error("Failed to regenerate team invite id", mlog.String("team_id", teamId), mlog.Err(resp.Error))
+	}
+}
+
+var teamUserEntity UserEntity = UserEntity{
+	Name: "Teams",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 10,
+		},
+		{
+			Item:   actionPost,
+			Weight: 6,
+		},
+		{
+			Item:   actionBrowseOpenTeams,
+			Weight: 3,
+		},
+		{
+			Item:   actionGetTeamInviteInfo,
+			Weight: 2,
+		},
+		{
+			Item:   actionInviteUsersToTeam,
+			Weight: 2,
+		},
+		{
+			Item:   actionLeaveJoinTeam,
+			Weight: 1,
+		},
+	},
+}
+
+// teamAdminEntity manages teams. It acts far less often than other entities.
+var teamAdminEntity UserEntity = UserEntity{
+	Name: "TeamAdmin",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionCreateArchiveTeam,
+			Weight: 2,
+		},
+		{
+			Item:   actionUpdateTeam,
+			Weight: 2,
+		},
+		{
+			Item:   actionSetTeamIcon,
+			Weight: 1,
+		},
+		{
+			Item:   actionRegenerateTeamInviteId,
+			Weight: 1,
+		},
+	},
+}
+
+var TestTeams TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 70,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         teamUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 25,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         teamAdminEntity,
+				RateMultiplier: 10.0,
+			},
+			Weight: 5,
+		},
+	},
+}
@@ -0,0 +1,2001 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEntityConfig returns an entity belonging to a single team with a single channel,
+// backed by mock clients. All chances are zero, so actions take their most direct path.
+func newTestEntityConfig() (*EntityConfig, *mockClient, *mockClient, *mockWebSocketClient) {
+	client := newMockClient()
+	adminClient := newMockClient()
+	webSocketClient := newMockWebSocketClient()
+
+	cfg := &LoadTestConfig{}
+	cfg.LoadtestEnviromentConfig.NumUsers = 2
+	cfg.LoadtestEnviromentConfig.NumEmoji = 2
+
+	userData := UserImportData{
+		Username: "user0",
+		Email:    "success+user0@simulator.amazonses.com",
+		Password: "Loadtestpassword1@#%",
+		Teams: []UserTeamImportData{
+			{
+				Name:          "team0",
+				Channels:      []UserChannelImportData{{Name: "channel0"}},
+				ChannelChoice: []randutil.Choice{{Item: 0, Weight: 1}},
+			},
+		},
+		TeamChoice: []randutil.Choice{{Item: 0, Weight: 1}},
+	}
+
+	return &EntityConfig{
+		EntityNumber:    0,
+		EntityName:      "Test",
+		UserData:        userData,
+		Users:           []UserImportData{userData, {Username: "user1"}},
+		ChannelMap:      map[string]map[string]string{"team0": {"channel0": "channelid0", "town-square": "townsquareid0"}},
+		TeamMap:         map[string]string{"team0": "teamid0"},
+		TownSquareMap:   map[string]string{"team0": "townsquareid0"},
+		Client:          client,
+		AdminClient:     adminClient,
+		WebSocketClient: webSocketClient,
+		LoadTestConfig:  cfg,
+		r:               rand.New(rand.NewSource(1)),
+		entityState:     &entityState{},
+		permissions:     &permissionChanges{},
+	}, client, adminClient, webSocketClient
+}
+
+func TestActions(t *testing.T) {
+	me := &model.User{Id: "userid0", Username: "user0", Email: "success+user0@simulator.amazonses.com"}
+	post := &model.Post{Id: "postid0", ChannelId: "channelid0", UserId: "userid0"}
+
+	testCases := []struct {
+		Name   string
+		Action func(*EntityConfig)
+		Setup  func(c *EntityConfig, client, adminClient *mockClient)
+		// ExpectedCalls lists the methods called on the user client, in order.
+		ExpectedCalls []string
+		// ExpectedAdminCalls lists the methods called on the admin client, in order.
+		ExpectedAdminCalls []string
+		// Check makes additional assertions after the action has run.
+		Check func(t *testing.T, c *EntityConfig, client, adminClient *mockClient)
+	}{
+		{
+			Name:   "get statuses seeds user ids from channel members",
+			Action: actionGetStatuses,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetChannelMembers"] = &model.ChannelMembers{{UserId: "userid0"}, {UserId: "userid1"}}
+			},
+			ExpectedCalls: []string{"GetChannelMembers", "GetUsersStatusesByIds"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{[]string{"userid0", "userid1"}}, client.Calls()[1].Args)
+			},
+		},
+		{
+			Name:   "get statuses reuses seeded user ids",
+			Action: actionGetStatuses,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.statuses.userIds = []string{"userid1"}
+			},
+			ExpectedCalls: []string{"GetUsersStatusesByIds"},
+		},
+		{
+			Name:   "get statuses fails to get channel members",
+			Action: actionGetStatuses,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetChannelMembers")
+			},
+			ExpectedCalls: []string{"GetChannelMembers"},
+		},
+		{
+			Name:   "leave and rejoin channel",
+			Action: actionLeaveJoinChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "GetChannel", "RemoveUserFromChannel", "AddChannelMember"},
+		},
+		{
+			Name:   "leave and rejoin channel fails to get channel",
+			Action: actionLeaveJoinChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+				client.fail("GetChannel")
+			},
+			ExpectedCalls: []string{"GetMe", "GetChannel"},
+		},
+		{
+			Name:   "leave and rejoin team fails to leave",
+			Action: actionLeaveJoinTeam,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+				client.Returns["GetTeam"] = &model.Team{Id: "teamid0", InviteId: "inviteid0"}
+				client.fail("RemoveTeamMember")
+			},
+			ExpectedCalls: []string{"GetMe", "GetTeam", "RemoveTeamMember"},
+		},
+		{
+			Name:   "post to town square",
+			Action: actionPostToTownSquare,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["CreatePost"] = post
+			},
+			ExpectedCalls: []string{"CreatePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "townsquareid0", client.Calls()[0].Args[0].(*model.Post).ChannelId)
+			},
+		},
+		{
+			Name:   "post with reaction",
+			Action: actionPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.SystemEmojiReactionChance = 1
+				client.Returns["CreatePost"] = post
+			},
+			ExpectedCalls: []string{"CreatePost", "SaveReaction"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "channelid0", client.Calls()[0].Args[0].(*model.Post).ChannelId)
+				assert.Equal(t, "smile", client.Calls()[1].Args[0].(*model.Reaction).EmojiName)
+			},
+		},
+		{
+			Name:   "post triggering outgoing webhook reply",
+			Action: actionPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.OutgoingWebhookChance = 1
+				c.LoadTestConfig.UserEntitiesConfiguration.OutgoingWebhookReplyChance = 1
+				client.Returns["CreatePost"] = post
+			},
+			ExpectedCalls: []string{"CreatePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				message := client.Calls()[0].Args[0].(*model.Post).Message
+				assert.Equal(t, OUTGOING_WEBHOOK_TRIGGER_REPLY, strings.Fields(message)[0])
+			},
+		},
+		{
+			Name:   "post failure skips reaction",
+			Action: actionPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.SystemEmojiReactionChance = 1
+				client.fail("CreatePost")
+			},
+			ExpectedCalls: []string{"CreatePost"},
+		},
+		{
+			Name:   "post to channel missing from the channel map",
+			Action: actionPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				delete(c.ChannelMap["team0"], "channel0")
+				adminClient.Returns["GetChannelByName"] = &model.Channel{Id: "channelid0"}
+				client.Returns["CreatePost"] = post
+			},
+			ExpectedCalls:      []string{"CreatePost"},
+			ExpectedAdminCalls: []string{"GetChannelByName"},
+		},
+		{
+			Name:   "create and delete public channel",
+			Action: actionCreateDeleteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.PublicChannelCreationChance = 1
+				client.Returns["GetMe"] = me
+				client.Returns["CreateChannel"] = &model.Channel{Id: "newchannelid", Type: model.CHANNEL_OPEN}
+			},
+			ExpectedCalls: []string{"GetMe", "CreateChannel", "DeleteChannel"},
+		},
+		{
+			Name:   "create direct channel",
+			Action: actionCreateDeleteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.Users = c.Users[1:]
+				c.LoadTestConfig.UserEntitiesConfiguration.DirectChannelCreationChance = 1
+				client.Returns["GetMe"] = me
+				client.Returns["SearchUsers"] = []*model.User{{Id: "userid1"}}
+				client.Returns["CreateDirectChannel"] = &model.Channel{Id: "directchannelid", Type: model.CHANNEL_DIRECT}
+			},
+			ExpectedCalls: []string{"GetMe", "SearchUsers", "CreateDirectChannel"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"userid0", "userid1"}, client.Calls()[2].Args)
+			},
+		},
+		{
+			Name:   "create channel failure skips delete",
+			Action: actionCreateDeleteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.PrivateChannelCreationChance = 1
+				client.Returns["GetMe"] = me
+				client.fail("CreateChannel")
+			},
+			ExpectedCalls: []string{"GetMe", "CreateChannel"},
+		},
+		{
+			Name:   "post reactions",
+			Action: actionPostReactions,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.NumPostReactionsPerUser = 2
+				client.Returns["GetMe"] = me
+				client.Returns["GetChannelsForTeamForUser"] = []*model.Channel{{Id: "channelid0"}}
+				client.Returns["GetPostsForChannel"] = &model.PostList{Order: []string{"postid0"}}
+			},
+			ExpectedCalls: []string{"GetMe", "GetChannelsForTeamForUser", "GetPostsForChannel", "SaveReaction", "SaveReaction"},
+		},
+		{
+			Name:   "post reactions fails to get channels",
+			Action: actionPostReactions,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+				client.fail("GetChannelsForTeamForUser")
+			},
+			ExpectedCalls: []string{"GetMe", "GetChannelsForTeamForUser"},
+		},
+		{
+			Name:   "get channel fetches reactions, files and thumbnails",
+			Action: actionGetChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetPostsForChannel"] = &model.PostList{
+					Order: []string{"postid0"},
+					Posts: map[string]*model.Post{
+						"postid0": {Id: "postid0", HasReactions: true, FileIds: []string{"fileid0"}},
+					},
+				}
+				client.Returns["GetFileInfosForPost"] = []*model.FileInfo{{Id: "fileid0", MimeType: "image/png"}}
+			},
+			ExpectedCalls: []string{
+				"ViewChannel", "GetChannelMember", "GetChannelMembers", "GetChannelStats", "ViewChannel",
+				"GetPostsForChannel", "GetReactions", "GetFileInfosForPost", "GetFileThumbnail",
+			},
+		},
+		{
+			Name:   "get channel fails to get posts",
+			Action: actionGetChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetPostsForChannel")
+			},
+			ExpectedCalls: []string{
+				"ViewChannel", "GetChannelMember", "GetChannelMembers", "GetChannelStats", "ViewChannel",
+				"GetPostsForChannel",
+			},
+		},
+		{
+			Name:          "perform search",
+			Action:        actionPerformSearch,
+			ExpectedCalls: []string{"SearchPosts"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "teamid0", client.Calls()[0].Args[0])
+			},
+		},
+		{
+			Name:   "get posts before and after a search result",
+			Action: actionGetPostsBeforeAfter,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["SearchPosts"] = &model.PostList{
+					Order: []string{"postid0"},
+					Posts: map[string]*model.Post{"postid0": post},
+				}
+			},
+			ExpectedCalls: []string{"SearchPosts", "GetPostsBefore", "GetPostsAfter"},
+		},
+		{
+			Name:   "get posts before failure skips after",
+			Action: actionGetPostsBeforeAfter,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["SearchPosts"] = &model.PostList{
+					Order: []string{"postid0"},
+					Posts: map[string]*model.Post{"postid0": post},
+				}
+				client.fail("GetPostsBefore")
+			},
+			ExpectedCalls: []string{"SearchPosts", "GetPostsBefore"},
+		},
+		{
+			Name:   "get posts before and after fails to search",
+			Action: actionGetPostsBeforeAfter,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("SearchPosts")
+			},
+			ExpectedCalls: []string{"SearchPosts"},
+		},
+		{
+			Name:   "autocomplete channel",
+			Action: actionAutocompleteChannel,
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				for _, method := range client.Methods() {
+					assert.Equal(t, "AutocompleteChannelsForTeam", method)
+				}
+			},
+		},
+		{
+			Name:   "search channel",
+			Action: actionSearchChannel,
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				for _, method := range client.Methods() {
+					assert.Equal(t, "SearchChannels", method)
+				}
+			},
+		},
+		{
+			Name:   "search user",
+			Action: actionSearchUser,
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				for _, method := range client.Methods() {
+					assert.Equal(t, "SearchUsers", method)
+				}
+			},
+		},
+		{
+			Name:          "get team unreads",
+			Action:        actionGetTeamUnreads,
+			ExpectedCalls: []string{"GetTeamsUnreadForUser"},
+		},
+		{
+			Name:   "get channel unreads",
+			Action: actionGetChannelUnreads,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "GetChannelUnread"},
+		},
+		{
+			Name:   "get channel unreads with posts around last unread",
+			Action: actionGetChannelUnreads,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.GetPostsAroundLastUnreadChance = 1
+				c.LoadTestConfig.UserEntitiesConfiguration.NumGetPostsAroundLastUnread = 30
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "GetPostsAroundLastUnread", "GetChannelUnread"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"userid0", "channelid0", 30, 30}, client.Calls()[1].Args)
+			},
+		},
+		{
+			Name:   "get channel unreads fails to get me",
+			Action: actionGetChannelUnreads,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetMe")
+			},
+			ExpectedCalls: []string{"GetMe"},
+		},
+		{
+			Name:   "update user profile without changes",
+			Action: actionUpdateUserProfile,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe"},
+		},
+		{
+			Name:   "update user profile nickname",
+			Action: actionUpdateUserProfile,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.UserProfileUpdateNicknameChance = 1
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "PatchUser", "GetMe", "UpdateUser"},
+		},
+		{
+			Name:   "update user profile fails to patch",
+			Action: actionUpdateUserProfile,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.UserProfileUpdateNicknameChance = 1
+				client.Returns["GetMe"] = me
+				client.fail("PatchUser")
+			},
+			ExpectedCalls: []string{"GetMe", "PatchUser"},
+		},
+		{
+			Name:   "deactivate and reactivate",
+			Action: actionDeactivateReactivate,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls:      []string{"GetMe", "Login"},
+			ExpectedAdminCalls: []string{"UpdateUserActive", "UpdateUserActive"},
+		},
+		{
+			Name:   "deactivate and reactivate fails to get me",
+			Action: actionDeactivateReactivate,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetMe")
+			},
+			ExpectedCalls: []string{"GetMe"},
+		},
+		{
+			Name:          "more channels",
+			Action:        actionMoreChannels,
+			ExpectedCalls: []string{"GetPublicChannelsForTeam"},
+		},
+		{
+			Name:   "more channels fails to get channels",
+			Action: actionMoreChannels,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetPublicChannelsForTeam")
+			},
+			ExpectedCalls: []string{"GetPublicChannelsForTeam"},
+		},
+		{
+			Name:          "wakeup",
+			Action:        actionWakeup,
+			ExpectedCalls: []string{"GetWebappPlugins"},
+		},
+		{
+			Name:          "mobile view channel fetches a page of posts",
+			Action:        actionMobileViewChannel,
+			ExpectedCalls: []string{"GetPostsForChannel", "ViewChannel"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"channelid0", 0, MOBILE_POSTS_PAGE_SIZE, ""}, client.Calls()[0].Args)
+			},
+		},
+		{
+			Name:   "mobile view channel syncs posts already fetched",
+			Action: actionMobileViewChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.mobile.viewChannel("channelid0", 1000)
+			},
+			ExpectedCalls: []string{"GetPostsSince", "ViewChannel"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"channelid0", int64(1000)}, client.Calls()[0].Args)
+				assert.Equal(t, "channelid0", client.Calls()[1].Args[1].(*model.ChannelView).PrevChannelId)
+			},
+		},
+		{
+			Name:   "mobile background",
+			Action: actionMobileBackground,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.MobileBackgroundSeconds = 60
+			},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []string{"Close"}, c.WebSocketClient.(*mockWebSocketClient).Methods())
+				assert.WithinDuration(t, time.Now().Add(time.Minute), c.mobile.backgroundedUntil(), time.Second)
+			},
+		},
+		{
+			Name:   "mobile background without a websocket",
+			Action: actionMobileBackground,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.WebSocketClient = nil
+			},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.True(t, c.mobile.backgroundedUntil().IsZero())
+			},
+		},
+		{
+			Name:          "mobile launch",
+			Action:        actionMobileResume,
+			ExpectedCalls: []string{"GetMe", "GetTeamsUnreadForUser", "GetChannelsForTeamForUser"},
+		},
+		{
+			Name:   "mobile resume syncs the current channel",
+			Action: actionMobileResume,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.mobile.viewChannel("channelid0", 1000)
+			},
+			ExpectedCalls: []string{"GetMe", "GetTeamsUnreadForUser", "GetChannelsForTeamForUser", "GetPostsSince"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"channelid0", int64(1000)}, client.Calls()[3].Args)
+			},
+		},
+		{
+			Name:   "reply to thread loads posts when no thread has been seen",
+			Action: actionReplyToThread,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetPostsForChannel"] = &model.PostList{Order: []string{post.Id}, Posts: map[string]*model.Post{post.Id: post}}
+				client.Returns["CreatePost"] = &model.Post{Id: "postid1", ChannelId: "channelid0", RootId: post.Id}
+			},
+			ExpectedCalls: []string{"GetPostsForChannel", "CreatePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, post.Id, client.Calls()[1].Args[0].(*model.Post).RootId)
+				assert.True(t, c.threads.isFollowing(post.Id))
+			},
+		},
+		{
+			Name:   "view thread marks a followed thread read",
+			Action: actionViewThread,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+				c.threads.setFollowing(post.Id, true)
+			},
+			ExpectedCalls: []string{"GetPostThread", "UpdateThreadReadForUser"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"me", "teamid0", post.Id}, client.Calls()[1].Args[:3])
+			},
+		},
+		{
+			Name:   "view thread leaves an unfollowed thread unread",
+			Action: actionViewThread,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+			},
+			ExpectedCalls: []string{"GetPostThread"},
+		},
+		{
+			Name:   "follow thread toggles following",
+			Action: actionFollowThread,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+				c.threads.setFollowing(post.Id, true)
+			},
+			ExpectedCalls: []string{"UpdateThreadFollowForUser"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"me", "teamid0", post.Id, false}, client.Calls()[0].Args)
+				assert.False(t, c.threads.isFollowing(post.Id))
+			},
+		},
+		{
+			Name:   "follow thread fails",
+			Action: actionFollowThread,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+				client.fail("UpdateThreadFollowForUser")
+			},
+			ExpectedCalls: []string{"UpdateThreadFollowForUser"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.False(t, c.threads.isFollowing(post.Id))
+			},
+		},
+		{
+			Name:   "get user threads reads the first unread thread",
+			Action: actionGetUserThreads,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetUserThreads"] = &Threads{Threads: []*ThreadResponse{
+					{PostId: "postid1"},
+					{PostId: "postid2", UnreadReplies: 2},
+					{PostId: "postid3", UnreadReplies: 1},
+				}}
+			},
+			ExpectedCalls: []string{"GetUserThreads", "GetPostThread", "UpdateThreadReadForUser"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "postid2", client.Calls()[1].Args[0])
+				assert.True(t, c.threads.isFollowing("postid1"))
+			},
+		},
+		{
+			Name:   "get user threads fails",
+			Action: actionGetUserThreads,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetUserThreads")
+			},
+			ExpectedCalls: []string{"GetUserThreads"},
+		},
+		{
+			Name:          "edit post does nothing before posting",
+			Action:        actionEditPost,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "edit post patches an own post",
+			Action: actionEditPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.posts.rememberOwn(post)
+			},
+			ExpectedCalls: []string{"PatchPost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, post.Id, client.Calls()[0].Args[0])
+				assert.NotEmpty(t, *client.Calls()[0].Args[1].(*model.PostPatch).Message)
+			},
+		},
+		{
+			Name:   "delete post forgets the post and its thread",
+			Action: actionDeletePost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.posts.rememberOwn(post)
+				c.threads.remember(post, "teamid0")
+			},
+			ExpectedCalls: []string{"DeletePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				_, ok := c.posts.pickOwn(c.r)
+				assert.False(t, ok)
+				_, ok = c.threads.pick(c.r, "")
+				assert.False(t, ok)
+			},
+		},
+		{
+			Name:   "delete post fails",
+			Action: actionDeletePost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.posts.rememberOwn(post)
+				client.fail("DeletePost")
+			},
+			ExpectedCalls: []string{"DeletePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				_, ok := c.posts.pickOwn(c.r)
+				assert.True(t, ok)
+			},
+		},
+		{
+			Name:   "pin post",
+			Action: actionPinPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+			},
+			ExpectedCalls: []string{"PinPost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.True(t, c.posts.isPinned(post.Id))
+			},
+		},
+		{
+			Name:   "pin post unpins a pinned post",
+			Action: actionPinPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+				c.posts.setPinned(post.Id, true)
+			},
+			ExpectedCalls: []string{"UnpinPost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.False(t, c.posts.isPinned(post.Id))
+			},
+		},
+		{
+			Name:          "get pinned posts",
+			Action:        actionGetPinnedPosts,
+			ExpectedCalls: []string{"GetPinnedPosts"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "channelid0", client.Calls()[0].Args[0])
+			},
+		},
+		{
+			Name:   "flag post saves a preference",
+			Action: actionFlagPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "UpdatePreferences"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				preferences := *client.Calls()[1].Args[1].(*model.Preferences)
+				assert.Equal(t, model.Preference{UserId: me.Id, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: post.Id, Value: "true"}, preferences[0])
+				assert.True(t, c.posts.isFlagged(post.Id))
+			},
+		},
+		{
+			Name:   "flag post unflags a flagged post",
+			Action: actionFlagPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.threads.remember(post, "teamid0")
+				c.posts.setFlagged(post.Id, true)
+				c.user.userId = me.Id
+			},
+			ExpectedCalls: []string{"DeletePreferences"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, me.Id, client.Calls()[0].Args[0])
+				assert.False(t, c.posts.isFlagged(post.Id))
+			},
+		},
+		{
+			Name:          "get flagged posts",
+			Action:        actionGetFlaggedPosts,
+			ExpectedCalls: []string{"GetFlaggedPostsForUser"},
+		},
+		{
+			Name:   "post files uploads generated files",
+			Action: actionPostFiles,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.FileUploads = []FileUpload{{Type: FILE_TYPE_TEXT, Weight: 1, MinSizeKilobytes: 1, MaxSizeKilobytes: 2}}
+				client.Returns["UploadFile"] = &model.FileUploadResponse{FileInfos: []*model.FileInfo{{Id: "fileid0", Name: "file.txt"}}}
+				client.Returns["CreatePost"] = post
+			},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				calls := client.Calls()
+				require.True(t, len(calls) >= 2)
+				created := calls[len(calls)-1]
+				assert.Equal(t, "CreatePost", created.Method)
+				for _, call := range calls[:len(calls)-1] {
+					assert.Equal(t, "UploadFile", call.Method)
+					assert.Equal(t, "channelid0", call.Args[1])
+					assert.Regexp(t, `^[a-z]+\.txt$`, call.Args[2])
+				}
+				assert.Len(t, created.Args[0].(*model.Post).FileIds, len(calls)-1)
+				file, ok := c.files.pick(c.r, false)
+				assert.True(t, ok)
+				assert.Equal(t, "fileid0", file.Id)
+			},
+		},
+		{
+			Name:   "post files stops when an upload fails",
+			Action: actionPostFiles,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.FileUploads = []FileUpload{{Type: FILE_TYPE_TEXT, Weight: 1, MinSizeKilobytes: 1, MaxSizeKilobytes: 2}}
+				client.fail("UploadFile")
+			},
+			ExpectedCalls: []string{"UploadFile"},
+		},
+		{
+			Name:          "download file does nothing without seen files",
+			Action:        actionDownloadFile,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "download file",
+			Action: actionDownloadFile,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.files.remember(&model.FileInfo{Id: "fileid0", Name: "file.txt"})
+			},
+			ExpectedCalls: []string{"GetFile"},
+		},
+		{
+			Name:   "get file preview only previews images",
+			Action: actionGetFilePreview,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.files.remember(&model.FileInfo{Id: "fileid0", Name: "file.txt"})
+				c.files.remember(&model.FileInfo{Id: "fileid1", Name: "file.png", Extension: "png", MimeType: "image/png"})
+			},
+			ExpectedCalls: []string{"GetFilePreview"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "fileid1", client.Calls()[0].Args[0])
+			},
+		},
+		{
+			Name:   "get file public link downloads through the link",
+			Action: actionGetFilePublicLink,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.files.remember(&model.FileInfo{Id: "fileid0", Name: "file.txt"})
+				client.Returns["GetFileLink"] = "http://localhost/files/fileid0/public?h=hash"
+			},
+			ExpectedCalls: []string{"GetFileLink", "GetPublicFile"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "http://localhost/files/fileid0/public?h=hash", client.Calls()[1].Args[0])
+			},
+		},
+		{
+			Name:   "search files remembers the results",
+			Action: actionSearchFiles,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["SearchFiles"] = &FileInfoList{
+					Order:     []string{"fileid0"},
+					FileInfos: map[string]*model.FileInfo{"fileid0": {Id: "fileid0", Name: "file.txt"}},
+				}
+			},
+			ExpectedCalls: []string{"SearchFiles"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "teamid0", client.Calls()[0].Args[0])
+				file, ok := c.files.pick(c.r, false)
+				assert.True(t, ok)
+				assert.Equal(t, "fileid0", file.Id)
+			},
+		},
+		{
+			Name:          "execute slash command does nothing without an integration URL",
+			Action:        actionExecuteSlashCommand,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "execute slash command",
+			Action: actionExecuteSlashCommand,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.ConnectionConfiguration.IntegrationURL = "http://localhost:8077"
+				c.LoadTestConfig.UserEntitiesConfiguration.SlashCommandResponses = []SlashCommandResponse{{Type: SLASH_COMMAND_RESPONSE_DELAYED, Weight: 1}}
+				c.LoadTestConfig.UserEntitiesConfiguration.SlashCommandDelayMilliseconds = 500
+			},
+			ExpectedCalls: []string{"ExecuteCommand"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "channelid0", client.Calls()[0].Args[0])
+				assert.Regexp(t, `^/loadtest delayed [a-z0-9]{26} 500$`, client.Calls()[0].Args[1])
+				_, lost := c.commands.results()
+				assert.Equal(t, map[string]int64{SLASH_COMMAND_RESPONSE_DELAYED: 1}, lost, "the command should await its response")
+			},
+		},
+		{
+			Name:   "execute slash command forgets failed commands",
+			Action: actionExecuteSlashCommand,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.ConnectionConfiguration.IntegrationURL = "http://localhost:8077"
+				client.fail("ExecuteCommand")
+			},
+			ExpectedCalls: []string{"ExecuteCommand"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				_, lost := c.commands.results()
+				assert.Empty(t, lost)
+			},
+		},
+		{
+			Name:          "post interactive message does nothing without an integration URL",
+			Action:        actionPostInteractive,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "post interactive message",
+			Action: actionPostInteractive,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.ConnectionConfiguration.IntegrationURL = "http://localhost:8077/"
+				client.Returns["CreatePost"] = post
+			},
+			ExpectedCalls: []string{"CreatePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				created := client.Calls()[0].Args[0].(*model.Post)
+				require.True(t, isInteractivePost(created))
+				assert.Equal(t, "http://localhost:8077/actions", created.GetAction(INTERACTIVE_SELECT_ID).Integration.URL)
+				postId, ok := c.interactive.pick(c.r)
+				assert.True(t, ok)
+				assert.Equal(t, post.Id, postId)
+			},
+		},
+		{
+			Name:          "click interactive message does nothing without interactive messages",
+			Action:        actionClickInteractive,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "click interactive message",
+			Action: actionClickInteractive,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.interactive.remember("postid0")
+			},
+			ExpectedCalls: []string{"DoPostActionWithCookie"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[0].Args
+				assert.Equal(t, "postid0", args[0])
+				assert.Contains(t, []string{INTERACTIVE_BUTTON_ID, INTERACTIVE_SELECT_ID}, args[1])
+				_, lost, _ := c.interactive.results()
+				assert.Len(t, lost, 1, "the click should await its update")
+			},
+		},
+		{
+			Name:   "click interactive message counts failures",
+			Action: actionClickInteractive,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.interactive.remember("postid0")
+				client.fail("DoPostActionWithCookie")
+			},
+			ExpectedCalls: []string{"DoPostActionWithCookie"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				_, lost, errors := c.interactive.results()
+				assert.Empty(t, lost)
+				assert.Len(t, errors, 1)
+				_, ok := c.interactive.pick(c.r)
+				assert.False(t, ok, "the message should be forgotten")
+			},
+		},
+		{
+			Name:   "update status",
+			Action: actionUpdateStatus,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "UpdateUserStatus"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				status := client.Calls()[1].Args[1].(*model.Status)
+				assert.Equal(t, me.Id, status.UserId)
+				assert.Contains(t, []string{model.STATUS_ONLINE, model.STATUS_AWAY, model.STATUS_DND}, status.Status)
+				assert.True(t, status.Manual)
+
+				actionUpdateStatus(c)
+				assert.Equal(t, []string{"GetMe", "UpdateUserStatus", "UpdateUserStatus"}, client.Methods(), "the user id should be remembered")
+			},
+		},
+		{
+			Name:   "update status with the user id from the websocket",
+			Action: actionUpdateStatus,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.user.receivedEvent(model.NewWebSocketEvent(model.WEBSOCKET_EVENT_HELLO, "", "", "userid0", nil))
+			},
+			ExpectedCalls: []string{"UpdateUserStatus"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "userid0", client.Calls()[0].Args[1].(*model.Status).UserId)
+			},
+		},
+		{
+			Name:   "update status fails to get me",
+			Action: actionUpdateStatus,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetMe")
+			},
+			ExpectedCalls: []string{"GetMe"},
+		},
+		{
+			Name:          "update custom status",
+			Action:        actionUpdateCustomStatus,
+			ExpectedCalls: []string{"UpdateUserCustomStatus"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				customStatus := client.Calls()[0].Args[1].(*CustomStatus)
+				assert.Contains(t, CUSTOM_STATUS_EMOJI, customStatus.Emoji)
+				assert.NotEmpty(t, customStatus.Text)
+				assert.True(t, len([]rune(customStatus.Text)) <= CUSTOM_STATUS_TEXT_MAX_RUNES)
+			},
+		},
+		{
+			Name:   "clear custom status",
+			Action: actionUpdateCustomStatus,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.UserEntitiesConfiguration.CustomStatusClearChance = 1
+			},
+			ExpectedCalls: []string{"RemoveUserCustomStatus"},
+		},
+		{
+			Name:          "plugin kv write",
+			Action:        actionPluginKVWrite,
+			ExpectedCalls: []string{"DoPluginRequest"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[0].Args
+				assert.Equal(t, http.MethodPost, args[0])
+				assert.Equal(t, LOADTEST_PLUGIN_ID, args[1])
+				assert.Regexp(t, "^/kv/key[0-9]$", args[2])
+				assert.NotEmpty(t, args[3])
+			},
+		},
+		{
+			Name:   "plugin kv read",
+			Action: actionPluginKVRead,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["DoPluginRequest"] = []byte("value")
+			},
+			ExpectedCalls: []string{"DoPluginRequest"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[0].Args
+				assert.Equal(t, http.MethodGet, args[0])
+				assert.Regexp(t, "^/kv/key[0-9]$", args[2])
+			},
+		},
+		{
+			Name:          "plugin broadcast",
+			Action:        actionPluginBroadcast,
+			ExpectedCalls: []string{"DoPluginRequest"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[0].Args
+				assert.Equal(t, http.MethodPost, args[0])
+				assert.Equal(t, "/broadcast", args[2])
+			},
+		},
+		{
+			Name:          "bot post does nothing without a bot",
+			Action:        actionBotPost,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "bot post posts to a bot channel",
+			Action: actionBotPost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.bot = &BotAccount{Username: "loadtestbot0", ChannelIds: []string{"channelid0"}}
+				c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookPayloads = []IncomingWebhookPayload{{Type: WEBHOOK_PAYLOAD_ATTACHMENTS, Weight: 1}}
+				client.Returns["CreatePost"] = post
+			},
+			ExpectedCalls: []string{"CreatePost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				created := client.Calls()[0].Args[0].(*model.Post)
+				assert.Equal(t, "channelid0", created.ChannelId)
+				assert.NotEmpty(t, created.Attachments())
+				_, ok := c.posts.pickOwn(c.r)
+				assert.True(t, ok, "the post should be remembered for updating")
+			},
+		},
+		{
+			Name:   "bot update post patches an own post",
+			Action: actionBotUpdatePost,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.bot = &BotAccount{Username: "loadtestbot0", ChannelIds: []string{"channelid0"}}
+				c.posts.rememberOwn(post)
+			},
+			ExpectedCalls: []string{"PatchPost"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, post.Id, client.Calls()[0].Args[0])
+				patch := client.Calls()[0].Args[1].(*model.PostPatch)
+				assert.NotEmpty(t, *patch.Message)
+				assert.NotEmpty(t, (*patch.Props)["attachments"])
+			},
+		},
+		{
+			Name:   "favorite channel",
+			Action: actionFavoriteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+			},
+			ExpectedCalls: []string{"GetMe", "UpdatePreferences"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				preference := (*client.Calls()[1].Args[1].(*model.Preferences))[0]
+				assert.Equal(t, me.Id, preference.UserId)
+				assert.Equal(t, model.PREFERENCE_CATEGORY_FAVORITE_CHANNEL, preference.Category)
+				assert.Equal(t, "channelid0", preference.Name)
+				assert.True(t, c.sidebar.isFavorite("channelid0"))
+			},
+		},
+		{
+			Name:   "favorite channel unfavorites a favorite",
+			Action: actionFavoriteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.user.userId = me.Id
+				c.sidebar.setFavorite("channelid0", true)
+			},
+			ExpectedCalls: []string{"DeletePreferences"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, me.Id, client.Calls()[0].Args[0])
+				assert.False(t, c.sidebar.isFavorite("channelid0"))
+			},
+		},
+		{
+			Name:   "favorite channel remembers nothing on failure",
+			Action: actionFavoriteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetMe"] = me
+				client.fail("UpdatePreferences")
+			},
+			ExpectedCalls: []string{"GetMe", "UpdatePreferences"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.False(t, c.sidebar.isFavorite("channelid0"))
+			},
+		},
+		{
+			Name:          "mute channel",
+			Action:        actionMuteChannel,
+			ExpectedCalls: []string{"UpdateChannelNotifyProps"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[0].Args
+				assert.Equal(t, "channelid0", args[0])
+				assert.Equal(t, "me", args[1])
+				assert.Equal(t, map[string]string{model.MARK_UNREAD_NOTIFY_PROP: model.CHANNEL_MARK_UNREAD_MENTION}, args[2])
+				assert.True(t, c.sidebar.isMuted("channelid0"))
+			},
+		},
+		{
+			Name:   "mute channel unmutes a muted channel",
+			Action: actionMuteChannel,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.sidebar.setMuted("channelid0", true)
+			},
+			ExpectedCalls: []string{"UpdateChannelNotifyProps"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				props := client.Calls()[0].Args[2].(map[string]string)
+				assert.Equal(t, model.CHANNEL_MARK_UNREAD_ALL, props[model.MARK_UNREAD_NOTIFY_PROP])
+				assert.False(t, c.sidebar.isMuted("channelid0"))
+			},
+		},
+		{
+			Name:          "update channel notify props",
+			Action:        actionUpdateChannelNotifyProps,
+			ExpectedCalls: []string{"UpdateChannelNotifyProps"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				props := client.Calls()[0].Args[2].(map[string]string)
+				assert.Contains(t, CHANNEL_NOTIFY_LEVELS, props[model.DESKTOP_NOTIFY_PROP])
+				assert.Contains(t, CHANNEL_NOTIFY_LEVELS, props[model.PUSH_NOTIFY_PROP])
+				assert.Contains(t, CHANNEL_EMAIL_NOTIFY_LEVELS, props[model.EMAIL_NOTIFY_PROP])
+			},
+		},
+		{
+			Name:          "mark channel read",
+			Action:        actionMarkChannelRead,
+			ExpectedCalls: []string{"ViewChannel"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "channelid0", client.Calls()[0].Args[1].(*model.ChannelView).ChannelId)
+			},
+		},
+		{
+			Name:   "reorder sidebar categories",
+			Action: actionReorderSidebarCategories,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetSidebarCategoriesForTeamForUser"] = &OrderedSidebarCategories{Order: []string{"category0", "category1", "category2"}}
+			},
+			ExpectedCalls: []string{"GetSidebarCategoriesForTeamForUser", "UpdateSidebarCategoryOrderForTeamForUser"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[1].Args
+				assert.Equal(t, "teamid0", args[1])
+				assert.ElementsMatch(t, []string{"category0", "category1", "category2"}, args[2])
+			},
+		},
+		{
+			Name:   "move channel to category creates a custom category",
+			Action: actionMoveChannelToCategory,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetSidebarCategoriesForTeamForUser"] = &OrderedSidebarCategories{
+					Categories: []*SidebarCategoryWithChannels{
+						{SidebarCategory: SidebarCategory{Id: "favorites0", UserId: "userid0", Type: SIDEBAR_CATEGORY_FAVORITES}, Channels: []string{}},
+						{SidebarCategory: SidebarCategory{Id: "channels0", UserId: "userid0", Type: SIDEBAR_CATEGORY_CHANNELS}, Channels: []string{"channelid0"}},
+					},
+				}
+				client.Returns["CreateSidebarCategoryForTeamForUser"] = &SidebarCategoryWithChannels{
+					SidebarCategory: SidebarCategory{Id: "custom0", UserId: "userid0", Type: SIDEBAR_CATEGORY_CUSTOM},
+					Channels:        []string{},
+				}
+			},
+			ExpectedCalls: []string{"GetSidebarCategoriesForTeamForUser", "CreateSidebarCategoryForTeamForUser", "UpdateSidebarCategoriesForTeamForUser"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				created := client.Calls()[1].Args[2].(*SidebarCategoryWithChannels)
+				assert.Equal(t, SIDEBAR_CATEGORY_CUSTOM, created.Type)
+				assert.Equal(t, SIDEBAR_CUSTOM_CATEGORY_NAME, created.DisplayName)
+				assert.Equal(t, "userid0", created.UserId)
+
+				updated := client.Calls()[2].Args[2].([]*SidebarCategoryWithChannels)
+				require.Len(t, updated, 2)
+				assert.Equal(t, "channels0", updated[0].Id)
+				assert.Empty(t, updated[0].Channels)
+				assert.Contains(t, []string{"favorites0", "custom0"}, updated[1].Id)
+				assert.Equal(t, []string{"channelid0"}, updated[1].Channels)
+			},
+		},
+		{
+			Name:   "move channel to category does nothing without channels",
+			Action: actionMoveChannelToCategory,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetSidebarCategoriesForTeamForUser"] = &OrderedSidebarCategories{
+					Categories: []*SidebarCategoryWithChannels{
+						{SidebarCategory: SidebarCategory{Id: "favorites0", Type: SIDEBAR_CATEGORY_FAVORITES}, Channels: []string{}},
+						{SidebarCategory: SidebarCategory{Id: "custom0", Type: SIDEBAR_CATEGORY_CUSTOM}, Channels: []string{}},
+					},
+				}
+			},
+			ExpectedCalls: []string{"GetSidebarCategoriesForTeamForUser"},
+		},
+		{
+			Name:   "open more direct messages",
+			Action: actionOpenMoreDirectMessages,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetUsers"] = []*model.User{me, {Id: "userid1"}}
+			},
+			ExpectedCalls: []string{"GetUsers", "GetUsersStatusesByIds", "SearchUsers"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, MORE_DIRECT_MESSAGES_PAGE_SIZE, client.Calls()[0].Args[1])
+				assert.Equal(t, []string{"userid0", "userid1"}, client.Calls()[1].Args[0])
+				search := client.Calls()[2].Args[0].(*model.UserSearch)
+				assert.Equal(t, "use", search.Term)
+			},
+		},
+		{
+			Name:   "open more direct messages fails to get users",
+			Action: actionOpenMoreDirectMessages,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("GetUsers")
+			},
+			ExpectedCalls: []string{"GetUsers"},
+		},
+		{
+			Name:          "browse open teams",
+			Action:        actionBrowseOpenTeams,
+			ExpectedCalls: []string{"GetAllTeams"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, []interface{}{"", 0, TEAMS_FETCH_SIZE}, client.Calls()[0].Args)
+			},
+		},
+		{
+			Name:   "get team invite info",
+			Action: actionGetTeamInviteInfo,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetTeam"] = &model.Team{Id: "teamid0", InviteId: "inviteid0"}
+			},
+			ExpectedCalls: []string{"GetTeam", "GetTeamInviteInfo"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "teamid0", client.Calls()[0].Args[0])
+				assert.Equal(t, "inviteid0", client.Calls()[1].Args[0])
+			},
+		},
+		{
+			Name:          "invite users to team does nothing without an SMTP server",
+			Action:        actionInviteUsersToTeam,
+			ExpectedCalls: []string{},
+		},
+		{
+			Name:   "invite users to team",
+			Action: actionInviteUsersToTeam,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				c.LoadTestConfig.ConnectionConfiguration.SMTPServerAddress = "localhost:8025"
+			},
+			ExpectedCalls: []string{"InviteUsersToTeam"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := client.Calls()[0].Args
+				assert.Equal(t, "teamid0", args[0])
+				emails := args[1].([]string)
+				assert.Len(t, emails, TEAM_EMAIL_INVITES_PER_REQUEST)
+				for _, email := range emails {
+					assert.True(t, model.IsValidEmail(email), email)
+				}
+			},
+		},
+		{
+			Name:   "create archive team",
+			Action: actionCreateArchiveTeam,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["CreateTeam"] = &model.Team{Id: "teamid1"}
+			},
+			ExpectedCalls: []string{"CreateTeam", "SoftDeleteTeam"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				team := client.Calls()[0].Args[0].(*model.Team)
+				assert.True(t, model.IsValidTeamName(team.Name), team.Name)
+				assert.NotEmpty(t, team.DisplayName)
+				assert.Equal(t, "teamid1", client.Calls()[1].Args[0])
+			},
+		},
+		{
+			Name:   "create archive team fails to create",
+			Action: actionCreateArchiveTeam,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.fail("CreateTeam")
+			},
+			ExpectedCalls: []string{"CreateTeam"},
+		},
+		{
+			Name:               "update team",
+			Action:             actionUpdateTeam,
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"PatchTeam"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				args := adminClient.Calls()[0].Args
+				assert.Equal(t, "teamid0", args[0])
+				patch := args[1].(*model.TeamPatch)
+				assert.NotEmpty(t, *patch.Description)
+				assert.Nil(t, patch.AllowOpenInvite)
+			},
+		},
+		{
+			Name:               "set team icon",
+			Action:             actionSetTeamIcon,
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"SetTeamIcon"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				data := adminClient.Calls()[0].Args[1].([]byte)
+				assert.Equal(t, "\x89PNG", string(data[:4]))
+			},
+		},
+		{
+			Name:               "regenerate team invite id",
+			Action:             actionRegenerateTeamInviteId,
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"RegenerateTeamInviteId"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "teamid0", adminClient.Calls()[0].Args[0])
+			},
+		},
+		{
+			Name:   "churn role permissions grants a churned permission",
+			Action: actionChurnRolePermissions,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Name: TEAM_SCHEME_NAME_PREFIX + "0", DefaultTeamUserRole: "schemerole0", DefaultTeamAdminRole: "schemerole1"}}
+				adminClient.Returns["GetRoleByName"] = &model.Role{Id: "roleid0", Permissions: []string{model.PERMISSION_CREATE_POST.Id}}
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "GetRoleByName", "PatchRole"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Contains(t, []string{"schemerole0", "schemerole1"}, adminClient.Calls()[1].Args[0])
+				assert.Equal(t, "roleid0", adminClient.Calls()[2].Args[0])
+				permissions := *adminClient.Calls()[2].Args[1].(*model.RolePatch).Permissions
+				require.Len(t, permissions, 2)
+				assert.Equal(t, model.PERMISSION_CREATE_POST.Id, permissions[0])
+				assert.Contains(t, CHURNED_PERMISSIONS, permissions[1])
+			},
+		},
+		{
+			Name:   "churn role permissions revokes a granted permission",
+			Action: actionChurnRolePermissions,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Name: CHANNEL_SCHEME_NAME_PREFIX + "0", DefaultChannelUserRole: "schemerole0"}}
+				adminClient.Returns["GetRoleByName"] = &model.Role{Id: "roleid0", Permissions: append([]string{model.PERMISSION_CREATE_POST.Id}, CHURNED_PERMISSIONS...)}
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "GetRoleByName", "PatchRole"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "schemerole0", adminClient.Calls()[1].Args[0])
+				permissions := *adminClient.Calls()[2].Args[1].(*model.RolePatch).Permissions
+				assert.Len(t, permissions, len(CHURNED_PERMISSIONS))
+				assert.Contains(t, permissions, model.PERMISSION_CREATE_POST.Id)
+			},
+		},
+		{
+			Name:   "churn role permissions stops when the role cannot be fetched",
+			Action: actionChurnRolePermissions,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Name: CHANNEL_SCHEME_NAME_PREFIX + "0", DefaultChannelUserRole: "schemerole0"}}
+				adminClient.fail("GetRoleByName")
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "GetRoleByName"},
+		},
+		{
+			Name:   "churn role permissions leaves roles of other schemes alone",
+			Action: actionChurnRolePermissions,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Name: "customscheme", DefaultChannelUserRole: "schemerole0"}}
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes"},
+		},
+		{
+			Name:   "assign team scheme",
+			Action: actionAssignTeamScheme,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Scope: model.SCHEME_SCOPE_TEAM}}
+				adminClient.Returns["GetTeam"] = &model.Team{Id: "teamid0"}
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "GetTeam", "UpdateTeamScheme"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, model.SCHEME_SCOPE_TEAM, adminClient.Calls()[0].Args[0])
+				assert.Equal(t, "teamid0", adminClient.Calls()[2].Args[0])
+				assert.Equal(t, "schemeid0", adminClient.Calls()[2].Args[1], "the entity's seed should assign the scheme")
+				assert.Equal(t, map[string]string{"teamid0": ""}, c.permissions.teamSchemes, "the original scheme should be recorded")
+			},
+		},
+		{
+			Name:   "assign team scheme fetches the team once",
+			Action: actionAssignTeamScheme,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Scope: model.SCHEME_SCOPE_TEAM}}
+				c.permissions.recordTeamScheme("teamid0", "schemeid1")
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "UpdateTeamScheme"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, map[string]string{"teamid0": "schemeid1"}, c.permissions.teamSchemes)
+			},
+		},
+		{
+			Name:   "assign team scheme stops when the team cannot be fetched",
+			Action: actionAssignTeamScheme,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.Returns["GetSchemes"] = []*model.Scheme{{Id: "schemeid0", Scope: model.SCHEME_SCOPE_TEAM}}
+				adminClient.fail("GetTeam")
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "GetTeam"},
+		},
+		{
+			Name:   "assign channel scheme without schemes restores the default",
+			Action: actionAssignChannelScheme,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				schemeId := "schemeid1"
+				adminClient.Returns["GetChannel"] = &model.Channel{Id: "channelid0", SchemeId: &schemeId}
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes", "GetChannel", "UpdateChannelScheme"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, model.SCHEME_SCOPE_CHANNEL, adminClient.Calls()[0].Args[0])
+				assert.Equal(t, "channelid0", adminClient.Calls()[2].Args[0])
+				assert.Equal(t, "", adminClient.Calls()[2].Args[1])
+				assert.Equal(t, map[string]string{"channelid0": "schemeid1"}, c.permissions.channelSchemes, "the original scheme should be recorded")
+			},
+		},
+		{
+			Name:   "assign channel scheme stops when schemes cannot be listed",
+			Action: actionAssignChannelScheme,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				adminClient.fail("GetSchemes")
+			},
+			ExpectedCalls:      []string{},
+			ExpectedAdminCalls: []string{"GetSchemes"},
+		},
+		{
+			Name:   "promote channel admin",
+			Action: actionPromoteDemoteChannelAdmin,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetChannelMembers"] = &model.ChannelMembers{{ChannelId: "channelid0", UserId: "userid1", SchemeUser: true}}
+			},
+			ExpectedCalls:      []string{"GetChannelMembers"},
+			ExpectedAdminCalls: []string{"UpdateChannelMemberSchemeRoles"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, "channelid0", adminClient.Calls()[0].Args[0])
+				assert.Equal(t, "userid1", adminClient.Calls()[0].Args[1])
+				assert.Equal(t, &model.SchemeRoles{SchemeUser: true, SchemeAdmin: true}, adminClient.Calls()[0].Args[2])
+			},
+		},
+		{
+			Name:   "demote channel admin",
+			Action: actionPromoteDemoteChannelAdmin,
+			Setup: func(c *EntityConfig, client, adminClient *mockClient) {
+				client.Returns["GetChannelMembers"] = &model.ChannelMembers{{ChannelId: "channelid0", UserId: "userid1", SchemeUser: true, SchemeAdmin: true}}
+			},
+			ExpectedCalls:      []string{"GetChannelMembers"},
+			ExpectedAdminCalls: []string{"UpdateChannelMemberSchemeRoles"},
+			Check: func(t *testing.T, c *EntityConfig, client, adminClient *mockClient) {
+				assert.Equal(t, &model.SchemeRoles{SchemeUser: true, SchemeAdmin: false}, adminClient.Calls()[0].Args[2])
+			},
+		},
+		{
+			Name:               "promote channel admin without members",
+			Action:             actionPromoteDemoteChannelAdmin,
+			ExpectedCalls:      []string{"GetChannelMembers"},
+			ExpectedAdminCalls: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			c, client, adminClient, _ := newTestEntityConfig()
+			if testCase.Setup != nil {
+				testCase.Setup(c, client, adminClient)
+			}
+
+			testCase.Action(c)
+
+			if testCase.ExpectedCalls != nil {
+				assert.Equal(t, testCase.ExpectedCalls, client.Methods())
+			}
+			expectedAdminCalls := testCase.ExpectedAdminCalls
+			if expectedAdminCalls == nil {
+				expectedAdminCalls = []string{}
+			}
+			assert.Equal(t, expectedAdminCalls, adminClient.Methods())
+			if testCase.Check != nil {
+				testCase.Check(t, c, client, adminClient)
+			}
+		})
+	}
+}
+
+func TestWaitInBackground(t *testing.T) {
+	c, _, _, _ := newTestEntityConfig()
+	stop := make(chan bool)
+	c.StopChannel = stop
+
+	start := time.Now()
+	assert.True(t, waitInBackground(c), "an app in the foreground should reconnect")
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	c.mobile.background(time.Now().Add(100 * time.Millisecond))
+	start = time.Now()
+	assert.True(t, waitInBackground(c))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "an app in the background should wait before reconnecting")
+
+	c.mobile.background(time.Now().Add(time.Minute))
+	close(stop)
+	assert.False(t, waitInBackground(c), "a stopped entity should not reconnect")
+}
+
+func TestActionDisconnectWebsocket(t *testing.T) {
+	c, client, _, webSocketClient := newTestEntityConfig()
+
+	actionDisconnectWebsocket(c)
+
+	assert.Equal(t, []string{"Close"}, webSocketClient.Methods())
+	assert.Empty(t, client.Methods())
+}
+
+func TestSendTyping(t *testing.T) {
+	c, client, _, webSocketClient := newTestEntityConfig()
+	client.Returns["CreatePost"] = &model.Post{Id: "postid0", ChannelId: "channelid0"}
+
+	actionPost(c)
+	assert.Empty(t, webSocketClient.Methods(), "typing should be off by default")
+
+	for _, testCase := range []struct {
+		length int
+		waits  []time.Duration
+	}{
+		{4, []time.Duration{500 * time.Millisecond}},
+		{100, []time.Duration{5 * time.Second, 5 * time.Second, 2500 * time.Millisecond}},
+		{1000, []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second}},
+	} {
+		webSocketClient.calls = nil
+		waits := []time.Duration{}
+		typeMessage(webSocketClient, 10, "channelid0", "", strings.Repeat("x", testCase.length), func(d time.Duration) bool {
+			waits = append(waits, d)
+			return true
+		})
+
+		assert.Equal(t, testCase.waits, waits, "typing %d characters", testCase.length)
+		methods := webSocketClient.Methods()
+		assert.Len(t, methods, len(testCase.waits), "an event should be sent before each pause")
+		for _, method := range methods {
+			assert.Equal(t, "UserTyping", method)
+		}
+	}
+
+	webSocketClient.calls = nil
+	typeMessage(webSocketClient, 100, "channelid0", "", strings.Repeat("x", 1000), func(time.Duration) bool { return true })
+	assert.Len(t, webSocketClient.Methods(), 2, "events should be sent every 100 characters")
+
+	webSocketClient.calls = nil
+	typeMessage(webSocketClient, 10, "channelid0", "", strings.Repeat("x", 1000), func(time.Duration) bool { return false })
+	assert.Len(t, webSocketClient.Methods(), 1, "typing should stop once waiting fails")
+
+	// Typing a long message should neither hold up posting it nor outlive the entity.
+	stop := make(chan bool)
+	c.StopChannel = stop
+	c.LoadTestConfig.UserEntitiesConfiguration.TypingCharactersPerEvent = 10
+	webSocketClient.calls = nil
+	started := time.Now()
+	sendTyping(c, "channelid0", "", strings.Repeat("x", 1000))
+	assert.True(t, time.Since(started) < time.Second, "sending typing events should not block")
+	close(stop)
+	assert.Eventually(t, func() bool { return len(webSocketClient.Methods()) == 1 }, time.Second, 10*time.Millisecond)
+
+	c.WebSocketClient = nil
+	sendTyping(c, "channelid0", "", "message")
+}
+
+func TestActionGetStatusesWebsocket(t *testing.T) {
+	c, client, _, webSocketClient := newTestEntityConfig()
+	client.Returns["GetChannelMembers"] = &model.ChannelMembers{{UserId: "userid0"}, {UserId: "userid1"}}
+
+	actionGetStatusesWebsocket(c)
+	actionGetStatusesWebsocket(c)
+
+	assert.Equal(t, []string{"GetChannelMembers"}, client.Methods(), "the users should be looked up once")
+	assert.Equal(t, []string{"GetStatusesByIds", "GetStatusesByIds"}, webSocketClient.Methods())
+}
+
+// roundTrip is an entity acting as user0 against a fakeserver, seeded with a system admin and
+// with user0 and user1, who are members of team0 and its channel0.
+type roundTrip struct {
+	server      *fakeserver.Server
+	team        *model.Team
+	channel     *model.Channel
+	users       []*model.User
+	client      *model.Client4
+	adminClient *model.Client4
+	c           *EntityConfig
+}
+
+func newRoundTrip(t *testing.T) *roundTrip {
+	s := fakeserver.New(fakeserver.Config{})
+	s.Start()
+
+	rt := &roundTrip{server: s}
+	rt.team = s.CreateTeam(&model.Team{Name: "team0", DisplayName: "Team 0", InviteId: model.NewId()})
+	rt.channel = s.CreateChannel(&model.Channel{TeamId: rt.team.Id, Name: "channel0", DisplayName: "Channel 0", Type: model.CHANNEL_OPEN})
+	townSquare := s.GetChannelByName(rt.team.Id, model.DEFAULT_CHANNEL)
+	require.NotNil(t, townSquare)
+
+	admin := s.CreateUser(&model.User{Username: "admin", Email: "success+admin@simulator.amazonses.com", Roles: model.SYSTEM_ADMIN_ROLE_ID + " " + model.SYSTEM_USER_ROLE_ID}, "password")
+	s.AddTeamMember(rt.team.Id, admin.Id)
+	for _, username := range []string{"user0", "user1"} {
+		user := s.CreateUser(&model.User{Username: username, Email: "success+" + username + "@simulator.amazonses.com"}, "password")
+		s.AddTeamMember(rt.team.Id, user.Id)
+		s.AddChannelMember(rt.channel.Id, user.Id)
+		rt.users = append(rt.users, user)
+	}
+	rt.adminClient = rt.login(t, admin)
+	rt.client = rt.login(t, rt.users[0])
+
+	rt.c, _, _, _ = newTestEntityConfig()
+	rt.c.Client = &apiClient{rt.client}
+	rt.c.AdminClient = rt.adminClient
+	rt.c.WebSocketClient = nil
+	rt.c.TeamMap = map[string]string{"team0": rt.team.Id}
+	rt.c.ChannelMap = map[string]map[string]string{"team0": {"channel0": rt.channel.Id, model.DEFAULT_CHANNEL: townSquare.Id}}
+	rt.c.TownSquareMap = map[string]string{"team0": townSquare.Id}
+
+	return rt
+}
+
+func (rt *roundTrip) login(t *testing.T, user *model.User) *model.Client4 {
+	client := model.NewAPIv4Client(rt.server.URL())
+	_, resp := client.Login(user.Email, "password")
+	require.Nil(t, resp.Error)
+
+	return client
+}
+
+func TestUserStatusRoundTrip(t *testing.T) {
+	rt := newRoundTrip(t)
+	defer rt.server.Close()
+
+	typist, appErr := newWebSocketClient(websocket.DefaultDialer, rt.server.WebsocketURL(), rt.client.AuthToken)
+	require.Nil(t, appErr)
+	defer typist.Close()
+	typist.Listen()
+	rt.c.WebSocketClient = typist
+
+	listener, appErr := newWebSocketClient(websocket.DefaultDialer, rt.server.WebsocketURL(), rt.login(t, rt.users[1]).AuthToken)
+	require.Nil(t, appErr)
+	defer listener.Close()
+	listener.Listen()
+	hello := <-listener.Events()
+	require.Equal(t, model.WEBSOCKET_EVENT_HELLO, hello.Event)
+
+	// More requests are sent than the responses channel holds, so the responses must be drained.
+	for i := 0; i < 150; i++ {
+		typist.UserTyping(rt.channel.Id, "")
+	}
+	actionGetStatusesWebsocket(rt.c)
+	actionUpdateStatus(rt.c)
+	rt.c.LoadTestConfig.UserEntitiesConfiguration.CustomStatusClearChance = 0
+	actionUpdateCustomStatus(rt.c)
+
+	var status string
+	var typing, userUpdated bool
+	timeout := time.After(5 * time.Second)
+	for !typing || status == "" || !userUpdated {
+		select {
+		case response := <-typist.Responses():
+			assert.Nil(t, response.Error)
+		case event := <-listener.Events():
+			switch event.Event {
+			case model.WEBSOCKET_EVENT_TYPING:
+				typing = true
+				assert.Equal(t, rt.users[0].Id, event.Data["user_id"])
+			case model.WEBSOCKET_EVENT_STATUS_CHANGE:
+				status = event.Data["status"].(string)
+			case model.WEBSOCKET_EVENT_USER_UPDATED:
+				userUpdated = true
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the events")
+		}
+	}
+
+	statuses, resp := rt.adminClient.GetUsersStatusesByIds([]string{rt.users[0].Id})
+	require.Nil(t, resp.Error)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, status, statuses[0].Status)
+	assert.True(t, statuses[0].Manual)
+
+	user, resp := rt.adminClient.GetUser(rt.users[0].Id, "")
+	require.Nil(t, resp.Error)
+	var customStatus CustomStatus
+	require.NoError(t, json.Unmarshal([]byte(user.Props["customStatus"]), &customStatus))
+	assert.Contains(t, CUSTOM_STATUS_EMOJI, customStatus.Emoji)
+	assert.NotEmpty(t, customStatus.Text)
+
+	rt.c.LoadTestConfig.UserEntitiesConfiguration.CustomStatusClearChance = 1
+	actionUpdateCustomStatus(rt.c)
+	user, resp = rt.adminClient.GetUser(rt.users[0].Id, "")
+	require.Nil(t, resp.Error)
+	assert.Empty(t, user.Props["customStatus"])
+}
+
+func TestSidebarRoundTrip(t *testing.T) {
+	rt := newRoundTrip(t)
+	defer rt.server.Close()
+	c, channel := rt.c, rt.channel
+
+	isFavorite := func() bool {
+		preferences, resp := rt.client.GetPreferences("me")
+		require.Nil(t, resp.Error)
+		for _, preference := range preferences {
+			if preference.Category == model.PREFERENCE_CATEGORY_FAVORITE_CHANNEL && preference.Name == channel.Id {
+				return preference.Value == "true"
+			}
+		}
+		return false
+	}
+	actionFavoriteChannel(c)
+	assert.True(t, isFavorite())
+	actionFavoriteChannel(c)
+	assert.False(t, isFavorite(), "the channel should be unfavorited")
+
+	actionMuteChannel(c)
+	member, resp := rt.client.GetChannelMember(channel.Id, rt.users[0].Id, "")
+	require.Nil(t, resp.Error)
+	assert.Equal(t, model.CHANNEL_MARK_UNREAD_MENTION, member.NotifyProps[model.MARK_UNREAD_NOTIFY_PROP])
+
+	actionUpdateChannelNotifyProps(c)
+	member, resp = rt.client.GetChannelMember(channel.Id, rt.users[0].Id, "")
+	require.Nil(t, resp.Error)
+	assert.Contains(t, CHANNEL_NOTIFY_LEVELS, member.NotifyProps[model.DESKTOP_NOTIFY_PROP])
+	assert.Equal(t, model.CHANNEL_MARK_UNREAD_MENTION, member.NotifyProps[model.MARK_UNREAD_NOTIFY_PROP], "the channel should stay muted")
+
+	actionMoveChannelToCategory(c)
+	after, resp := c.Client.GetSidebarCategoriesForTeamForUser("me", rt.team.Id, "")
+	require.Nil(t, resp.Error)
+	require.Len(t, after.Categories, 4, "a custom category should be created")
+	custom := after.Categories[0]
+	assert.Equal(t, SIDEBAR_CATEGORY_CUSTOM, custom.Type)
+	assert.Equal(t, SIDEBAR_CUSTOM_CATEGORY_NAME, custom.DisplayName)
+	assert.Equal(t, []string{channel.Id}, custom.Channels)
+
+	actionReorderSidebarCategories(c)
+	reordered, resp := c.Client.GetSidebarCategoriesForTeamForUser("me", rt.team.Id, "")
+	require.Nil(t, resp.Error)
+	assert.ElementsMatch(t, after.Order, reordered.Order)
+
+	_, resp = rt.login(t, rt.users[1]).CreatePost(&model.Post{ChannelId: channel.Id, Message: "hello"})
+	require.Nil(t, resp.Error)
+	unread, resp := rt.client.GetChannelUnread(channel.Id, "me")
+	require.Nil(t, resp.Error)
+	require.EqualValues(t, 1, unread.MsgCount)
+	actionMarkChannelRead(c)
+	unread, resp = rt.client.GetChannelUnread(channel.Id, "me")
+	require.Nil(t, resp.Error)
+	assert.Zero(t, unread.MsgCount)
+
+	actionOpenMoreDirectMessages(c)
+}
+
+func TestTeamsRoundTrip(t *testing.T) {
+	rt := newRoundTrip(t)
+	defer rt.server.Close()
+	c, team := rt.c, rt.team
+
+	actionCreateArchiveTeam(c)
+	teams, resp := rt.adminClient.GetAllTeams("", 0, 10)
+	require.Nil(t, resp.Error)
+	require.Len(t, teams, 1, "the created team should be archived")
+	assert.Equal(t, team.Id, teams[0].Id)
+
+	actionRegenerateTeamInviteId(c)
+	actionUpdateTeam(c)
+	actionSetTeamIcon(c)
+
+	updated, resp := rt.client.GetTeam(team.Id, "")
+	require.Nil(t, resp.Error)
+	assert.NotEqual(t, team.InviteId, updated.InviteId)
+	assert.NotEqual(t, team.Description, updated.Description)
+	assert.NotZero(t, updated.LastTeamIconUpdate)
+}
+
+func TestPermissionsRoundTrip(t *testing.T) {
+	rt := newRoundTrip(t)
+	defer rt.server.Close()
+	c := rt.c
+
+	teamScheme := rt.server.CreateScheme(&model.Scheme{Name: TEAM_SCHEME_NAME_PREFIX + "0", DisplayName: "Team Scheme", Scope: model.SCHEME_SCOPE_TEAM})
+	channelScheme := rt.server.CreateScheme(&model.Scheme{Name: CHANNEL_SCHEME_NAME_PREFIX + "0", DisplayName: "Channel Scheme", Scope: model.SCHEME_SCOPE_CHANNEL})
+
+	schemeIds := func() (string, string) {
+		team, resp := rt.adminClient.GetTeam(rt.team.Id, "")
+		require.Nil(t, resp.Error)
+		channel, resp := rt.adminClient.GetChannel(rt.channel.Id, "")
+		require.Nil(t, resp.Error)
+		if team.SchemeId == nil || channel.SchemeId == nil {
+			return "", ""
+		}
+		return *team.SchemeId, *channel.SchemeId
+	}
+
+	// With seed 1 the schemes are assigned, and with seed 2 the defaults are restored.
+	c.r = rand.New(rand.NewSource(1))
+	actionAssignTeamScheme(c)
+	c.r = rand.New(rand.NewSource(1))
+	actionAssignChannelScheme(c)
+	teamSchemeId, channelSchemeId := schemeIds()
+	assert.Equal(t, teamScheme.Id, teamSchemeId)
+	assert.Equal(t, channelScheme.Id, channelSchemeId)
+
+	c.r = rand.New(rand.NewSource(2))
+	actionAssignTeamScheme(c)
+	c.r = rand.New(rand.NewSource(2))
+	actionAssignChannelScheme(c)
+	teamSchemeId, channelSchemeId = schemeIds()
+	assert.Empty(t, teamSchemeId)
+	assert.Empty(t, channelSchemeId)
+
+	channelAdmins := func() []string {
+		members, resp := rt.adminClient.GetChannelMembers(rt.channel.Id, 0, 10, "")
+		require.Nil(t, resp.Error)
+		admins := []string{}
+		for _, member := range *members {
+			assert.True(t, member.SchemeUser)
+			if member.SchemeAdmin {
+				admins = append(admins, member.UserId)
+			}
+		}
+		return admins
+	}
+	// The same seed picks the same member, who is promoted and then demoted again.
+	c.r = rand.New(rand.NewSource(1))
+	actionPromoteDemoteChannelAdmin(c)
+	admins := channelAdmins()
+	require.Len(t, admins, 1)
+	assert.Contains(t, []string{rt.users[0].Id, rt.users[1].Id}, admins[0])
+	c.r = rand.New(rand.NewSource(1))
+	actionPromoteDemoteChannelAdmin(c)
+	assert.Empty(t, channelAdmins())
+
+	role, resp := rt.adminClient.GetRoleByName(teamScheme.DefaultChannelAdminRole)
+	require.Nil(t, resp.Error)
+	original := role.Permissions
+	require.NotContains(t, original, model.PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS.Id)
+
+	// With seed 1 the channel admin role of the team scheme is picked, along with the permission
+	// to manage others' slash commands, which is granted and then revoked again.
+	c.r = rand.New(rand.NewSource(1))
+	actionChurnRolePermissions(c)
+	role, resp = rt.adminClient.GetRoleByName(teamScheme.DefaultChannelAdminRole)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, append(append([]string{}, original...), model.PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS.Id), role.Permissions)
+
+	c.r = rand.New(rand.NewSource(1))
+	actionChurnRolePermissions(c)
+	role, resp = rt.adminClient.GetRoleByName(teamScheme.DefaultChannelAdminRole)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, original, role.Permissions)
+
+	builtIn, resp := rt.adminClient.GetRoleByName(model.CHANNEL_ADMIN_ROLE_ID)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, original, builtIn.Permissions, "the built-in role should be left alone")
+
+	// Leave every change in place, then restore them as the end of the test would.
+	c.r = rand.New(rand.NewSource(1))
+	actionAssignTeamScheme(c)
+	c.r = rand.New(rand.NewSource(1))
+	actionAssignChannelScheme(c)
+	c.r = rand.New(rand.NewSource(1))
+	actionPromoteDemoteChannelAdmin(c)
+	c.r = rand.New(rand.NewSource(1))
+	actionChurnRolePermissions(c)
+	require.Len(t, channelAdmins(), 1)
+
+	c.permissions.restore(rt.adminClient)
+
+	teamSchemeId, channelSchemeId = schemeIds()
+	assert.Empty(t, teamSchemeId)
+	assert.Empty(t, channelSchemeId)
+	assert.Empty(t, channelAdmins())
+	role, resp = rt.adminClient.GetRoleByName(teamScheme.DefaultChannelAdminRole)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, original, role.Permissions)
+}
+
+// fillingAdminClient fills the webhook pool while a webhook is created, as another entity would.
+type fillingAdminClient struct {
+	*mockClient
+	webhooks *incomingWebhookPool
+}
+
+func (f *fillingAdminClient) CreateIncomingWebhook(hook *model.IncomingWebhook) (*model.IncomingWebhook, *model.Response) {
+	f.webhooks.lock.Lock()
+	f.webhooks.hooks = append(f.webhooks.hooks, incomingWebhook{Id: "hookid0", TeamName: "team0"})
+	f.webhooks.lock.Unlock()
+
+	return f.mockClient.CreateIncomingWebhook(hook)
+}
+
+func TestActionPostWebhook(t *testing.T) {
+	t.Run("creates the webhook once", func(t *testing.T) {
+		c, client, adminClient, _ := newTestEntityConfig()
+		c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookUsernameOverrideChance = 1
+		adminClient.Returns["CreateIncomingWebhook"] = &model.IncomingWebhook{Id: "hookid0"}
+
+		actionPostWebhook(c)
+		actionPostWebhook(c)
+
+		assert.Equal(t, []string{"CreateIncomingWebhook"}, adminClient.Methods())
+		require.Equal(t, []string{"PostIncomingWebhook", "PostIncomingWebhook"}, client.Methods())
+		assert.Equal(t, "hookid0", client.Calls()[0].Args[0])
+		request := client.Calls()[0].Args[1].(*model.IncomingWebhookRequest)
+		assert.NotEmpty(t, request.Text)
+		assert.Empty(t, request.Attachments)
+		assert.Equal(t, WEBHOOK_OVERRIDE_USERNAME, request.Username, "the default configuration should post as before")
+		assert.Empty(t, request.IconURL)
+		assert.Empty(t, request.ChannelName)
+	})
+
+	t.Run("fails to create the webhook", func(t *testing.T) {
+		c, client, adminClient, _ := newTestEntityConfig()
+		adminClient.fail("CreateIncomingWebhook")
+
+		actionPostWebhook(c)
+
+		require.Equal(t, []string{"CreateIncomingWebhook"}, adminClient.Methods())
+		assert.Empty(t, client.Methods())
+	})
+
+	t.Run("shares the configured number of webhooks", func(t *testing.T) {
+		webhooks := &incomingWebhookPool{}
+		for i := 0; i < 3; i++ {
+			c, client, adminClient, _ := newTestEntityConfig()
+			c.LoadTestConfig.UserEntitiesConfiguration.NumIncomingWebhooks = 2
+			c.webhooks = webhooks
+			adminClient.Returns["CreateIncomingWebhook"] = &model.IncomingWebhook{Id: fmt.Sprintf("hookid%d", i)}
+
+			actionPostWebhook(c)
+
+			if i < 2 {
+				assert.Equal(t, []string{"CreateIncomingWebhook"}, adminClient.Methods())
+			} else {
+				assert.Empty(t, adminClient.Methods(), "the shared webhooks should be reused")
+			}
+			assert.Equal(t, []string{"PostIncomingWebhook"}, client.Methods())
+		}
+	})
+
+	t.Run("creates webhooks without holding the pool", func(t *testing.T) {
+		webhooks := &incomingWebhookPool{}
+		c, client, adminClient, _ := newTestEntityConfig()
+		c.LoadTestConfig.UserEntitiesConfiguration.NumIncomingWebhooks = 1
+		c.webhooks = webhooks
+		adminClient.Returns["CreateIncomingWebhook"] = &model.IncomingWebhook{Id: "hookid1"}
+		c.AdminClient = &fillingAdminClient{mockClient: adminClient, webhooks: webhooks}
+
+		actionPostWebhook(c)
+
+		assert.Equal(t, []string{"PostIncomingWebhook"}, client.Methods())
+		assert.Equal(t, "hookid1", client.Calls()[0].Args[0], "the created webhook should still be used")
+		assert.Equal(t, []incomingWebhook{{Id: "hookid0", TeamName: "team0"}}, webhooks.hooks, "the pool should not grow past its size")
+	})
+
+	t.Run("overrides the username, icon and channel", func(t *testing.T) {
+		c, client, adminClient, _ := newTestEntityConfig()
+		c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookUsernameOverrideChance = 1
+		c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookIconOverrideChance = 1
+		c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookChannelOverrideChance = 1
+		c.LoadTestConfig.UserEntitiesConfiguration.IncomingWebhookPayloads = []IncomingWebhookPayload{{Type: WEBHOOK_PAYLOAD_ATTACHMENTS, Weight: 1}}
+		adminClient.Returns["CreateIncomingWebhook"] = &model.IncomingWebhook{Id: "hookid0"}
+
+		actionPostWebhook(c)
+
+		require.Equal(t, []string{"PostIncomingWebhook"}, client.Methods())
+		request := client.Calls()[0].Args[1].(*model.IncomingWebhookRequest)
+		assert.Equal(t, WEBHOOK_OVERRIDE_USERNAME, request.Username)
+		assert.Equal(t, WEBHOOK_OVERRIDE_ICON_URL, request.IconURL)
+		assert.Equal(t, "channel0", request.ChannelName)
+		assert.NotEmpty(t, request.Attachments)
+	})
+
+	t.Run("fails to post", func(t *testing.T) {
+		c, client, adminClient, _ := newTestEntityConfig()
+		adminClient.Returns["CreateIncomingWebhook"] = &model.IncomingWebhook{Id: "hookid0"}
+		client.fail("PostIncomingWebhook")
+
+		actionPostWebhook(c)
+
+		assert.Equal(t, []string{"PostIncomingWebhook"}, client.Methods())
+	})
+}
+
+func TestThreadState(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var ts threadState
+
+	_, ok := ts.pick(r, "")
+	assert.False(t, ok)
+
+	ts.remember(&model.Post{Id: "postid0", ChannelId: "channelid0"}, "")
+	_, ok = ts.pick(r, "")
+	assert.False(t, ok, "posts outside of teams should be ignored")
+
+	for i := 0; i < THREADS_REMEMBERED_PER_CHANNEL+5; i++ {
+		ts.remember(&model.Post{Id: model.NewId(), ChannelId: "channelid0"}, "teamid0")
+	}
+	ts.remember(&model.Post{Id: "postid1", ChannelId: "channelid0", RootId: "rootid0"}, "teamid0")
+	ts.remember(&model.Post{Id: "postid2", ChannelId: "channelid0", RootId: "rootid0"}, "teamid0")
+	assert.Len(t, ts.threads["channelid0"], THREADS_REMEMBERED_PER_CHANNEL)
+	assert.Equal(t, seenThread{RootId: "rootid0", ChannelId: "channelid0", TeamId: "teamid0"}, ts.threads["channelid0"][THREADS_REMEMBERED_PER_CHANNEL-1])
+
+	thread, ok := ts.pick(r, "channelid0")
+	assert.True(t, ok)
+	assert.Equal(t, "channelid0", thread.ChannelId)
+	_, ok = ts.pick(r, "channelid1")
+	assert.False(t, ok)
+}
+
+func TestAddMentions(t *testing.T) {
+	c, _, _, _ := newTestEntityConfig()
+	c.Users[1].Teams = []UserTeamImportData{{Name: "team0", Channels: []UserChannelImportData{{Name: "channel0"}}}}
+	c.Users = append(c.Users, UserImportData{Username: "user2", Teams: []UserTeamImportData{{Name: "team0"}}})
+	c.channelMembers = newChannelMembers(c.Users, c.ChannelMap, c.TownSquareMap)
+
+	assert.Equal(t, channelMembers{
+		"channelid0":    {"user0", "user1"},
+		"townsquareid0": {"user0", "user1", "user2"},
+	}, c.channelMembers)
+
+	assert.Equal(t, "hello", addMentions(c, "channelid0", "hello"))
+
+	c.LoadTestConfig.UserEntitiesConfiguration.UserMentionChance = 1
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "hello @user1", addMentions(c, "channelid0", "hello"), "the entity should not mention itself")
+	}
+	assert.Equal(t, "hello", addMentions(c, "channelid1", "hello"))
+
+	c.LoadTestConfig.UserEntitiesConfiguration.UserMentionChance = 0
+	c.LoadTestConfig.UserEntitiesConfiguration.HereMentionChance = 1
+	c.LoadTestConfig.UserEntitiesConfiguration.ChannelMentionChance = 1
+	c.LoadTestConfig.UserEntitiesConfiguration.KeywordMentionChance = 1
+	words := strings.Fields(addMentions(c, "channelid0", "hello"))
+	require.Len(t, words, 4)
+	assert.Equal(t, "@here", words[1])
+	assert.Contains(t, []string{"@channel", "@all"}, words[2])
+	assert.Contains(t, MENTION_KEYWORDS, words[3])
+}
+
+func TestMentionState(t *testing.T) {
+	var ms mentionState
+
+	posted := func(mentions ...string) *model.WebSocketEvent {
+		event := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_POSTED, "", "channelid0", "", nil)
+		if mentions != nil {
+			event.Add("mentions", model.ArrayToJson(mentions))
+		}
+		return event
+	}
+
+	ms.receivedEvent(posted("userid0"), "")
+	assert.Equal(t, int64(0), ms.count(), "mentions before the user id is known cannot be attributed")
+
+	ms.receivedEvent(posted("userid1", "userid0"), "userid0")
+	ms.receivedEvent(posted("userid1"), "userid0")
+	ms.receivedEvent(posted(), "userid0")
+	assert.Equal(t, int64(1), ms.count())
+}
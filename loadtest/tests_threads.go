@@ -0,0 +1,325 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// An entity remembers at most this many of the threads it has seen in each channel.
+const THREADS_REMEMBERED_PER_CHANNEL = 20
+
+// The webapp fetches the followed threads a page at a time.
+const USER_THREADS_PAGE_SIZE = 25
+
+// seenThread is a thread an entity has seen, and so can reply to or follow.
+type seenThread struct {
+	RootId    string
+	ChannelId string
+	TeamId    string
+}
+
+// threadState remembers the threads an entity has seen in posts it fetched or received over its
+// websocket. It is shared between an entity's actions and its websocket listener.
+type threadState struct {
+	lock sync.Mutex
+	// threads maps channel ids to the threads recently seen in them, oldest first.
+	threads    map[string][]seenThread
+	channelIds []string
+	// following records the threads the entity follows.
+	following map[string]bool
+}
+
+// remember records the thread the given post belongs to. Posts outside of teams are ignored,
+// since threads are listed and followed per team.
+func (ts *threadState) remember(post *model.Post, teamId string) {
+	if post == nil || teamId == "" {
+		return
+	}
+
+	thread := seenThread{
+		RootId:    post.RootId,
+		ChannelId: post.ChannelId,
+		TeamId:    teamId,
+	}
+	if thread.RootId == "" {
+		thread.RootId = post.Id
+	}
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if ts.threads == nil {
+		ts.threads = make(map[string][]seenThread)
+	}
+
+	threads, ok := ts.threads[post.ChannelId]
+	if !ok {
+		ts.channelIds = append(ts.channelIds, post.ChannelId)
+	}
+	for i, seen := range threads {
+		if seen.RootId == thread.RootId {
+			threads = append(threads[:i], threads[i+1:]...)
+			break
+		}
+	}
+	threads = append(threads, thread)
+	if len(threads) > THREADS_REMEMBERED_PER_CHANNEL {
+		threads = threads[1:]
+	}
+	ts.threads[post.ChannelId] = threads
+}
+
+// rememberList records the threads of all the given posts.
+func (ts *threadState) rememberList(posts *model.PostList, teamId string) {
+	if posts == nil {
+		return
+	}
+
+	for _, postId := range posts.Order {
+		ts.remember(posts.Posts[postId], teamId)
+	}
+}
+
+// pick returns a random thread seen in the given channel, or in any channel if none is given.
+func (ts *threadState) pick(r *rand.Rand, channelId string) (seenThread, bool) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if channelId == "" {
+		if len(ts.channelIds) == 0 {
+			return seenThread{}, false
+		}
+		channelId = ts.channelIds[r.Intn(len(ts.channelIds))]
+	}
+
+	threads := ts.threads[channelId]
+	if len(threads) == 0 {
+		return seenThread{}, false
+	}
+
+	return threads[r.Intn(len(threads))], true
+}
+
+// forget drops the thread with the given root post, once the root post has been deleted.
+func (ts *threadState) forget(channelId, rootId string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	threads := ts.threads[channelId]
+	for i, seen := range threads {
+		if seen.RootId == rootId {
+			ts.threads[channelId] = append(threads[:i], threads[i+1:]...)
+			break
+		}
+	}
+	delete(ts.following, rootId)
+}
+
+// setFollowing records whether the entity follows the given thread.
+func (ts *threadState) setFollowing(rootId string, following bool) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if ts.following == nil {
+		ts.following = make(map[string]bool)
+	}
+	ts.following[rootId] = following
+}
+
+func (ts *threadState) isFollowing(rootId string) bool {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	return ts.following[rootId]
+}
+
+// pickThread returns a thread the entity has seen, first loading the posts of a random channel
+// if it has not seen any yet.
+func pickThread(c *EntityConfig) (seenThread, bool) {
+	if thread, ok := c.threads.pick(c.r, ""); ok {
+		return thread, true
+	}
+
+	team, channel := c.UserData.PickTeamChannel(c.r)
+	if team == nil || channel == nil {
+		return seenThread{}, false
+	}
+
+	channelId, err := c.GetTeamChannelId(team.Name, channel.Name)
+	if err != nil {
+		mlog.Error("Unable to get channel from map", mlog.String("team", team.Name), mlog.String("channel", channel.Name), mlog.Err(err))
+		return seenThread{}, false
+	}
+
+	posts, resp := c.Client.GetPostsForChannel(channelId, 0, 60, "")
+	if resp.Error != nil {
+		mlog.Error("Unable to get posts for channel", mlog.String("channel_id", channelId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return seenThread{}, false
+	}
+	c.threads.rememberList(posts, c.TeamMap[team.Name])
+
+	return c.threads.pick(c.r, channelId)
+}
+
+// replyToThread posts a reply to the given thread, which the server then has the entity follow.
+func replyToThread(c *EntityConfig, thread seenThread) {
+	post, resp := c.Client.CreatePost(&model.Post{
+		ChannelId: thread.ChannelId,
+		RootId:    thread.RootId,
+		ParentId:  thread.RootId,
+		Message:   fake.Sentences(),
+	})
+	if resp.Error != nil {
+		mlog.Info("Failed to reply to thread", mlog.String("channel_id", thread.ChannelId), mlog.String("root_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.threads.remember(post, thread.TeamId)
+	c.posts.rememberOwn(post)
+	c.threads.setFollowing(thread.RootId, true)
+}
+
+func actionReplyToThread(c *EntityConfig) {
+	thread, ok := pickThread(c)
+	if !ok {
+		return
+	}
+
+	replyToThread(c, thread)
+}
+
+// actionViewThread opens a thread in the right-hand sidebar, marking it read if it is followed.
+func actionViewThread(c *EntityConfig) {
+	thread, ok := pickThread(c)
+	if !ok {
+		return
+	}
+
+	if _, resp := c.Client.GetPostThread(thread.RootId, ""); resp.Error != nil {
+		mlog.Error("Failed to get post thread", mlog.String("root_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	if !c.threads.isFollowing(thread.RootId) {
+		return
+	}
+
+	if _, resp := c.Client.UpdateThreadReadForUser("me", thread.TeamId, thread.RootId, model.GetMillis()); resp.Error != nil {
+		mlog.Error("Failed to mark thread read", mlog.String("root_id", thread.RootId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+	}
+}
+
+// actionFollowThread follows a thread, or unfollows it if it was already followed.
+func actionFollowThread(c *EntityConfig) {
+	thread, ok := pickThread(c)
+	if !ok {
+		return
+	}
+
+	follow := !c.threads.isFollowing(thread.RootId)
+	if _, resp := c.Client.UpdateThreadFollowForUser("me", thread.TeamId, thread.RootId, follow); resp.Error != nil {
+		mlog.Error("Failed to update thread following", mlog.String("root_id", thread.RootId), mlog.Bool("follow", follow), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	c.threads.setFollowing(thread.RootId, follow)
+}
+
+// actionGetUserThreads opens the threads view of a team, and reads the first unread thread.
+func actionGetUserThreads(c *EntityConfig) {
+	team := c.UserData.PickTeam(c.r)
+	if team == nil {
+		return
+	}
+	teamId := c.TeamMap[team.Name]
+	if teamId == "" {
+		mlog.Error("Unable to get team from map", mlog.String("team", team.Name))
+		return
+	}
+
+	threads, resp := c.Client.GetUserThreads("me", teamId, 0, USER_THREADS_PAGE_SIZE)
+	if resp.Error != nil {
+		mlog.Error("Failed to get user threads", mlog.String("team_id", teamId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		return
+	}
+
+	for _, thread := range threads.Threads {
+		c.threads.setFollowing(thread.PostId, true)
+	}
+
+	for _, thread := range threads.Threads {
+		if thread.UnreadReplies == 0 && thread.UnreadMentions == 0 {
+			continue
+		}
+
+		if _, resp := c.Client.GetPostThread(thread.PostId, ""); resp.Error != nil {
+			mlog.Error("Failed to get post thread", mlog.String("root_id", thread.PostId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+			return
+		}
+		if _, resp := c.Client.UpdateThreadReadForUser("me", teamId, thread.PostId, model.GetMillis()); resp.Error != nil {
+			mlog.Error("Failed to mark thread read", mlog.String("root_id", thread.PostId), mlog.String("username", c.UserData.Username), mlog.Err(resp.Error))
+		}
+		return
+	}
+}
+
+var threadsUserEntity UserEntity = UserEntity{
+	Name: "Threads",
+	Actions: []randutil.Choice{
+		{
+			Item:   actionGetChannel,
+			Weight: 20,
+		},
+		{
+			Item:   actionPost,
+			Weight: 5,
+		},
+		{
+			Item:   actionReplyToThread,
+			Weight: 10,
+		},
+		{
+			Item:   actionViewThread,
+			Weight: 10,
+		},
+		{
+			Item:   actionGetUserThreads,
+			Weight: 8,
+		},
+		{
+			Item:   actionFollowThread,
+			Weight: 3,
+		},
+		{
+			Item:   actionGetTeamUnreads,
+			Weight: 5,
+		},
+	},
+}
+
+var TestThreads TestRun = TestRun{
+	UserEntities: []randutil.Choice{
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         standardUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 50,
+		},
+		{
+			Item: UserEntityWithRateMultiplier{
+				Entity:         threadsUserEntity,
+				RateMultiplier: 1.0,
+			},
+			Weight: 50,
+		},
+	},
+}
@@ -5,6 +5,9 @@ package loadtest
 
 import (
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,38 +15,199 @@ type TimedRoundTripperReport struct {
 	Method          string
 	Path            string
 	RequestDuration time.Duration
-	StatusCode      int
+	// CorrectedDuration is the request duration plus however late the enclosing action started
+	// relative to its intended start time. It is zero unless latency correction is enabled.
+	CorrectedDuration time.Duration
+	StatusCode        int
+	// Protocol is the protocol negotiated for the response, such as HTTP/1.1 or HTTP/2.0.
+	Protocol string
+	// Endpoint names the app node the request was sent to. It is empty unless timings are
+	// reported by endpoint.
+	Endpoint string
 }
 
 type TimedRoundTripper struct {
 	standardRoundTripper http.RoundTripper
 	reportChan           chan<- TimedRoundTripperReport
+	endpoint             string
+
+	// actionLag is the delay, in nanoseconds, between the intended and actual start of the
+	// action currently issuing requests through this round tripper. A negative value disables
+	// reporting of corrected durations.
+	actionLag int64
+
+	createAt time.Time
+
+	// rateLimitLock protects throttledUntil and throttledDuration, which track the windows
+	// during which the server asked this client to stop sending requests.
+	rateLimitLock     sync.Mutex
+	throttledUntil    time.Time
+	throttledDuration time.Duration
 }
 
 func NewTimedRoundTripper(reportChan chan<- TimedRoundTripperReport) *TimedRoundTripper {
 	rt := &TimedRoundTripper{
 		standardRoundTripper: http.DefaultTransport,
 		reportChan:           reportChan,
+		actionLag:            -1,
+		createAt:             time.Now(),
 	}
 
 	return rt
 }
 
+// SetTransport replaces the round tripper used to send requests, which defaults to
+// http.DefaultTransport. It must be called before the first request.
+func (trt *TimedRoundTripper) SetTransport(transport http.RoundTripper) {
+	trt.standardRoundTripper = transport
+}
+
+// SetEndpoint names the app node this round tripper sends requests to, so that timings can be
+// broken down by node.
+func (trt *TimedRoundTripper) SetEndpoint(name string) {
+	trt.endpoint = name
+}
+
+// SetActionLag records how late the current action started relative to its intended start
+// time, so that subsequent requests also report a duration corrected for coordinated omission.
+func (trt *TimedRoundTripper) SetActionLag(lag time.Duration) {
+	if lag < 0 {
+		lag = 0
+	}
+	atomic.StoreInt64(&trt.actionLag, int64(lag))
+}
+
+// ClearActionLag stops correcting the durations of subsequent requests, once the action that
+// started late has completed.
+func (trt *TimedRoundTripper) ClearActionLag() {
+	atomic.StoreInt64(&trt.actionLag, -1)
+}
+
+// Uncorrected returns a round tripper for requests made alongside actions rather than by them.
+// It sends requests through this round tripper, but never corrects their durations.
+func (trt *TimedRoundTripper) Uncorrected() http.RoundTripper {
+	return uncorrectedRoundTripper{trt}
+}
+
+type uncorrectedRoundTripper struct {
+	trt *TimedRoundTripper
+}
+
+func (urt uncorrectedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return urt.trt.roundTrip(r, false)
+}
+
+// ThrottledUntil returns the time before which the server has asked for no further requests.
+func (trt *TimedRoundTripper) ThrottledUntil() time.Time {
+	trt.rateLimitLock.Lock()
+	defer trt.rateLimitLock.Unlock()
+
+	return trt.throttledUntil
+}
+
+// ThrottledFraction returns the fraction of time since the round tripper was created during
+// which the server had asked for no further requests.
+func (trt *TimedRoundTripper) ThrottledFraction(now time.Time) float64 {
+	trt.rateLimitLock.Lock()
+	defer trt.rateLimitLock.Unlock()
+
+	throttled := trt.throttledDuration
+	if trt.throttledUntil.After(now) {
+		throttled -= trt.throttledUntil.Sub(now)
+	}
+
+	elapsed := now.Sub(trt.createAt)
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(throttled) / float64(elapsed)
+}
+
+// parseRateLimitSeconds parses a header value given as a number of seconds, as used by both the
+// Retry-After and X-RateLimit-Reset headers.
+func parseRateLimitSeconds(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	// Retry-After may also be given as an HTTP date.
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+func (trt *TimedRoundTripper) recordRateLimit(resp *http.Response, now time.Time) {
+	var wait time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait = parseRateLimitSeconds(resp.Header.Get("Retry-After"), now)
+		if wait <= 0 {
+			wait = parseRateLimitSeconds(resp.Header.Get("X-Ratelimit-Reset"), now)
+		}
+	} else if resp.Header.Get("X-Ratelimit-Remaining") == "0" {
+		wait = parseRateLimitSeconds(resp.Header.Get("X-Ratelimit-Reset"), now)
+	}
+
+	if wait <= 0 {
+		return
+	}
+
+	trt.rateLimitLock.Lock()
+	defer trt.rateLimitLock.Unlock()
+
+	until := now.Add(wait)
+	if !until.After(trt.throttledUntil) {
+		return
+	}
+
+	// Only count the portion of the window not already covered by an earlier one.
+	from := now
+	if trt.throttledUntil.After(from) {
+		from = trt.throttledUntil
+	}
+	trt.throttledDuration += until.Sub(from)
+	trt.throttledUntil = until
+}
+
 func (trt *TimedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return trt.roundTrip(r, true)
+}
+
+// roundTrip sends the request and reports its duration, also corrected for the lag of the
+// current action if correct is set.
+func (trt *TimedRoundTripper) roundTrip(r *http.Request, correct bool) (*http.Response, error) {
 	requestStart := time.Now()
 	resp, err := trt.standardRoundTripper.RoundTrip(r)
 	requestEnd := time.Now()
 
 	statuscode := 544
+	var protocol string
 	if resp != nil {
 		statuscode = resp.StatusCode
+		protocol = resp.Proto
+		trt.recordRateLimit(resp, requestEnd)
+	}
+
+	requestDuration := requestEnd.Sub(requestStart)
+	var correctedDuration time.Duration
+	if lag := atomic.LoadInt64(&trt.actionLag); correct && lag >= 0 {
+		correctedDuration = requestDuration + time.Duration(lag)
 	}
 
 	trt.reportChan <- TimedRoundTripperReport{
-		Method:          r.Method,
-		Path:            r.URL.Path,
-		RequestDuration: requestEnd.Sub(requestStart),
-		StatusCode:      statuscode,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		RequestDuration:   requestDuration,
+		CorrectedDuration: correctedDuration,
+		StatusCode:        statuscode,
+		Protocol:          protocol,
+		Endpoint:          trt.endpoint,
 	}
 
 	return resp, err
@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// HTTPProtocolAuto negotiates HTTP/2 with servers that offer it, and HTTP/1.1 otherwise.
+	HTTPProtocolAuto = "auto"
+	// HTTPProtocolHTTP1 only ever speaks HTTP/1.1.
+	HTTPProtocolHTTP1 = "http1"
+	// HTTPProtocolHTTP2 only offers HTTP/2 when negotiating TLS connections.
+	HTTPProtocolHTTP2 = "http2"
+)
+
+// NewTLSConfig returns the TLS configuration for connections to the server, loading any CA bundle
+// and client certificate named in the connection configuration.
+func NewTLSConfig(cfg *ConnectionConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if cfg.TLSCAFile != "" {
+		caBundle, err := ioutil.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read CA bundle")
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.TLSCAFile)
+		}
+	}
+
+	if cfg.TLSClientCertFile != "" || cfg.TLSClientKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.TLSClientCertFile, cfg.TLSClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// configureHTTPProtocol sets up the transport to speak the given protocol over TLS connections.
+func configureHTTPProtocol(transport *http.Transport, protocol string) error {
+	switch protocol {
+	case "", HTTPProtocolAuto:
+		return http2.ConfigureTransport(transport)
+	case HTTPProtocolHTTP1:
+		// A non-nil, empty map prevents the transport from upgrading to HTTP/2.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return nil
+	case HTTPProtocolHTTP2:
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return err
+		}
+		transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+		return nil
+	}
+
+	return fmt.Errorf("unknown HTTP protocol %q", protocol)
+}
+
+// NewWebSocketDialer returns a websocket dialer sharing the TLS configuration used for REST requests.
+func NewWebSocketDialer(tlsConfig *tls.Config) *websocket.Dialer {
+	// Websockets are always upgraded from HTTP/1.1, whatever protocol REST requests use.
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = nil
+
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mattermost/mattermost-server/v5/mlog"
+)
+
+const (
+	// ConnectionModelShared sends the requests of all entities through a single connection pool.
+	ConnectionModelShared = "shared"
+	// ConnectionModelPerEntity gives each entity its own connection pool, limited like a browser's.
+	ConnectionModelPerEntity = "per_entity"
+	// ConnectionModelPerRequest opens a new connection for every request.
+	ConnectionModelPerRequest = "per_request"
+)
+
+// connectionTracker counts the connections dialed by the transports sharing it.
+type connectionTracker struct {
+	dialer *net.Dialer
+
+	open  int64
+	peak  int64
+	total int64
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker   *connectionTracker
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(&c.tracker.open, -1)
+	})
+
+	return c.Conn.Close()
+}
+
+func (ct *connectionTracker) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := ct.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&ct.total, 1)
+	open := atomic.AddInt64(&ct.open, 1)
+	for {
+		peak := atomic.LoadInt64(&ct.peak)
+		if open <= peak || atomic.CompareAndSwapInt64(&ct.peak, peak, open) {
+			break
+		}
+	}
+
+	return &trackedConn{Conn: conn, tracker: ct}, nil
+}
+
+// ConnectionStats summarizes the HTTP connections opened by the loadtest agent.
+type ConnectionStats struct {
+	Open  int64
+	Peak  int64
+	Total int64
+}
+
+// TransportFactory creates the HTTP transports used by the admin client and user entities,
+// according to the configured connection model.
+type TransportFactory struct {
+	cfg       *ConnectionConfiguration
+	tracker   *connectionTracker
+	tlsConfig *tls.Config
+	shared    *http.Transport
+}
+
+// NewTransportFactory returns a factory for the connection model in the given configuration.
+func NewTransportFactory(cfg *ConnectionConfiguration) (*TransportFactory, error) {
+	switch cfg.ConnectionModel {
+	case "", ConnectionModelShared, ConnectionModelPerEntity, ConnectionModelPerRequest:
+	default:
+		return nil, fmt.Errorf("unknown connection model %q", cfg.ConnectionModel)
+	}
+
+	tlsConfig, err := NewTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &TransportFactory{
+		cfg: cfg,
+		tracker: &connectionTracker{
+			dialer: &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			},
+		},
+		tlsConfig: tlsConfig,
+	}
+	tf.shared = tf.newTransport(cfg.MaxIdleConns, cfg.MaxIdleConnsPerHost, 0)
+	if err := configureHTTPProtocol(tf.shared, cfg.HTTPProtocol); err != nil {
+		return nil, err
+	}
+
+	return tf, nil
+}
+
+// newTransport mirrors http.DefaultTransport, with the given connection limits.
+func (tf *TransportFactory) newTransport(maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost int) *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           tf.tracker.DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		MaxConnsPerHost:       maxConnsPerHost,
+		IdleConnTimeout:       time.Duration(tf.cfg.IdleConnTimeoutMilliseconds) * time.Millisecond,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tf.tlsConfig.Clone(),
+	}
+}
+
+// newHTTPClient returns a client for setup requests made outside of a test run, using the
+// configured TLS settings.
+func newHTTPClient(cfg *ConnectionConfiguration) (*http.Client, error) {
+	transports, err := NewTransportFactory(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: transports.Shared()}, nil
+}
+
+// Shared returns the transport shared by the admin client and, in the shared connection
+// model, all entities.
+func (tf *TransportFactory) Shared() *http.Transport {
+	return tf.shared
+}
+
+// EntityTransport returns the transport a newly started entity should use.
+func (tf *TransportFactory) EntityTransport() *http.Transport {
+	var transport *http.Transport
+	switch tf.cfg.ConnectionModel {
+	case ConnectionModelPerEntity:
+		maxConns := tf.cfg.MaxConnsPerEntity
+		transport = tf.newTransport(maxConns, maxConns, maxConns)
+	case ConnectionModelPerRequest:
+		transport = tf.newTransport(0, 0, 0)
+		transport.DisableKeepAlives = true
+	default:
+		return tf.shared
+	}
+
+	// The protocol was validated when configuring the shared transport.
+	if err := configureHTTPProtocol(transport, tf.cfg.HTTPProtocol); err != nil {
+		mlog.Error("Failed to configure HTTP protocol", mlog.String("protocol", tf.cfg.HTTPProtocol), mlog.Err(err))
+	}
+
+	return transport
+}
+
+// WebSocketDialer returns a dialer for websocket connections using the configured TLS settings.
+func (tf *TransportFactory) WebSocketDialer() *websocket.Dialer {
+	return NewWebSocketDialer(tf.tlsConfig)
+}
+
+// Stats returns the number of connections currently open, the most ever open at once, and the
+// total number dialed across all transports created by the factory.
+func (tf *TransportFactory) Stats() ConnectionStats {
+	return ConnectionStats{
+		Open:  atomic.LoadInt64(&tf.tracker.open),
+		Peak:  atomic.LoadInt64(&tf.tracker.peak),
+		Total: atomic.LoadInt64(&tf.tracker.total),
+	}
+}
+
+// userAgentRoundTripper identifies requests as coming from a particular client, such as one of
+// the mobile apps.
+type userAgentRoundTripper struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (uart *userAgentRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Round trippers must not modify the request they are given.
+	withUserAgent := new(http.Request)
+	*withUserAgent = *r
+	withUserAgent.Header = make(http.Header, len(r.Header)+1)
+	for key, values := range r.Header {
+		withUserAgent.Header[key] = values
+	}
+	withUserAgent.Header.Set("User-Agent", uart.userAgent)
+
+	return uart.next.RoundTrip(withUserAgent)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportFactory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	get := func(t *testing.T, transport http.RoundTripper) {
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		require.NoError(t, err)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	newConfig := func(connectionModel string) *ConnectionConfiguration {
+		return &ConnectionConfiguration{
+			ConnectionModel:             connectionModel,
+			MaxIdleConns:                100,
+			MaxIdleConnsPerHost:         128,
+			MaxConnsPerEntity:           6,
+			IdleConnTimeoutMilliseconds: 90000,
+		}
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		transports, err := NewTransportFactory(newConfig(ConnectionModelShared))
+		require.NoError(t, err)
+		defer transports.Shared().CloseIdleConnections()
+
+		for i := 0; i < 3; i++ {
+			get(t, transports.EntityTransport())
+		}
+		assert.Equal(t, transports.Shared(), transports.EntityTransport())
+		assert.Equal(t, ConnectionStats{Open: 1, Peak: 1, Total: 1}, transports.Stats())
+	})
+
+	t.Run("per entity", func(t *testing.T) {
+		transports, err := NewTransportFactory(newConfig(ConnectionModelPerEntity))
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			transport := transports.EntityTransport()
+			assert.Equal(t, 6, transport.MaxConnsPerHost)
+			get(t, transport)
+			get(t, transport)
+			defer transport.CloseIdleConnections()
+		}
+		assert.Equal(t, ConnectionStats{Open: 3, Peak: 3, Total: 3}, transports.Stats())
+	})
+
+	t.Run("per request", func(t *testing.T) {
+		transports, err := NewTransportFactory(newConfig(ConnectionModelPerRequest))
+		require.NoError(t, err)
+
+		transport := transports.EntityTransport()
+		for i := 0; i < 3; i++ {
+			get(t, transport)
+		}
+		assert.Equal(t, int64(3), transports.Stats().Total)
+	})
+
+	t.Run("rejects an unknown model", func(t *testing.T) {
+		_, err := NewTransportFactory(newConfig("pipelined"))
+		assert.Error(t, err)
+	})
+}
+
+func TestTransportFactoryTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "loadtest-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, caBundle, 0600))
+
+	get := func(cfg *ConnectionConfiguration) (*http.Response, error) {
+		transports, err := NewTransportFactory(cfg)
+		require.NoError(t, err)
+		defer transports.Shared().CloseIdleConnections()
+
+		resp, err := (&http.Client{Transport: transports.Shared()}).Get(server.URL)
+		if err != nil {
+			return nil, err
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		return resp, nil
+	}
+
+	t.Run("rejects an unknown certificate authority", func(t *testing.T) {
+		_, err := get(&ConnectionConfiguration{})
+		assert.Error(t, err)
+	})
+
+	t.Run("skips verification", func(t *testing.T) {
+		resp, err := get(&ConnectionConfiguration{TLSInsecureSkipVerify: true})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/2.0", resp.Proto)
+	})
+
+	t.Run("trusts the configured certificate authority", func(t *testing.T) {
+		resp, err := get(&ConnectionConfiguration{TLSCAFile: caFile})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/2.0", resp.Proto)
+	})
+
+	t.Run("forces HTTP/1.1", func(t *testing.T) {
+		resp, err := get(&ConnectionConfiguration{TLSCAFile: caFile, HTTPProtocol: HTTPProtocolHTTP1})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1", resp.Proto)
+	})
+
+	t.Run("rejects an unknown protocol", func(t *testing.T) {
+		_, err := NewTransportFactory(&ConnectionConfiguration{HTTPProtocol: "spdy"})
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects a missing client certificate", func(t *testing.T) {
+		_, err := NewTransportFactory(&ConnectionConfiguration{TLSClientCertFile: filepath.Join(dir, "missing.pem")})
+		assert.Error(t, err)
+	})
+}
+
+func TestUserAgentRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.UserAgent()))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	request.Header.Set("User-Agent", "Go")
+
+	resp, err := (&userAgentRoundTripper{http.DefaultTransport, MOBILE_USER_AGENT_IOS}).RoundTrip(request)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, MOBILE_USER_AGENT_IOS, string(body))
+	assert.Equal(t, "Go", request.Header.Get("User-Agent"))
+}
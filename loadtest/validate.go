@@ -0,0 +1,408 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// percentageTolerance allows for rounding when checking that percentages sum to one.
+const percentageTolerance = 0.001
+
+// ValidationResult collects every problem found with a configuration, so that they can all be
+// fixed before starting a test rather than one at a time as the test fails.
+type ValidationResult struct {
+	// Problems prevent a test from running as configured.
+	Problems []string
+	// Warnings are worth fixing, but a test can run regardless.
+	Warnings []string
+}
+
+func (vr *ValidationResult) problem(format string, args ...interface{}) {
+	vr.Problems = append(vr.Problems, fmt.Sprintf(format, args...))
+}
+
+func (vr *ValidationResult) warning(format string, args ...interface{}) {
+	vr.Warnings = append(vr.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Err returns an error listing every problem found, or nil if there were none.
+func (vr *ValidationResult) Err() error {
+	if len(vr.Problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(vr.Problems, "\n  "))
+}
+
+// ValidateConfig checks the configuration for a test spread over the given number of loadtest
+// agents, optionally also checking that the server, database, websocket, pprof endpoint and
+// app server commands can all be reached.
+func ValidateConfig(cfg *LoadTestConfig, numInstances int, checkConnectivity bool) *ValidationResult {
+	vr := &ValidationResult{}
+
+	vr.checkEnvironment(&cfg.LoadtestEnviromentConfig)
+	vr.checkUserEntities(&cfg.UserEntitiesConfiguration)
+	vr.checkConnection(&cfg.ConnectionConfiguration)
+	vr.checkTestFiles(cfg)
+
+	if numInstances < 1 {
+		numInstances = 1
+	}
+	if numEntities := cfg.UserEntitiesConfiguration.NumActiveEntities * numInstances; numEntities > cfg.LoadtestEnviromentConfig.NumUsers {
+		vr.problem("%d active entities on each of %d instances need %d users, but NumUsers is %d", cfg.UserEntitiesConfiguration.NumActiveEntities, numInstances, numEntities, cfg.LoadtestEnviromentConfig.NumUsers)
+	}
+
+	if cfg.ResultsConfiguration.PProfDelayMinutes < 0 {
+		vr.problem("PProfDelayMinutes must not be negative")
+	} else if cfg.ResultsConfiguration.PProfDelayMinutes > cfg.UserEntitiesConfiguration.TestLengthMinutes {
+		vr.warning("PProfDelayMinutes is longer than the test, so no profile will be taken")
+	}
+	if cfg.ResultsConfiguration.PProfDelayMinutes > 0 {
+		if cfg.ResultsConfiguration.PProfLength <= 0 {
+			vr.problem("PProfLength must be positive when PProfDelayMinutes is set")
+		}
+		if cfg.ConnectionConfiguration.PProfURL == "" {
+			vr.problem("PProfURL must be set when PProfDelayMinutes is set")
+		}
+	}
+
+	if checkConnectivity {
+		vr.checkConnectivity(cfg)
+	}
+
+	return vr
+}
+
+// checkChances checks that every float field named as a chance or percentage is between zero and one.
+func (vr *ValidationResult) checkChances(section string, config interface{}) {
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Type.Kind() != reflect.Float64 {
+			continue
+		}
+		if !strings.HasSuffix(field.Name, "Chance") && !strings.HasPrefix(field.Name, "Percent") {
+			continue
+		}
+
+		if chance := value.Field(i).Float(); chance < 0 || chance > 1 {
+			vr.problem("%s.%s must be between 0 and 1, but is %v", section, field.Name, chance)
+		}
+	}
+}
+
+// checkSum checks that the named percentages add up to one.
+func (vr *ValidationResult) checkSum(section string, names []string, values ...float64) {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	if math.Abs(sum-1) > percentageTolerance {
+		vr.problem("%s.%s must add up to 1, but add up to %v", section, strings.Join(names, " + "), sum)
+	}
+}
+
+func (vr *ValidationResult) checkEnvironment(cfg *LoadtestEnviromentConfig) {
+	const section = "LoadtestEnviromentConfig"
+
+	vr.checkChances(section, cfg)
+	vr.checkSum(section, []string{"PercentHighVolumeChannels", "PercentMidVolumeChannels", "PercentLowVolumeChannels"},
+		cfg.PercentHighVolumeChannels, cfg.PercentMidVolumeChannels, cfg.PercentLowVolumeChannels)
+	vr.checkSum(section, []string{"PercentHighVolumeTeams", "PercentMidVolumeTeams", "PercentLowVolumeTeams"},
+		cfg.PercentHighVolumeTeams, cfg.PercentMidVolumeTeams, cfg.PercentLowVolumeTeams)
+
+	if cfg.NumTeams < 1 {
+		vr.problem("%s.NumTeams must be at least 1", section)
+	}
+	if cfg.NumUsers < 1 {
+		vr.problem("%s.NumUsers must be at least 1", section)
+	}
+
+	for _, count := range []struct {
+		name  string
+		value int
+	}{
+		{"NumChannelsPerTeam", cfg.NumChannelsPerTeam},
+		{"NumPrivateChannelsPerTeam", cfg.NumPrivateChannelsPerTeam},
+		{"NumDirectMessageChannels", cfg.NumDirectMessageChannels},
+		{"NumGroupMessageChannels", cfg.NumGroupMessageChannels},
+		{"NumTeamSchemes", cfg.NumTeamSchemes},
+		{"NumChannelSchemes", cfg.NumChannelSchemes},
+		{"NumEmoji", cfg.NumEmoji},
+		{"NumPlugins", cfg.NumPlugins},
+		{"NumBots", cfg.NumBots},
+		{"NumBotChannelsPerTeam", cfg.NumBotChannelsPerTeam},
+		{"NumPosts", cfg.NumPosts},
+	} {
+		if count.value < 0 {
+			vr.problem("%s.%s must not be negative", section, count.name)
+		}
+	}
+
+	// Custom emoji are picked from all but the last one created.
+	if cfg.NumEmoji == 1 {
+		vr.problem("%s.NumEmoji must be 0 or at least 2", section)
+	}
+	vr.checkPlugins(section, cfg)
+}
+
+func (vr *ValidationResult) checkUserEntities(cfg *UserEntitiesConfiguration) {
+	const section = "UserEntitiesConfiguration"
+
+	vr.checkChances(section, cfg)
+	vr.checkSum(section, []string{"PublicChannelCreationChance", "PrivateChannelCreationChance", "DirectChannelCreationChance", "GroupChannelCreationChance"},
+		cfg.PublicChannelCreationChance, cfg.PrivateChannelCreationChance, cfg.DirectChannelCreationChance, cfg.GroupChannelCreationChance)
+
+	if cfg.TestLengthMinutes < 1 {
+		vr.problem("%s.TestLengthMinutes must be at least 1", section)
+	}
+	if cfg.NumActiveEntities < 1 {
+		vr.problem("%s.NumActiveEntities must be at least 1", section)
+	}
+	if cfg.ActionRateMilliseconds < 1 {
+		vr.problem("%s.ActionRateMilliseconds must be at least 1", section)
+	}
+	// The variance is passed to rand.Intn, which panics for anything less than one.
+	if cfg.ActionRateMaxVarianceMilliseconds < 1 {
+		vr.problem("%s.ActionRateMaxVarianceMilliseconds must be at least 1", section)
+	}
+	if cfg.TypingCharactersPerEvent < 0 {
+		vr.problem("%s.TypingCharactersPerEvent must not be negative", section)
+	}
+	if cfg.MobileBackgroundSeconds < 0 {
+		vr.problem("%s.MobileBackgroundSeconds must not be negative", section)
+	}
+
+	// These are chances of repeating a request, so a chance of one would never stop.
+	for _, repeat := range []struct {
+		name   string
+		chance float64
+	}{
+		{"NeedsProfilesByIdChance", cfg.NeedsProfilesByIdChance},
+		{"NeedsProfilesByUsernameChance", cfg.NeedsProfilesByUsernameChance},
+		{"NeedsProfileStatusChance", cfg.NeedsProfileStatusChance},
+	} {
+		if repeat.chance == 1 {
+			vr.problem("%s.%s must be less than 1", section, repeat.name)
+		}
+	}
+
+	vr.checkActionWeights(section, cfg.ActionWeights)
+	vr.checkFileUploads(section, cfg.FileUploads)
+	vr.checkSlashCommandResponses(section, cfg)
+	vr.checkIncomingWebhookPayloads(section, cfg)
+
+	entityNames := make(map[string]bool)
+	for i, conditions := range cfg.NetworkConditions {
+		name := fmt.Sprintf("%s.NetworkConditions[%d]", section, i)
+		if entityNames[conditions.EntityName] {
+			vr.problem("%s repeats the conditions for entity %q", name, conditions.EntityName)
+		}
+		entityNames[conditions.EntityName] = true
+
+		if conditions.LatencyMilliseconds < 0 || conditions.JitterMilliseconds < 0 || conditions.BandwidthKilobitsPerSecond < 0 {
+			vr.problem("%s must not have a negative latency, jitter or bandwidth", name)
+		}
+		if conditions.RequestDropChance < 0 || conditions.RequestDropChance > 1 {
+			vr.problem("%s.RequestDropChance must be between 0 and 1", name)
+		}
+		if conditions.WebsocketDropChance < 0 || conditions.WebsocketDropChance > 1 {
+			vr.problem("%s.WebsocketDropChance must be between 0 and 1", name)
+		}
+	}
+}
+
+func (vr *ValidationResult) checkConnection(cfg *ConnectionConfiguration) {
+	const section = "ConnectionConfiguration"
+
+	checkURL := func(name, value string, schemes ...string) {
+		if value == "" {
+			vr.problem("%s.%s must be set", section, name)
+			return
+		}
+
+		parsed, err := url.Parse(value)
+		if err != nil {
+			vr.problem("%s.%s is not a valid URL: %v", section, name, err)
+			return
+		}
+		for _, scheme := range schemes {
+			if parsed.Scheme == scheme {
+				return
+			}
+		}
+		vr.problem("%s.%s must be a %s URL", section, name, strings.Join(schemes, " or "))
+	}
+
+	checkURL("ServerURL", cfg.ServerURL, "http", "https")
+	checkURL("WebsocketURL", cfg.WebsocketURL, "ws", "wss")
+	if cfg.PProfURL != "" {
+		checkURL("PProfURL", cfg.PProfURL, "http", "https")
+	}
+	if cfg.IntegrationURL != "" {
+		checkURL("IntegrationURL", cfg.IntegrationURL, "http", "https")
+		// The server would call back an agent serving nothing, failing every command and click.
+		if cfg.IntegrationListenAddress == "" {
+			vr.problem("%s.IntegrationListenAddress must be set when IntegrationURL is set", section)
+		}
+	} else {
+		vr.warning("%s.IntegrationURL is not set, so integrations such as slash commands are not exercised", section)
+	}
+	if cfg.SMTPServerAddress != "" {
+		if _, _, err := net.SplitHostPort(cfg.SMTPServerAddress); err != nil {
+			vr.problem("%s.SMTPServerAddress must be a host and port: %v", section, err)
+		}
+	} else {
+		vr.warning("%s.SMTPServerAddress is not set, so team email invitations are not sent", section)
+	}
+
+	switch cfg.DriverName {
+	case "mysql", "postgres":
+	default:
+		vr.problem("%s.DriverName must be mysql or postgres, but is %q", section, cfg.DriverName)
+	}
+	if cfg.DataSource == "" {
+		vr.problem("%s.DataSource must be set", section)
+	}
+
+	if cfg.AdminEmail == "" || cfg.AdminPassword == "" {
+		vr.problem("%s.AdminEmail and AdminPassword must be set", section)
+	}
+
+	if cfg.LocalCommands {
+		if cfg.MattermostInstallDir == "" {
+			vr.warning("%s.MattermostInstallDir is not set, so app server commands cannot be run", section)
+		}
+	} else if cfg.SSHHostnamePort == "" || (cfg.SSHKey == "" && cfg.SSHPassword == "") {
+		vr.warning("%s.SSHHostnamePort and either SSHKey or SSHPassword are not set, so app server commands cannot be run", section)
+	}
+
+	if _, err := NewTransportFactory(cfg); err != nil {
+		vr.problem("%s has invalid connection settings: %v", section, err)
+	}
+	if cfg.ConnectionModel == ConnectionModelPerEntity && cfg.MaxConnsPerEntity < 1 {
+		vr.problem("%s.MaxConnsPerEntity must be at least 1", section)
+	}
+	if _, err := NewEndpointPicker(cfg, rand.New(rand.NewSource(0))); err != nil {
+		vr.problem("%s has invalid server endpoints: %v", section, err)
+	}
+}
+
+// checkTestFiles checks that the files uploaded during setup and tests can be found.
+func (vr *ValidationResult) checkTestFiles(cfg *LoadTestConfig) {
+	files := []string{
+		"testfiles/test.png",
+		"testfiles/test_emoji.png",
+	}
+	files = append(files, pluginBundles(&cfg.LoadtestEnviromentConfig)...)
+
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			if file == LOADTEST_PLUGIN_BUNDLE {
+				vr.problem("missing test file %s, build it with make plugin", file)
+			} else {
+				vr.problem("missing test file %s, run the loadtest from the repository root", file)
+			}
+		}
+	}
+}
+
+// checkConnectivity checks that everything the test connects to can be reached.
+func (vr *ValidationResult) checkConnectivity(cfg *LoadTestConfig) {
+	connectionCfg := &cfg.ConnectionConfiguration
+
+	if db, err := openDB(connectionCfg.DriverName, connectionCfg.DataSource); err != nil {
+		vr.problem("unable to connect to the database: %v", err)
+	} else {
+		db.Close()
+	}
+
+	if cmdrun, err := connectCommandRunner(connectionCfg); err != nil {
+		vr.warning("unable to run mattermost commands on the app server: %v", err)
+	} else {
+		cmdrun.Close()
+	}
+
+	transports, err := NewTransportFactory(connectionCfg)
+	if err != nil {
+		// Already reported as a configuration problem.
+		return
+	}
+	httpClient := &http.Client{Transport: transports.Shared(), Timeout: 30 * time.Second}
+
+	if connectionCfg.ServerURL != "" {
+		vr.checkServer(httpClient, transports, connectionCfg)
+	}
+
+	if picker, err := NewEndpointPicker(connectionCfg, rand.New(rand.NewSource(0))); err == nil && len(connectionCfg.ServerEndpoints) > 0 {
+		for _, endpoint := range picker.Endpoints() {
+			client := newClientFromToken(httpClient, "", endpoint.ServerURL)
+			if status, resp := client.GetPing(); resp.Error != nil || status != "OK" {
+				vr.problem("unable to ping endpoint %s at %s: %v", endpoint.Name, endpoint.ServerURL, resp.Error)
+			}
+		}
+	}
+
+	if connectionCfg.PProfURL != "" && cfg.ResultsConfiguration.PProfDelayMinutes > 0 {
+		if resp, err := httpClient.Get(connectionCfg.PProfURL + "/"); err != nil {
+			vr.problem("unable to reach PProfURL: %v", err)
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				vr.problem("PProfURL responded with %s", resp.Status)
+			}
+		}
+	}
+}
+
+// checkServer pings the server, logs in as the admin and connects to the websocket as them.
+func (vr *ValidationResult) checkServer(httpClient *http.Client, transports *TransportFactory, cfg *ConnectionConfiguration) {
+	client := newClientFromToken(httpClient, "", cfg.ServerURL)
+	if status, resp := client.GetPing(); resp.Error != nil || status != "OK" {
+		vr.problem("unable to ping the server at %s: %v", cfg.ServerURL, resp.Error)
+		return
+	}
+
+	user, resp := client.Login(cfg.AdminEmail, cfg.AdminPassword)
+	if resp.Error != nil {
+		vr.problem("unable to login as the admin %s: %v", cfg.AdminEmail, resp.Error)
+		return
+	}
+	defer client.Logout()
+
+	if !user.IsInRole(model.SYSTEM_ADMIN_ROLE_ID) {
+		vr.problem("the admin %s is not a system admin", cfg.AdminEmail)
+	}
+
+	if cfg.WebsocketURL == "" {
+		return
+	}
+	webSocketClient, appErr := newWebSocketClient(transports.WebSocketDialer(), cfg.WebsocketURL, client.AuthToken)
+	if appErr != nil {
+		vr.problem("unable to connect to the websocket at %s: %v", cfg.WebsocketURL, appErr)
+		return
+	}
+	webSocketClient.Close()
+}
+
+// LogWarnings logs any warnings found while validating the configuration.
+func (vr *ValidationResult) LogWarnings() {
+	for _, warning := range vr.Warnings {
+		mlog.Warn("Configuration warning: " + warning)
+	}
+}
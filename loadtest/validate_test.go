@@ -0,0 +1,186 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readDefaultConfig reads the default configuration from the repository root.
+func readDefaultConfig(t *testing.T) *LoadTestConfig {
+	data, err := ioutil.ReadFile("loadtestconfig.default.json")
+	require.NoError(t, err)
+
+	cfg := &LoadTestConfig{}
+	require.NoError(t, json.Unmarshal(data, cfg))
+
+	return cfg
+}
+
+func TestValidateConfig(t *testing.T) {
+	// The loadtest is run from the repository root, where the test files are found.
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(".."))
+	defer os.Chdir(wd)
+
+	t.Run("default configuration", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+
+		validation := ValidateConfig(cfg, 1, false)
+		assert.Empty(t, validation.Problems)
+		assert.NoError(t, validation.Err())
+	})
+
+	t.Run("reports every problem", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.LoadtestEnviromentConfig.PercentHighVolumeChannels = 0.5
+		cfg.UserEntitiesConfiguration.LinkPreviewChance = 1.5
+		cfg.UserEntitiesConfiguration.ActionRateMaxVarianceMilliseconds = 0
+		cfg.ConnectionConfiguration.WebsocketURL = "http://localhost:8065"
+		cfg.ConnectionConfiguration.EndpointStrategy = "nearest"
+
+		validation := ValidateConfig(cfg, 1, false)
+		assert.Equal(t, []string{
+			"LoadtestEnviromentConfig.PercentHighVolumeChannels + PercentMidVolumeChannels + PercentLowVolumeChannels must add up to 1, but add up to 1.3",
+			"UserEntitiesConfiguration.LinkPreviewChance must be between 0 and 1, but is 1.5",
+			"UserEntitiesConfiguration.ActionRateMaxVarianceMilliseconds must be at least 1",
+			"ConnectionConfiguration.WebsocketURL must be a ws or wss URL",
+			`ConnectionConfiguration has invalid server endpoints: unknown endpoint strategy "nearest"`,
+		}, validation.Problems)
+		assert.Error(t, validation.Err())
+	})
+
+	t.Run("too few users for instances", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.LoadtestEnviromentConfig.NumUsers = 1000
+		cfg.UserEntitiesConfiguration.NumActiveEntities = 500
+
+		assert.Empty(t, ValidateConfig(cfg, 2, false).Problems)
+		assert.Equal(t, []string{
+			"500 active entities on each of 3 instances need 1500 users, but NumUsers is 1000",
+		}, ValidateConfig(cfg, 3, false).Problems)
+	})
+
+	t.Run("invalid file uploads", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.UserEntitiesConfiguration.FileUploads = []FileUpload{
+			{Type: "docx", Weight: 1, MinSizeKilobytes: 1, MaxSizeKilobytes: 10},
+			{Type: FILE_TYPE_PNG, Weight: -1, MinSizeKilobytes: 0, MaxSizeKilobytes: 10},
+			{Type: FILE_TYPE_PDF, Weight: 1, MinSizeKilobytes: 100, MaxSizeKilobytes: 10},
+		}
+
+		assert.Equal(t, []string{
+			`UserEntitiesConfiguration.FileUploads[0] has unknown type "docx", must be one of png, jpg, gif, pdf, text or binary`,
+			"UserEntitiesConfiguration.FileUploads[1] must not have a negative weight",
+			"UserEntitiesConfiguration.FileUploads[1].MinSizeKilobytes must be at least 1",
+			"UserEntitiesConfiguration.FileUploads[2].MaxSizeKilobytes must be at least MinSizeKilobytes",
+		}, ValidateConfig(cfg, 1, false).Problems)
+	})
+
+	t.Run("invalid slash command responses", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.UserEntitiesConfiguration.SlashCommandResponses = []SlashCommandResponse{
+			{Type: "modal", Weight: 1},
+			{Type: SLASH_COMMAND_RESPONSE_DELAYED, Weight: -1},
+		}
+		cfg.UserEntitiesConfiguration.SlashCommandDelayMilliseconds = -1
+		cfg.ConnectionConfiguration.IntegrationListenAddress = ":8077"
+		cfg.ConnectionConfiguration.IntegrationURL = "localhost:8077"
+
+		assert.Equal(t, []string{
+			`UserEntitiesConfiguration.SlashCommandResponses[0] has unknown type "modal", must be one of ephemeral, in_channel or delayed`,
+			"UserEntitiesConfiguration.SlashCommandResponses[1] must not have a negative weight",
+			"UserEntitiesConfiguration.SlashCommandDelayMilliseconds must not be negative",
+			"ConnectionConfiguration.IntegrationURL must be a http or https URL",
+		}, ValidateConfig(cfg, 1, false).Problems)
+	})
+
+	t.Run("integration URL without a listen address", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.ConnectionConfiguration.IntegrationURL = "http://localhost:8077"
+		cfg.ConnectionConfiguration.IntegrationListenAddress = ""
+
+		assert.Equal(t, []string{
+			"ConnectionConfiguration.IntegrationListenAddress must be set when IntegrationURL is set",
+		}, ValidateConfig(cfg, 1, false).Problems)
+	})
+
+	t.Run("invalid incoming webhook payloads", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.UserEntitiesConfiguration.IncomingWebhookPayloads = []IncomingWebhookPayload{
+			{Type: "html", Weight: 1},
+			{Type: WEBHOOK_PAYLOAD_MARKDOWN, Weight: -1},
+		}
+		cfg.UserEntitiesConfiguration.NumIncomingWebhooks = -1
+
+		assert.Equal(t, []string{
+			`UserEntitiesConfiguration.IncomingWebhookPayloads[0] has unknown type "html", must be one of text, markdown or attachments`,
+			"UserEntitiesConfiguration.IncomingWebhookPayloads[1] must not have a negative weight",
+			"UserEntitiesConfiguration.NumIncomingWebhooks must not be negative",
+		}, ValidateConfig(cfg, 1, false).Problems)
+	})
+
+	t.Run("negative typing characters per event", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.UserEntitiesConfiguration.TypingCharactersPerEvent = -1
+
+		assert.Equal(t, []string{
+			"UserEntitiesConfiguration.TypingCharactersPerEvent must not be negative",
+		}, ValidateConfig(cfg, 1, false).Problems)
+	})
+
+	t.Run("negative mobile background", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.UserEntitiesConfiguration.MobileBackgroundSeconds = -1
+
+		assert.Equal(t, []string{
+			"UserEntitiesConfiguration.MobileBackgroundSeconds must not be negative",
+		}, ValidateConfig(cfg, 1, false).Problems)
+	})
+
+	t.Run("invalid SMTP server address", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.ConnectionConfiguration.SMTPServerAddress = "localhost"
+
+		assert.Equal(t, []string{
+			"ConnectionConfiguration.SMTPServerAddress must be a host and port: address localhost: missing port in address",
+		}, ValidateConfig(cfg, 1, false).Problems)
+
+		cfg.ConnectionConfiguration.SMTPServerAddress = ""
+		assert.Contains(t, ValidateConfig(cfg, 1, false).Warnings, "ConnectionConfiguration.SMTPServerAddress is not set, so team email invitations are not sent")
+	})
+
+	t.Run("invalid plugins", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.LoadtestEnviromentConfig.NumPlugins = 2
+		cfg.LoadtestEnviromentConfig.PluginBundles = nil
+		cfg.LoadtestEnviromentConfig.LoadtestPluginSettings.HookKVReads = -1
+
+		assert.Contains(t, ValidateConfig(cfg, 1, false).Problems, "LoadtestEnviromentConfig.NumPlugins is 2, but only 1 plugin bundles are configured")
+		assert.Contains(t, ValidateConfig(cfg, 1, false).Problems, "LoadtestEnviromentConfig.LoadtestPluginSettings.HookKVReads must not be negative")
+	})
+
+	t.Run("missing load test plugin", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		cfg.LoadtestEnviromentConfig.NumPlugins = 2
+		cfg.LoadtestEnviromentConfig.PluginBundles = []string{"testfiles/com.mattermost.sample-plugin-webapp-only.tar.gz", "testfiles/missing-loadtest-plugin.tar.gz"}
+
+		assert.Contains(t, ValidateConfig(cfg, 1, false).Problems, "missing test file testfiles/missing-loadtest-plugin.tar.gz, run the loadtest from the repository root")
+	})
+
+	t.Run("missing test files", func(t *testing.T) {
+		cfg := readDefaultConfig(t)
+		require.NoError(t, os.Chdir(wd))
+		defer os.Chdir("..")
+
+		assert.Contains(t, ValidateConfig(cfg, 1, false).Problems, "missing test file testfiles/test.png, run the loadtest from the repository root")
+	})
+}
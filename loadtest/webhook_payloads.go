@@ -0,0 +1,151 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/icrowley/fake"
+	"github.com/mattermost/mattermost-load-test/randutil"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	WEBHOOK_PAYLOAD_TEXT        = "text"
+	WEBHOOK_PAYLOAD_MARKDOWN    = "markdown"
+	WEBHOOK_PAYLOAD_ATTACHMENTS = "attachments"
+)
+
+// Webhook posts that override the username or icon use these, like a CI or monitoring system.
+const (
+	WEBHOOK_OVERRIDE_USERNAME = "ltwhuser"
+	WEBHOOK_OVERRIDE_ICON_URL = "https://www.mattermost.org/wp-content/uploads/2016/04/icon.png"
+)
+
+// The colours of message attachments, as used by monitoring systems for their alert levels.
+var webhookAttachmentColors = []string{"#36a64f", "#ffae42", "#d00000", "#439fe0"}
+
+// IncomingWebhookPayload describes a kind of message posted through incoming webhooks.
+type IncomingWebhookPayload struct {
+	// Type is one of text, markdown or attachments. Text payloads are a few plain paragraphs,
+	// markdown payloads are long documents with headings, lists, tables and code blocks, and
+	// attachments payloads are message attachments with fields, like alerts and build reports.
+	Type   string
+	Weight int
+}
+
+// defaultIncomingWebhookPayloads is used when no incoming webhook payloads are configured, and
+// posts plain paragraphs only.
+var defaultIncomingWebhookPayloads = []IncomingWebhookPayload{
+	{Type: WEBHOOK_PAYLOAD_TEXT, Weight: 1},
+}
+
+// generateWebhookRequest generates a request of one of the given kinds of payload, using the
+// defaults when none are given.
+func generateWebhookRequest(r *rand.Rand, payloads []IncomingWebhookPayload) (*model.IncomingWebhookRequest, error) {
+	if len(payloads) == 0 {
+		payloads = defaultIncomingWebhookPayloads
+	}
+
+	choices := make([]randutil.Choice, len(payloads))
+	for i, payload := range payloads {
+		choices[i] = randutil.Choice{Item: payload.Type, Weight: payload.Weight}
+	}
+	choice, err := randutil.WeightedChoice(r, choices)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &model.IncomingWebhookRequest{}
+	switch choice.Item.(string) {
+	case WEBHOOK_PAYLOAD_TEXT:
+		request.Text = fake.Paragraphs()
+	case WEBHOOK_PAYLOAD_MARKDOWN:
+		request.Text = generateMarkdown(r)
+	case WEBHOOK_PAYLOAD_ATTACHMENTS:
+		request.Text = fake.Sentence()
+		request.Attachments = generateAttachments(r)
+	default:
+		return nil, fmt.Errorf("unknown incoming webhook payload type %q", choice.Item)
+	}
+
+	return request, nil
+}
+
+// generateMarkdown generates a long markdown document, like a release note or a report.
+func generateMarkdown(r *rand.Rand) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# %s\n\n%s\n\n", fake.Title(), fake.Paragraph())
+
+	for section := 0; section < 2+r.Intn(3); section++ {
+		fmt.Fprintf(&sb, "## %s\n\n", fake.Title())
+
+		for i := 0; i < 3+r.Intn(5); i++ {
+			fmt.Fprintf(&sb, "- **%s** %s\n", fake.Word(), fake.Sentence())
+		}
+
+		fmt.Fprintf(&sb, "\n| %s | %s | %s |\n| --- | --- | ---: |\n", fake.Word(), fake.Word(), fake.Word())
+		for i := 0; i < 2+r.Intn(6); i++ {
+			fmt.Fprintf(&sb, "| %s | `%s` | %d |\n", fake.Word(), fake.Word(), r.Intn(10000))
+		}
+
+		fmt.Fprintf(&sb, "\n```\n%s\n```\n\n%s [%s](%s)\n\n", strings.Join(strings.Fields(fake.Paragraph()), "\n"), fake.Sentence(), fake.Word(), OPENGRAPH_TEST_URL)
+	}
+
+	return sb.String()
+}
+
+// generateAttachments generates message attachments with fields, like the alerts of a monitoring
+// system or the reports of a build server.
+func generateAttachments(r *rand.Rand) []*model.SlackAttachment {
+	attachments := make([]*model.SlackAttachment, 1+r.Intn(3))
+	for i := range attachments {
+		fields := make([]*model.SlackAttachmentField, 1+r.Intn(6))
+		for j := range fields {
+			fields[j] = &model.SlackAttachmentField{
+				Title: fake.Word(),
+				Value: fake.Sentence(),
+				Short: r.Intn(2) == 0,
+			}
+		}
+
+		title := fake.Sentence()
+		attachments[i] = &model.SlackAttachment{
+			Fallback:   title,
+			Color:      webhookAttachmentColors[r.Intn(len(webhookAttachmentColors))],
+			Pretext:    fake.Sentence(),
+			AuthorName: fake.FullName(),
+			Title:      title,
+			TitleLink:  OPENGRAPH_TEST_URL,
+			Text:       fake.Paragraph(),
+			Fields:     fields,
+			Footer:     fake.Company(),
+		}
+	}
+
+	return attachments
+}
+
+// checkIncomingWebhookPayloads checks that the configured incoming webhook payloads could be
+// generated.
+func (vr *ValidationResult) checkIncomingWebhookPayloads(section string, cfg *UserEntitiesConfiguration) {
+	for i, payload := range cfg.IncomingWebhookPayloads {
+		name := fmt.Sprintf("%s.IncomingWebhookPayloads[%d]", section, i)
+		switch payload.Type {
+		case WEBHOOK_PAYLOAD_TEXT, WEBHOOK_PAYLOAD_MARKDOWN, WEBHOOK_PAYLOAD_ATTACHMENTS:
+		default:
+			vr.problem("%s has unknown type %q, must be one of text, markdown or attachments", name, payload.Type)
+		}
+		if payload.Weight < 0 {
+			vr.problem("%s must not have a negative weight", name)
+		}
+	}
+
+	if cfg.NumIncomingWebhooks < 0 {
+		vr.problem("%s.NumIncomingWebhooks must not be negative", section)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package loadtest
+
+import (
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-load-test/fakeserver"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateWebhookRequest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	t.Run("text", func(t *testing.T) {
+		request, err := generateWebhookRequest(r, []IncomingWebhookPayload{{Type: WEBHOOK_PAYLOAD_TEXT, Weight: 1}})
+		require.NoError(t, err)
+		assert.NotEmpty(t, request.Text)
+		assert.Empty(t, request.Attachments)
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		request, err := generateWebhookRequest(r, []IncomingWebhookPayload{{Type: WEBHOOK_PAYLOAD_MARKDOWN, Weight: 1}})
+		require.NoError(t, err)
+		assert.Contains(t, request.Text, "# ")
+		assert.Contains(t, request.Text, "| --- |")
+		assert.Contains(t, request.Text, "```")
+		assert.Empty(t, request.Attachments)
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		request, err := generateWebhookRequest(r, []IncomingWebhookPayload{{Type: WEBHOOK_PAYLOAD_ATTACHMENTS, Weight: 1}})
+		require.NoError(t, err)
+		require.NotEmpty(t, request.Attachments)
+		for _, attachment := range request.Attachments {
+			assert.NotEmpty(t, attachment.Fallback)
+			assert.NotEmpty(t, attachment.Fields)
+		}
+	})
+
+	t.Run("defaults to text", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			request, err := generateWebhookRequest(r, nil)
+			require.NoError(t, err)
+			assert.NotEmpty(t, request.Text)
+			assert.NotContains(t, request.Text, "# ")
+			assert.Empty(t, request.Attachments)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := generateWebhookRequest(r, []IncomingWebhookPayload{{Type: "html", Weight: 1}})
+		assert.Error(t, err)
+	})
+}
+
+func TestPostIncomingWebhook(t *testing.T) {
+	s := fakeserver.New(fakeserver.Config{})
+	serverURL := s.Start()
+	defer s.Close()
+
+	team := s.CreateTeam(&model.Team{Name: "team0", DisplayName: "Team 0"})
+	townSquare := s.GetChannelByName(team.Id, model.DEFAULT_CHANNEL)
+	require.NotNil(t, townSquare)
+	channel := s.CreateChannel(&model.Channel{TeamId: team.Id, Name: "channel0", DisplayName: "Channel 0", Type: model.CHANNEL_OPEN})
+	user := s.CreateUser(&model.User{Username: "user0", Email: "success+user0@simulator.amazonses.com"}, "password")
+	s.AddTeamMember(team.Id, user.Id)
+
+	adminClient := model.NewAPIv4Client(serverURL)
+	_, resp := adminClient.Login("success+user0@simulator.amazonses.com", "password")
+	require.Nil(t, resp.Error)
+
+	hook, resp := adminClient.CreateIncomingWebhook(&model.IncomingWebhook{ChannelId: townSquare.Id, DisplayName: "hook"})
+	require.Nil(t, resp.Error)
+
+	client := &apiClient{model.NewAPIv4Client(serverURL)}
+	request := &model.IncomingWebhookRequest{
+		Text:        "hello",
+		Username:    WEBHOOK_OVERRIDE_USERNAME,
+		IconURL:     WEBHOOK_OVERRIDE_ICON_URL,
+		ChannelName: channel.Name,
+		Attachments: generateAttachments(rand.New(rand.NewSource(1))),
+	}
+	ok, resp := client.PostIncomingWebhook(hook.Id, request)
+	require.Nil(t, resp.Error)
+	assert.True(t, ok)
+
+	posts := s.GetPostsForChannel(channel.Id)
+	require.Len(t, posts.Order, 1)
+	post := posts.Posts[posts.Order[0]]
+	assert.Equal(t, "hello", post.Message)
+	assert.Equal(t, WEBHOOK_OVERRIDE_USERNAME, post.Props["override_username"])
+	assert.Equal(t, WEBHOOK_OVERRIDE_ICON_URL, post.Props["override_icon_url"])
+	assert.Len(t, post.Attachments(), len(request.Attachments))
+
+	_, resp = client.PostIncomingWebhook(hook.Id, &model.IncomingWebhookRequest{Text: "hello", ChannelName: "missing"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, resp = client.PostIncomingWebhook(model.NewId(), &model.IncomingWebhookRequest{Text: "hello"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// configuration is the cost of the plugin's hooks and endpoints, as set in the plugin's settings.
+type configuration struct {
+	// HookCPUMicroseconds is the CPU time spent in MessageWillBePosted for every post.
+	HookCPUMicroseconds int
+	// HookKVReads and HookKVWrites are the numbers of KV store reads and writes made in
+	// MessageWillBePosted for every post.
+	HookKVReads  int
+	HookKVWrites int
+	// HookBroadcast publishes a websocket event to the channel of every post.
+	HookBroadcast bool
+	// HTTPCPUMicroseconds is the CPU time spent on every request to the plugin's endpoints.
+	HTTPCPUMicroseconds int
+}
+
+func (p *Plugin) getConfiguration() *configuration {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	if p.configuration == nil {
+		return &configuration{}
+	}
+
+	return p.configuration
+}
+
+// OnConfigurationChange loads the plugin's settings whenever they change.
+func (p *Plugin) OnConfigurationChange() error {
+	configuration := &configuration{}
+	if err := p.API.LoadPluginConfiguration(configuration); err != nil {
+		return errors.Wrap(err, "failed to load plugin configuration")
+	}
+
+	p.configurationLock.Lock()
+	p.configuration = configuration
+	p.configurationLock.Unlock()
+
+	return nil
+}
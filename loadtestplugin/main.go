@@ -0,0 +1,15 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Command loadtestplugin is a Mattermost server plugin that adds configurable work to every post
+// and serves endpoints for the load test to call, so that the overhead of plugins can be measured.
+// Build the bundle installed by the server setup with `make plugin`.
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+func main() {
+	plugin.ClientMain(&Plugin{})
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+// The websocket events published by the plugin, which clients receive prefixed with
+// custom_com.mattermost.loadtest-plugin_.
+const (
+	POSTED_EVENT    = "posted"
+	BROADCAST_EVENT = "broadcast"
+)
+
+// Keys given to the KV endpoints are limited in length, since the user id is prepended to them
+// and the KV store limits the length of keys.
+const MAX_KV_KEY_LENGTH = 16
+
+// MAX_KV_VALUE_SIZE limits the values written through the KV endpoints.
+const MAX_KV_VALUE_SIZE = 64 * 1024
+
+// Plugin adds configurable work to every post, and serves endpoints that read and write the KV
+// store and broadcast websocket events.
+type Plugin struct {
+	plugin.MattermostPlugin
+
+	configurationLock sync.RWMutex
+	configuration     *configuration
+}
+
+// burnCPU keeps a CPU busy for the given number of microseconds.
+func burnCPU(microseconds int) {
+	if microseconds <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(time.Duration(microseconds) * time.Microsecond)
+	sum := sha256.Sum256(nil)
+	for time.Now().Before(deadline) {
+		sum = sha256.Sum256(sum[:])
+	}
+}
+
+// MessageWillBePosted does the configured work for every post, leaving the post unchanged. The
+// post is not saved yet, so it is known by the pending post id the client gave it.
+func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*model.Post, string) {
+	config := p.getConfiguration()
+
+	burnCPU(config.HookCPUMicroseconds)
+
+	key := "channel_" + post.ChannelId
+	for i := 0; i < config.HookKVReads; i++ {
+		if _, appErr := p.API.KVGet(key); appErr != nil {
+			p.API.LogError("Failed to read from the KV store", "key", key, "err", appErr.Error())
+		}
+	}
+	for i := 0; i < config.HookKVWrites; i++ {
+		if appErr := p.API.KVSet(key, []byte(post.PendingPostId)); appErr != nil {
+			p.API.LogError("Failed to write to the KV store", "key", key, "err", appErr.Error())
+		}
+	}
+
+	if config.HookBroadcast {
+		p.API.PublishWebSocketEvent(POSTED_EVENT, map[string]interface{}{
+			"pending_post_id": post.PendingPostId,
+		}, &model.WebsocketBroadcast{ChannelId: post.ChannelId})
+	}
+
+	return nil, ""
+}
+
+// ServeHTTP serves the endpoints called by the load test:
+//
+//	GET  /status       returns the plugin's configuration
+//	GET  /kv/{key}     reads a value of the user from the KV store
+//	POST /kv/{key}     writes a value of the user to the KV store
+//	POST /broadcast    publishes a websocket event to the user
+func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-Id")
+	if userId == "" {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+
+	config := p.getConfiguration()
+	burnCPU(config.HTTPCPUMicroseconds)
+
+	switch {
+	case r.URL.Path == "/status" && r.Method == http.MethodGet:
+		writeJSON(w, config)
+	case r.URL.Path == "/broadcast" && r.Method == http.MethodPost:
+		p.API.PublishWebSocketEvent(BROADCAST_EVENT, map[string]interface{}{
+			"user_id": userId,
+		}, &model.WebsocketBroadcast{UserId: userId})
+		writeJSON(w, map[string]string{"status": "OK"})
+	case strings.HasPrefix(r.URL.Path, "/kv/"):
+		p.serveKV(w, r, userId, strings.TrimPrefix(r.URL.Path, "/kv/"))
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// serveKV reads or writes one of the user's values in the KV store.
+func (p *Plugin) serveKV(w http.ResponseWriter, r *http.Request, userId, key string) {
+	if key == "" || len(key) > MAX_KV_KEY_LENGTH || strings.Contains(key, "/") {
+		writeError(w, http.StatusBadRequest, "invalid key")
+		return
+	}
+	key = userId + "_" + key
+
+	switch r.Method {
+	case http.MethodGet:
+		value, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			writeError(w, http.StatusInternalServerError, appErr.Error())
+			return
+		}
+		if value == nil {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	case http.MethodPost:
+		value, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_KV_VALUE_SIZE))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if appErr := p.API.KVSet(key, value); appErr != nil {
+			writeError(w, http.StatusInternalServerError, appErr.Error())
+			return
+		}
+		writeJSON(w, map[string]string{"status": "OK"})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with an error in the format of the server's own errors, which the load
+// test's client understands.
+func writeError(w http.ResponseWriter, status int, details string) {
+	appErr := model.NewAppError("ServeHTTP", "plugin.loadtest.app_error", nil, details, status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(appErr.ToJson()))
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageWillBePosted(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+
+	post := &model.Post{ChannelId: model.NewId(), PendingPostId: model.NewId() + ":1234"}
+	key := "channel_" + post.ChannelId
+	api.On("KVGet", key).Return([]byte("previous"), nil).Times(2)
+	api.On("KVSet", key, []byte(post.PendingPostId)).Return(nil).Once()
+	api.On("PublishWebSocketEvent", POSTED_EVENT, map[string]interface{}{"pending_post_id": post.PendingPostId}, &model.WebsocketBroadcast{ChannelId: post.ChannelId}).Once()
+
+	p := &Plugin{configuration: &configuration{HookKVReads: 2, HookKVWrites: 1, HookBroadcast: true}}
+	p.SetAPI(api)
+
+	updated, rejection := p.MessageWillBePosted(nil, post)
+	assert.Nil(t, updated, "the post should be left unchanged")
+	assert.Empty(t, rejection)
+}
+
+func TestServeHTTP(t *testing.T) {
+	userId := model.NewId()
+	serve := func(p *Plugin, method, path, body string, authenticated bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if authenticated {
+			r.Header.Set("Mattermost-User-Id", userId)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("requires a user", func(t *testing.T) {
+		p := &Plugin{}
+		p.SetAPI(&plugintest.API{})
+
+		assert.Equal(t, http.StatusUnauthorized, serve(p, http.MethodGet, "/status", "", false).Code)
+	})
+
+	t.Run("kv", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		api.On("KVSet", userId+"_key0", []byte("value")).Return(nil).Once()
+		api.On("KVGet", userId+"_key0").Return([]byte("value"), nil).Once()
+		api.On("KVGet", userId+"_key1").Return(nil, nil).Once()
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/kv/key0", "value", true).Code)
+		w := serve(p, http.MethodGet, "/kv/key0", "", true)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "value", w.Body.String())
+
+		w = serve(p, http.MethodGet, "/kv/key1", "", true)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		appErr := model.AppErrorFromJson(w.Body)
+		assert.Equal(t, http.StatusNotFound, appErr.StatusCode)
+
+		assert.Equal(t, http.StatusBadRequest, serve(p, http.MethodGet, "/kv/"+strings.Repeat("k", MAX_KV_KEY_LENGTH+1), "", true).Code)
+	})
+
+	t.Run("broadcast", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		api.On("PublishWebSocketEvent", BROADCAST_EVENT, mock.Anything, &model.WebsocketBroadcast{UserId: userId}).Once()
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/broadcast", "", true).Code)
+	})
+
+	t.Run("unknown endpoint", func(t *testing.T) {
+		p := &Plugin{}
+		p.SetAPI(&plugintest.API{})
+
+		assert.Equal(t, http.StatusNotFound, serve(p, http.MethodGet, "/unknown", "", true).Code)
+	})
+}
@@ -15,6 +15,7 @@ var (
 		"percent": func(x float64) string {
 			return fmt.Sprintf("%.2f%%", float64(x)*100.0)
 		},
+		"protocols": formatProtocols,
 		"compareInt64": func(a, b int64) string {
 			delta := a - b
 			if delta == 0 {
@@ -58,6 +59,11 @@ var (
 ### Score: {{printf "%.2f" .Actual.GetScore}}
 The score is the average of the 95th percentile, median and interquartile ranges in the routes below.
 
+{{with .RateLimiting}}{{if .NumEntitiesThrottled -}}
+### Rate Limiting
+{{.NumEntitiesThrottled}} of {{.NumEntities}} entities were throttled, for {{percent .MeanThrottledFraction}} of the time on average and {{percent .MaxThrottledFraction}} at most.
+
+{{end}}{{end -}}
 ### Routes
 `,
 	))
@@ -68,9 +74,24 @@ The score is the average of the 95th percentile, median and interquartile ranges
 | --- | --- |
 | Hits | {{.Actual.NumHits}} |
 | Error Rate | {{percent .Actual.ErrorRate}} |
+{{if .Actual.NumRateLimited -}}
+| Rate Limited | {{.Actual.NumRateLimited}} ({{percent .Actual.RateLimitedRate}}) |
+{{end -}}
+{{if .Actual.Protocols -}}
+| Protocols | {{protocols .Actual.Protocols}} |
+{{end -}}
 | Mean Response Time | {{printf "%.2f" .Actual.Mean}}ms |
 | Median Response Time | {{printf "%.2f" .Actual.Median}}ms |
 | 95th Percentile | {{printf "%.2f" .Actual.Percentile95}}ms |
+{{if .Actual.CorrectedDuration -}}
+| Corrected Mean Response Time | {{printf "%.2f" .Actual.CorrectedMean}}ms |
+| Corrected Median Response Time | {{printf "%.2f" .Actual.CorrectedMedian}}ms |
+| Corrected 95th Percentile | {{printf "%.2f" .Actual.CorrectedPercentile95}}ms |
+{{if .Verbose -}}
+| Corrected 90th Percentile | {{printf "%.2f" .Actual.CorrectedPercentile90}}ms |
+| Corrected Max Response Time | {{.Actual.CorrectedMax}}ms |
+{{end -}}
+{{end -}}
 {{if .Verbose -}}
 | 90th Percentile | {{printf "%.2f" .Actual.Percentile90}}ms |
 | Max Response Time | {{.Actual.Max}}ms |
@@ -85,6 +106,11 @@ The score is the average of the 95th percentile, median and interquartile ranges
 ### Score: {{printf "%.2f" .Actual.GetScore}} ({{compareFloat64 .Actual.GetScore .Baseline.GetScore}}, relative to baseline)
 The score is the average of the 95th percentile, median and interquartile ranges in the routes below.
 
+{{with .RateLimiting}}{{if .NumEntitiesThrottled -}}
+### Rate Limiting
+{{.NumEntitiesThrottled}} of {{.NumEntities}} entities were throttled, for {{percent .MeanThrottledFraction}} of the time on average and {{percent .MaxThrottledFraction}} at most.
+
+{{end}}{{end -}}
 ### Routes
 `,
 	))
@@ -95,9 +121,24 @@ The score is the average of the 95th percentile, median and interquartile ranges
 | --- | --- | --- | --- | --- |
 | Hits | {{.Baseline.NumHits}} | {{.Actual.NumHits}} | {{compareInt64 .Actual.NumHits .Baseline.NumHits}} | {{comparePercentageInt64 .Actual.NumHits .Baseline.NumHits}}
 | Error Rate | {{percent .Baseline.ErrorRate }} | {{percent .Actual.ErrorRate}} | {{comparePercentageFloat64 .Actual.ErrorRate .Baseline.ErrorRate}} | {{comparePercentageFloat64 .Actual.ErrorRate .Baseline.ErrorRate}} |
+{{if or .Actual.NumRateLimited .Baseline.NumRateLimited -}}
+| Rate Limited | {{.Baseline.NumRateLimited}} | {{.Actual.NumRateLimited}} | {{compareInt64 .Actual.NumRateLimited .Baseline.NumRateLimited}} | {{comparePercentageInt64 .Actual.NumRateLimited .Baseline.NumRateLimited}} |
+{{end -}}
+{{if or .Actual.Protocols .Baseline.Protocols -}}
+| Protocols | {{protocols .Baseline.Protocols}} | {{protocols .Actual.Protocols}} | - | - |
+{{end -}}
 | Mean Response Time | {{printf "%.2f" .Baseline.Mean}}ms | {{printf "%.2f" .Actual.Mean}}ms | {{compareFloat64 .Actual.Mean .Baseline.Mean}}ms | {{comparePercentageFloat64 .Actual.Mean .Baseline.Mean}} |
 | Median Response Time | {{printf "%.2f" .Baseline.Median}}ms | {{printf "%.2f" .Actual.Median}}ms | {{compareFloat64 .Actual.Median .Baseline.Median}}ms | {{comparePercentageFloat64 .Actual.Median .Baseline.Median}} |
 | 95th Percentile | {{printf "%.2f" .Baseline.Percentile95}}ms | {{printf "%.2f" .Actual.Percentile95}}ms | {{compareFloat64 .Actual.Percentile95 .Baseline.Percentile95}}ms | {{comparePercentageFloat64 .Actual.Percentile95 .Baseline.Percentile95}} |
+{{if .Actual.CorrectedDuration -}}
+| Corrected Mean Response Time | {{printf "%.2f" .Baseline.CorrectedMean}}ms | {{printf "%.2f" .Actual.CorrectedMean}}ms | {{compareFloat64 .Actual.CorrectedMean .Baseline.CorrectedMean}}ms | {{comparePercentageFloat64 .Actual.CorrectedMean .Baseline.CorrectedMean}} |
+| Corrected Median Response Time | {{printf "%.2f" .Baseline.CorrectedMedian}}ms | {{printf "%.2f" .Actual.CorrectedMedian}}ms | {{compareFloat64 .Actual.CorrectedMedian .Baseline.CorrectedMedian}}ms | {{comparePercentageFloat64 .Actual.CorrectedMedian .Baseline.CorrectedMedian}} |
+| Corrected 95th Percentile | {{printf "%.2f" .Baseline.CorrectedPercentile95}}ms | {{printf "%.2f" .Actual.CorrectedPercentile95}}ms | {{compareFloat64 .Actual.CorrectedPercentile95 .Baseline.CorrectedPercentile95}}ms | {{comparePercentageFloat64 .Actual.CorrectedPercentile95 .Baseline.CorrectedPercentile95}} |
+{{if .Verbose -}}
+| Corrected 90th Percentile | {{printf "%.2f" .Baseline.CorrectedPercentile90}}ms | {{printf "%.2f" .Actual.CorrectedPercentile90}}ms | {{compareFloat64 .Actual.CorrectedPercentile90 .Baseline.CorrectedPercentile90}}ms | {{comparePercentageFloat64 .Actual.CorrectedPercentile90 .Baseline.CorrectedPercentile90}} |
+| Corrected Max Response Time | {{.Baseline.CorrectedMax}}ms | {{.Actual.CorrectedMax}}ms | {{compareFloat64 .Actual.CorrectedMax .Baseline.CorrectedMax}}ms | {{comparePercentageFloat64 .Actual.CorrectedMax .Baseline.CorrectedMax}} |
+{{end -}}
+{{end -}}
 {{if .Verbose -}}
 | 90th Percentile | {{printf "%.2f" .Baseline.Percentile90}}ms | {{printf "%.2f" .Actual.Percentile90}}ms | {{compareFloat64 .Actual.Percentile90 .Baseline.Percentile90}}ms | {{comparePercentageFloat64 .Actual.Percentile90 .Baseline.Percentile90}} |
 | Max Response Time | {{.Baseline.Max}}ms | {{.Actual.Max}}ms | {{compareFloat64 .Actual.Max .Baseline.Max}}ms | {{comparePercentageFloat64 .Actual.Max .Baseline.Max}} |
@@ -113,9 +154,24 @@ The score is the average of the 95th percentile, median and interquartile ranges
 | --- | --- | --- | --- |
 | Hits | - | {{.Actual.NumHits}} | - |
 | Error Rate | - | {{percent .Actual.ErrorRate}} | - |
+{{if .Actual.NumRateLimited -}}
+| Rate Limited | - | {{.Actual.NumRateLimited}} ({{percent .Actual.RateLimitedRate}}) | - |
+{{end -}}
+{{if .Actual.Protocols -}}
+| Protocols | - | {{protocols .Actual.Protocols}} | - |
+{{end -}}
 | Mean Response Time | - | {{printf "%.2f" .Actual.Mean}}ms | - |
 | Median Response Time | - | {{printf "%.2f" .Actual.Median}}ms | - |
 | 95th Percentile | - | {{printf "%.2f" .Actual.Percentile95}}ms | - |
+{{if .Actual.CorrectedDuration -}}
+| Corrected Mean Response Time | - | {{printf "%.2f" .Actual.CorrectedMean}}ms | - |
+| Corrected Median Response Time | - | {{printf "%.2f" .Actual.CorrectedMedian}}ms | - |
+| Corrected 95th Percentile | - | {{printf "%.2f" .Actual.CorrectedPercentile95}}ms | - |
+{{if .Verbose -}}
+| Corrected 90th Percentile | - | {{printf "%.2f" .Actual.CorrectedPercentile90}}ms | - |
+| Corrected Max Response Time | - | {{.Actual.CorrectedMax}}ms | - |
+{{end -}}
+{{end -}}
 {{if .Verbose -}}
 | 90th Percentile | - | {{printf "%.2f" .Actual.Percentile90}}ms | - |
 | Max Response Time | - | {{.Actual.Max}}ms | - |
@@ -126,11 +182,13 @@ The score is the average of the 95th percentile, median and interquartile ranges
 	))
 )
 
-func dumpSingleTimingsMarkdown(timings *loadtest.ClientTimingStats, output io.Writer, verbose bool) error {
+func dumpSingleTimingsMarkdown(timings *loadtest.ClientTimingStats, limiting *rateLimiting, output io.Writer, verbose bool) error {
 	summaryData := struct {
-		Actual *loadtest.ClientTimingStats
+		Actual       *loadtest.ClientTimingStats
+		RateLimiting *rateLimiting
 	}{
 		timings,
+		limiting,
 	}
 	if err := singleTimingSummaryMarkdown.Execute(output, summaryData); err != nil {
 		return errors.Wrap(err, "error executing summary template")
@@ -147,13 +205,15 @@ func dumpSingleTimingsMarkdown(timings *loadtest.ClientTimingStats, output io.Wr
 	return nil
 }
 
-func dumpComparisonTimingsMarkdown(timings *loadtest.ClientTimingStats, baseline *loadtest.ClientTimingStats, output io.Writer, verbose bool) error {
+func dumpComparisonTimingsMarkdown(timings *loadtest.ClientTimingStats, baseline *loadtest.ClientTimingStats, limiting *rateLimiting, output io.Writer, verbose bool) error {
 	summaryData := struct {
-		Actual   *loadtest.ClientTimingStats
-		Baseline *loadtest.ClientTimingStats
+		Actual       *loadtest.ClientTimingStats
+		Baseline     *loadtest.ClientTimingStats
+		RateLimiting *rateLimiting
 	}{
 		timings,
 		baseline,
+		limiting,
 	}
 	if err := comparisonTimingSummaryMarkdown.Execute(output, summaryData); err != nil {
 		return errors.Wrap(err, "error executing summary template")
@@ -176,10 +236,10 @@ func dumpComparisonTimingsMarkdown(timings *loadtest.ClientTimingStats, baseline
 	return nil
 }
 
-func dumpTimingsMarkdown(timings *loadtest.ClientTimingStats, baselineTimings *loadtest.ClientTimingStats, output io.Writer, verbose bool) error {
+func dumpTimingsMarkdown(timings *loadtest.ClientTimingStats, baselineTimings *loadtest.ClientTimingStats, limiting *rateLimiting, output io.Writer, verbose bool) error {
 	if baselineTimings == nil {
-		return dumpSingleTimingsMarkdown(timings, output, verbose)
+		return dumpSingleTimingsMarkdown(timings, limiting, output, verbose)
 	} else {
-		return dumpComparisonTimingsMarkdown(timings, baselineTimings, output, verbose)
+		return dumpComparisonTimingsMarkdown(timings, baselineTimings, limiting, output, verbose)
 	}
 }
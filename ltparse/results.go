@@ -2,8 +2,10 @@ package ltparse
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"sort"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
@@ -18,6 +20,9 @@ type ResultsConfig struct {
 	Display       string
 	Aggregate     bool
 	Verbose       bool
+	// Phase limits the results to those between the given configuration changes, numbered from
+	// one for the results before the first change. Zero includes the results of every phase.
+	Phase int
 }
 
 type templateData struct {
@@ -41,8 +46,74 @@ func sortedRoutes(routesMap map[string]*loadtest.RouteStats) []*loadtest.RouteSt
 	return routes
 }
 
-func parseTimings(input io.Reader) ([]*loadtest.ClientTimingStats, error) {
-	allTimings := make(map[string]*loadtest.ClientTimingStats)
+// formatProtocols lists the number of responses received over each protocol, e.g.
+// "HTTP/1.1: 10, HTTP/2.0: 5".
+func formatProtocols(protocols map[string]int64) string {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counts := make([]string, 0, len(names))
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%s: %d", name, protocols[name]))
+	}
+
+	return strings.Join(counts, ", ")
+}
+
+// rateLimiting is the time entities spent throttled by rate limits, as reported by an instance at
+// the end of its run.
+type rateLimiting struct {
+	MeanThrottledFraction float64 `mapstructure:"mean_throttled_fraction"`
+	MaxThrottledFraction  float64 `mapstructure:"max_throttled_fraction"`
+	NumEntitiesThrottled  int     `mapstructure:"num_entities_throttled"`
+	NumEntities           int     `mapstructure:"num_entities"`
+}
+
+// merge combines the rate limiting of two instances, weighting their means by their entities.
+func (rl *rateLimiting) merge(other *rateLimiting) *rateLimiting {
+	if rl == nil {
+		return other
+	}
+	if other == nil {
+		return rl
+	}
+
+	merged := &rateLimiting{
+		MaxThrottledFraction: rl.MaxThrottledFraction,
+		NumEntitiesThrottled: rl.NumEntitiesThrottled + other.NumEntitiesThrottled,
+		NumEntities:          rl.NumEntities + other.NumEntities,
+	}
+	if other.MaxThrottledFraction > merged.MaxThrottledFraction {
+		merged.MaxThrottledFraction = other.MaxThrottledFraction
+	}
+	if merged.NumEntities > 0 {
+		merged.MeanThrottledFraction = (rl.MeanThrottledFraction*float64(rl.NumEntities) + other.MeanThrottledFraction*float64(other.NumEntities)) / float64(merged.NumEntities)
+	}
+
+	return merged
+}
+
+// instanceResults are the results logged by a single loadtest instance.
+type instanceResults struct {
+	timings      *loadtest.ClientTimingStats
+	rateLimiting *rateLimiting
+}
+
+// currentPhase returns the phase an instance is in, given the configuration changes seen so far.
+func currentPhase(phases map[string]int, instanceId string) int {
+	if phase, ok := phases[instanceId]; ok {
+		return phase
+	}
+
+	return 1
+}
+
+func parseTimings(input io.Reader, phase int) ([]*instanceResults, error) {
+	allResults := make(map[string]*instanceResults)
+	phases := make(map[string]int)
 	decoder := json.NewDecoder(input)
 	foundStructuredLogs := false
 	for decoder.More() {
@@ -52,70 +123,106 @@ func parseTimings(input io.Reader) ([]*loadtest.ClientTimingStats, error) {
 		}
 		foundStructuredLogs = true
 
+		var instanceId string
+		if instanceIdValue, ok := log["instance_id"].(string); ok {
+			instanceId = instanceIdValue
+		}
+		if instanceId == "" {
+			instanceId = "default"
+		}
+
+		// Track configuration changes, which start a new phase of the test
+		if log["tag"] == "config_change" {
+			if phaseValue, ok := log["phase"].(float64); ok {
+				phases[instanceId] = int(phaseValue)
+			}
+		}
+
 		// Look for result logs
 		if log["tag"] == "timings" {
+			if phase != 0 && phase != currentPhase(phases, instanceId) {
+				continue
+			}
+
 			timings := &loadtest.ClientTimingStats{}
 			if err := mapstructure.Decode(log["timings"], timings); err != nil {
 				continue
 			}
 
-			var instanceId string
-			if instanceIdValue := log["instance_id"]; instanceIdValue != nil {
-				instanceId = instanceIdValue.(string)
+			if allResults[instanceId] == nil {
+				allResults[instanceId] = &instanceResults{}
 			}
-			if instanceId == "" {
-				instanceId = "default"
+			allResults[instanceId].timings = allResults[instanceId].timings.Merge(timings)
+		}
+
+		// The time spent throttled is reported once for the whole run, so it belongs to no phase
+		if log["tag"] == "ratelimits" && phase == 0 {
+			limiting := &rateLimiting{}
+			if err := mapstructure.Decode(log, limiting); err != nil {
+				continue
 			}
 
-			allTimings[instanceId] = allTimings[instanceId].Merge(timings)
+			if allResults[instanceId] == nil {
+				allResults[instanceId] = &instanceResults{}
+			}
+			allResults[instanceId].rateLimiting = limiting
 		}
 	}
 
 	if !foundStructuredLogs {
 		return nil, errors.New("failed to find structured logs")
 	}
-	if len(allTimings) == 0 {
-		return nil, errors.New("failed to find results")
+
+	allResultsList := make([]*instanceResults, 0, len(allResults))
+	for _, results := range allResults {
+		if results.timings != nil {
+			allResultsList = append(allResultsList, results)
+		}
 	}
 
-	allTimingsList := make([]*loadtest.ClientTimingStats, 0, len(allTimings))
-	for _, timings := range allTimings {
-		allTimingsList = append(allTimingsList, timings)
+	if len(allResultsList) == 0 {
+		if phase != 0 {
+			return nil, fmt.Errorf("failed to find results for phase %d", phase)
+		}
+		return nil, errors.New("failed to find results")
 	}
 
-	return allTimingsList, nil
+	return allResultsList, nil
 }
 
 func ParseResults(config *ResultsConfig) error {
-	allTimings, err := parseTimings(config.Input)
+	allResults, err := parseTimings(config.Input, config.Phase)
 	if err != nil {
 		return err
 	}
 
-	allBaselineTimings := []*loadtest.ClientTimingStats{}
+	allBaselineResults := []*instanceResults{}
 	if config.BaselineInput != nil {
-		allBaselineTimings, err = parseTimings(config.BaselineInput)
+		allBaselineResults, err = parseTimings(config.BaselineInput, 0)
 		if err != nil {
 			return err
 		}
 	}
 
 	var timings *loadtest.ClientTimingStats
+	var limiting *rateLimiting
 	if !config.Aggregate {
-		timings = allTimings[len(allTimings)-1]
+		timings = allResults[len(allResults)-1].timings
+		limiting = allResults[len(allResults)-1].rateLimiting
 	} else {
-		for _, t := range allTimings {
-			timings = timings.Merge(t)
+		for _, r := range allResults {
+			timings = timings.Merge(r.timings)
+			limiting = limiting.merge(r.rateLimiting)
 		}
 	}
 
 	var baselineTimings *loadtest.ClientTimingStats
-	if len(allBaselineTimings) > 0 {
+	if len(allBaselineResults) > 0 {
 		if !config.Aggregate {
-			baselineTimings = allBaselineTimings[len(allBaselineTimings)-1]
+			baselineTimings = allBaselineResults[len(allBaselineResults)-1].timings
 		} else {
-			for _, t := range allBaselineTimings {
-				baselineTimings = timings.Merge(t)
+			for _, r := range allBaselineResults {
+				baselineTimings = timings.Merge(r.timings)
 			}
 		}
 	}
@@ -127,16 +234,16 @@ func ParseResults(config *ResultsConfig) error {
 
 	switch config.Display {
 	case "markdown":
-		if err := dumpTimingsMarkdown(timings, baselineTimings, config.Output, config.Verbose); err != nil {
+		if err := dumpTimingsMarkdown(timings, baselineTimings, limiting, config.Output, config.Verbose); err != nil {
 			return errors.Wrap(err, "failed to dump timings")
 		}
 	case "text":
-		if len(allBaselineTimings) > 0 {
+		if len(allBaselineResults) > 0 {
 			return errors.New("cannot compare to baseline using text display")
 		}
 		fallthrough
 	default:
-		if err := dumpTimingsText(timings, config.Output, config.Verbose); err != nil {
+		if err := dumpTimingsText(timings, limiting, config.Output, config.Verbose); err != nil {
 			return errors.Wrap(err, "failed to dump timings")
 		}
 	}
@@ -292,6 +292,161 @@ Min Response Time: 1ms
 Inter Quartile Range: 45.5
 
 Score: 369.00
+`,
+		},
+		{
+			"route with rate limited requests",
+			encodeClientTimingStats(
+				&loadtest.ClientTimingStats{
+					Routes: map[string]*loadtest.RouteStats{
+						"/test/route/1": &loadtest.RouteStats{
+							Name:           "/test/route/1",
+							NumHits:        20,
+							NumErrors:      1,
+							NumRateLimited: 4,
+							Duration: []float64{
+								1, 2, 3, 4, 5,
+								6, 7, 8, 9, 10,
+								20, 40, 60, 80, 100,
+							},
+						},
+					},
+				},
+			),
+
+			false,
+			`--------- Timings Report ------------
+Route: /test/route/1
+Total Hits: 20
+Error Rate: 5.00%
+Rate Limited: 4 (20.00%)
+Mean Response Time: 23.67ms
+Median Response Time: 8.00ms
+95th Percentile: 90.00ms
+
+Score: 134.00
+`,
+			`--------- Timings Report ------------
+Route: /test/route/1
+Total Hits: 20
+Error Rate: 5.00%
+Rate Limited: 4 (20.00%)
+Mean Response Time: 23.67ms
+Median Response Time: 8.00ms
+95th Percentile: 90.00ms
+90th Percentile: 70.00ms
+Max Response Time: 100ms
+Min Response Time: 1ms
+Inter Quartile Range: 36
+
+Score: 134.00
+`,
+		},
+		{
+			"route with corrected data points",
+			encodeClientTimingStats(
+				&loadtest.ClientTimingStats{
+					Routes: map[string]*loadtest.RouteStats{
+						"/test/route/1": &loadtest.RouteStats{
+							Name:    "/test/route/1",
+							NumHits: 15,
+							Duration: []float64{
+								1, 2, 3, 4, 5,
+								6, 7, 8, 9, 10,
+								20, 40, 60, 80, 100,
+							},
+							CorrectedDuration: []float64{
+								1, 2, 3, 4, 5,
+								6, 7, 8, 9, 10,
+								200, 400, 600, 800, 1000,
+							},
+						},
+					},
+				},
+			),
+
+			false,
+			`--------- Timings Report ------------
+Route: /test/route/1
+Total Hits: 15
+Error Rate: 0.00%
+Mean Response Time: 23.67ms
+Median Response Time: 8.00ms
+95th Percentile: 90.00ms
+Corrected Mean Response Time: 203.67ms
+Corrected Median Response Time: 8.00ms
+Corrected 95th Percentile: 900.00ms
+
+Score: 134.00
+`,
+			`--------- Timings Report ------------
+Route: /test/route/1
+Total Hits: 15
+Error Rate: 0.00%
+Mean Response Time: 23.67ms
+Median Response Time: 8.00ms
+95th Percentile: 90.00ms
+Corrected Mean Response Time: 203.67ms
+Corrected Median Response Time: 8.00ms
+Corrected 95th Percentile: 900.00ms
+Corrected 90th Percentile: 700.00ms
+Corrected Max Response Time: 1000ms
+90th Percentile: 70.00ms
+Max Response Time: 100ms
+Min Response Time: 1ms
+Inter Quartile Range: 36
+
+Score: 134.00
+`,
+		},
+		{
+			"route with negotiated protocols",
+			encodeClientTimingStats(
+				&loadtest.ClientTimingStats{
+					Routes: map[string]*loadtest.RouteStats{
+						"/test/route/1": &loadtest.RouteStats{
+							Name:    "/test/route/1",
+							NumHits: 15,
+							Duration: []float64{
+								1, 2, 3, 4, 5,
+								6, 7, 8, 9, 10,
+								20, 40, 60, 80, 100,
+							},
+							Protocols: map[string]int64{
+								"HTTP/2.0": 12,
+								"HTTP/1.1": 3,
+							},
+						},
+					},
+				},
+			),
+
+			false,
+			`--------- Timings Report ------------
+Route: /test/route/1
+Total Hits: 15
+Error Rate: 0.00%
+Protocols: HTTP/1.1: 3, HTTP/2.0: 12
+Mean Response Time: 23.67ms
+Median Response Time: 8.00ms
+95th Percentile: 90.00ms
+
+Score: 134.00
+`,
+			`--------- Timings Report ------------
+Route: /test/route/1
+Total Hits: 15
+Error Rate: 0.00%
+Protocols: HTTP/1.1: 3, HTTP/2.0: 12
+Mean Response Time: 23.67ms
+Median Response Time: 8.00ms
+95th Percentile: 90.00ms
+90th Percentile: 70.00ms
+Max Response Time: 100ms
+Min Response Time: 1ms
+Inter Quartile Range: 36
+
+Score: 134.00
 `,
 		},
 	}
@@ -694,3 +849,96 @@ The score is the average of the 95th percentile, median and interquartile ranges
 		})
 	}
 }
+
+func TestParseResultsByPhase(t *testing.T) {
+	routeTimings := func(name string) string {
+		return encodeClientTimingStats(&loadtest.ClientTimingStats{
+			Routes: map[string]*loadtest.RouteStats{
+				name: &loadtest.RouteStats{
+					Name:     name,
+					NumHits:  1,
+					Duration: []float64{10},
+				},
+			},
+		})
+	}
+	input := strings.Join([]string{
+		routeTimings("/test/route/1"),
+		`{"tag":"config_change","phase":2,"changes":["LinkPreviewChance"]}`,
+		routeTimings("/test/route/2"),
+	}, "\n")
+
+	parse := func(phase int) (string, error) {
+		output := &strings.Builder{}
+		err := ltparse.ParseResults(&ltparse.ResultsConfig{
+			Input:     strings.NewReader(input),
+			Output:    output,
+			Display:   "text",
+			Aggregate: true,
+			Phase:     phase,
+		})
+
+		return output.String(), err
+	}
+
+	t.Run("all phases", func(t *testing.T) {
+		output, err := parse(0)
+		require.NoError(t, err)
+		assert.Contains(t, output, "/test/route/1")
+		assert.Contains(t, output, "/test/route/2")
+	})
+
+	t.Run("before the change", func(t *testing.T) {
+		output, err := parse(1)
+		require.NoError(t, err)
+		assert.Contains(t, output, "/test/route/1")
+		assert.NotContains(t, output, "/test/route/2")
+	})
+
+	t.Run("after the change", func(t *testing.T) {
+		output, err := parse(2)
+		require.NoError(t, err)
+		assert.NotContains(t, output, "/test/route/1")
+		assert.Contains(t, output, "/test/route/2")
+	})
+
+	t.Run("unknown phase", func(t *testing.T) {
+		_, err := parse(3)
+		assert.Error(t, err)
+	})
+}
+
+func TestParseResultsRateLimiting(t *testing.T) {
+	timings := encodeClientTimingStats(&loadtest.ClientTimingStats{
+		Routes: map[string]*loadtest.RouteStats{
+			"/test/route": &loadtest.RouteStats{
+				Name:     "/test/route",
+				NumHits:  1,
+				Duration: []float64{10},
+			},
+		},
+	})
+	input := strings.Join([]string{
+		strings.Replace(timings, `{"tag":"timings"`, `{"tag":"timings","instance_id":"instance1"`, 1),
+		strings.Replace(timings, `{"tag":"timings"`, `{"tag":"timings","instance_id":"instance2"`, 1),
+		`{"tag":"ratelimits","mean_throttled_fraction":0.1,"max_throttled_fraction":0.4,"num_entities_throttled":2,"num_entities":10,"instance_id":"instance1"}`,
+		`{"tag":"ratelimits","mean_throttled_fraction":0.4,"max_throttled_fraction":0.5,"num_entities_throttled":5,"num_entities":10,"instance_id":"instance2"}`,
+	}, "\n")
+
+	parse := func(display string, phase int) string {
+		output := &strings.Builder{}
+		require.NoError(t, ltparse.ParseResults(&ltparse.ResultsConfig{
+			Input:     strings.NewReader(input),
+			Output:    output,
+			Display:   display,
+			Aggregate: true,
+			Phase:     phase,
+		}))
+
+		return output.String()
+	}
+
+	assert.Contains(t, parse("text", 0), "Throttled: 7 of 20 entities, 25.00% of the time on average, 50.00% at most\n")
+	assert.Contains(t, parse("markdown", 0), "### Rate Limiting\n7 of 20 entities were throttled, for 25.00% of the time on average and 50.00% at most.\n\n### Routes\n")
+	assert.NotContains(t, parse("text", 1), "Throttled", "the time spent throttled covers every phase")
+}
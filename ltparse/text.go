@@ -12,9 +12,24 @@ import (
 
 const text = `Total Hits: {{.Actual.NumHits}}
 Error Rate: {{percent .Actual.ErrorRate}}
+{{if .Actual.NumRateLimited -}}
+Rate Limited: {{.Actual.NumRateLimited}} ({{percent .Actual.RateLimitedRate}})
+{{end -}}
+{{if .Actual.Protocols -}}
+Protocols: {{protocols .Actual.Protocols}}
+{{end -}}
 Mean Response Time: {{printf "%.2f" .Actual.Mean}}ms
 Median Response Time: {{printf "%.2f" .Actual.Median}}ms
 95th Percentile: {{printf "%.2f" .Actual.Percentile95}}ms
+{{if .Actual.CorrectedDuration -}}
+Corrected Mean Response Time: {{printf "%.2f" .Actual.CorrectedMean}}ms
+Corrected Median Response Time: {{printf "%.2f" .Actual.CorrectedMedian}}ms
+Corrected 95th Percentile: {{printf "%.2f" .Actual.CorrectedPercentile95}}ms
+{{if .Verbose -}}
+Corrected 90th Percentile: {{printf "%.2f" .Actual.CorrectedPercentile90}}ms
+Corrected Max Response Time: {{.Actual.CorrectedMax}}ms
+{{end -}}
+{{end -}}
 {{if .Verbose -}}
 90th Percentile: {{printf "%.2f" .Actual.Percentile90}}ms
 Max Response Time: {{.Actual.Max}}ms
@@ -23,11 +38,12 @@ Inter Quartile Range: {{.Actual.InterQuartileRange}}
 {{end}}
 `
 
-func dumpTimingsText(timings *loadtest.ClientTimingStats, output io.Writer, verbose bool) error {
+func dumpTimingsText(timings *loadtest.ClientTimingStats, limiting *rateLimiting, output io.Writer, verbose bool) error {
 	funcMap := template.FuncMap{
 		"percent": func(x float64) string {
 			return fmt.Sprintf("%.2f%%", float64(x)*100.0)
 		},
+		"protocols": formatProtocols,
 	}
 	rateTemplate := template.Must(template.New("rates").Funcs(funcMap).Parse(text))
 
@@ -41,6 +57,10 @@ func dumpTimingsText(timings *loadtest.ClientTimingStats, output io.Writer, verb
 		}
 	}
 
+	if limiting != nil && limiting.NumEntitiesThrottled > 0 {
+		fmt.Fprintf(output, "Throttled: %d of %d entities, %.2f%% of the time on average, %.2f%% at most\n", limiting.NumEntitiesThrottled, limiting.NumEntities, limiting.MeanThrottledFraction*100.0, limiting.MaxThrottledFraction*100.0)
+	}
+
 	fmt.Fprintf(output, "Score: %.2f\n", timings.GetScore())
 
 	return nil
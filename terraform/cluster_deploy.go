@@ -235,6 +235,11 @@ func configureLoadtestInstance(instanceNum int, client *ssh.Client, cluster ltop
 		".ConnectionConfiguration.MattermostInstallDir": "/opt/mattermost",
 		".LoadtestEnviromentConfig.NumEmoji":            0,
 		".LoadtestEnviromentConfig.NumPlugins":          0,
+		// The loadtest instances do not accept connections from the app servers, so
+		// integrations calling back into the loadtest are not exercised, and the app servers
+		// cannot send email through the loadtest.
+		".ConnectionConfiguration.IntegrationURL":    "",
+		".ConnectionConfiguration.SMTPServerAddress": "",
 	} {
 		logger.Debugf("updating config %s=%v", k, v)
 		jsonValue, err := json.Marshal(v)